@@ -0,0 +1,45 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"hw6coursera/dto"
+	"net/http"
+)
+
+const apiKeyHeader = "X-API-Key"
+
+// APIKeys - статические ключи из настроек. Ключ передаётся в заголовке X-API-Key
+type APIKeys struct {
+	// храним хеши: сравнение через map не должно зависеть от длины совпавшего префикса ключа
+	principals map[[sha256.Size]byte]dto.Principal
+}
+
+func NewAPIKeys(keys map[string]dto.Principal) (*APIKeys, error) {
+	principals := make(map[[sha256.Size]byte]dto.Principal, len(keys))
+	for key, p := range keys {
+		if key == "" || p.ID == "" {
+			return nil, fmt.Errorf("api key and its id cannot be empty")
+		}
+		principals[sha256.Sum256([]byte(key))] = p
+	}
+	return &APIKeys{principals: principals}, nil
+}
+
+// Authenticate implements Authenticator
+func (a *APIKeys) Authenticate(r *http.Request) (dto.Principal, error) {
+	key := r.Header.Get(apiKeyHeader)
+	if key == "" {
+		return dto.Principal{}, ErrNoCredentials
+	}
+	p, ok := a.principals[sha256.Sum256([]byte(key))]
+	if !ok {
+		return dto.Principal{}, fmt.Errorf("%w: unknown api key", ErrInvalidCredentials)
+	}
+	return p, nil
+}
+
+// Challenge implements Authenticator
+func (a *APIKeys) Challenge() string {
+	return `ApiKey header="` + apiKeyHeader + `"`
+}
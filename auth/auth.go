@@ -0,0 +1,81 @@
+// Package auth проверяет, кто обращается к API, и передаёт клиента дальше через контекст запроса
+package auth
+
+import (
+	"errors"
+	"hw6coursera/dto"
+	"hw6coursera/logging"
+	"hw6coursera/service"
+	"net/http"
+	"strings"
+)
+
+var (
+	// ErrNoCredentials - в запросе нет данных для этого способа аутентификации, пробуем следующий
+	ErrNoCredentials = errors.New("no credentials")
+	// ErrInvalidCredentials - данные есть, но не подошли
+	ErrInvalidCredentials = errors.New("invalid credentials")
+)
+
+type Authenticator interface {
+	Authenticate(r *http.Request) (dto.Principal, error)
+	// Challenge - значение заголовка WWW-Authenticate для ответа 401
+	Challenge() string
+}
+
+// Middleware пропускает запрос дальше, только если его принял один из способов аутентификации
+type Middleware struct {
+	next           http.Handler
+	authenticators []Authenticator
+	allowAnonymous bool // запросы без данных для аутентификации проходят без клиента в контексте
+}
+
+func NewMiddleware(next http.Handler, allowAnonymous bool, authenticators ...Authenticator) *Middleware {
+	return &Middleware{
+		next:           next,
+		authenticators: authenticators,
+		allowAnonymous: allowAnonymous,
+	}
+}
+
+func (m *Middleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	for _, a := range m.authenticators {
+		p, err := a.Authenticate(r)
+		switch {
+		case err == nil:
+			m.next.ServeHTTP(w, r.WithContext(service.WithPrincipal(r.Context(), p)))
+			return
+		case errors.Is(err, ErrNoCredentials):
+			continue
+		default:
+			// данные были, но не подошли: другие способы не пробуем, анонимом тоже не пускаем
+			logging.FromContext(r.Context()).Warn("authentication failed", "err", err)
+			m.unauthorized(w)
+			return
+		}
+	}
+
+	if m.allowAnonymous {
+		m.next.ServeHTTP(w, r)
+		return
+	}
+	m.unauthorized(w)
+}
+
+func (m *Middleware) unauthorized(w http.ResponseWriter) {
+	for _, a := range m.authenticators {
+		w.Header().Add("WWW-Authenticate", a.Challenge())
+	}
+	w.WriteHeader(http.StatusUnauthorized)
+	w.Write([]byte("unauthorized"))
+}
+
+// authorizationValue - значение `Authorization: <scheme> <value>`, если схема совпадает
+func authorizationValue(r *http.Request, scheme string) (string, bool) {
+	header := r.Header.Get("Authorization")
+	prefix, value, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(prefix, scheme) {
+		return "", false
+	}
+	return strings.TrimSpace(value), true
+}
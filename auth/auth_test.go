@@ -0,0 +1,157 @@
+package auth
+
+import (
+	"hw6coursera/dto"
+	"hw6coursera/service"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// echoPrincipal отвечает id клиента из контекста
+var echoPrincipal = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	p, ok := service.PrincipalFromContext(r.Context())
+	if !ok {
+		w.Write([]byte("anonymous"))
+		return
+	}
+	w.Write([]byte(p.ID))
+})
+
+func newTestBasic(t *testing.T) *Basic {
+	hash, err := bcrypt.GenerateFromPassword([]byte("qwerty"), bcrypt.MinCost)
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "credentials")
+	content := "# login:hash:roles\n\nalice:" + string(hash) + ":admin,writer\nbob:" + string(hash) + "\n"
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+
+	basic, err := NewBasicFromFile(path)
+	require.NoError(t, err)
+	return basic
+}
+
+func TestMiddleware(t *testing.T) {
+	apiKeys, err := NewAPIKeys(map[string]dto.Principal{"key-1": {ID: "sync-bot", Roles: []string{"writer"}}})
+	require.NoError(t, err)
+	basic := newTestBasic(t)
+
+	testCases := []struct {
+		name              string
+		allowAnonymous    bool
+		prepare           func(r *http.Request)
+		expectedSatusCode int
+		expectedBody      string
+	}{
+		{
+			name:              "api key",
+			prepare:           func(r *http.Request) { r.Header.Set("X-API-Key", "key-1") },
+			expectedSatusCode: 200,
+			expectedBody:      "sync-bot",
+		},
+		{
+			name:              "basic",
+			prepare:           func(r *http.Request) { r.SetBasicAuth("alice", "qwerty") },
+			expectedSatusCode: 200,
+			expectedBody:      "alice",
+		},
+		{
+			name:              "wrong api key",
+			prepare:           func(r *http.Request) { r.Header.Set("X-API-Key", "key-2") },
+			expectedSatusCode: 401,
+			expectedBody:      "unauthorized",
+		},
+		{
+			name:              "wrong password",
+			prepare:           func(r *http.Request) { r.SetBasicAuth("alice", "123456") },
+			expectedSatusCode: 401,
+			expectedBody:      "unauthorized",
+		},
+		{
+			name:              "unknown user",
+			prepare:           func(r *http.Request) { r.SetBasicAuth("mallory", "qwerty") },
+			expectedSatusCode: 401,
+			expectedBody:      "unauthorized",
+		},
+		{
+			name:              "no credentials",
+			prepare:           func(r *http.Request) {},
+			expectedSatusCode: 401,
+			expectedBody:      "unauthorized",
+		},
+		{
+			name:              "anonymous allowed",
+			allowAnonymous:    true,
+			prepare:           func(r *http.Request) {},
+			expectedSatusCode: 200,
+			expectedBody:      "anonymous",
+		},
+		{
+			name:              "invalid credentials with anonymous allowed",
+			allowAnonymous:    true,
+			prepare:           func(r *http.Request) { r.Header.Set("X-API-Key", "key-2") },
+			expectedSatusCode: 401,
+			expectedBody:      "unauthorized",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			m := NewMiddleware(echoPrincipal, tc.allowAnonymous, apiKeys, basic)
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest("GET", "/items", nil)
+			tc.prepare(r)
+
+			m.ServeHTTP(w, r)
+
+			assert.Equal(t, tc.expectedSatusCode, w.Result().StatusCode)
+			assert.Equal(t, tc.expectedBody, w.Body.String())
+			if tc.expectedSatusCode == http.StatusUnauthorized {
+				assert.Equal(t, []string{`ApiKey header="X-API-Key"`, `Basic realm="hw6coursera"`}, w.Result().Header.Values("WWW-Authenticate"))
+			}
+		})
+	}
+}
+
+func TestBasic_roles(t *testing.T) {
+	basic := newTestBasic(t)
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.SetBasicAuth("alice", "qwerty")
+	p, err := basic.Authenticate(r)
+	require.NoError(t, err)
+	assert.Equal(t, dto.Principal{ID: "alice", Roles: []string{"admin", "writer"}}, p)
+
+	r.SetBasicAuth("bob", "qwerty")
+	p, err = basic.Authenticate(r)
+	require.NoError(t, err)
+	assert.Equal(t, dto.Principal{ID: "bob"}, p)
+}
+
+func TestNewBasicFromFile_errors(t *testing.T) {
+	testCases := map[string]string{
+		"plain password": "alice:qwerty\n",
+		"no password":    "alice\n",
+		"empty login":    ":$2a$04$abc\n",
+	}
+	for name, content := range testCases {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "credentials")
+			require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+			_, err := NewBasicFromFile(path)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestNewAPIKeys_errors(t *testing.T) {
+	_, err := NewAPIKeys(map[string]dto.Principal{"": {ID: "bot"}})
+	assert.Error(t, err)
+	_, err = NewAPIKeys(map[string]dto.Principal{"key": {}})
+	assert.Error(t, err)
+}
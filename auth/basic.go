@@ -0,0 +1,77 @@
+package auth
+
+import (
+	"bufio"
+	"fmt"
+	"hw6coursera/dto"
+	"net/http"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Basic - HTTP Basic по файлу с учётными данными. Строка файла: `login:bcrypt-хеш[:роль1,роль2]`,
+// пустые строки и строки с # пропускаются
+type Basic struct {
+	users map[string]basicUser
+}
+
+type basicUser struct {
+	hash  []byte
+	roles []string
+}
+
+func NewBasicFromFile(path string) (*Basic, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open credentials file: %v", err)
+	}
+	defer f.Close()
+
+	users := make(map[string]basicUser)
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.Split(line, ":")
+		if len(parts) < 2 || len(parts) > 3 || parts[0] == "" {
+			return nil, fmt.Errorf("%s:%d: expected login:hash[:roles]", path, n)
+		}
+		if _, err := bcrypt.Cost([]byte(parts[1])); err != nil {
+			return nil, fmt.Errorf("%s:%d: password must be a bcrypt hash: %v", path, n, err)
+		}
+		user := basicUser{hash: []byte(parts[1])}
+		if len(parts) == 3 && parts[2] != "" {
+			user.roles = strings.Split(parts[2], ",")
+		}
+		users[parts[0]] = user
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("unable to read credentials file: %v", err)
+	}
+	return &Basic{users: users}, nil
+}
+
+// Authenticate implements Authenticator
+func (b *Basic) Authenticate(r *http.Request) (dto.Principal, error) {
+	login, password, ok := r.BasicAuth()
+	if !ok {
+		return dto.Principal{}, ErrNoCredentials
+	}
+	user, ok := b.users[login]
+	if !ok {
+		return dto.Principal{}, fmt.Errorf("%w: unknown user %s", ErrInvalidCredentials, login)
+	}
+	if err := bcrypt.CompareHashAndPassword(user.hash, []byte(password)); err != nil {
+		return dto.Principal{}, fmt.Errorf("%w: wrong password for %s", ErrInvalidCredentials, login)
+	}
+	return dto.Principal{ID: login, Roles: user.roles}, nil
+}
+
+// Challenge implements Authenticator
+func (b *Basic) Challenge() string {
+	return `Basic realm="hw6coursera"`
+}
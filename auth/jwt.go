@@ -0,0 +1,279 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"hw6coursera/dto"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Поддерживаемые алгоритмы подписи
+const (
+	HS256 = "HS256"
+	RS256 = "RS256"
+)
+
+// JWTOptions - что проверять в токене помимо подписи
+type JWTOptions struct {
+	Issuer     string        // пустой - не проверяется
+	Audience   string        // пустой - не проверяется
+	RolesClaim string        // claim со списком ролей, по умолчанию roles
+	Leeway     time.Duration // допустимое расхождение часов для exp и nbf
+}
+
+// JWT - проверка `Authorization: Bearer <token>`, подписанных HS256 или RS256 локально настроенными ключами
+type JWT struct {
+	keys []jwtKey
+	opts JWTOptions
+	now  func() time.Time
+}
+
+// jwtKey - ключ подходит только для своего алгоритма: HS256-токен нельзя проверить публичным RSA-ключом
+type jwtKey struct {
+	kid    string // пустой - ключ подходит к токену с любым kid
+	alg    string
+	secret []byte
+	public *rsa.PublicKey
+}
+
+func NewJWT(opts JWTOptions) *JWT {
+	if opts.RolesClaim == "" {
+		opts.RolesClaim = "roles"
+	}
+	return &JWT{opts: opts, now: time.Now}
+}
+
+// AddSecret добавляет общий секрет для HS256
+func (j *JWT) AddSecret(kid string, secret []byte) error {
+	if len(secret) < 32 {
+		return fmt.Errorf("HS256 secret must be at least 32 bytes")
+	}
+	j.keys = append(j.keys, jwtKey{kid: kid, alg: HS256, secret: secret})
+	return nil
+}
+
+// AddPublicKeyFile добавляет публичный ключ RS256 из PEM-файла (PUBLIC KEY, RSA PUBLIC KEY или CERTIFICATE)
+func (j *JWT) AddPublicKeyFile(kid string, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("unable to read public key: %v", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return fmt.Errorf("%s: no PEM data", path)
+	}
+
+	var key interface{}
+	switch block.Type {
+	case "PUBLIC KEY":
+		key, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		key, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	case "CERTIFICATE":
+		var cert *x509.Certificate
+		if cert, err = x509.ParseCertificate(block.Bytes); err == nil {
+			key = cert.PublicKey
+		}
+	default:
+		return fmt.Errorf("%s: unsupported PEM block %s", path, block.Type)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	public, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return fmt.Errorf("%s: not an RSA public key", path)
+	}
+	j.keys = append(j.keys, jwtKey{kid: kid, alg: RS256, public: public})
+	return nil
+}
+
+// AddJWKSFile добавляет ключи из JWKS-файла: RSA-ключи для RS256 и oct-ключи для HS256
+func (j *JWT) AddJWKSFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("unable to read jwks: %v", err)
+	}
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Alg string `json:"alg"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			K   string `json:"k"`
+		} `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+
+	for i, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		switch {
+		case k.Kty == "RSA" && (k.Alg == "" || k.Alg == RS256):
+			n, errN := base64.RawURLEncoding.DecodeString(k.N)
+			e, errE := base64.RawURLEncoding.DecodeString(k.E)
+			if errN != nil || errE != nil || len(n) == 0 || len(e) == 0 || len(e) > 4 {
+				return fmt.Errorf("%s: invalid RSA key %d", path, i)
+			}
+			public := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+			j.keys = append(j.keys, jwtKey{kid: k.Kid, alg: RS256, public: public})
+		case k.Kty == "oct" && (k.Alg == "" || k.Alg == HS256):
+			secret, err := base64.RawURLEncoding.DecodeString(k.K)
+			if err != nil {
+				return fmt.Errorf("%s: invalid oct key %d", path, i)
+			}
+			if err := j.AddSecret(k.Kid, secret); err != nil {
+				return fmt.Errorf("%s: key %d: %v", path, i, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Authenticate implements Authenticator
+func (j *JWT) Authenticate(r *http.Request) (dto.Principal, error) {
+	token, ok := authorizationValue(r, "Bearer")
+	if !ok {
+		return dto.Principal{}, ErrNoCredentials
+	}
+	claims, err := j.verify(token)
+	if err != nil {
+		return dto.Principal{}, fmt.Errorf("%w: %v", ErrInvalidCredentials, err)
+	}
+	return j.principal(claims)
+}
+
+// Challenge implements Authenticator
+func (j *JWT) Challenge() string {
+	return "Bearer"
+}
+
+func (j *JWT) verify(token string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed token")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("malformed header: %v", err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("malformed signature: %v", err)
+	}
+
+	signed := []byte(parts[0] + "." + parts[1])
+	if !j.checkSignature(header.Alg, header.Kid, signed, signature) {
+		return nil, fmt.Errorf("invalid signature")
+	}
+
+	var claims map[string]interface{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("malformed claims: %v", err)
+	}
+	if err := j.checkClaims(claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func (j *JWT) checkSignature(alg, kid string, signed, signature []byte) bool {
+	digest := sha256.Sum256(signed)
+	for _, k := range j.keys {
+		if k.alg != alg || (kid != "" && k.kid != "" && k.kid != kid) {
+			continue
+		}
+		switch alg {
+		case HS256:
+			mac := hmac.New(sha256.New, k.secret)
+			mac.Write(signed)
+			if hmac.Equal(mac.Sum(nil), signature) {
+				return true
+			}
+		case RS256:
+			if rsa.VerifyPKCS1v15(k.public, crypto.SHA256, digest[:], signature) == nil {
+				return true
+			}
+		}
+	}
+	return false // в том числе alg=none и любые неизвестные алгоритмы
+}
+
+func (j *JWT) checkClaims(claims map[string]interface{}) error {
+	now := j.now()
+	if exp, ok := claims["exp"].(float64); ok && now.After(time.Unix(int64(exp), 0).Add(j.opts.Leeway)) {
+		return fmt.Errorf("token expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(j.opts.Leeway).Before(time.Unix(int64(nbf), 0)) {
+		return fmt.Errorf("token not valid yet")
+	}
+	if j.opts.Issuer != "" && claims["iss"] != j.opts.Issuer {
+		return fmt.Errorf("unexpected issuer")
+	}
+	if j.opts.Audience != "" && !containsString(claims["aud"], j.opts.Audience) {
+		return fmt.Errorf("unexpected audience")
+	}
+	return nil
+}
+
+func (j *JWT) principal(claims map[string]interface{}) (dto.Principal, error) {
+	sub, _ := claims["sub"].(string)
+	if sub == "" {
+		return dto.Principal{}, fmt.Errorf("%w: token has no subject", ErrInvalidCredentials)
+	}
+	p := dto.Principal{ID: sub}
+	switch roles := claims[j.opts.RolesClaim].(type) {
+	case string: // как scope в OAuth: роли через пробел
+		p.Roles = strings.Fields(roles)
+	case []interface{}:
+		for _, role := range roles {
+			if s, ok := role.(string); ok {
+				p.Roles = append(p.Roles, s)
+			}
+		}
+	}
+	return p, nil
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// aud может быть строкой или списком строк
+func containsString(value interface{}, s string) bool {
+	switch v := value.(type) {
+	case string:
+		return v == s
+	case []interface{}:
+		for _, item := range v {
+			if item == s {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,173 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"hw6coursera/dto"
+	"math/big"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+var testNow = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+func segment(t *testing.T, v interface{}) string {
+	data, err := json.Marshal(v)
+	require.NoError(t, err)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func signHS256(t *testing.T, header, claims map[string]interface{}, secret string) string {
+	signed := segment(t, header) + "." + segment(t, claims)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(signed))
+	return signed + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func signRS256(t *testing.T, header, claims map[string]interface{}, key *rsa.PrivateKey) string {
+	signed := segment(t, header) + "." + segment(t, claims)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	require.NoError(t, err)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func authenticateToken(j *JWT, token string) (dto.Principal, error) {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	return j.Authenticate(r)
+}
+
+func validClaims() map[string]interface{} {
+	return map[string]interface{}{
+		"sub":   "alice",
+		"iss":   "https://issuer.example",
+		"aud":   []string{"other", "dbexplorer"},
+		"exp":   testNow.Add(time.Hour).Unix(),
+		"nbf":   testNow.Add(-time.Minute).Unix(),
+		"roles": []string{"admin"},
+	}
+}
+
+func TestJWT_HS256(t *testing.T) {
+	j := NewJWT(JWTOptions{Issuer: "https://issuer.example", Audience: "dbexplorer", Leeway: 30 * time.Second})
+	j.now = func() time.Time { return testNow }
+	require.NoError(t, j.AddSecret("", []byte(testSecret)))
+
+	hs := map[string]interface{}{"alg": "HS256", "typ": "JWT"}
+	with := func(key string, value interface{}) map[string]interface{} {
+		claims := validClaims()
+		if value == nil {
+			delete(claims, key)
+		} else {
+			claims[key] = value
+		}
+		return claims
+	}
+
+	testCases := []struct {
+		name     string
+		token    string
+		expected dto.Principal
+		wantErr  bool
+	}{
+		{name: "OK", token: signHS256(t, hs, validClaims(), testSecret), expected: dto.Principal{ID: "alice", Roles: []string{"admin"}}},
+		{name: "roles as string", token: signHS256(t, hs, with("roles", "reader writer"), testSecret), expected: dto.Principal{ID: "alice", Roles: []string{"reader", "writer"}}},
+		{name: "expired within leeway", token: signHS256(t, hs, with("exp", testNow.Add(-10*time.Second).Unix()), testSecret), expected: dto.Principal{ID: "alice", Roles: []string{"admin"}}},
+		{name: "expired", token: signHS256(t, hs, with("exp", testNow.Add(-time.Minute).Unix()), testSecret), wantErr: true},
+		{name: "not valid yet", token: signHS256(t, hs, with("nbf", testNow.Add(time.Minute).Unix()), testSecret), wantErr: true},
+		{name: "wrong issuer", token: signHS256(t, hs, with("iss", "https://evil.example"), testSecret), wantErr: true},
+		{name: "wrong audience", token: signHS256(t, hs, with("aud", "other"), testSecret), wantErr: true},
+		{name: "no subject", token: signHS256(t, hs, with("sub", nil), testSecret), wantErr: true},
+		{name: "wrong secret", token: signHS256(t, hs, validClaims(), testSecret+"!"), wantErr: true},
+		{name: "alg none", token: segment(t, map[string]interface{}{"alg": "none"}) + "." + segment(t, validClaims()) + ".", wantErr: true},
+		{name: "RS256 header with HS256 key", token: signHS256(t, map[string]interface{}{"alg": "RS256"}, validClaims(), testSecret), wantErr: true},
+		{name: "malformed", token: "not.a-token", wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			p, err := authenticateToken(j, tc.token)
+			if tc.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidCredentials)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, p)
+		})
+	}
+}
+
+func TestJWT_RS256(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	pemPath := filepath.Join(dir, "public.pem")
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(pemPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0o600))
+
+	jwksPath := filepath.Join(dir, "jwks.json")
+	jwks := map[string]interface{}{"keys": []map[string]string{
+		{
+			"kty": "RSA", "kid": "other", "use": "sig",
+			"n": base64.RawURLEncoding.EncodeToString(otherKey.N.Bytes()),
+			"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(otherKey.E)).Bytes()),
+		},
+		{"kty": "RSA", "kid": "enc", "use": "enc", "n": "AQAB", "e": "AQAB"},
+	}}
+	data, err := json.Marshal(jwks)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(jwksPath, data, 0o600))
+
+	j := NewJWT(JWTOptions{})
+	j.now = func() time.Time { return testNow }
+	require.NoError(t, j.AddPublicKeyFile("", pemPath))
+	require.NoError(t, j.AddJWKSFile(jwksPath))
+
+	p, err := authenticateToken(j, signRS256(t, map[string]interface{}{"alg": "RS256"}, validClaims(), key))
+	require.NoError(t, err)
+	assert.Equal(t, "alice", p.ID)
+
+	p, err = authenticateToken(j, signRS256(t, map[string]interface{}{"alg": "RS256", "kid": "other"}, validClaims(), otherKey))
+	require.NoError(t, err)
+	assert.Equal(t, "alice", p.ID)
+
+	// ключ из JWKS с другим kid не подходит
+	_, err = authenticateToken(j, signRS256(t, map[string]interface{}{"alg": "RS256", "kid": "missing"}, validClaims(), otherKey))
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+
+	// без HS256-ключей подпись секретом не проверяется
+	_, err = authenticateToken(j, signHS256(t, map[string]interface{}{"alg": "HS256"}, validClaims(), testSecret))
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+}
+
+func TestJWT_noCredentials(t *testing.T) {
+	j := NewJWT(JWTOptions{})
+	r := httptest.NewRequest("GET", "/", nil)
+	r.SetBasicAuth("alice", "qwerty")
+	_, err := j.Authenticate(r)
+	assert.ErrorIs(t, err, ErrNoCredentials)
+}
+
+func TestJWT_shortSecret(t *testing.T) {
+	assert.Error(t, NewJWT(JWTOptions{}).AddSecret("", []byte("short")))
+}
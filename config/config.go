@@ -0,0 +1,446 @@
+// Package config собирает настройки приложения из значений по умолчанию, yaml-файла,
+// переменных окружения и флагов командной строки (в порядке возрастания приоритета)
+package config
+
+import (
+	"flag"
+	"fmt"
+	"hw6coursera/logging"
+	"hw6coursera/repository"
+	"io"
+	"os"
+	"regexp"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const redacted = "***"
+
+// EnvPrefix - префикс переменных окружения: флаг -db-max-open-conns читается из DBEXPLORER_DB_MAX_OPEN_CONNS
+const EnvPrefix = "DBEXPLORER_"
+
+var (
+	tableNamePattern = regexp.MustCompile(`\A\w+\z`)
+	columnAccesses   = map[string]bool{"hidden": true, "read_only": true, "write_only": true}
+	actions          = map[string]bool{"list": true, "get": true, "create": true, "update": true, "delete": true, "*": true}
+	transforms       = map[string]bool{"trim": true, "normalize": true, "lowercase": true, "bcrypt": true, "argon2": true, "created_at": true, "updated_at": true}
+	rowRulePattern   = regexp.MustCompile(`\A\s*(\w+)\s*=\s*principal\.id\s*\z`)
+	dsnPasswordRegex = regexp.MustCompile(`\A(\w+://[^:/@]*:)[^@]*@`)
+)
+
+type Config struct {
+	DSN        string     `yaml:"dsn"`    // со схемой, см. repository.ParseDSN
+	Listen     string     `yaml:"listen"` // адрес http-сервера
+	DB         DB         `yaml:"db"`
+	Server     Server     `yaml:"server"`
+	Pagination Pagination `yaml:"pagination"`
+	Output     Output     `yaml:"output"`
+	Tables     []string   `yaml:"tables,omitempty"` // какие таблицы отдавать через API, пусто - все
+	Policy     Policy     `yaml:"policy"`
+	Auth       Auth       `yaml:"auth"`
+	Access     Access     `yaml:"access"`
+	// таблица -> колонка -> преобразования перед записью: trim, normalize, lowercase, bcrypt, argon2,
+	// created_at или updated_at. Задаются только в файле настроек
+	Transforms map[string]map[string][]string `yaml:"transforms,omitempty"`
+	// таблица -> колонка версии записи, по которой считается ETag. База или сервер должны менять её
+	// при каждом изменении записи (счётчик, триггер, преобразование updated_at); у остальных таблиц
+	// ETag считается по всей записи
+	VersionColumns map[string]string `yaml:"version_columns,omitempty"`
+	SoftDelete     SoftDelete        `yaml:"soft_delete"`
+	Features       Features          `yaml:"features"`
+	Batch          Batch             `yaml:"batch"`
+	Audit          Audit             `yaml:"audit"`
+	Log            Log               `yaml:"log"`
+}
+
+// DB - пул соединений и подключение при старте
+type DB struct {
+	MaxOpenConns         int      `yaml:"max_open_conns"` // 0 - без ограничения
+	MaxIdleConns         int      `yaml:"max_idle_conns"`
+	ConnMaxLifetime      Duration `yaml:"conn_max_lifetime"` // 0 - соединения не пересоздаются
+	ConnectRetries       int      `yaml:"connect_retries"`
+	ConnectRetryInterval Duration `yaml:"connect_retry_interval"`
+}
+
+// Server - таймауты http-сервера, 0 - без таймаута
+type Server struct {
+	ReadHeaderTimeout Duration `yaml:"read_header_timeout"`
+	// ограничивает чтение всего запроса, в том числе загрузку таблицы, поэтому по умолчанию выключен
+	ReadTimeout Duration `yaml:"read_timeout"`
+	// ограничивает весь ответ, в том числе выгрузку таблицы, поэтому по умолчанию выключен
+	WriteTimeout Duration `yaml:"write_timeout"`
+	IdleTimeout  Duration `yaml:"idle_timeout"`
+}
+
+type Pagination struct {
+	DefaultLimit int `yaml:"default_limit"`
+	MaxLimit     int `yaml:"max_limit"` // 0 - без ограничения
+}
+
+// Output - вид отдаваемых записей
+type Output struct {
+	// отдавать поля с null явно, а не пропускать их; в запросе меняется параметром with_nulls
+	KeepNulls bool `yaml:"keep_nulls"`
+	// сжимать ответы gzip или deflate, если клиент их принимает (Accept-Encoding)
+	Compress bool `yaml:"compress"`
+}
+
+// SoftDelete - таблицы, в которых удаление только помечает запись
+type SoftDelete struct {
+	// искать колонку deleted_at или is_deleted у таблиц, которых нет в Columns
+	Detect bool `yaml:"detect"`
+	// таблица -> колонка-метка (время удаления или целочисленный флаг); пустая строка - удалять
+	// записи по-настоящему, даже если колонка нашлась
+	Columns map[string]string `yaml:"columns,omitempty"`
+}
+
+// Log - что и в каком виде писать в лог
+type Log struct {
+	Level  string `yaml:"level"`  // debug, info, warn или error
+	Format string `yaml:"format"` // text или json
+	// писать каждый запрос к базе; вместо значений аргументов в лог попадают их типы
+	SQL bool `yaml:"sql"`
+}
+
+// Policy - что из доступных таблиц скрыть или закрыть на запись
+type Policy struct {
+	HiddenTables   []string                     `yaml:"hidden_tables,omitempty"`
+	ReadOnlyTables []string                     `yaml:"read_only_tables,omitempty"`
+	Columns        map[string]map[string]string `yaml:"columns,omitempty"` // таблица -> колонка -> hidden, read_only или write_only
+}
+
+// Auth - способы аутентификации. Если ни один не настроен, API открыт для всех
+type Auth struct {
+	AllowAnonymous       bool     `yaml:"allow_anonymous"` // пускать запросы без учётных данных
+	APIKeys              []APIKey `yaml:"api_keys,omitempty"`
+	JWT                  JWT      `yaml:"jwt"`
+	BasicCredentialsFile string   `yaml:"basic_credentials_file"` // строки login:bcrypt-хеш[:роли]
+}
+
+type APIKey struct {
+	Key   string   `yaml:"key"`
+	ID    string   `yaml:"id"`
+	Roles []string `yaml:"roles,omitempty"`
+}
+
+type JWT struct {
+	Secret         string   `yaml:"secret"`                     // HS256, не короче 32 байт
+	PublicKeyFiles []string `yaml:"public_key_files,omitempty"` // RS256, PEM
+	JWKSFile       string   `yaml:"jwks_file"`
+	Issuer         string   `yaml:"issuer"`
+	Audience       string   `yaml:"audience"`
+	RolesClaim     string   `yaml:"roles_claim"`
+	Leeway         Duration `yaml:"leeway"`
+}
+
+func (a Auth) Enabled() bool {
+	return len(a.APIKeys) > 0 || a.JWT.Enabled() || a.BasicCredentialsFile != ""
+}
+
+func (j JWT) Enabled() bool {
+	return j.Secret != "" || len(j.PublicKeyFiles) > 0 || j.JWKSFile != ""
+}
+
+// Access - права ролей на таблицы. Задаётся только в файле настроек
+type Access struct {
+	Roles map[string]map[string][]string `yaml:"roles,omitempty"` // роль -> таблица или * -> list, get, create, update, delete или *
+	Rows  map[string]RowRule             `yaml:"rows,omitempty"`  // таблица -> правило для строк
+}
+
+type RowRule struct {
+	Rule        string   `yaml:"rule"` // `owner_id = principal.id`
+	ExemptRoles []string `yaml:"exempt_roles,omitempty"`
+}
+
+// Column - колонка, которая должна совпадать с id клиента
+func (r RowRule) Column() (string, error) {
+	m := rowRulePattern.FindStringSubmatch(r.Rule)
+	if m == nil {
+		return "", fmt.Errorf("invalid row rule %q, expected `column = principal.id`", r.Rule)
+	}
+	return m[1], nil
+}
+
+// Features - отключаемые части API
+type Features struct {
+	Batch   bool `yaml:"batch"`   // POST /_batch
+	Bulk    bool `yaml:"bulk"`    // PATCH и DELETE по фильтру
+	Upsert  bool `yaml:"upsert"`  // PUT /table/_upsert
+	History bool `yaml:"history"` // GET /table/id/_history
+	Export  bool `yaml:"export"`  // GET /table/_export
+	Import  bool `yaml:"import"`  // POST /table/_import
+	Metrics bool `yaml:"metrics"` // GET /_metrics
+}
+
+// Batch - ограничения POST /_batch
+type Batch struct {
+	// больше операций в одном пакете не принимается: весь пакет идёт одной транзакцией
+	MaxOperations int `yaml:"max_operations"`
+}
+
+// Audit - журнал изменений, не больше одного из вариантов
+type Audit struct {
+	Table string `yaml:"table"`
+	File  string `yaml:"file"`
+	// больше записей изменение или удаление по фильтру не затронет: старые значения для журнала держатся в памяти
+	MaxBulkRows int `yaml:"max_bulk_rows"`
+}
+
+func Default() Config {
+	return Config{
+		Listen: ":8082",
+		DB: DB{
+			MaxOpenConns:         10,
+			MaxIdleConns:         2,
+			ConnMaxLifetime:      Duration(time.Hour),
+			ConnectRetries:       10,
+			ConnectRetryInterval: Duration(5 * time.Second),
+		},
+		Server: Server{
+			ReadHeaderTimeout: Duration(10 * time.Second),
+			ReadTimeout:       0,
+			WriteTimeout:      0,
+			IdleTimeout:       Duration(time.Minute),
+		},
+		Pagination: Pagination{
+			DefaultLimit: 5,
+			MaxLimit:     1000,
+		},
+		Output: Output{
+			Compress: true,
+		},
+		Auth: Auth{
+			JWT: JWT{
+				RolesClaim: "roles",
+				Leeway:     Duration(30 * time.Second),
+			},
+		},
+		Features: Features{
+			Batch:   true,
+			Bulk:    true,
+			Upsert:  true,
+			History: true,
+			Export:  true,
+			Import:  true,
+			Metrics: true,
+		},
+		SoftDelete: SoftDelete{
+			Detect: true,
+		},
+		Batch: Batch{
+			MaxOperations: 100,
+		},
+		Audit: Audit{
+			MaxBulkRows: 10000,
+		},
+		Log: Log{
+			Level:  "info",
+			Format: logging.FormatText,
+		},
+	}
+}
+
+// Load собирает конфиг. printConfig - запрошен ли вывод итогового конфига (-print-config)
+func Load(args []string, getenv func(string) string) (cfg Config, printConfig bool, err error) {
+	fs := flag.NewFlagSet("hw6coursera", flag.ContinueOnError)
+	configPath := fs.String("config", getenv(EnvPrefix+"CONFIG"), "yaml-файл с настройками")
+	fs.BoolVar(&printConfig, "print-config", false, "вывести итоговые настройки и выйти")
+
+	// флаги разбираем в отдельный конфиг: они применяются последними, но путь к файлу нужен сразу
+	var fromFlags Config
+	for _, s := range settings {
+		fs.Var(s.bind(&fromFlags), s.name, s.usage)
+	}
+	if err := fs.Parse(args); err != nil {
+		return Config{}, false, err
+	}
+	if fs.NArg() > 0 {
+		return Config{}, false, fmt.Errorf("unexpected arguments: %v", fs.Args())
+	}
+
+	cfg = Default()
+	if *configPath != "" {
+		if err := loadFile(*configPath, &cfg); err != nil {
+			return Config{}, false, err
+		}
+	}
+
+	for _, s := range settings {
+		if value := getenv(s.env()); value != "" {
+			if err := s.bind(&cfg).Set(value); err != nil {
+				return Config{}, false, fmt.Errorf("invalid %s: %v", s.env(), err)
+			}
+		}
+	}
+
+	var flagErr error
+	fs.Visit(func(f *flag.Flag) {
+		if s, ok := settingsByName[f.Name]; ok && flagErr == nil {
+			flagErr = s.bind(&cfg).Set(f.Value.String())
+		}
+	})
+	if flagErr != nil {
+		return Config{}, false, flagErr
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return Config{}, false, err
+	}
+	return cfg, printConfig, nil
+}
+
+func loadFile(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("unable to read config file: %v", err)
+	}
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return fmt.Errorf("invalid config file %s: %v", path, err)
+	}
+	return nil
+}
+
+func (c Config) Validate() error {
+	if c.DSN == "" {
+		return fmt.Errorf("dsn is required")
+	}
+	if _, _, err := repository.ParseDSN(c.DSN); err != nil {
+		return fmt.Errorf("invalid dsn: %v", err)
+	}
+	if c.Listen == "" {
+		return fmt.Errorf("listen address is required")
+	}
+	if c.DB.MaxOpenConns < 0 || c.DB.MaxIdleConns < 0 {
+		return fmt.Errorf("db pool sizes cannot be negative")
+	}
+	if c.DB.ConnectRetries < 1 {
+		return fmt.Errorf("db connect retries must be positive")
+	}
+	if c.DB.ConnMaxLifetime < 0 || c.DB.ConnectRetryInterval < 0 ||
+		c.Server.ReadHeaderTimeout < 0 || c.Server.ReadTimeout < 0 || c.Server.WriteTimeout < 0 || c.Server.IdleTimeout < 0 {
+		return fmt.Errorf("durations cannot be negative")
+	}
+	if c.Pagination.DefaultLimit <= 0 {
+		return fmt.Errorf("default limit must be positive")
+	}
+	if c.Pagination.MaxLimit < 0 || (c.Pagination.MaxLimit > 0 && c.Pagination.MaxLimit < c.Pagination.DefaultLimit) {
+		return fmt.Errorf("max limit must be 0 (unlimited) or not less than default limit")
+	}
+	for _, list := range [][]string{c.Tables, c.Policy.HiddenTables, c.Policy.ReadOnlyTables} {
+		for _, t := range list {
+			if !tableNamePattern.MatchString(t) {
+				return fmt.Errorf("invalid table name %q", t)
+			}
+		}
+	}
+	for t, columns := range c.Policy.Columns {
+		for col, access := range columns {
+			if !tableNamePattern.MatchString(t) || !tableNamePattern.MatchString(col) {
+				return fmt.Errorf("invalid column name %q", t+"."+col)
+			}
+			if !columnAccesses[access] {
+				return fmt.Errorf("invalid access %q for column %s.%s", access, t, col)
+			}
+		}
+	}
+	keys := make(map[string]bool, len(c.Auth.APIKeys))
+	for _, k := range c.Auth.APIKeys {
+		if k.Key == "" || k.ID == "" {
+			return fmt.Errorf("api key and its id cannot be empty")
+		}
+		if keys[k.Key] {
+			return fmt.Errorf("duplicate api key for %s", k.ID)
+		}
+		keys[k.Key] = true
+	}
+	if c.Auth.JWT.Secret != "" && len(c.Auth.JWT.Secret) < 32 {
+		return fmt.Errorf("jwt secret must be at least 32 bytes")
+	}
+	if c.Auth.JWT.Leeway < 0 {
+		return fmt.Errorf("durations cannot be negative")
+	}
+	if _, err := logging.ParseLevel(c.Log.Level); err != nil {
+		return err
+	}
+	if c.Log.Format != logging.FormatText && c.Log.Format != logging.FormatJSON {
+		return fmt.Errorf("unknown log format %q, expected %s or %s", c.Log.Format, logging.FormatText, logging.FormatJSON)
+	}
+	if c.Auth.AllowAnonymous && !c.Auth.Enabled() {
+		return fmt.Errorf("allow anonymous requires at least one authentication method")
+	}
+	for role, tables := range c.Access.Roles {
+		for t, list := range tables {
+			if t != "*" && !tableNamePattern.MatchString(t) {
+				return fmt.Errorf("invalid table name %q in role %s", t, role)
+			}
+			for _, a := range list {
+				if !actions[a] {
+					return fmt.Errorf("invalid action %q in role %s", a, role)
+				}
+			}
+		}
+	}
+	for t, rule := range c.Access.Rows {
+		if !tableNamePattern.MatchString(t) {
+			return fmt.Errorf("invalid table name %q in row rules", t)
+		}
+		if _, err := rule.Column(); err != nil {
+			return err
+		}
+	}
+	for t, columns := range c.Transforms {
+		for col, list := range columns {
+			if !tableNamePattern.MatchString(t) || !tableNamePattern.MatchString(col) {
+				return fmt.Errorf("invalid column %s.%s in transforms", t, col)
+			}
+			for _, tr := range list {
+				if !transforms[tr] {
+					return fmt.Errorf("invalid transform %q for %s.%s", tr, t, col)
+				}
+			}
+		}
+	}
+	for t, col := range c.VersionColumns {
+		if !tableNamePattern.MatchString(t) || !tableNamePattern.MatchString(col) {
+			return fmt.Errorf("invalid version column %s.%s", t, col)
+		}
+	}
+	for t, col := range c.SoftDelete.Columns {
+		if !tableNamePattern.MatchString(t) || (col != "" && !tableNamePattern.MatchString(col)) {
+			return fmt.Errorf("invalid soft delete column %s.%s", t, col)
+		}
+	}
+	if c.Batch.MaxOperations <= 0 {
+		return fmt.Errorf("batch max operations must be positive")
+	}
+	if c.Audit.Table != "" && c.Audit.File != "" {
+		return fmt.Errorf("audit table and audit file cannot be used together")
+	}
+	if c.Audit.MaxBulkRows <= 0 {
+		return fmt.Errorf("audit max bulk rows must be positive")
+	}
+	return nil
+}
+
+// Print выводит конфиг в формате файла настроек, пароль из DSN, ключи и секреты скрыты
+func (c Config) Print(w io.Writer) error {
+	c.DSN = dsnPasswordRegex.ReplaceAllString(c.DSN, "${1}"+redacted+"@")
+	if len(c.Auth.APIKeys) > 0 {
+		apiKeys := make([]APIKey, len(c.Auth.APIKeys)) // не меняем исходный срез
+		for i, k := range c.Auth.APIKeys {
+			k.Key = redacted
+			apiKeys[i] = k
+		}
+		c.Auth.APIKeys = apiKeys
+	}
+	if c.Auth.JWT.Secret != "" {
+		c.Auth.JWT.Secret = redacted
+	}
+	data, err := yaml.Marshal(c)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
@@ -0,0 +1,255 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// setting - одна настройка, которую можно задать флагом или переменной окружения
+type setting struct {
+	name  string
+	usage string
+	bind  func(c *Config) flag.Value
+}
+
+func (s setting) env() string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(s.name, "-", "_"))
+}
+
+var settings = []setting{
+	{name: "dsn", usage: "строка подключения: mysql://..., postgres://... или sqlite://...", bind: func(c *Config) flag.Value { return (*stringValue)(&c.DSN) }},
+	{name: "listen", usage: "адрес http-сервера", bind: func(c *Config) flag.Value { return (*stringValue)(&c.Listen) }},
+
+	{name: "db-max-open-conns", usage: "максимум открытых соединений с базой", bind: func(c *Config) flag.Value { return (*intValue)(&c.DB.MaxOpenConns) }},
+	{name: "db-max-idle-conns", usage: "максимум простаивающих соединений", bind: func(c *Config) flag.Value { return (*intValue)(&c.DB.MaxIdleConns) }},
+	{name: "db-conn-max-lifetime", usage: "время жизни соединения", bind: func(c *Config) flag.Value { return &c.DB.ConnMaxLifetime }},
+	{name: "db-connect-retries", usage: "попыток подключиться к базе при старте", bind: func(c *Config) flag.Value { return (*intValue)(&c.DB.ConnectRetries) }},
+	{name: "db-connect-retry-interval", usage: "пауза между попытками подключения", bind: func(c *Config) flag.Value { return &c.DB.ConnectRetryInterval }},
+
+	{name: "read-header-timeout", usage: "таймаут чтения заголовков запроса", bind: func(c *Config) flag.Value { return &c.Server.ReadHeaderTimeout }},
+	{name: "read-timeout", usage: "таймаут чтения запроса, включая загрузку таблицы (0 - без таймаута)", bind: func(c *Config) flag.Value { return &c.Server.ReadTimeout }},
+	{name: "write-timeout", usage: "таймаут записи ответа, включая выгрузку таблицы (0 - без таймаута)", bind: func(c *Config) flag.Value { return &c.Server.WriteTimeout }},
+	{name: "idle-timeout", usage: "таймаут keep-alive соединения", bind: func(c *Config) flag.Value { return &c.Server.IdleTimeout }},
+
+	{name: "default-limit", usage: "размер страницы по умолчанию", bind: func(c *Config) flag.Value { return (*intValue)(&c.Pagination.DefaultLimit) }},
+	{name: "max-limit", usage: "максимальный размер страницы, 0 - без ограничения", bind: func(c *Config) flag.Value { return (*intValue)(&c.Pagination.MaxLimit) }},
+	{name: "keep-nulls", usage: "отдавать поля с null, а не пропускать их", bind: func(c *Config) flag.Value { return (*boolValue)(&c.Output.KeepNulls) }},
+	{name: "compress", usage: "сжимать ответы gzip или deflate по Accept-Encoding", bind: func(c *Config) flag.Value { return (*boolValue)(&c.Output.Compress) }},
+
+	{name: "tables", usage: "таблицы, доступные через API, через запятую", bind: func(c *Config) flag.Value { return (*listValue)(&c.Tables) }},
+
+	{name: "hidden-tables", usage: "таблицы, скрытые из API, через запятую", bind: func(c *Config) flag.Value { return (*listValue)(&c.Policy.HiddenTables) }},
+	{name: "read-only-tables", usage: "таблицы только для чтения, через запятую", bind: func(c *Config) flag.Value { return (*listValue)(&c.Policy.ReadOnlyTables) }},
+	{name: "columns", usage: "доступ к колонкам: users.password=write_only,users.note=hidden", bind: func(c *Config) flag.Value { return (*columnsValue)(&c.Policy.Columns) }},
+	{name: "soft-delete-detect", usage: "мягко удалять записи таблиц с колонкой deleted_at или is_deleted", bind: func(c *Config) flag.Value { return (*boolValue)(&c.SoftDelete.Detect) }},
+	{name: "soft-delete-columns", usage: "колонки мягкого удаления: items=deleted_at,logs= (пусто - удалять по-настоящему)", bind: func(c *Config) flag.Value { return (*tableColumnValue)(&c.SoftDelete.Columns) }},
+	{name: "version-columns", usage: "колонки версии для ETag: items=version,users=updated_at", bind: func(c *Config) flag.Value { return (*tableColumnValue)(&c.VersionColumns) }},
+
+	{name: "auth-anonymous", usage: "пускать запросы без учётных данных при включённой аутентификации", bind: func(c *Config) flag.Value { return (*boolValue)(&c.Auth.AllowAnonymous) }},
+	{name: "jwt-secret", usage: "секрет HS256 для проверки JWT", bind: func(c *Config) flag.Value { return (*stringValue)(&c.Auth.JWT.Secret) }},
+	{name: "jwt-public-keys", usage: "PEM-файлы публичных ключей RS256 через запятую", bind: func(c *Config) flag.Value { return (*listValue)(&c.Auth.JWT.PublicKeyFiles) }},
+	{name: "jwt-jwks-file", usage: "JWKS-файл с ключами для проверки JWT", bind: func(c *Config) flag.Value { return (*stringValue)(&c.Auth.JWT.JWKSFile) }},
+	{name: "jwt-issuer", usage: "ожидаемый iss в JWT", bind: func(c *Config) flag.Value { return (*stringValue)(&c.Auth.JWT.Issuer) }},
+	{name: "jwt-audience", usage: "ожидаемый aud в JWT", bind: func(c *Config) flag.Value { return (*stringValue)(&c.Auth.JWT.Audience) }},
+	{name: "jwt-roles-claim", usage: "claim JWT со списком ролей", bind: func(c *Config) flag.Value { return (*stringValue)(&c.Auth.JWT.RolesClaim) }},
+	{name: "jwt-leeway", usage: "допустимое расхождение часов при проверке exp и nbf", bind: func(c *Config) flag.Value { return &c.Auth.JWT.Leeway }},
+	{name: "basic-credentials-file", usage: "файл для HTTP Basic: строки login:bcrypt-хеш[:роли]", bind: func(c *Config) flag.Value { return (*stringValue)(&c.Auth.BasicCredentialsFile) }},
+
+	{name: "feature-batch", usage: "включить пакетные операции", bind: func(c *Config) flag.Value { return (*boolValue)(&c.Features.Batch) }},
+	{name: "feature-bulk", usage: "включить изменение и удаление по фильтру", bind: func(c *Config) flag.Value { return (*boolValue)(&c.Features.Bulk) }},
+	{name: "feature-upsert", usage: "включить upsert", bind: func(c *Config) flag.Value { return (*boolValue)(&c.Features.Upsert) }},
+	{name: "feature-history", usage: "включить историю изменений записи", bind: func(c *Config) flag.Value { return (*boolValue)(&c.Features.History) }},
+	{name: "feature-export", usage: "включить выгрузку таблиц целиком", bind: func(c *Config) flag.Value { return (*boolValue)(&c.Features.Export) }},
+	{name: "feature-import", usage: "включить загрузку записей из CSV и NDJSON", bind: func(c *Config) flag.Value { return (*boolValue)(&c.Features.Import) }},
+	{name: "feature-metrics", usage: "включить метрики Prometheus на /_metrics", bind: func(c *Config) flag.Value { return (*boolValue)(&c.Features.Metrics) }},
+
+	{name: "batch-max-operations", usage: "максимум операций в одном пакете", bind: func(c *Config) flag.Value { return (*intValue)(&c.Batch.MaxOperations) }},
+
+	{name: "audit-table", usage: "таблица журнала изменений (создаётся, если её нет)", bind: func(c *Config) flag.Value { return (*stringValue)(&c.Audit.Table) }},
+	{name: "audit-file", usage: "файл журнала изменений в формате JSONL", bind: func(c *Config) flag.Value { return (*stringValue)(&c.Audit.File) }},
+	{name: "audit-max-bulk-rows", usage: "максимум записей в изменении или удалении по фильтру при включённом журнале", bind: func(c *Config) flag.Value { return (*intValue)(&c.Audit.MaxBulkRows) }},
+
+	{name: "log-level", usage: "уровень лога: debug, info, warn или error", bind: func(c *Config) flag.Value { return (*stringValue)(&c.Log.Level) }},
+	{name: "log-format", usage: "формат лога: text или json", bind: func(c *Config) flag.Value { return (*stringValue)(&c.Log.Format) }},
+	{name: "log-sql", usage: "писать в лог запросы к базе (без значений аргументов)", bind: func(c *Config) flag.Value { return (*boolValue)(&c.Log.SQL) }},
+}
+
+var settingsByName = func() map[string]setting {
+	m := make(map[string]setting, len(settings))
+	for _, s := range settings {
+		m[s.name] = s
+	}
+	return m
+}()
+
+type stringValue string
+
+func (v *stringValue) Set(s string) error { *v = stringValue(s); return nil }
+func (v *stringValue) String() string {
+	if v == nil {
+		return ""
+	}
+	return string(*v)
+}
+
+type intValue int
+
+func (v *intValue) Set(s string) error {
+	i, err := strconv.Atoi(s)
+	if err != nil {
+		return err
+	}
+	*v = intValue(i)
+	return nil
+}
+func (v *intValue) String() string {
+	if v == nil {
+		return "0"
+	}
+	return strconv.Itoa(int(*v))
+}
+
+type boolValue bool
+
+func (v *boolValue) Set(s string) error {
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		return err
+	}
+	*v = boolValue(b)
+	return nil
+}
+func (v *boolValue) String() string {
+	if v == nil {
+		return "false"
+	}
+	return strconv.FormatBool(bool(*v))
+}
+
+// -feature-batch без значения означает true
+func (v *boolValue) IsBoolFlag() bool { return true }
+
+type listValue []string
+
+func (v *listValue) Set(s string) error {
+	*v = nil
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*v = append(*v, item)
+		}
+	}
+	return nil
+}
+func (v *listValue) String() string {
+	if v == nil {
+		return ""
+	}
+	return strings.Join(*v, ",")
+}
+
+// columnsValue - `table.column=access` через запятую
+type columnsValue map[string]map[string]string
+
+func (v *columnsValue) Set(s string) error {
+	*v = nil
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		name, access, ok := strings.Cut(item, "=")
+		table, column, ok2 := strings.Cut(name, ".")
+		if !ok || !ok2 {
+			return fmt.Errorf("expected table.column=access, got %q", item)
+		}
+		if *v == nil {
+			*v = make(map[string]map[string]string)
+		}
+		if (*v)[table] == nil {
+			(*v)[table] = make(map[string]string)
+		}
+		(*v)[table][column] = access
+	}
+	return nil
+}
+
+func (v *columnsValue) String() string {
+	if v == nil {
+		return ""
+	}
+	items := make([]string, 0)
+	for table, columns := range *v {
+		for column, access := range columns {
+			items = append(items, table+"."+column+"="+access)
+		}
+	}
+	sort.Strings(items)
+	return strings.Join(items, ",")
+}
+
+// tableColumnValue - таблица -> колонка: items=version,users=updated_at
+type tableColumnValue map[string]string
+
+func (v *tableColumnValue) Set(s string) error {
+	*v = nil
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		table, column, ok := strings.Cut(item, "=")
+		if !ok {
+			return fmt.Errorf("expected table=column, got %q", item)
+		}
+		if *v == nil {
+			*v = make(map[string]string)
+		}
+		(*v)[table] = column
+	}
+	return nil
+}
+
+func (v *tableColumnValue) String() string {
+	if v == nil {
+		return ""
+	}
+	items := make([]string, 0, len(*v))
+	for table, column := range *v {
+		items = append(items, table+"="+column)
+	}
+	sort.Strings(items)
+	return strings.Join(items, ",")
+}
+
+// Duration - time.Duration, который в yaml пишется как "5s"
+type Duration time.Duration
+
+func (d *Duration) Set(s string) error {
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+func (d *Duration) String() string {
+	if d == nil {
+		return "0s"
+	}
+	return time.Duration(*d).String()
+}
+
+func (d Duration) MarshalYAML() (interface{}, error) {
+	return time.Duration(d).String(), nil
+}
+
+func (d *Duration) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	return d.Set(s)
+}
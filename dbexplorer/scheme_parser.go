@@ -2,8 +2,8 @@ package dbexplorer
 
 import (
 	"hw6coursera/dto"
+	"hw6coursera/logging"
 	"hw6coursera/repository"
-	"log"
 )
 
 type SchemeParserExplorer struct {
@@ -12,7 +12,8 @@ type SchemeParserExplorer struct {
 
 // ParseSchema implements SchemeParser
 func (s *SchemeParserExplorer) ParseSchema() (dto.Schema, error) {
-	log.Println("getting tables")
+	logger := logging.Default()
+	logger.Debug("getting tables")
 	tableNames, err := s.repoExplorer.GetTableNames()
 	if err != nil {
 		return nil, err
@@ -22,13 +23,30 @@ func (s *SchemeParserExplorer) ParseSchema() (dto.Schema, error) {
 
 	for _, tableName := range tableNames {
 		t := dto.Table{}
-		log.Printf("parsing colunms in table: %s", tableName)
+		logger.Debug("parsing columns", "table", tableName)
 		cols, err := s.repoExplorer.GetColumns(tableName)
 		if err != nil {
 			return nil, err
 		}
+		logger.Debug("parsing indexes", "table", tableName)
+		indexes, err := s.repoExplorer.GetIndexes(tableName)
+		if err != nil {
+			return nil, err
+		}
+		logger.Debug("parsing foreign keys", "table", tableName)
+		foreignKeys, err := s.repoExplorer.GetForeignKeys(tableName)
+		if err != nil {
+			return nil, err
+		}
+		for i := range cols { // значение вычисляет база, записать его нельзя (первичный ключ и так не записывается)
+			if cols[i].Generated && !cols[i].IsPrimaryKey {
+				cols[i].ReadOnly = true
+			}
+		}
 		t.Name = tableName
 		t.Columns = cols
+		t.Indexes = indexes
+		t.ForeignKeys = foreignKeys
 		sch[tableName] = t
 	}
 	return sch, nil
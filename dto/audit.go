@@ -0,0 +1,26 @@
+package dto
+
+import "time"
+
+// Операции, которые попадают в журнал аудита
+const (
+	AuditCreate  = "create"
+	AuditUpdate  = "update"
+	AuditDelete  = "delete"
+	AuditRestore = "restore"
+)
+
+// AuditEntry - одно изменение одной записи
+type AuditEntry struct {
+	Table     string            `json:"table"`
+	RecordID  int               `json:"record_id"`
+	Operation string            `json:"operation"`
+	Actor     string            `json:"actor"`
+	Time      time.Time         `json:"time"`
+	Changes   map[string]Change `json:"changes"` // только изменившиеся поля
+}
+
+type Change struct {
+	Old interface{} `json:"old"`
+	New interface{} `json:"new"`
+}
@@ -0,0 +1,25 @@
+package dto
+
+// Операции, которые можно выполнять в одном пакете
+const (
+	BatchCreate = "create"
+	BatchUpdate = "update"
+	BatchDelete = "delete"
+)
+
+// BatchOperation - одна операция пакета. ID и значения Data могут ссылаться
+// на id записи, созданной раньше в том же пакете: `$0.id`
+type BatchOperation struct {
+	Op    string
+	Table string
+	ID    string
+	Data  map[string]string
+}
+
+type BatchResult struct {
+	Index int    `json:"index"`
+	Op    string `json:"op"`
+	Table string `json:"table"`
+	ID    int    `json:"id,omitempty"`
+	Error string `json:"error,omitempty"`
+}
@@ -0,0 +1,22 @@
+package dto
+
+// Операторы сравнения, которые можно использовать в фильтре: `?level[lt]=5`
+const (
+	OpEq   = "eq"
+	OpNe   = "ne"
+	OpLt   = "lt"
+	OpLte  = "lte"
+	OpGt   = "gt"
+	OpGte  = "gte"
+	OpLike = "like"
+)
+
+// Condition - одно условие фильтра. Value равное nil означает сравнение с null
+type Condition struct {
+	Column   string
+	Operator string
+	Value    interface{}
+}
+
+// Filter - набор условий, объединяемых через AND
+type Filter []Condition
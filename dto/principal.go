@@ -0,0 +1,7 @@
+package dto
+
+// Principal - аутентифицированный клиент API
+type Principal struct {
+	ID    string   `json:"id"`
+	Roles []string `json:"roles,omitempty"`
+}
@@ -0,0 +1,70 @@
+package dto
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// Records - страница записей таблицы. Columns - отдаваемые колонки в порядке схемы:
+// у записей нет ключей для null, а CSV нужен полный и одинаковый для всех строк список
+type Records struct {
+	Columns []string
+	Rows    []map[string]interface{}
+}
+
+// Ordered - записи страницы с ключами в порядке колонок
+func (r Records) Ordered() []OrderedRecord {
+	ordered := make([]OrderedRecord, len(r.Rows))
+	for i, row := range r.Rows {
+		ordered[i] = OrderedRecord{Columns: r.Columns, Values: row}
+	}
+	return ordered
+}
+
+// OrderedRecord - запись, которая в json отдаёт поля в порядке колонок таблицы, а не по алфавиту,
+// как map. Поля, которых нет в Values (например, null), и значения вне Columns не отдаются
+type OrderedRecord struct {
+	Columns []string
+	Values  map[string]interface{}
+}
+
+// MarshalJSON implements json.Marshaler
+func (r OrderedRecord) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for _, column := range r.Columns {
+		value, ok := r.Values[column]
+		if !ok {
+			continue
+		}
+		if buf.Len() > 1 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(column)
+		if err != nil {
+			return nil, err
+		}
+		data, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(data)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// ImportReport - итог загрузки файла. Errors - первые отклонённые строки с причинами,
+// Rejected - сколько строк отклонено всего
+type ImportReport struct {
+	Inserted int            `json:"inserted"`
+	Rejected int            `json:"rejected"`
+	Errors   []RejectedLine `json:"errors"`
+}
+
+type RejectedLine struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
@@ -4,19 +4,52 @@ const (
 	StringType  = "string"
 	IntType     = "int"
 	FloatType   = "float"
+	BoolType    = "bool"
 	UnknownType = "unknown"
+
+	PrimaryIndexName = "PRIMARY" // так MySQL называет индекс первичного ключа
 )
 
 type Schema map[string]Table
 
 type Table struct {
-	Name    string
-	Columns []Column
+	Name        string       `json:"name"`
+	Columns     []Column     `json:"columns"`
+	Indexes     []Index      `json:"indexes"`
+	ForeignKeys []ForeignKey `json:"foreign_keys"`
+
+	VersionColumn    string `json:"version_column,omitempty"`     // колонка версии из настроек, по ней считается ETag записи; пустая - ETag считается по всей записи
+	SoftDeleteColumn string `json:"soft_delete_column,omitempty"` // deleted_at или is_deleted; пустая - записи удаляются по-настоящему
+	ReadOnly         bool   `json:"read_only,omitempty"`          // записи можно только читать
+
+	// RowsEstimate - примерное число строк по статистике базы, -1 - статистики нет.
+	// Меняется со временем, поэтому заполняется только при запросе описания схемы
+	RowsEstimate int64 `json:"rows_estimate"`
 }
 
 type Column struct {
-	Name         string
-	ColumnType   string // одна из констант
-	Nullable     bool
-	IsPrimaryKey bool
+	Name         string `json:"name"`
+	ColumnType   string `json:"type"` // одна из констант
+	Nullable     bool   `json:"nullable"`
+	IsPrimaryKey bool   `json:"primary_key,omitempty"`
+	ReadOnly     bool   `json:"read_only,omitempty"`  // не принимается при создании и изменении
+	WriteOnly    bool   `json:"write_only,omitempty"` // принимается при записи, но не отдаётся и не участвует в фильтрах
+	Generated    bool   `json:"generated,omitempty"`  // значение вычисляет база: auto-increment, identity или GENERATED-колонка
+
+	MaxLength int      `json:"max_length,omitempty"` // для строк CHAR(n)/VARCHAR(n), 0 - длина не ограничена
+	Enum      []string `json:"enum,omitempty"`       // допустимые значения ENUM-колонки
+}
+
+type Index struct {
+	Name    string   `json:"name"`
+	Columns []string `json:"columns"` // в порядке следования в индексе
+	Unique  bool     `json:"unique"`
+}
+
+// ForeignKey - внешний ключ: Columns таблицы ссылаются на RefColumns таблицы RefTable, по порядку
+type ForeignKey struct {
+	Name       string   `json:"name"`
+	Columns    []string `json:"columns"`
+	RefTable   string   `json:"ref_table"`
+	RefColumns []string `json:"ref_columns"`
 }
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"hw6coursera/router"
+	"hw6coursera/service"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// importCommand - параметры команды import, остальные флаги - обычные настройки
+type importCommand struct {
+	table  string
+	file   string // "-" - stdin
+	format string // по умолчанию по расширению файла
+	opts   service.ImportOptions
+}
+
+// repeatedValue - флаг, который можно указать несколько раз
+type repeatedValue []string
+
+func (v *repeatedValue) Set(s string) error { *v = append(*v, s); return nil }
+func (v *repeatedValue) String() string     { return strings.Join(*v, ",") }
+
+// parseImportArgs отделяет флаги команды import от флагов настроек: те разбирает config.Load
+func parseImportArgs(args []string) (importCommand, []string, error) {
+	var cmd importCommand
+	var nulls, mapping repeatedValue
+	nullsSet := false
+
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	fs.StringVar(&cmd.table, "table", "", "таблица, в которую загружаются записи")
+	fs.StringVar(&cmd.file, "file", "", "файл CSV или NDJSON, - для stdin")
+	fs.StringVar(&cmd.format, "format", "", "csv или ndjson, по умолчанию по расширению файла")
+	fs.Var(&nulls, "null", "значение, которое читается как null, можно повторять")
+	fs.Var(&mapping, "map", "заголовок=колонка, пустая колонка - пропустить заголовок, можно повторять")
+	fs.IntVar(&cmd.opts.ChunkSize, "chunk-size", service.DefaultImportChunk, "записей в одной транзакции")
+
+	var own, rest []string
+	for i := 0; i < len(args); i++ {
+		name := strings.TrimLeft(args[i], "-")
+		name, _, hasValue := strings.Cut(name, "=")
+		if !strings.HasPrefix(args[i], "-") || fs.Lookup(name) == nil {
+			rest = append(rest, args[i])
+			continue
+		}
+		own = append(own, args[i])
+		if !hasValue && i+1 < len(args) {
+			i++
+			own = append(own, args[i])
+		}
+	}
+	if err := fs.Parse(own); err != nil {
+		return importCommand{}, nil, err
+	}
+	fs.Visit(func(f *flag.Flag) { nullsSet = nullsSet || f.Name == "null" })
+
+	if cmd.table == "" || cmd.file == "" {
+		return importCommand{}, nil, errors.New("import requires -table and -file")
+	}
+	if cmd.format == "" {
+		cmd.format = strings.TrimPrefix(strings.ToLower(filepath.Ext(cmd.file)), ".")
+	}
+	if cmd.opts.ChunkSize <= 0 || cmd.opts.ChunkSize > service.MaxImportChunk {
+		return importCommand{}, nil, fmt.Errorf("chunk-size must be between 1 and %d", service.MaxImportChunk)
+	}
+
+	cmd.opts.NullTokens = router.DefaultNullTokens(cmd.format)
+	if nullsSet {
+		cmd.opts.NullTokens = nulls
+	}
+	for _, m := range mapping {
+		header, column, ok := strings.Cut(m, "=")
+		if !ok {
+			return importCommand{}, nil, fmt.Errorf("invalid -map %s, expected header=column", m)
+		}
+		if cmd.opts.Mapping == nil {
+			cmd.opts.Mapping = make(map[string]string)
+		}
+		cmd.opts.Mapping[header] = column
+	}
+	return cmd, rest, nil
+}
+
+// run загружает файл и печатает отчёт в out
+func (cmd importCommand) run(ctx context.Context, s service.RecordService, out io.Writer) error {
+	var in io.Reader = os.Stdin
+	if cmd.file != "-" {
+		f, err := os.Open(cmd.file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	src, err := router.NewRecordReader(cmd.format, in)
+	if err != nil {
+		return fmt.Errorf("%v %q, expected csv or ndjson", err, cmd.format)
+	}
+	report, err := s.ImportRecords(ctx, cmd.table, src, cmd.opts)
+	if err != nil {
+		return fmt.Errorf("import stopped after %d records: %v", report.Inserted, err)
+	}
+
+	data, err := json.MarshalIndent(report, "", "    ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(out, string(data))
+	return err
+}
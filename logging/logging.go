@@ -0,0 +1,266 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode"
+)
+
+// Level - уровень записи, как в log/slog: записи ниже уровня логгера отбрасываются
+type Level int
+
+const (
+	LevelDebug Level = -4
+	LevelInfo  Level = 0
+	LevelWarn  Level = 4
+	LevelError Level = 8
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarn:
+		return "WARN"
+	case LevelError:
+		return "ERROR"
+	default:
+		return fmt.Sprintf("LEVEL(%d)", int(l))
+	}
+}
+
+// ParseLevel разбирает debug, info, warn или error без учёта регистра
+func ParseLevel(s string) (Level, error) {
+	for _, l := range []Level{LevelDebug, LevelInfo, LevelWarn, LevelError} {
+		if strings.EqualFold(s, l.String()) {
+			return l, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown log level %q, expected debug, info, warn or error", s)
+}
+
+// форматы записей
+const (
+	FormatText = "text" // key=value в строку, как slog.TextHandler
+	FormatJSON = "json" // объект в строку, как slog.JSONHandler
+)
+
+// Options - настройки логгера
+type Options struct {
+	Level  Level
+	Format string // FormatText, если пусто
+}
+
+// output - общее у логгера и всех его With: куда и как писать
+type output struct {
+	mu    sync.Mutex
+	w     io.Writer
+	level Level
+	json  bool
+	now   func() time.Time
+}
+
+// Logger пишет записи из сообщения и пар ключ-значение. With добавляет пары ко всем записям,
+// так к записям запроса попадает request_id
+type Logger struct {
+	out   *output
+	attrs []attr
+}
+
+type attr struct {
+	key   string
+	value interface{}
+}
+
+func New(w io.Writer, opts Options) (*Logger, error) {
+	format := opts.Format
+	if format == "" {
+		format = FormatText
+	}
+	if format != FormatText && format != FormatJSON {
+		return nil, fmt.Errorf("unknown log format %q, expected %s or %s", format, FormatText, FormatJSON)
+	}
+	return &Logger{out: &output{w: w, level: opts.Level, json: format == FormatJSON, now: time.Now}}, nil
+}
+
+// With - логгер, который добавляет к каждой записи пары args: "table", "items", "id", 3
+func (l *Logger) With(args ...interface{}) *Logger {
+	attrs := make([]attr, 0, len(l.attrs)+len(args)/2)
+	attrs = append(attrs, l.attrs...)
+	return &Logger{out: l.out, attrs: appendAttrs(attrs, args)}
+}
+
+// Enabled - попадут ли в лог записи уровня level
+func (l *Logger) Enabled(level Level) bool {
+	return level >= l.out.level
+}
+
+func (l *Logger) Debug(msg string, args ...interface{}) { l.Log(LevelDebug, msg, args...) }
+func (l *Logger) Info(msg string, args ...interface{})  { l.Log(LevelInfo, msg, args...) }
+func (l *Logger) Warn(msg string, args ...interface{})  { l.Log(LevelWarn, msg, args...) }
+func (l *Logger) Error(msg string, args ...interface{}) { l.Log(LevelError, msg, args...) }
+
+// Log пишет запись уровня level. args - пары ключ-значение, значение без ключа попадает под !BADKEY
+func (l *Logger) Log(level Level, msg string, args ...interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
+	attrs := make([]attr, 0, len(l.attrs)+len(args)/2+3)
+	attrs = append(attrs, attr{"time", l.out.now()}, attr{"level", level.String()}, attr{"msg", msg})
+	attrs = append(attrs, l.attrs...)
+	attrs = appendAttrs(attrs, args)
+
+	var buf bytes.Buffer
+	if l.out.json {
+		writeJSON(&buf, attrs)
+	} else {
+		writeText(&buf, attrs)
+	}
+	buf.WriteByte('\n')
+
+	l.out.mu.Lock()
+	defer l.out.mu.Unlock()
+	l.out.w.Write(buf.Bytes())
+}
+
+// StdLogger - *log.Logger, строки которого становятся записями уровня level (для http.Server.ErrorLog
+// и библиотек, которые пишут через пакет log)
+func (l *Logger) StdLogger(level Level) *log.Logger {
+	return log.New(&stdWriter{l: l, level: level}, "", 0)
+}
+
+type stdWriter struct {
+	l     *Logger
+	level Level
+}
+
+func (w *stdWriter) Write(p []byte) (int, error) {
+	w.l.Log(w.level, strings.TrimSuffix(string(p), "\n"))
+	return len(p), nil
+}
+
+func appendAttrs(attrs []attr, args []interface{}) []attr {
+	for len(args) > 0 {
+		key, ok := args[0].(string)
+		if !ok || len(args) == 1 {
+			attrs = append(attrs, attr{"!BADKEY", args[0]})
+			args = args[1:]
+			continue
+		}
+		attrs = append(attrs, attr{key, args[1]})
+		args = args[2:]
+	}
+	return attrs
+}
+
+// value - значение для записи: ошибки и длительности строкой, время в RFC 3339
+func value(v interface{}) interface{} {
+	switch v := v.(type) {
+	case error:
+		return v.Error()
+	case time.Duration:
+		return v.String()
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case fmt.Stringer:
+		return v.String()
+	}
+	return v
+}
+
+func writeJSON(buf *bytes.Buffer, attrs []attr) {
+	buf.WriteByte('{')
+	for i, a := range attrs {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(a.key)
+		buf.Write(key)
+		buf.WriteByte(':')
+		data, err := json.Marshal(value(a.value))
+		if err != nil {
+			data, _ = json.Marshal(fmt.Sprint(a.value))
+		}
+		buf.Write(data)
+	}
+	buf.WriteByte('}')
+}
+
+func writeText(buf *bytes.Buffer, attrs []attr) {
+	for i, a := range attrs {
+		if i > 0 {
+			buf.WriteByte(' ')
+		}
+		buf.WriteString(quoteText(a.key))
+		buf.WriteByte('=')
+		v := value(a.value)
+		if v == nil {
+			buf.WriteString("<nil>")
+			continue
+		}
+		buf.WriteString(quoteText(fmt.Sprint(v)))
+	}
+}
+
+// quoteText берёт в кавычки пустые строки и строки с пробелами, кавычками, = и непечатными символами
+func quoteText(s string) string {
+	if s == "" {
+		return `""`
+	}
+	for _, r := range s {
+		if r == '=' || r == '"' || unicode.IsSpace(r) || !unicode.IsPrint(r) {
+			return strconv.Quote(s)
+		}
+	}
+	return s
+}
+
+var defaultLogger atomic.Value
+
+func init() {
+	l, _ := New(os.Stderr, Options{})
+	defaultLogger.Store(l)
+}
+
+// Default - логгер по умолчанию: до SetDefault текстовый, уровня info, в stderr
+func Default() *Logger {
+	return defaultLogger.Load().(*Logger)
+}
+
+// SetDefault заменяет логгер по умолчанию, туда же направляется вывод пакета log
+func SetDefault(l *Logger) {
+	if l == nil {
+		panic(errors.New("logging: nil default logger"))
+	}
+	defaultLogger.Store(l)
+	log.SetFlags(0)
+	log.SetOutput(&stdWriter{l: l, level: LevelInfo})
+}
+
+type ctxKey struct{}
+
+// NewContext - ctx с логгером запроса
+func NewContext(ctx context.Context, l *Logger) context.Context {
+	return context.WithValue(ctx, ctxKey{}, l)
+}
+
+// FromContext - логгер запроса из ctx, без него - логгер по умолчанию
+func FromContext(ctx context.Context) *Logger {
+	if l, ok := ctx.Value(ctxKey{}).(*Logger); ok {
+		return l
+	}
+	return Default()
+}
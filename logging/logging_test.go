@@ -0,0 +1,69 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestLogger(t *testing.T, level Level, format string) (*Logger, *bytes.Buffer) {
+	var buf bytes.Buffer
+	l, err := New(&buf, Options{Level: level, Format: format})
+	require.NoError(t, err)
+	l.out.now = func() time.Time { return time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC) }
+	return l, &buf
+}
+
+func TestLogger_text(t *testing.T) {
+	l, buf := newTestLogger(t, LevelInfo, FormatText)
+	l = l.With("request_id", "abc")
+
+	l.Debug("skipped")
+	l.Info("record not found", "table", "items", "id", 3)
+	l.Error("unable to create record", "err", errors.New(`duplicate "name"`), "duration", 1500*time.Millisecond, 42)
+
+	assert.Equal(t, `time=2024-05-01T12:00:00Z level=INFO msg="record not found" request_id=abc table=items id=3
+time=2024-05-01T12:00:00Z level=ERROR msg="unable to create record" request_id=abc err="duplicate \"name\"" duration=1.5s !BADKEY=42
+`, buf.String())
+}
+
+func TestLogger_json(t *testing.T) {
+	l, buf := newTestLogger(t, LevelDebug, FormatJSON)
+
+	l.Debug("sql", "query", "SELECT 1", "args", []string{"int", "NULL"}, "err", nil)
+
+	assert.Equal(t, `{"time":"2024-05-01T12:00:00Z","level":"DEBUG","msg":"sql","query":"SELECT 1","args":["int","NULL"],"err":null}`+"\n", buf.String())
+}
+
+func TestLogger_StdLogger(t *testing.T) {
+	l, buf := newTestLogger(t, LevelWarn, FormatText)
+
+	l.StdLogger(LevelWarn).Printf("http: TLS handshake error from %s", "127.0.0.1")
+	l.StdLogger(LevelInfo).Print("skipped")
+
+	assert.Equal(t, `time=2024-05-01T12:00:00Z level=WARN msg="http: TLS handshake error from 127.0.0.1"`+"\n", buf.String())
+}
+
+func TestParseLevel(t *testing.T) {
+	level, err := ParseLevel("Warn")
+	require.NoError(t, err)
+	assert.Equal(t, LevelWarn, level)
+
+	_, err = ParseLevel("verbose")
+	assert.Error(t, err)
+
+	_, err = New(&bytes.Buffer{}, Options{Format: "xml"})
+	assert.Error(t, err)
+}
+
+func TestFromContext(t *testing.T) {
+	assert.Same(t, Default(), FromContext(context.Background()))
+
+	l, _ := newTestLogger(t, LevelInfo, FormatText)
+	assert.Same(t, l, FromContext(NewContext(context.Background(), l)))
+}
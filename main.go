@@ -1,76 +1,355 @@
 package main
 
 import (
-	"database/sql"
-	"flag"
+	"context"
+	"encoding/json"
 	"fmt"
+	"hw6coursera/auth"
+	"hw6coursera/config"
 	"hw6coursera/dbexplorer"
+	"hw6coursera/dto"
+	"hw6coursera/logging"
+	"hw6coursera/metrics"
+	"hw6coursera/openapi"
 	"hw6coursera/repository"
 	"hw6coursera/router"
 	"hw6coursera/service"
-	"log"
 	"net/http"
-	"strconv"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 
 	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
 )
 
+// команды: serve (по умолчанию) запускает сервер, openapi выводит описание API и завершает работу,
+// import загружает в таблицу файл CSV или NDJSON и печатает отчёт
 const (
-	localDSN  = "root:1234@tcp(localhost:%d)/golang?charset=utf8"
-	dockerDSN = "root:1234@tcp(database-mysql:3306)/golang?charset=utf8"
+	commandServe   = "serve"
+	commandOpenAPI = "openapi"
+	commandImport  = "import"
 )
 
 func main() {
-	log.Printf("startig application")
-
-	var db *sql.DB
-	var err error
-	var port int
+	command, args := commandServe, os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
+	if command != commandServe && command != commandOpenAPI && command != commandImport {
+		fatal(fmt.Sprintf("unknown command %s, expected %s, %s or %s", command, commandServe, commandOpenAPI, commandImport))
+	}
 
-	flag.Parse()
-	if flag.Arg(0) == "local" {
-		port, err = strconv.Atoi(flag.Arg(1))
-		if err != nil {
-			log.Println(err)
-			return
+	var importCmd importCommand
+	if command == commandImport {
+		var err error
+		if importCmd, args, err = parseImportArgs(args); err != nil {
+			fatal("invalid import arguments", "err", err)
 		}
-		DSN := fmt.Sprintf(localDSN, port)
-		log.Printf("db dsn: %s", DSN)
-		db, err = sql.Open("mysql", DSN)
-	} else {
-		db, err = sql.Open("mysql", dockerDSN)
 	}
 
+	cfg, printConfig, err := config.Load(args, os.Getenv)
 	if err != nil {
-		log.Println(err)
+		fatal("invalid config", "err", err)
+	}
+	if printConfig {
+		if err := cfg.Print(os.Stdout); err != nil {
+			fatal("unable to print config", "err", err)
+		}
 		return
 	}
+
+	level, _ := logging.ParseLevel(cfg.Log.Level) // уже проверено в config.Validate
+	logger, err := logging.New(os.Stderr, logging.Options{Level: level, Format: cfg.Log.Format})
+	if err != nil {
+		fatal("invalid config", "err", err)
+	}
+	logging.SetDefault(logger)
+
+	logger.Info("starting application", "command", command)
+
+	db, driver, err := repository.Open(cfg.DSN)
+	if err != nil {
+		fatal("unable to open db", "err", err)
+	}
 	defer db.Close()
 
-	for i := 0; i < 10; i++ {
+	// для SQLite пул уже ограничен одним соединением, а пересоздание соединения потеряет базу в памяти
+	if driver != repository.SQLite {
+		db.SetMaxOpenConns(cfg.DB.MaxOpenConns)
+		db.SetMaxIdleConns(cfg.DB.MaxIdleConns)
+		db.SetConnMaxLifetime(time.Duration(cfg.DB.ConnMaxLifetime))
+	}
+
+	for i := 0; i < cfg.DB.ConnectRetries; i++ {
 		err = db.Ping()
 		if err == nil {
 			break
 		}
-		log.Printf("failed to ping db: %v", err)
-		time.Sleep(5 * time.Second)
+		logger.Warn("failed to ping db", "attempt", i+1, "err", err)
+		time.Sleep(time.Duration(cfg.DB.ConnectRetryInterval))
 	}
 
 	if err != nil {
-		log.Println(err)
-		return
+		fatal("unable to connect to db", "err", err)
+	}
+
+	repo, err := repository.NewRepositoryFor(db, driver)
+	if err != nil {
+		fatal("unable to init repository", "err", err)
+	}
+	if cfg.Log.SQL { // до метрик: они оборачивают менеджер записей
+		repo.LogSQL()
+	}
+	switch {
+	case cfg.Audit.Table != "":
+		repo.AuditLog, err = repository.NewAuditTable(db, driver, cfg.Audit.Table)
+	case cfg.Audit.File != "":
+		repo.AuditLog, err = repository.NewAuditFile(cfg.Audit.File)
+	}
+	if err != nil {
+		fatal("failed to init audit log", "err", err)
+	}
+
+	// метрики нужны только серверу: команды отрабатывают и завершаются
+	var appMetrics *metrics.Metrics
+	if command == commandServe && cfg.Features.Metrics {
+		appMetrics = metrics.New()
+		appMetrics.RegisterDBStats(db)
+		repository.Instrument(repo, appMetrics)
 	}
 
-	repo := repository.NewRepository(db)
 	explorer := dbexplorer.NewDbExplorer(repo)
-	service := service.NewService(repo, explorer)
+	columns := make(map[string]map[string]service.ColumnAccess, len(cfg.Policy.Columns))
+	for table, access := range cfg.Policy.Columns {
+		columns[table] = make(map[string]service.ColumnAccess, len(access))
+		for column, a := range access {
+			columns[table][column] = service.ColumnAccess(a)
+		}
+	}
+	transforms := make(map[string]map[string][]service.Transform, len(cfg.Transforms))
+	for table, list := range cfg.Transforms {
+		transforms[table] = make(map[string][]service.Transform, len(list))
+		for column, names := range list {
+			for _, name := range names {
+				transforms[table][column] = append(transforms[table][column], service.Transform(name))
+			}
+		}
+	}
+	access, err := newAccessPolicy(cfg.Access)
+	if err != nil {
+		fatal("invalid access rules", "err", err)
+	}
+	if command == commandOpenAPI || command == commandImport { // описываем всё API, загрузку запускает администратор
+		access = service.AccessPolicy{}
+	}
+	service := service.NewService(repo, explorer, service.Options{
+		Tables:             cfg.Tables,
+		HiddenTables:       cfg.Policy.HiddenTables,
+		ReadOnlyTables:     cfg.Policy.ReadOnlyTables,
+		Columns:            columns,
+		Access:             access,
+		Transforms:         transforms,
+		VersionColumns:     cfg.VersionColumns,
+		SoftDeleteColumns:  cfg.SoftDelete.Columns,
+		DetectSoftDelete:   cfg.SoftDelete.Detect,
+		AuditMaxBulkRows:   cfg.Audit.MaxBulkRows,
+		BatchMaxOperations: cfg.Batch.MaxOperations,
+		Metrics:            appMetrics,
+	})
 	if err := service.InitSchema(); err != nil {
-		log.Printf("failed to init database shcema: %v", err)
+		fatal("failed to init database schema", "err", err)
+	}
+	routerOpts := router.Options{
+		DefaultLimit:   cfg.Pagination.DefaultLimit,
+		MaxLimit:       cfg.Pagination.MaxLimit,
+		KeepNulls:      cfg.Output.KeepNulls,
+		Batch:          cfg.Features.Batch,
+		Bulk:           cfg.Features.Bulk,
+		Upsert:         cfg.Features.Upsert,
+		History:        cfg.Features.History,
+		Export:         cfg.Features.Export,
+		Import:         cfg.Features.Import,
+		Auth:           authMethods(cfg.Auth),
+		AllowAnonymous: cfg.Auth.AllowAnonymous,
+	}
+
+	if command == commandOpenAPI {
+		schema, err := service.GetSchema(context.Background())
+		if err != nil {
+			fatal("unable to get schema", "err", err)
+		}
+		data, err := json.MarshalIndent(router.OpenAPI(schema, routerOpts), "", "    ")
+		if err != nil {
+			fatal("unable to serialize openapi document", "err", err)
+		}
+		fmt.Println(string(data))
 		return
 	}
-	router := router.NewRouter(service)
 
-	fmt.Println("starting server at :8082")
-	http.ListenAndServe(":8082", router)
+	if command == commandImport {
+		if err := importCmd.run(context.Background(), service, os.Stdout); err != nil {
+			fatal("import failed", "err", err) // ненулевой код выхода для скриптов
+		}
+		return
+	}
+
+	var handler http.Handler = router.NewRouter(service, routerOpts)
+	if appMetrics != nil {
+		handler = withMetrics(handler, appMetrics.Registry)
+	}
+	if cfg.Auth.Enabled() {
+		authenticators, err := newAuthenticators(cfg.Auth)
+		if err != nil {
+			fatal("failed to init authentication", "err", err)
+		}
+		handler = auth.NewMiddleware(handler, cfg.Auth.AllowAnonymous, authenticators...)
+	}
+	if cfg.Output.Compress {
+		handler = router.NewCompressor(handler)
+	}
+	handler = router.NewRequestLogger(handler, logger)
+	if appMetrics != nil {
+		handler = router.NewInstrumenter(handler, appMetrics, service.HasTable)
+	}
+
+	server := newServer(cfg, handler)
+	go reloadSchemaOnHUP(service)
+	logger.Info("starting server", "listen", cfg.Listen)
+	fatal("server stopped", "err", server.ListenAndServe())
+}
+
+// withMetrics отдаёт метрики на служебном адресе /_metrics, как /_schema: адрес не закрывает таблицу
+// с именем metrics и при включённой аутентификации требует её, как и остальной API
+func withMetrics(api http.Handler, registry http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/_metrics" {
+			registry.ServeHTTP(w, r)
+			return
+		}
+		api.ServeHTTP(w, r)
+	})
+}
+
+func newServer(cfg config.Config, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              cfg.Listen,
+		Handler:           handler,
+		ReadHeaderTimeout: time.Duration(cfg.Server.ReadHeaderTimeout),
+		ReadTimeout:       time.Duration(cfg.Server.ReadTimeout),
+		WriteTimeout:      time.Duration(cfg.Server.WriteTimeout),
+		IdleTimeout:       time.Duration(cfg.Server.IdleTimeout),
+		ErrorLog:          logging.Default().StdLogger(logging.LevelWarn),
+	}
+}
+
+// reloadSchemaOnHUP перечитывает схему базы по SIGHUP: новые таблицы и колонки появляются в API
+// и в /_openapi.json без перезапуска сервера
+func reloadSchemaOnHUP(s *service.Service) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	for range signals {
+		if err := s.InitSchema(); err != nil {
+			logging.Default().Error("unable to reload database schema, keeping the previous one", "err", err)
+			continue
+		}
+		logging.Default().Info("database schema reloaded")
+	}
+}
+
+// fatal пишет ошибку в лог и завершает процесс с ненулевым кодом
+func fatal(msg string, args ...interface{}) {
+	logging.Default().Error(msg, args...)
+	os.Exit(1)
+}
+
+// authMethods - включённые способы аутентификации для описания API
+func authMethods(cfg config.Auth) []string {
+	var methods []string
+	if len(cfg.APIKeys) > 0 {
+		methods = append(methods, openapi.AuthAPIKey)
+	}
+	if cfg.JWT.Enabled() {
+		methods = append(methods, openapi.AuthBearer)
+	}
+	if cfg.BasicCredentialsFile != "" {
+		methods = append(methods, openapi.AuthBasic)
+	}
+	return methods
+}
+
+func newAuthenticators(cfg config.Auth) ([]auth.Authenticator, error) {
+	var authenticators []auth.Authenticator
+
+	if len(cfg.APIKeys) > 0 {
+		keys := make(map[string]dto.Principal, len(cfg.APIKeys))
+		for _, k := range cfg.APIKeys {
+			keys[k.Key] = dto.Principal{ID: k.ID, Roles: k.Roles}
+		}
+		apiKeys, err := auth.NewAPIKeys(keys)
+		if err != nil {
+			return nil, err
+		}
+		authenticators = append(authenticators, apiKeys)
+	}
+
+	if cfg.JWT.Enabled() {
+		jwt := auth.NewJWT(auth.JWTOptions{
+			Issuer:     cfg.JWT.Issuer,
+			Audience:   cfg.JWT.Audience,
+			RolesClaim: cfg.JWT.RolesClaim,
+			Leeway:     time.Duration(cfg.JWT.Leeway),
+		})
+		if cfg.JWT.Secret != "" {
+			if err := jwt.AddSecret("", []byte(cfg.JWT.Secret)); err != nil {
+				return nil, err
+			}
+		}
+		for _, path := range cfg.JWT.PublicKeyFiles {
+			if err := jwt.AddPublicKeyFile("", path); err != nil {
+				return nil, err
+			}
+		}
+		if cfg.JWT.JWKSFile != "" {
+			if err := jwt.AddJWKSFile(cfg.JWT.JWKSFile); err != nil {
+				return nil, err
+			}
+		}
+		authenticators = append(authenticators, jwt)
+	}
+
+	if cfg.BasicCredentialsFile != "" {
+		basic, err := auth.NewBasicFromFile(cfg.BasicCredentialsFile)
+		if err != nil {
+			return nil, err
+		}
+		authenticators = append(authenticators, basic)
+	}
+	return authenticators, nil
+}
+
+func newAccessPolicy(cfg config.Access) (service.AccessPolicy, error) {
+	access := service.AccessPolicy{
+		Roles: make(map[string]map[string][]service.Action, len(cfg.Roles)),
+		Rows:  make(map[string]service.RowRule, len(cfg.Rows)),
+	}
+	for role, tables := range cfg.Roles {
+		access.Roles[role] = make(map[string][]service.Action, len(tables))
+		for table, actions := range tables {
+			for _, a := range actions {
+				access.Roles[role][table] = append(access.Roles[role][table], service.Action(a))
+			}
+		}
+	}
+	for table, rule := range cfg.Rows {
+		column, err := rule.Column()
+		if err != nil {
+			return service.AccessPolicy{}, err
+		}
+		access.Rows[table] = service.RowRule{Column: column, ExemptRoles: rule.ExemptRoles}
+	}
+	return access, nil
 }
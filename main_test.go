@@ -1,22 +1,31 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"hw6coursera/auth"
+	"hw6coursera/config"
 	"hw6coursera/dbexplorer"
+	"hw6coursera/dto"
+	"hw6coursera/metrics"
 	"hw6coursera/repository"
 	"hw6coursera/router"
 	"hw6coursera/service"
+	"io"
 	"log"
 	"testing"
 
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"time"
 
 	_ "github.com/go-sql-driver/mysql"
+	"github.com/golang/mock/gomock"
+	_ "github.com/mattn/go-sqlite3"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -24,9 +33,8 @@ var (
 	client = &http.Client{Timeout: time.Second}
 )
 
-func prepareTestApis(db *sql.DB) error {
-
-	qs := []string{
+var (
+	mysqlTestApisSchema = []string{
 		`DROP TABLE IF EXISTS items_test;`,
 
 		`CREATE TABLE items_test (
@@ -59,6 +67,36 @@ func prepareTestApis(db *sql.DB) error {
 		('rvasily',	'love',	'rvasily@example.com',	'none',	NULL);`,
 	}
 
+	// то же самое для SQLite. rating сразу округлён: DECIMAL(5,2) в SQLite не округляет
+	sqliteTestApisSchema = []string{
+		`CREATE TABLE items_test (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		title VARCHAR(255) NOT NULL,
+		description TEXT NOT NULL,
+		updated VARCHAR(255) DEFAULT NULL,
+		rating DECIMAL(5,2),
+		level INT
+		);`,
+
+		`INSERT INTO items_test (title, description, updated, rating, level) VALUES
+		('database/sql', 'Рассказать про базы данных', 'rvasily', '2.72', '15'),
+		('memcache', 'Рассказать про мемкеш с примером использования', NULL, '0.0', '80');`,
+
+		`CREATE TABLE users_test (
+		user_id INTEGER PRIMARY KEY AUTOINCREMENT,
+		login VARCHAR(255) NOT NULL,
+		password VARCHAR(255) NOT NULL,
+		email VARCHAR(255) NOT NULL,
+		info TEXT NOT NULL,
+		updated VARCHAR(255) DEFAULT NULL
+		);`,
+
+		`INSERT INTO users_test (login, password, email, info, updated) VALUES
+		('rvasily', 'love', 'rvasily@example.com', 'none', NULL);`,
+	}
+)
+
+func prepareTestApis(db *sql.DB, qs []string) error {
 	for _, q := range qs {
 		if _, err := db.Exec(q); err != nil {
 			return err
@@ -86,7 +124,7 @@ func TestApis(t *testing.T) {
 		panic(err)
 	}
 	defer db.Close()
-	if err := prepareTestApis(db); err != nil {
+	if err := prepareTestApis(db, mysqlTestApisSchema); err != nil {
 		log.Printf("failed to prepare tests: %v", err)
 		assert.Equal(t, nil, err)
 		return
@@ -94,18 +132,45 @@ func TestApis(t *testing.T) {
 
 	defer cleanupTestApis(db)
 
-	repo := repository.NewRepository(db)
+	testApis(t, db, repository.MySQL)
+}
+
+// Весь http-стек на SQLite в памяти, без внешних сервисов
+func TestApisSQLite(t *testing.T) {
+	db, driver, err := repository.Open("sqlite://:memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := prepareTestApis(db, sqliteTestApisSchema); err != nil {
+		log.Printf("failed to prepare tests: %v", err)
+		assert.Equal(t, nil, err)
+		return
+	}
+
+	testApis(t, db, driver)
+}
+
+func testApis(t *testing.T, db *sql.DB, driver string) {
+	repo, err := repository.NewRepositoryFor(db, driver)
+	if err != nil {
+		t.Fatal(err)
+	}
 	explorer := dbexplorer.NewDbExplorer(repo)
-	service := service.NewService(repo, explorer)
+	service := service.NewService(repo, explorer, service.Options{})
 	if err := service.InitSchema(); err != nil {
 		log.Printf("failed to init database shcema: %v", err)
 		assert.Equal(t, nil, err)
 		return
 	}
-	router := router.NewRouter(service)
+	router := router.NewRouter(service, router.DefaultOptions())
 
 	ts := httptest.NewServer(router)
 
+	// API отдаёт поля записей в порядке колонок таблицы
+	itemsColumns := []string{"id", "title", "description", "updated", "rating", "level"}
+	usersColumns := []string{"user_id", "login", "password", "email", "info", "updated"}
+
 	tableItemsContent := []map[string]interface{}{
 		{
 			"id":          1,
@@ -123,34 +188,35 @@ func TestApis(t *testing.T) {
 			"rating":      0,
 		},
 	}
-	jsonItems, _ := json.MarshalIndent(tableItemsContent, "", "    ")
+	jsonItems, _ := json.Marshal(dto.Records{Columns: itemsColumns, Rows: tableItemsContent}.Ordered())
 	itemsData := string(jsonItems)
 
-	jsonSlice1stItem, _ := json.MarshalIndent(tableItemsContent[:1], "", "    ")
+	jsonSlice1stItem, _ := json.Marshal(dto.Records{Columns: itemsColumns, Rows: tableItemsContent[:1]}.Ordered())
 	slice1stItem := string(jsonSlice1stItem)
 
-	jsonSlice2stItem, _ := json.MarshalIndent(tableItemsContent[1:], "", "    ")
+	jsonSlice2stItem, _ := json.Marshal(dto.Records{Columns: itemsColumns, Rows: tableItemsContent[1:]}.Ordered())
 	slice2stItem := string(jsonSlice2stItem)
 
-	json1stItem, _ := json.MarshalIndent(tableItemsContent[0], "", "    ")
-	items1stRecord := string(json1stItem)
+	json1stItem, _ := json.Marshal(dto.OrderedRecord{Columns: itemsColumns, Values: tableItemsContent[0]})
+	// запись кодируется прямо в ответ, json.Encoder завершает её переводом строки
+	items1stRecord := string(json1stItem) + "\n"
 
 	newItem := map[string]string{"id": "42", "title": "db_crud", "description": ""}
 	newItemCorrectId := map[string]interface{}{"id": 3, "title": "db_crud", "description": ""}
-	newItemBytes, _ := json.MarshalIndent(newItemCorrectId, "", "    ")
-	newItemString := string(newItemBytes)
+	newItemBytes, _ := json.Marshal(dto.OrderedRecord{Columns: itemsColumns, Values: newItemCorrectId})
+	newItemString := string(newItemBytes) + "\n"
 
 	updatedItem := map[string]interface{}{"id": 3, "title": "db_crud", "description": "Написать программу db_crud"}
-	updatedItemBytes, _ := json.MarshalIndent(updatedItem, "", "    ")
-	updatedItemString := string(updatedItemBytes)
+	updatedItemBytes, _ := json.Marshal(dto.OrderedRecord{Columns: itemsColumns, Values: updatedItem})
+	updatedItemString := string(updatedItemBytes) + "\n"
 
 	updatedItem2 := map[string]interface{}{"id": 3, "title": "db_crud", "updated": "autotests", "description": "Написать программу db_crud"}
-	updatedItemBytes2, _ := json.MarshalIndent(updatedItem2, "", "    ")
-	updatedItemString2 := string(updatedItemBytes2)
+	updatedItemBytes2, _ := json.Marshal(dto.OrderedRecord{Columns: itemsColumns, Values: updatedItem2})
+	updatedItemString2 := string(updatedItemBytes2) + "\n"
 
 	finaleItem := map[string]interface{}{"id": 3, "title": "db_crud", "description": "Написать программу db_crud"}
-	finaleItemBytes, _ := json.MarshalIndent(finaleItem, "", "    ")
-	finaleItemString := string(finaleItemBytes)
+	finaleItemBytes, _ := json.Marshal(dto.OrderedRecord{Columns: itemsColumns, Values: finaleItem})
+	finaleItemString := string(finaleItemBytes) + "\n"
 
 	userRVasiliy := map[string]interface{}{
 		"user_id":  1,
@@ -159,8 +225,8 @@ func TestApis(t *testing.T) {
 		"email":    "rvasily@example.com",
 		"info":     "none",
 	}
-	userRVasiliyBytes, _ := json.MarshalIndent(userRVasiliy, "", "    ")
-	userRVasiliyString := string(userRVasiliyBytes)
+	userRVasiliyBytes, _ := json.Marshal(dto.OrderedRecord{Columns: usersColumns, Values: userRVasiliy})
+	userRVasiliyString := string(userRVasiliyBytes) + "\n"
 
 	updatedVasiliy := map[string]interface{}{
 		"user_id":  1,
@@ -170,8 +236,8 @@ func TestApis(t *testing.T) {
 		"info":     "try update",
 		"updated":  "now",
 	}
-	updatedVasiliyBytes, _ := json.MarshalIndent(updatedVasiliy, "", "    ")
-	updatedVasiliyString := string(updatedVasiliyBytes)
+	updatedVasiliyBytes, _ := json.Marshal(dto.OrderedRecord{Columns: usersColumns, Values: updatedVasiliy})
+	updatedVasiliyString := string(updatedVasiliyBytes) + "\n"
 
 	sqlGuy := map[string]interface{}{
 		"user_id":  3,
@@ -180,8 +246,8 @@ func TestApis(t *testing.T) {
 		"email":    "pochta@yandex.ru",
 		"info":     "info); DELETE FROM table WHERE 1=1; now(",
 	}
-	sqlGuyBytes, _ := json.MarshalIndent(sqlGuy, "", "    ")
-	sqlGuyString := string(sqlGuyBytes)
+	sqlGuyBytes, _ := json.Marshal(dto.OrderedRecord{Columns: usersColumns, Values: sqlGuy})
+	sqlGuyString := string(sqlGuyBytes) + "\n"
 
 	// users := []map[string]interface{}{
 	// 	{
@@ -215,7 +281,7 @@ func TestApis(t *testing.T) {
 		{
 			name:                 "tables list",
 			path:                 "/",
-			expectedResponseBody: "[\n    \"items_test\",\n    \"users_test\"\n]",
+			expectedResponseBody: "[\"items_test\",\"users_test\"]\n",
 		},
 		{
 			name:                   "unknown_table",
@@ -487,4 +553,224 @@ func TestApis(t *testing.T) {
 			assert.Equal(t, tc.expectedResponseBody, buf.String())
 		})
 	}
+
+	// изменение требует строгого совпадения ETag, слабый W/"..." в If-Match не подходит
+	t.Run("weak ETag in If-Match", func(t *testing.T) {
+		resp, err := client.Get(ts.URL + "/items_test/1")
+		if !assert.NoError(t, err) {
+			return
+		}
+		resp.Body.Close()
+		etag := resp.Header.Get("ETag")
+
+		for _, step := range []struct {
+			ifMatch        string
+			expectedStatus int
+		}{
+			{ifMatch: "W/" + etag, expectedStatus: http.StatusPreconditionFailed},
+			{ifMatch: etag, expectedStatus: http.StatusOK},
+		} {
+			req, _ := http.NewRequest(http.MethodPost, ts.URL+"/items_test/1", bytes.NewBufferString("description=etag"))
+			req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+			req.Header.Add("If-Match", step.ifMatch)
+			resp, err := client.Do(req)
+			if !assert.NoError(t, err) {
+				return
+			}
+			resp.Body.Close()
+			assert.Equal(t, step.expectedStatus, resp.StatusCode, step.ifMatch)
+		}
+	})
+}
+
+func TestServer_slowExport(t *testing.T) {
+	// выгрузка, которая идёт дольше таймаута записи из второго случая
+	slowExport := func(_ context.Context, _ string, _ dto.Filter, _ service.ReadOptions, w service.RecordWriter) error {
+		if err := w.Columns([]string{"id"}); err != nil {
+			return err
+		}
+		for id := 1; id <= 3; id++ {
+			time.Sleep(100 * time.Millisecond)
+			if err := w.Write(map[string]interface{}{"id": id}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	testCases := []struct {
+		name         string
+		writeTimeout config.Duration
+		complete     bool
+	}{
+		// по умолчанию таймаута записи нет, и выгрузка любой длины доходит целиком
+		{name: "default config", writeTimeout: config.Default().Server.WriteTimeout, complete: true},
+		{name: "write timeout cuts export", writeTimeout: config.Duration(150 * time.Millisecond), complete: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := gomock.NewController(t)
+			defer c.Finish()
+			recordService := service.NewMockRecordService(c)
+			recordService.EXPECT().ExportRecords(gomock.Any(), "items", dto.Filter(nil), service.ReadOptions{}, gomock.Any()).DoAndReturn(slowExport)
+
+			cfg := config.Default()
+			cfg.Server.WriteTimeout = tc.writeTimeout
+			ts := httptest.NewUnstartedServer(nil)
+			ts.Config = newServer(cfg, router.NewRouter(&service.Service{RecordService: recordService}, router.DefaultOptions()))
+			ts.Start()
+			defer ts.Close()
+
+			var body []byte
+			resp, err := http.Get(ts.URL + "/items/_export")
+			if err == nil {
+				defer resp.Body.Close()
+				body, err = io.ReadAll(resp.Body)
+			}
+
+			if !tc.complete {
+				assert.Error(t, err) // клиент видит оборванный ответ, а не неполный файл
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, "{\"id\":1}\n{\"id\":2}\n{\"id\":3}\n", string(body))
+		})
+	}
+}
+
+func TestServer_slowImport(t *testing.T) {
+	readAll := func(_ context.Context, _ string, src service.RecordReader, _ service.ImportOptions) (dto.ImportReport, error) {
+		report := dto.ImportReport{Errors: []dto.RejectedLine{}}
+		for {
+			_, _, err := src.Read()
+			if err == io.EOF {
+				return report, nil
+			}
+			if err != nil {
+				return report, err
+			}
+			report.Inserted++
+		}
+	}
+
+	testCases := []struct {
+		name        string
+		readTimeout config.Duration
+		complete    bool
+	}{
+		// по умолчанию таймаута чтения нет, и медленная загрузка доходит целиком
+		{name: "default config", readTimeout: config.Default().Server.ReadTimeout, complete: true},
+		{name: "read timeout cuts import", readTimeout: config.Duration(150 * time.Millisecond), complete: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := gomock.NewController(t)
+			defer c.Finish()
+			recordService := service.NewMockRecordService(c)
+			recordService.EXPECT().ImportRecords(gomock.Any(), "items", gomock.Any(), gomock.Any()).DoAndReturn(readAll)
+
+			cfg := config.Default()
+			cfg.Server.ReadTimeout = tc.readTimeout
+			ts := httptest.NewUnstartedServer(nil)
+			ts.Config = newServer(cfg, router.NewRouter(&service.Service{RecordService: recordService}, router.DefaultOptions()))
+			ts.Start()
+			defer ts.Close()
+
+			// клиент отправляет файл по строке раз в 100 мс
+			body, upload := io.Pipe()
+			go func() {
+				upload.Write([]byte("title\n"))
+				for i := 1; i <= 3; i++ {
+					time.Sleep(100 * time.Millisecond)
+					if _, err := fmt.Fprintf(upload, "item %d\n", i); err != nil {
+						return
+					}
+				}
+				upload.Close()
+			}()
+			resp, err := http.Post(ts.URL+"/items/_import", "text/csv", body)
+			var report []byte
+			if err == nil {
+				defer resp.Body.Close()
+				report, err = io.ReadAll(resp.Body)
+			}
+
+			if !tc.complete {
+				if err == nil {
+					assert.NotEqual(t, http.StatusOK, resp.StatusCode)
+				}
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			assert.Equal(t, "{\"inserted\":3,\"rejected\":0,\"errors\":[]}\n", string(report))
+		})
+	}
+}
+
+func TestWithMetrics(t *testing.T) {
+	m := metrics.New()
+	api := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("api " + r.URL.Path))
+	})
+	apiKeys, err := auth.NewAPIKeys(map[string]dto.Principal{"secret": {ID: "prometheus"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := auth.NewMiddleware(withMetrics(api, m.Registry), false, apiKeys)
+
+	testCases := []struct {
+		name           string
+		path           string
+		apiKey         string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{name: "metrics", path: "/_metrics", apiKey: "secret", expectedStatus: http.StatusOK, expectedBody: "# TYPE dbexplorer_http_requests_total counter"},
+		{name: "metrics require auth", path: "/_metrics", expectedStatus: http.StatusUnauthorized},
+		// таблица с именем metrics доступна как обычная
+		{name: "metrics table", path: "/metrics", apiKey: "secret", expectedStatus: http.StatusOK, expectedBody: "api /metrics"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			if tc.apiKey != "" {
+				req.Header.Set("X-API-Key", tc.apiKey)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			assert.Equal(t, tc.expectedStatus, w.Code)
+			assert.Contains(t, w.Body.String(), tc.expectedBody)
+		})
+	}
+}
+
+func TestParseImportArgs(t *testing.T) {
+	cmd, rest, err := parseImportArgs([]string{
+		"-dsn", "sqlite://app.db", "-table", "items", "-file=dump.CSV",
+		"-map", "Full Name=title", "-map", "note=", "-null", "NULL", "-chunk-size", "100", "-feature-batch=false",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"-dsn", "sqlite://app.db", "-feature-batch=false"}, rest)
+	assert.Equal(t, importCommand{
+		table:  "items",
+		file:   "dump.CSV",
+		format: "csv",
+		opts: service.ImportOptions{
+			Mapping:    map[string]string{"Full Name": "title", "note": ""},
+			NullTokens: []string{"NULL"},
+			ChunkSize:  100,
+		},
+	}, cmd)
+
+	cmd, _, err = parseImportArgs([]string{"-table", "items", "-file", "dump.csv"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{""}, cmd.opts.NullTokens) // пустая ячейка CSV - null, как в выгрузке
+
+	_, _, err = parseImportArgs([]string{"-table", "items"})
+	assert.EqualError(t, err, "import requires -table and -file")
 }
@@ -0,0 +1,55 @@
+package metrics
+
+import (
+	"database/sql"
+)
+
+// префикс имён метрик, как у переменных окружения DBEXPLORER_*
+const namespace = "dbexplorer_"
+
+// Metrics - метрики сервиса: http-запросы, запросы к базе, пул соединений и загрузки схемы
+type Metrics struct {
+	Registry *Registry
+
+	// по таблице, методу и коду ответа; у запросов не к таблице (/_batch, /_schema, /) таблица пустая
+	Requests        *Counter
+	RequestDuration *Histogram
+
+	// по операции репозитория (get_by_id, create, tx...), ошибки - без "запись не найдена"
+	QueryDuration *Histogram
+	QueryErrors   *Counter
+
+	// загрузки схемы базы по результату: ok или error
+	SchemaReloads *Counter
+}
+
+func New() *Metrics {
+	r := NewRegistry()
+	return &Metrics{
+		Registry:        r,
+		Requests:        r.NewCounter(namespace+"http_requests_total", "HTTP requests by table, method and status.", "table", "method", "status"),
+		RequestDuration: r.NewHistogram(namespace+"http_request_duration_seconds", "HTTP request latency by table, method and status.", DefaultBuckets, "table", "method", "status"),
+		QueryDuration:   r.NewHistogram(namespace+"db_query_duration_seconds", "Database query latency by repository operation.", DefaultBuckets, "operation"),
+		QueryErrors:     r.NewCounter(namespace+"db_query_errors_total", "Failed database queries by repository operation.", "operation"),
+		SchemaReloads:   r.NewCounter(namespace+"schema_reloads_total", "Database schema loads by result.", "result"),
+	}
+}
+
+// RegisterDBStats добавляет состояние пула соединений db, оно читается при каждом сборе метрик
+func (m *Metrics) RegisterDBStats(db *sql.DB) {
+	stat := func(fn func(s sql.DBStats) float64) func() float64 {
+		return func() float64 { return fn(db.Stats()) }
+	}
+	m.Registry.NewGaugeFunc(namespace+"db_max_open_connections", "Maximum number of open connections to the database.",
+		stat(func(s sql.DBStats) float64 { return float64(s.MaxOpenConnections) }))
+	m.Registry.NewGaugeFunc(namespace+"db_open_connections", "Established connections, both in use and idle.",
+		stat(func(s sql.DBStats) float64 { return float64(s.OpenConnections) }))
+	m.Registry.NewGaugeFunc(namespace+"db_in_use_connections", "Connections currently in use.",
+		stat(func(s sql.DBStats) float64 { return float64(s.InUse) }))
+	m.Registry.NewGaugeFunc(namespace+"db_idle_connections", "Idle connections.",
+		stat(func(s sql.DBStats) float64 { return float64(s.Idle) }))
+	m.Registry.NewCounterFunc(namespace+"db_wait_count_total", "Connections waited for because the pool was exhausted.",
+		stat(func(s sql.DBStats) float64 { return float64(s.WaitCount) }))
+	m.Registry.NewCounterFunc(namespace+"db_wait_duration_seconds_total", "Total time blocked waiting for a new connection.",
+		stat(func(s sql.DBStats) float64 { return s.WaitDuration.Seconds() }))
+}
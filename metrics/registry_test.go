@@ -0,0 +1,52 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistry_WriteTo(t *testing.T) {
+	r := NewRegistry()
+	requests := r.NewCounter("requests_total", "Requests.\nBy table.", "table", "status")
+	latency := r.NewHistogram("latency_seconds", "Latency.", []float64{0.1, 1}, "operation")
+	r.NewGaugeFunc("open_connections", "Open connections.", func() float64 { return 3 })
+
+	requests.Inc("users", "200")
+	requests.Add(2, `say "hi"\`, "404")
+	requests.Inc("users", "200")
+	latency.Observe(0.05, "create")
+	latency.Observe(0.5, "create")
+	latency.Observe(7, "create")
+
+	var nilCounter *Counter
+	nilCounter.Inc("ignored") // выключенные метрики не падают
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Equal(t, `# HELP requests_total Requests.\nBy table.
+# TYPE requests_total counter
+requests_total{table="say \"hi\"\\",status="404"} 2
+requests_total{table="users",status="200"} 2
+# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{operation="create",le="0.1"} 1
+latency_seconds_bucket{operation="create",le="1"} 2
+latency_seconds_bucket{operation="create",le="+Inf"} 3
+latency_seconds_sum{operation="create"} 7.55
+latency_seconds_count{operation="create"} 3
+# HELP open_connections Open connections.
+# TYPE open_connections gauge
+open_connections 3
+`, w.Body.String())
+	assert.Equal(t, float64(2), requests.Value("users", "200"))
+	assert.Equal(t, uint64(3), latency.Count("create"))
+}
+
+func TestCounter_wrongLabels(t *testing.T) {
+	c := NewRegistry().NewCounter("requests_total", "Requests.", "table")
+	assert.Panics(t, func() { c.Inc("users", "200") })
+}
@@ -0,0 +1,688 @@
+package openapi
+
+import (
+	"fmt"
+	"hw6coursera/dto"
+	"sort"
+)
+
+// Способы аутентификации, см. Options.Auth
+const (
+	AuthAPIKey = "api_key"
+	AuthBearer = "bearer"
+	AuthBasic  = "basic"
+)
+
+const (
+	textPlain         = "text/plain"
+	applicationJSON   = "application/json"
+	formURLEncoded    = "application/x-www-form-urlencoded"
+	applicationXML    = "application/xml"
+	applicationNDJSON = "application/x-ndjson"
+	textCSV           = "text/csv"
+
+	nullValue = "%00" // так null передаётся в параметрах и полях формы
+)
+
+// Options - что из API включено, от этого зависит набор путей
+type Options struct {
+	Title        string
+	Version      string // версия описываемого API
+	DefaultLimit int
+	MaxLimit     int // 0 - без ограничения
+	KeepNulls    bool
+
+	Batch   bool
+	Bulk    bool
+	Upsert  bool
+	History bool
+	Export  bool
+	Import  bool
+
+	Auth           []string // AuthAPIKey, AuthBearer, AuthBasic; пусто - API открыт
+	AllowAnonymous bool
+}
+
+// Generate строит описание API для таблиц схемы. Документ зависит только от схемы
+// и настроек, поэтому его можно строить заново при каждом изменении схемы
+func Generate(s dto.Schema, opts Options) *Document {
+	g := &generator{
+		opts: opts,
+		doc: &Document{
+			OpenAPI: Version,
+			Info:    Info{Title: opts.Title, Version: opts.Version},
+			Paths:   map[string]PathItem{},
+			Components: Components{
+				Schemas:    commonSchemas(),
+				Parameters: commonParameters(opts),
+				Responses:  commonResponses(len(opts.Auth) > 0),
+			},
+		},
+	}
+	g.addSecurity()
+
+	names := make([]string, 0, len(s))
+	for name := range s {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	g.doc.Paths["/"] = PathItem{"get": g.operation(&Operation{
+		Summary:     "List tables",
+		OperationID: "list_tables",
+		Responses: map[string]*Response{
+			"200": jsonResponse("Table names", &Schema{Type: "array", Items: &Schema{Type: "string", Enum: stringsToEnum(names)}}),
+		},
+	})}
+	for _, name := range names {
+		g.addTable(s[name])
+	}
+	g.doc.Paths["/_schema"] = PathItem{"get": g.operation(&Operation{
+		Summary:     "Describe tables: columns, keys, indexes and row estimates",
+		OperationID: "describe_schema",
+		Responses: map[string]*Response{
+			"200": jsonResponse("Tables by name", &Schema{Type: "object", AdditionalProperties: &Schema{Ref: ref("schemas", "Table")}}),
+		},
+	})}
+	g.doc.Paths["/_schema/{table}"] = PathItem{"get": g.operation(&Operation{
+		Summary:     "JSON Schema of table columns",
+		OperationID: "table_schema",
+		Parameters:  []*Parameter{{Name: "table", In: "path", Required: true, Schema: &Schema{Type: "string", Enum: stringsToEnum(names)}}},
+		Responses: map[string]*Response{
+			"200": {Description: "JSON Schema draft 2020-12", Content: map[string]MediaType{"application/schema+json": {Schema: &Schema{Type: "object"}}}},
+			"404": {Ref: ref("responses", "NotFound")},
+		},
+	})}
+	if opts.Batch {
+		g.addBatch()
+	}
+	return g.doc
+}
+
+type generator struct {
+	opts Options
+	doc  *Document
+}
+
+func (g *generator) addSecurity() {
+	if len(g.opts.Auth) == 0 {
+		return
+	}
+	g.doc.Components.SecuritySchemes = make(map[string]*SecurityScheme, len(g.opts.Auth))
+	for _, method := range g.opts.Auth {
+		switch method {
+		case AuthAPIKey:
+			g.doc.Components.SecuritySchemes[method] = &SecurityScheme{Type: "apiKey", In: "header", Name: "X-API-Key"}
+		case AuthBearer:
+			g.doc.Components.SecuritySchemes[method] = &SecurityScheme{Type: "http", Scheme: "bearer", BearerFormat: "JWT"}
+		case AuthBasic:
+			g.doc.Components.SecuritySchemes[method] = &SecurityScheme{Type: "http", Scheme: "basic"}
+		default:
+			continue
+		}
+		g.doc.Security = append(g.doc.Security, map[string][]string{method: {}})
+	}
+	if g.opts.AllowAnonymous {
+		g.doc.Security = append(g.doc.Security, map[string][]string{})
+	}
+}
+
+// operation добавляет ответы, которые возможны у любой операции
+func (g *generator) operation(op *Operation) *Operation {
+	if len(g.opts.Auth) > 0 {
+		op.Responses["401"] = &Response{Ref: ref("responses", "Unauthorized")}
+	}
+	return op
+}
+
+func (g *generator) addTable(t dto.Table) {
+	pk, hasPK := primaryKey(t)
+	tags := []string{t.Name}
+	g.doc.Components.Schemas[t.Name] = recordSchema(t)
+
+	filter := g.filterParameters(t)
+	list := &Operation{
+		Summary:     fmt.Sprintf("List %s records", t.Name),
+		OperationID: "list_" + t.Name,
+		Tags:        tags,
+		Parameters:  append(refParameters("limit", "offset", "format", "with_nulls", "pretty"), filter...),
+		Responses: map[string]*Response{
+			"200": recordsResponse(t),
+			"400": {Ref: ref("responses", "BadRequest")},
+			"403": {Ref: ref("responses", "Forbidden")},
+			"404": {Ref: ref("responses", "NotFound")},
+		},
+	}
+	if t.SoftDeleteColumn != "" {
+		list.Parameters = append(list.Parameters, refParameters("with_deleted")...)
+	}
+	tablePath := PathItem{"get": g.operation(list)}
+
+	if g.opts.Export {
+		export := &Operation{
+			Summary:     fmt.Sprintf("Export all %s records matching the filter", t.Name),
+			OperationID: "export_" + t.Name,
+			Tags:        tags,
+			Parameters: append([]*Parameter{{
+				Name: "format", In: "query", Description: "Response format, overrides the Accept header",
+				Schema: &Schema{Type: "string", Enum: stringsToEnum([]string{"ndjson", "csv"}), Default: "ndjson"},
+			}, {Ref: ref("parameters", "with_nulls")}}, filter...),
+			Responses: map[string]*Response{
+				"200": {
+					Description: "Records streamed one per line, null fields are omitted unless with_nulls is set",
+					Content: map[string]MediaType{
+						applicationNDJSON: {Schema: &Schema{Ref: ref("schemas", t.Name)}},
+						textCSV:           {Schema: &Schema{Type: "string", Description: "Header row with column names, null is an empty cell"}},
+					},
+				},
+				"400": {Ref: ref("responses", "BadRequest")},
+				"403": {Ref: ref("responses", "Forbidden")},
+				"404": {Ref: ref("responses", "NotFound")},
+			},
+		}
+		if t.SoftDeleteColumn != "" {
+			export.Parameters = append(export.Parameters, refParameters("with_deleted")...)
+		}
+		g.doc.Paths["/"+t.Name+"/_export"] = PathItem{"get": g.operation(export)}
+	}
+
+	if !t.ReadOnly {
+		g.doc.Components.Schemas[t.Name+".create"] = createSchema(t)
+		g.doc.Components.Schemas[t.Name+".update"] = updateSchema(t)
+
+		create := writeResponses("last insert id N")
+		create["409"] = &Response{Ref: ref("responses", "Conflict")}
+		tablePath["put"] = g.operation(&Operation{
+			Summary:     fmt.Sprintf("Create %s record", t.Name),
+			OperationID: "create_" + t.Name,
+			Tags:        tags,
+			RequestBody: formBody(t.Name + ".create"),
+			Responses:   create,
+		})
+		if g.opts.Bulk {
+			update := &Operation{
+				Summary:     fmt.Sprintf("Update %s records matching the filter", t.Name),
+				OperationID: "update_" + t.Name + "_by_filter",
+				Tags:        tags,
+				Parameters:  append(refParameters("confirm", "dry_run"), filter...),
+				RequestBody: formBody(t.Name + ".update"),
+				Responses:   writeResponses("updated N records"),
+			}
+			update.Responses["409"] = &Response{Ref: ref("responses", "Conflict")}
+			tablePath["patch"] = g.operation(update)
+			tablePath["delete"] = g.operation(&Operation{
+				Summary:     fmt.Sprintf("Delete %s records matching the filter", t.Name),
+				OperationID: "delete_" + t.Name + "_by_filter",
+				Tags:        tags,
+				Parameters:  update.Parameters,
+				Responses:   writeResponses("deleted N records"),
+			})
+		}
+		if g.opts.Import {
+			g.doc.Paths["/"+t.Name+"/_import"] = PathItem{"post": g.operation(&Operation{
+				Summary:     fmt.Sprintf("Import %s records from CSV or NDJSON", t.Name),
+				OperationID: "import_" + t.Name,
+				Tags:        tags,
+				Parameters: []*Parameter{
+					{Name: "format", In: "query", Description: "Body format, overrides the Content-Type header", Schema: &Schema{Type: "string", Enum: stringsToEnum([]string{"ndjson", "csv"})}},
+					{Name: "null", In: "query", Description: "Values read as null, repeatable; an empty CSV cell by default", Schema: &Schema{Type: "array", Items: &Schema{Type: "string"}}},
+					{Name: "map[header]", In: "query", Description: "Column for a file header, empty to skip the header", Schema: &Schema{Type: "string"}},
+					{Name: "chunk_size", In: "query", Description: "Records per transaction", Schema: &Schema{Type: "integer", Minimum: intPtr(1), Default: 500}},
+				},
+				RequestBody: &RequestBody{
+					Required: true,
+					Content: map[string]MediaType{
+						applicationNDJSON: {Schema: &Schema{Ref: ref("schemas", t.Name+".create")}},
+						textCSV:           {Schema: &Schema{Type: "string", Description: "Header row with column names"}},
+					},
+				},
+				Responses: map[string]*Response{
+					"200": jsonResponse("Import report, rejected lines do not stop the import", &Schema{Ref: ref("schemas", "ImportReport")}),
+					"400": {Ref: ref("responses", "BadRequest")},
+					"403": {Ref: ref("responses", "Forbidden")},
+					"404": {Ref: ref("responses", "NotFound")},
+					"415": textResponse("Unsupported Content-Type"),
+				},
+			})}
+		}
+	}
+	g.doc.Paths["/"+t.Name] = tablePath
+
+	if !hasPK { // без первичного ключа к записи не обратиться
+		return
+	}
+
+	recordPath := PathItem{"get": g.operation(&Operation{
+		Summary:     fmt.Sprintf("Get %s record", t.Name),
+		OperationID: "get_" + t.Name,
+		Tags:        tags,
+		Parameters:  refParameters("id", "If-None-Match", "with_nulls", "pretty"),
+		Responses: map[string]*Response{
+			"200": {
+				Description: "Record, null fields are omitted unless with_nulls is set",
+				Headers:     map[string]*Header{"ETag": {Schema: &Schema{Type: "string"}}},
+				Content:     map[string]MediaType{applicationJSON: {Schema: &Schema{Ref: ref("schemas", t.Name)}}},
+			},
+			"304": {Description: "Record matches If-None-Match"},
+			"403": {Ref: ref("responses", "Forbidden")},
+			"404": {Ref: ref("responses", "NotFound")},
+		},
+	})}
+	if t.SoftDeleteColumn != "" {
+		recordPath["get"].Parameters = append(recordPath["get"].Parameters, refParameters("with_deleted")...)
+	}
+
+	if !t.ReadOnly {
+		update := writeResponses("updated record id N")
+		update["412"] = &Response{Ref: ref("responses", "PreconditionFailed")}
+		update["409"] = &Response{Ref: ref("responses", "Conflict")}
+		recordPath["post"] = g.operation(&Operation{
+			Summary:     fmt.Sprintf("Update %s record", t.Name),
+			OperationID: "update_" + t.Name,
+			Tags:        tags,
+			Parameters:  refParameters("id", "If-Match"),
+			RequestBody: formBody(t.Name + ".update"),
+			Responses:   update,
+		})
+		remove := writeResponses("deleted record id N")
+		remove["412"] = &Response{Ref: ref("responses", "PreconditionFailed")}
+		recordPath["delete"] = g.operation(&Operation{
+			Summary:     fmt.Sprintf("Delete %s record", t.Name),
+			OperationID: "delete_" + t.Name,
+			Tags:        tags,
+			Parameters:  refParameters("id", "If-Match"),
+			Responses:   remove,
+		})
+
+		if g.opts.Upsert {
+			upsert := writeResponses("created record id N or updated record id N")
+			upsert["409"] = &Response{Ref: ref("responses", "Conflict")}
+			g.doc.Components.Schemas[t.Name+".upsert"] = upsertSchema(t, pk)
+			g.doc.Paths["/"+t.Name+"/_upsert"] = PathItem{"put": g.operation(&Operation{
+				Summary:     fmt.Sprintf("Create or update %s record by unique key", t.Name),
+				OperationID: "upsert_" + t.Name,
+				Tags:        tags,
+				Parameters: []*Parameter{{
+					Name:        "key",
+					In:          "query",
+					Description: "Unique key to match an existing record, primary key by default. Key columns are required",
+					Schema:      &Schema{Type: "string", Enum: stringsToEnum(uniqueKeys(t))},
+				}},
+				RequestBody: formBody(t.Name + ".upsert"),
+				Responses:   upsert,
+			})}
+		}
+
+		if t.SoftDeleteColumn != "" {
+			g.doc.Paths["/"+t.Name+"/{id}/_restore"] = PathItem{"post": g.operation(&Operation{
+				Summary:     fmt.Sprintf("Restore soft-deleted %s record", t.Name),
+				OperationID: "restore_" + t.Name,
+				Tags:        tags,
+				Parameters:  refParameters("id"),
+				Responses:   writeResponses("restored record id N"),
+			})}
+		}
+	}
+	g.doc.Paths["/"+t.Name+"/{id}"] = recordPath
+
+	if g.opts.History {
+		g.doc.Paths["/"+t.Name+"/{id}/_history"] = PathItem{"get": g.operation(&Operation{
+			Summary:     fmt.Sprintf("Change history of %s record", t.Name),
+			OperationID: "history_" + t.Name,
+			Tags:        tags,
+			Parameters:  refParameters("id", "pretty"),
+			Responses: map[string]*Response{
+				"200": jsonResponse("Changes from oldest to newest", &Schema{Type: "array", Items: &Schema{Ref: ref("schemas", "AuditEntry")}}),
+				"403": {Ref: ref("responses", "Forbidden")},
+				"404": {Ref: ref("responses", "NotFound")},
+			},
+		})}
+	}
+}
+
+func (g *generator) addBatch() {
+	g.doc.Paths["/_batch"] = PathItem{"post": g.operation(&Operation{
+		Summary:     "Execute operations in one transaction",
+		OperationID: "batch",
+		RequestBody: &RequestBody{
+			Required: true,
+			Content:  map[string]MediaType{applicationJSON: {Schema: &Schema{Type: "array", Items: &Schema{Ref: ref("schemas", "BatchOperation")}}}},
+		},
+		Responses: map[string]*Response{
+			"200": jsonResponse("All operations succeeded", &Schema{Type: "array", Items: &Schema{Ref: ref("schemas", "BatchResult")}}),
+			"400": jsonResponse("Batch rolled back, the last result holds the error", &Schema{Type: "array", Items: &Schema{Ref: ref("schemas", "BatchResult")}}),
+			"403": {Ref: ref("responses", "Forbidden")},
+			"404": {Ref: ref("responses", "NotFound")},
+			"409": jsonResponse("Batch rolled back, an operation conflicts with another record", &Schema{Type: "array", Items: &Schema{Ref: ref("schemas", "BatchResult")}}),
+			"413": textResponse("Too many operations in the batch"),
+		},
+	})}
+}
+
+// filterParameters - условия фильтра `column=value` и `column[operator]=value`
+func (g *generator) filterParameters(t dto.Table) []*Parameter {
+	var params []*Parameter
+	for _, c := range t.Columns {
+		if c.WriteOnly {
+			continue
+		}
+		operators := []string{dto.OpEq, dto.OpNe, dto.OpLt, dto.OpLte, dto.OpGt, dto.OpGte}
+		if c.ColumnType != dto.IntType && c.ColumnType != dto.FloatType && c.ColumnType != dto.BoolType {
+			operators = append(operators, dto.OpLike)
+		}
+		for _, op := range operators {
+			name, key := c.Name+"["+op+"]", t.Name+"."+c.Name+"."+op
+			description := fmt.Sprintf("Filter: %s %s value", c.Name, op)
+			if op == dto.OpEq {
+				name, key = c.Name, t.Name+"."+c.Name
+			}
+			if op == dto.OpEq || op == dto.OpNe {
+				description += ", " + nullValue + " compares with null"
+			}
+			g.doc.Components.Parameters[key] = &Parameter{Name: name, In: "query", Description: description, Schema: valueSchema(c)}
+			params = append(params, &Parameter{Ref: ref("parameters", key)})
+		}
+	}
+	return params
+}
+
+func commonParameters(opts Options) map[string]*Parameter {
+	limit := &Schema{Type: "integer", Minimum: intPtr(0), Default: opts.DefaultLimit}
+	if opts.MaxLimit > 0 {
+		limit.Maximum = intPtr(opts.MaxLimit)
+	}
+	return map[string]*Parameter{
+		"limit":         {Name: "limit", In: "query", Schema: limit},
+		"format":        {Name: "format", In: "query", Description: "Response format, overrides the Accept header", Schema: &Schema{Type: "string", Enum: stringsToEnum([]string{"json", "ndjson", "csv", "xml"})}},
+		"offset":        {Name: "offset", In: "query", Schema: &Schema{Type: "integer", Minimum: intPtr(0), Default: 0}},
+		"with_deleted":  {Name: "with_deleted", In: "query", Description: "Include soft-deleted records", Schema: &Schema{Type: "boolean"}},
+		"with_nulls":    {Name: "with_nulls", In: "query", Description: "Return null fields instead of omitting them", Schema: &Schema{Type: "boolean", Default: opts.KeepNulls}},
+		"pretty":        {Name: "pretty", In: "query", Description: "Indent JSON, by default it is compact", Schema: &Schema{Type: "boolean"}},
+		"confirm":       {Name: "confirm", In: "query", Description: "Required to change all records when the filter is empty", Schema: &Schema{Type: "boolean"}},
+		"dry_run":       {Name: "dry_run", In: "query", Description: "Only count matching records", Schema: &Schema{Type: "boolean"}},
+		"id":            {Name: "id", In: "path", Required: true, Schema: &Schema{Type: "integer"}},
+		"If-Match":      {Name: "If-Match", In: "header", Description: "Change the record only if its ETag matches", Schema: &Schema{Type: "string"}},
+		"If-None-Match": {Name: "If-None-Match", In: "header", Schema: &Schema{Type: "string"}},
+	}
+}
+
+func commonResponses(auth bool) map[string]*Response {
+	responses := map[string]*Response{
+		"BadRequest":         textResponse("Invalid data or filter"),
+		"Forbidden":          textResponse("Access denied"),
+		"NotFound":           textResponse("Unknown table or record"),
+		"PreconditionFailed": textResponse("Record was changed, ETag does not match"),
+		"Conflict":           textResponse("Another record has the same value of a unique key"),
+	}
+	if auth {
+		responses["Unauthorized"] = textResponse("Missing or invalid credentials")
+	}
+	return responses
+}
+
+func commonSchemas() map[string]*Schema {
+	return map[string]*Schema{
+		"AuditEntry": {
+			Type: "object",
+			Properties: map[string]*Schema{
+				"table":     {Type: "string"},
+				"record_id": {Type: "integer"},
+				"operation": {Type: "string", Enum: stringsToEnum([]string{dto.AuditCreate, dto.AuditUpdate, dto.AuditDelete, dto.AuditRestore})},
+				"actor":     {Type: "string"},
+				"time":      {Type: "string", Format: "date-time"},
+				"changes": {
+					Type:        "object",
+					Description: "Changed fields only",
+					AdditionalProperties: &Schema{
+						Type:       "object",
+						Properties: map[string]*Schema{"old": {}, "new": {}},
+					},
+				},
+			},
+			Required: []string{"table", "record_id", "operation", "actor", "time", "changes"},
+		},
+		"BatchOperation": {
+			Type: "object",
+			Properties: map[string]*Schema{
+				"op":    {Type: "string", Enum: stringsToEnum([]string{dto.BatchCreate, dto.BatchUpdate, dto.BatchDelete})},
+				"table": {Type: "string"},
+				"id":    {Type: []string{"integer", "string"}, Description: "Record id or `$N.id` - id of the record from operation N"},
+				"data":  {Type: "object", AdditionalProperties: &Schema{Type: []string{"string", "number", "null"}}},
+			},
+			Required: []string{"op", "table"},
+		},
+		"BatchResult": {
+			Type: "object",
+			Properties: map[string]*Schema{
+				"index": {Type: "integer"},
+				"op":    {Type: "string"},
+				"table": {Type: "string"},
+				"id":    {Type: "integer"},
+				"error": {Type: "string"},
+			},
+			Required: []string{"index", "op", "table"},
+		},
+		"ImportReport": {
+			Type: "object",
+			Properties: map[string]*Schema{
+				"inserted": {Type: "integer"},
+				"rejected": {Type: "integer"},
+				"errors": {Type: "array", Description: "First rejected lines with reasons", Items: &Schema{
+					Type: "object",
+					Properties: map[string]*Schema{
+						"line":  {Type: "integer"},
+						"error": {Type: "string"},
+					},
+					Required: []string{"line", "error"},
+				}},
+			},
+			Required: []string{"inserted", "rejected", "errors"},
+		},
+		"Table": {
+			Type: "object",
+			Properties: map[string]*Schema{
+				"name": {Type: "string"},
+				"columns": {Type: "array", Items: &Schema{
+					Type: "object",
+					Properties: map[string]*Schema{
+						"name":        {Type: "string"},
+						"type":        {Type: "string", Enum: stringsToEnum([]string{dto.IntType, dto.FloatType, dto.BoolType, dto.StringType, dto.UnknownType})},
+						"nullable":    {Type: "boolean"},
+						"primary_key": {Type: "boolean"},
+						"read_only":   {Type: "boolean"},
+						"write_only":  {Type: "boolean"},
+						"generated":   {Type: "boolean"},
+						"max_length":  {Type: "integer"},
+						"enum":        {Type: "array", Items: &Schema{Type: "string"}},
+					},
+					Required: []string{"name", "type", "nullable"},
+				}},
+				"indexes": {Type: "array", Items: &Schema{
+					Type: "object",
+					Properties: map[string]*Schema{
+						"name":    {Type: "string"},
+						"columns": {Type: "array", Items: &Schema{Type: "string"}},
+						"unique":  {Type: "boolean"},
+					},
+					Required: []string{"name", "columns", "unique"},
+				}},
+				"foreign_keys": {Type: "array", Items: &Schema{
+					Type: "object",
+					Properties: map[string]*Schema{
+						"name":        {Type: "string"},
+						"columns":     {Type: "array", Items: &Schema{Type: "string"}},
+						"ref_table":   {Type: "string"},
+						"ref_columns": {Type: "array", Items: &Schema{Type: "string"}},
+					},
+					Required: []string{"name", "columns", "ref_table", "ref_columns"},
+				}},
+				"version_column":     {Type: "string"},
+				"soft_delete_column": {Type: "string"},
+				"read_only":          {Type: "boolean"},
+				"rows_estimate":      {Type: "integer", Format: "int64", Description: "Approximate row count from database statistics, -1 if unknown"},
+			},
+			Required: []string{"name", "columns", "indexes", "foreign_keys", "rows_estimate"},
+		},
+	}
+}
+
+// recordSchema - запись в ответе. Поля со значением null не отдаются, поэтому
+// обязательны только not null колонки
+func recordSchema(t dto.Table) *Schema {
+	s := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	for _, c := range t.Columns {
+		if c.WriteOnly {
+			continue
+		}
+		property := valueSchema(c)
+		property.ReadOnly = c.IsPrimaryKey || c.ReadOnly
+		s.Properties[c.Name] = property
+		if !c.Nullable {
+			s.Required = append(s.Required, c.Name)
+		}
+	}
+	return s
+}
+
+// createSchema - поля формы для создания: отсутствующее поле - null
+func createSchema(t dto.Table) *Schema {
+	s := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	for _, c := range writableColumns(t) {
+		s.Properties[c.Name] = formSchema(c)
+		if !c.Nullable {
+			s.Required = append(s.Required, c.Name)
+		}
+	}
+	return s
+}
+
+// updateSchema - поля формы для изменения: отсутствующие поля не меняются
+func updateSchema(t dto.Table) *Schema {
+	s := &Schema{Type: "object", Properties: map[string]*Schema{}, MinProperties: 1}
+	for _, c := range writableColumns(t) {
+		s.Properties[c.Name] = formSchema(c)
+	}
+	return s
+}
+
+// upsertSchema - как для создания, но можно передать первичный ключ
+func upsertSchema(t dto.Table, pk dto.Column) *Schema {
+	s := createSchema(t)
+	s.Properties[pk.Name] = valueSchema(pk)
+	return s
+}
+
+func writableColumns(t dto.Table) []dto.Column {
+	columns := make([]dto.Column, 0, len(t.Columns))
+	for _, c := range t.Columns {
+		if !c.IsPrimaryKey && !c.ReadOnly {
+			columns = append(columns, c)
+		}
+	}
+	return columns
+}
+
+func valueSchema(c dto.Column) *Schema {
+	switch c.ColumnType {
+	case dto.IntType:
+		return &Schema{Type: "integer", Format: "int64"}
+	case dto.FloatType:
+		return &Schema{Type: "number", Format: "double"}
+	case dto.BoolType:
+		return &Schema{Type: "boolean"}
+	case dto.StringType:
+		return &Schema{Type: "string", MaxLength: c.MaxLength, Enum: stringsToEnum(c.Enum)}
+	default: // тип колонки неизвестен - значение отдаётся как есть
+		return &Schema{}
+	}
+}
+
+func formSchema(c dto.Column) *Schema {
+	s := valueSchema(c)
+	s.WriteOnly = c.WriteOnly
+	if c.Nullable {
+		s.Description = nullValue + " sets null"
+	}
+	return s
+}
+
+func primaryKey(t dto.Table) (dto.Column, bool) {
+	for _, c := range t.Columns {
+		if c.IsPrimaryKey {
+			return c, true
+		}
+	}
+	return dto.Column{}, false
+}
+
+func uniqueKeys(t dto.Table) []string {
+	var keys []string
+	for _, idx := range t.Indexes {
+		if idx.Unique {
+			keys = append(keys, idx.Name)
+		}
+	}
+	return keys
+}
+
+func refParameters(names ...string) []*Parameter {
+	params := make([]*Parameter, 0, len(names))
+	for _, name := range names {
+		params = append(params, &Parameter{Ref: ref("parameters", name)})
+	}
+	return params
+}
+
+func formBody(schema string) *RequestBody {
+	return &RequestBody{
+		Required: true,
+		Content:  map[string]MediaType{formURLEncoded: {Schema: &Schema{Ref: ref("schemas", schema)}}},
+	}
+}
+
+// writeResponses - ответы изменяющих операций, при успехе сервер отвечает текстом
+func writeResponses(success string) map[string]*Response {
+	return map[string]*Response{
+		"200": {Description: success, Content: map[string]MediaType{textPlain: {Schema: &Schema{Type: "string"}}}},
+		"400": {Ref: ref("responses", "BadRequest")},
+		"403": {Ref: ref("responses", "Forbidden")},
+		"404": {Ref: ref("responses", "NotFound")},
+	}
+}
+
+func jsonResponse(description string, schema *Schema) *Response {
+	return &Response{Description: description, Content: map[string]MediaType{applicationJSON: {Schema: schema}}}
+}
+
+// recordsResponse - список записей во всех форматах, которые можно выбрать через Accept или ?format=
+func recordsResponse(t dto.Table) *Response {
+	records := &Schema{Type: "array", Items: &Schema{Ref: ref("schemas", t.Name)}}
+	return &Response{
+		Description: "Records, null fields are omitted unless with_nulls is set",
+		Content: map[string]MediaType{
+			applicationJSON:   {Schema: records},
+			applicationNDJSON: {Schema: &Schema{Ref: ref("schemas", t.Name)}},
+			textCSV:           {Schema: &Schema{Type: "string", Description: "Header row with column names, null is an empty cell"}},
+			applicationXML:    {Schema: &Schema{Type: "string", Description: "<records><record><field name=\"column\">value</field></record></records>"}},
+		},
+	}
+}
+
+func textResponse(description string) *Response {
+	return &Response{Description: description, Content: map[string]MediaType{textPlain: {Schema: &Schema{Type: "string"}}}}
+}
+
+func stringsToEnum(values []string) []interface{} {
+	if len(values) == 0 {
+		return nil
+	}
+	enum := make([]interface{}, 0, len(values))
+	for _, v := range values {
+		enum = append(enum, v)
+	}
+	return enum
+}
+
+func intPtr(v int) *int {
+	return &v
+}
@@ -0,0 +1,173 @@
+package openapi
+
+import (
+	"encoding/json"
+	"hw6coursera/dto"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testSchema() dto.Schema {
+	return dto.Schema{
+		"users": {
+			Name: "users",
+			Columns: []dto.Column{
+				{Name: "id", ColumnType: dto.IntType, IsPrimaryKey: true},
+				{Name: "email", ColumnType: dto.StringType},
+				{Name: "password", ColumnType: dto.StringType, WriteOnly: true},
+				{Name: "score", ColumnType: dto.FloatType, Nullable: true},
+				{Name: "created_at", ColumnType: dto.StringType, ReadOnly: true},
+				{Name: "deleted_at", ColumnType: dto.StringType, Nullable: true},
+			},
+			Indexes:          []dto.Index{{Name: dto.PrimaryIndexName, Columns: []string{"id"}, Unique: true}, {Name: "email", Columns: []string{"email"}, Unique: true}},
+			SoftDeleteColumn: "deleted_at",
+		},
+		"countries": {
+			Name: "countries",
+			Columns: []dto.Column{
+				{Name: "id", ColumnType: dto.IntType, IsPrimaryKey: true},
+				{Name: "name", ColumnType: dto.StringType},
+			},
+			ReadOnly: true,
+		},
+	}
+}
+
+var allFeatures = Options{Title: "test", Version: "1", DefaultLimit: 5, MaxLimit: 100, Batch: true, Bulk: true, Upsert: true, History: true, Export: true, Import: true}
+
+func paths(doc *Document) map[string][]string {
+	result := make(map[string][]string, len(doc.Paths))
+	for path, item := range doc.Paths {
+		for method := range item {
+			result[path] = append(result[path], method)
+		}
+		sort.Strings(result[path])
+	}
+	return result
+}
+
+func TestGenerate_paths(t *testing.T) {
+	doc := Generate(testSchema(), allFeatures)
+	assert.Equal(t, Version, doc.OpenAPI)
+	assert.Equal(t, map[string][]string{
+		"/":                        {"get"},
+		"/_batch":                  {"post"},
+		"/_schema":                 {"get"},
+		"/_schema/{table}":         {"get"},
+		"/countries":               {"get"},
+		"/countries/_export":       {"get"},
+		"/countries/{id}":          {"get"},
+		"/countries/{id}/_history": {"get"},
+		"/users":                   {"delete", "get", "patch", "put"},
+		"/users/_export":           {"get"},
+		"/users/_import":           {"post"},
+		"/users/_upsert":           {"put"},
+		"/users/{id}":              {"delete", "get", "post"},
+		"/users/{id}/_history":     {"get"},
+		"/users/{id}/_restore":     {"post"},
+	}, paths(doc))
+
+	doc = Generate(testSchema(), Options{})
+	assert.Equal(t, map[string][]string{
+		"/":                    {"get"},
+		"/_schema":             {"get"},
+		"/_schema/{table}":     {"get"},
+		"/countries":           {"get"},
+		"/countries/{id}":      {"get"},
+		"/users":               {"get", "put"},
+		"/users/{id}":          {"delete", "get", "post"},
+		"/users/{id}/_restore": {"post"},
+	}, paths(doc))
+}
+
+func TestGenerate_schemas(t *testing.T) {
+	doc := Generate(testSchema(), allFeatures)
+	schemas := doc.Components.Schemas
+
+	record := schemas["users"]
+	assert.NotContains(t, record.Properties, "password")
+	assert.True(t, record.Properties["id"].ReadOnly)
+	assert.True(t, record.Properties["created_at"].ReadOnly)
+	assert.Equal(t, &Schema{Type: "number", Format: "double"}, record.Properties["score"])
+	assert.Equal(t, []string{"id", "email", "created_at"}, record.Required)
+
+	create := schemas["users.create"]
+	assert.NotContains(t, create.Properties, "id")
+	assert.NotContains(t, create.Properties, "created_at")
+	assert.True(t, create.Properties["password"].WriteOnly)
+	assert.Equal(t, []string{"email", "password"}, create.Required)
+	assert.Equal(t, nullValue+" sets null", create.Properties["score"].Description)
+
+	assert.Empty(t, schemas["users.update"].Required)
+	assert.Equal(t, 1, schemas["users.update"].MinProperties)
+	assert.Contains(t, schemas["users.upsert"].Properties, "id")
+	assert.NotContains(t, schemas, "countries.create")
+
+	upsert := doc.Paths["/users/_upsert"]["put"]
+	assert.Equal(t, []interface{}{dto.PrimaryIndexName, "email"}, upsert.Parameters[0].Schema.Enum)
+
+	limit := doc.Components.Parameters["limit"].Schema
+	assert.Equal(t, 5, limit.Default)
+	assert.Equal(t, 100, *limit.Maximum)
+}
+
+func TestGenerate_filterParameters(t *testing.T) {
+	doc := Generate(testSchema(), allFeatures)
+
+	var names []string
+	for _, p := range doc.Paths["/users"]["get"].Parameters {
+		if strings.HasPrefix(p.Ref, "#/components/parameters/users.score") {
+			names = append(names, doc.Components.Parameters[strings.TrimPrefix(p.Ref, "#/components/parameters/")].Name)
+		}
+	}
+	assert.Equal(t, []string{"score", "score[ne]", "score[lt]", "score[lte]", "score[gt]", "score[gte]"}, names)
+	assert.Contains(t, doc.Components.Parameters, "users.email.like")
+	assert.NotContains(t, doc.Components.Parameters, "users.password")
+}
+
+func TestGenerate_security(t *testing.T) {
+	doc := Generate(testSchema(), allFeatures)
+	assert.Empty(t, doc.Security)
+	assert.NotContains(t, doc.Paths["/users"]["get"].Responses, "401")
+
+	doc = Generate(testSchema(), Options{Auth: []string{AuthAPIKey, AuthBearer}, AllowAnonymous: true})
+	assert.Equal(t, []map[string][]string{{AuthAPIKey: {}}, {AuthBearer: {}}, {}}, doc.Security)
+	assert.Equal(t, "X-API-Key", doc.Components.SecuritySchemes[AuthAPIKey].Name)
+	assert.Equal(t, ref("responses", "Unauthorized"), doc.Paths["/users"]["get"].Responses["401"].Ref)
+}
+
+// все ссылки в документе должны вести на существующие компоненты
+func TestGenerate_refs(t *testing.T) {
+	doc := Generate(testSchema(), Options{Batch: true, Bulk: true, Upsert: true, History: true, Auth: []string{AuthBasic}})
+	data, err := json.Marshal(doc)
+	require.NoError(t, err)
+	var raw map[string]interface{}
+	require.NoError(t, json.Unmarshal(data, &raw))
+
+	var walk func(v interface{})
+	walk = func(v interface{}) {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			for k, child := range v {
+				if k != "$ref" {
+					walk(child)
+					continue
+				}
+				var target interface{} = raw
+				for _, part := range strings.Split(strings.TrimPrefix(child.(string), "#/"), "/") {
+					target = target.(map[string]interface{})[part]
+				}
+				assert.NotNil(t, target, child)
+			}
+		case []interface{}:
+			for _, child := range v {
+				walk(child)
+			}
+		}
+	}
+	walk(raw)
+}
@@ -0,0 +1,36 @@
+package openapi
+
+import "hw6coursera/dto"
+
+// JSONSchemaDialect - версия JSON Schema для схем таблиц, её же использует OpenAPI 3.1
+const JSONSchemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+// TableSchema - самостоятельный документ JSON Schema с колонками таблицы для генераторов форм
+// и валидаторов на клиенте. null допустим только в nullable колонках, обязательны колонки,
+// без которых запись не создать. Неизвестные поля сервис игнорирует, поэтому они не запрещены
+func TableSchema(t dto.Table) *Schema {
+	s := &Schema{
+		Schema:     JSONSchemaDialect,
+		Title:      t.Name,
+		Type:       "object",
+		Properties: make(map[string]*Schema, len(t.Columns)),
+	}
+	for _, c := range t.Columns {
+		property := valueSchema(c)
+		property.ReadOnly = c.IsPrimaryKey || c.ReadOnly
+		property.WriteOnly = c.WriteOnly
+		if c.Nullable {
+			if typeName, ok := property.Type.(string); ok {
+				property.Type = []string{typeName, "null"}
+			}
+			if len(property.Enum) > 0 {
+				property.Enum = append(property.Enum, nil)
+			}
+		}
+		s.Properties[c.Name] = property
+		if !c.Nullable && !property.ReadOnly {
+			s.Required = append(s.Required, c.Name)
+		}
+	}
+	return s
+}
@@ -0,0 +1,43 @@
+package openapi
+
+import (
+	"encoding/json"
+	"hw6coursera/dto"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTableSchema(t *testing.T) {
+	table := dto.Table{
+		Name: "items",
+		Columns: []dto.Column{
+			{Name: "id", ColumnType: dto.IntType, IsPrimaryKey: true, Generated: true},
+			{Name: "title", ColumnType: dto.StringType, MaxLength: 255},
+			{Name: "status", ColumnType: dto.StringType, Nullable: true, Enum: []string{"new", "sold"}},
+			{Name: "price", ColumnType: dto.FloatType, Nullable: true},
+			{Name: "total", ColumnType: dto.FloatType, Generated: true, ReadOnly: true},
+			{Name: "secret", ColumnType: dto.StringType, WriteOnly: true},
+			{Name: "payload", ColumnType: dto.UnknownType, Nullable: true},
+		},
+	}
+
+	data, err := json.Marshal(TableSchema(table))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"title": "items",
+		"type": "object",
+		"properties": {
+			"id": {"type": "integer", "format": "int64", "readOnly": true},
+			"title": {"type": "string", "maxLength": 255},
+			"status": {"type": ["string", "null"], "enum": ["new", "sold", null]},
+			"price": {"type": ["number", "null"], "format": "double"},
+			"total": {"type": "number", "format": "double", "readOnly": true},
+			"secret": {"type": "string", "writeOnly": true},
+			"payload": {}
+		},
+		"required": ["title", "secret"]
+	}`, string(data))
+}
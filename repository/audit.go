@@ -0,0 +1,215 @@
+package repository
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"hw6coursera/dto"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const auditTimeLayout = time.RFC3339Nano
+
+// auditTable хранит журнал в таблице той же базы. Пишем через переданный RecordManager,
+// поэтому запись журнала попадает в транзакцию изменения и откатывается вместе с ним
+type auditTable struct {
+	table   dto.Table
+	db      *sql.DB
+	dialect dialect
+}
+
+// NewAuditTable создаёт таблицу журнала, если её ещё нет. driver - как в NewRepositoryFor
+func NewAuditTable(db *sql.DB, driver string, name string) (AuditLog, error) {
+	d, err := getDialect(driver)
+	if err != nil {
+		return nil, err
+	}
+	for _, query := range d.auditTableDDL(name) {
+		if _, err := db.Exec(query); err != nil {
+			return nil, fmt.Errorf("unable to create audit table: %v", err)
+		}
+	}
+	return newAuditTable(db, d, name), nil
+}
+
+func newAuditTable(db *sql.DB, d dialect, name string) *auditTable {
+	return &auditTable{
+		db:      db,
+		dialect: d,
+		table: dto.Table{
+			Name: name,
+			Columns: []dto.Column{
+				{Name: "id", ColumnType: dto.IntType, IsPrimaryKey: true},
+				{Name: "table_name", ColumnType: dto.StringType},
+				{Name: "record_id", ColumnType: dto.IntType},
+				{Name: "operation", ColumnType: dto.StringType},
+				{Name: "actor", ColumnType: dto.StringType},
+				{Name: "created_at", ColumnType: dto.StringType},
+				{Name: "changes", ColumnType: dto.StringType},
+			},
+		},
+	}
+}
+
+// Write implements AuditLog
+func (a *auditTable) Write(rm RecordManager, entry dto.AuditEntry) error {
+	changes, err := json.Marshal(entry.Changes)
+	if err != nil {
+		return fmt.Errorf("unable to serialize changes: %v", err)
+	}
+	_, err = rm.Create(a.table, map[string]interface{}{
+		"table_name": entry.Table,
+		"record_id":  entry.RecordID,
+		"operation":  entry.Operation,
+		"actor":      entry.Actor,
+		"created_at": entry.Time.Format(auditTimeLayout),
+		"changes":    string(changes),
+	})
+	return err
+}
+
+// History implements AuditLog. RecordManager не задаёт порядок строк, поэтому журнал
+// читается своим запросом с сортировкой по id - в порядке записи
+func (a *auditTable) History(_ RecordManager, table string, recordId int) ([]dto.AuditEntry, error) {
+	filter := dto.Filter{
+		{Column: "table_name", Operator: dto.OpEq, Value: table},
+		{Column: "record_id", Operator: dto.OpEq, Value: recordId},
+	}
+	where, sqlVals, err := getWhereParams(a.dialect, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	queryString := fmt.Sprintf("SELECT %s FROM %s%s ORDER BY %s;",
+		getQueryFields(a.dialect, a.table), a.dialect.quote(a.table.Name), where, a.dialect.quote("id"))
+	rows, err := a.db.Query(a.dialect.rebind(queryString), sqlVals...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get audit entries due to error: %+v", err)
+	}
+	defer rows.Close()
+
+	entries := make([]dto.AuditEntry, 0)
+	dest := initScanDestination(a.table)
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		row, err := extractSqlVals(a.table, dest)
+		if err != nil {
+			return nil, err
+		}
+		entry, err := auditEntryFromRow(row)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// TableName implements AuditLog
+func (a *auditTable) TableName() string {
+	return a.table.Name
+}
+
+func auditEntryFromRow(row map[string]interface{}) (dto.AuditEntry, error) {
+	entry := dto.AuditEntry{
+		Table:     fmt.Sprint(row["table_name"]),
+		Operation: fmt.Sprint(row["operation"]),
+		Actor:     fmt.Sprint(row["actor"]),
+	}
+
+	// в зависимости от протокола драйвер отдаёт число или строку
+	recordId, err := strconv.Atoi(fmt.Sprint(row["record_id"]))
+	if err != nil {
+		return dto.AuditEntry{}, fmt.Errorf("invalid audit record id: %v", err)
+	}
+	entry.RecordID = recordId
+
+	if entry.Time, err = time.Parse(auditTimeLayout, fmt.Sprint(row["created_at"])); err != nil {
+		return dto.AuditEntry{}, fmt.Errorf("invalid audit time: %v", err)
+	}
+	if err := json.Unmarshal([]byte(fmt.Sprint(row["changes"])), &entry.Changes); err != nil {
+		return dto.AuditEntry{}, fmt.Errorf("invalid audit changes: %v", err)
+	}
+	return entry, nil
+}
+
+// auditFile хранит журнал в файле, по одной JSON-записи на строку.
+// Файл не участвует в транзакциях: запись в него идёт после изменения в базе
+type auditFile struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewAuditFile проверяет, что файл журнала можно открыть на дозапись
+func NewAuditFile(path string) (AuditLog, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open audit file: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+	return &auditFile{path: path}, nil
+}
+
+// Write implements AuditLog
+func (a *auditFile) Write(_ RecordManager, entry dto.AuditEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("unable to serialize audit entry: %v", err)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	f, err := os.OpenFile(a.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("unable to open audit file: %v", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("unable to write audit entry: %v", err)
+	}
+	return nil
+}
+
+// History implements AuditLog
+func (a *auditFile) History(_ RecordManager, table string, recordId int) ([]dto.AuditEntry, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	f, err := os.Open(a.path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open audit file: %v", err)
+	}
+	defer f.Close()
+
+	entries := make([]dto.AuditEntry, 0)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024) // строка журнала может быть длинной
+	for scanner.Scan() {
+		var entry dto.AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("invalid audit entry: %v", err)
+		}
+		if entry.Table == table && entry.RecordID == recordId {
+			entries = append(entries, entry)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("unable to read audit file: %v", err)
+	}
+	return entries, nil
+}
+
+// TableName implements AuditLog
+func (a *auditFile) TableName() string {
+	return ""
+}
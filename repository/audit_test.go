@@ -0,0 +1,73 @@
+package repository
+
+import (
+	"hw6coursera/dto"
+	"log"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+var testingAuditEntry = dto.AuditEntry{
+	Table:     "example_table_1",
+	RecordID:  3,
+	Operation: dto.AuditUpdate,
+	Actor:     "alice",
+	Time:      time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC),
+	Changes:   map[string]dto.Change{"name": {Old: "old", New: "new"}},
+}
+
+func TestAuditTable(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp)) //не требует полного совпадения запроса
+	if err != nil {
+		log.Fatalf("unable to mock db: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS `audit_log`").WillReturnResult(sqlmock.NewResult(0, 0))
+	audit, err := NewAuditTable(db, MySQL, "audit_log")
+	assert.NoError(t, err)
+	assert.Equal(t, "audit_log", audit.TableName())
+
+	rm := newRecordManager(db, mysqlDialect{})
+	changes := `{"name":{"old":"old","new":"new"}}`
+
+	mock.ExpectExec("INSERT INTO `audit_log` \\(`actor`, `changes`, `created_at`, `operation`, `record_id`, `table_name`\\)").
+		WithArgs("alice", changes, "2026-10-19T12:00:00Z", dto.AuditUpdate, 3, "example_table_1").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	assert.NoError(t, audit.Write(rm, testingAuditEntry))
+
+	rows := sqlmock.NewRows([]string{"id", "table_name", "record_id", "operation", "actor", "created_at", "changes"}).
+		AddRow(1, "example_table_1", 3, dto.AuditUpdate, "alice", "2026-10-19T12:00:00Z", changes)
+	mock.ExpectQuery("SELECT .* FROM `audit_log` WHERE `table_name` = \\? AND `record_id` = \\? ORDER BY `id`;").
+		WithArgs("example_table_1", 3).
+		WillReturnRows(rows)
+	entries, err := audit.History(rm, "example_table_1", 3)
+	assert.NoError(t, err)
+	assert.Equal(t, []dto.AuditEntry{testingAuditEntry}, entries)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAuditFile(t *testing.T) {
+	audit, err := NewAuditFile(filepath.Join(t.TempDir(), "audit.jsonl"))
+	assert.NoError(t, err)
+	assert.Equal(t, "", audit.TableName())
+
+	other := testingAuditEntry
+	other.RecordID = 4
+
+	assert.NoError(t, audit.Write(nil, testingAuditEntry))
+	assert.NoError(t, audit.Write(nil, other))
+
+	entries, err := audit.History(nil, "example_table_1", 3)
+	assert.NoError(t, err)
+	assert.Equal(t, []dto.AuditEntry{testingAuditEntry}, entries)
+
+	entries, err = audit.History(nil, "example_table_2", 3)
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+}
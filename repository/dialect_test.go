@@ -0,0 +1,178 @@
+package repository
+
+import (
+	"hw6coursera/dto"
+	"log"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_quote(t *testing.T) {
+	testCases := []struct {
+		name     string
+		dialect  dialect
+		ident    string
+		expected string
+	}{
+		{name: "mysql reserved word", dialect: mysqlDialect{}, ident: "order", expected: "`order`"},
+		{name: "mysql backtick", dialect: mysqlDialect{}, ident: "we`ird", expected: "`we``ird`"},
+		{name: "postgres space and dash", dialect: postgresDialect{}, ident: "my col-name", expected: `"my col-name"`},
+		{name: "postgres double quote", dialect: postgresDialect{}, ident: `we"ird`, expected: `"we""ird"`},
+		{name: "sqlite reserved word", dialect: sqliteDialect{}, ident: "key", expected: `"key"`},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, tc.dialect.quote(tc.ident))
+		})
+	}
+}
+
+func Test_rebindNumberedQuotedIdentifiers(t *testing.T) {
+	d := postgresDialect{}
+	query := "SELECT " + d.quote(`a"?`) + " FROM " + d.quote("t") + " WHERE " + d.quote("b") + " = ?"
+	assert.Equal(t, `SELECT "a""?" FROM "t" WHERE "b" = $1`, d.rebind(query))
+}
+
+func TestExplorer_reservedTableName(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		log.Fatalf("unable to mock db: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery("SHOW COLUMNS FROM `order` WHERE `Key` = 'PRI';").
+		WillReturnRows(sqlmock.NewRows([]string{"Field", "Type", "Null", "Key", "Default", "Extra"}).
+			AddRow("key", "int", "NO", "PRI", nil, "auto_increment"))
+
+	primaryKey, err := newExplorer(db).getPrimaryKeyFieldName("order")
+	assert.NoError(t, err)
+	assert.Equal(t, "key", primaryKey)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestExplorer_columnDetails(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
+	if err != nil {
+		log.Fatalf("unable to mock db: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery("FROM information_schema.COLUMNS").WithArgs("items").
+		WillReturnRows(sqlmock.NewRows([]string{"COLUMN_NAME", "DATA_TYPE", "COLUMN_TYPE", "CHARACTER_MAXIMUM_LENGTH", "EXTRA"}).
+			AddRow("id", "int", "int", nil, "auto_increment").
+			AddRow("title", "varchar", "varchar(255)", 255, "").
+			AddRow("body", "text", "text", 65535, "").
+			AddRow("status", "enum", "enum('new','it''s sold','a,b')", 9, "").
+			AddRow("total", "int", "int", nil, "VIRTUAL GENERATED").
+			AddRow("updated", "timestamp", "timestamp", nil, "DEFAULT_GENERATED on update CURRENT_TIMESTAMP"))
+
+	details, err := newExplorer(db).getColumnDetails("items")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]dto.Column{
+		"id":      {Name: "id", Generated: true},
+		"title":   {Name: "title", MaxLength: 255},
+		"body":    {Name: "body"},
+		"status":  {Name: "status", Enum: []string{"new", "it's sold", "a,b"}},
+		"total":   {Name: "total", Generated: true},
+		"updated": {Name: "updated"},
+	}, details)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestExplorer_foreignKeys(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
+	if err != nil {
+		log.Fatalf("unable to mock db: %v", err)
+	}
+	defer db.Close()
+	e := newExplorer(db)
+
+	mock.ExpectQuery("FROM information_schema.KEY_COLUMN_USAGE").WithArgs("items").
+		WillReturnRows(sqlmock.NewRows([]string{"CONSTRAINT_NAME", "COLUMN_NAME", "REFERENCED_TABLE_NAME", "REFERENCED_COLUMN_NAME"}).
+			AddRow("items_ibfk_1", "owner_id", "users", "id").
+			AddRow("items_ibfk_2", "a", "pairs", "x").
+			AddRow("items_ibfk_2", "b", "pairs", "y"))
+	foreignKeys, err := e.GetForeignKeys("items")
+	assert.NoError(t, err)
+	assert.Equal(t, []dto.ForeignKey{
+		{Name: "items_ibfk_1", Columns: []string{"owner_id"}, RefTable: "users", RefColumns: []string{"id"}},
+		{Name: "items_ibfk_2", Columns: []string{"a", "b"}, RefTable: "pairs", RefColumns: []string{"x", "y"}},
+	}, foreignKeys)
+
+	mock.ExpectQuery("FROM information_schema.TABLES").WithArgs("items").
+		WillReturnRows(sqlmock.NewRows([]string{"TABLE_ROWS"}).AddRow(42))
+	estimate, err := e.EstimateRows("items")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(42), estimate)
+
+	mock.ExpectQuery("FROM information_schema.TABLES").WithArgs("items_view").
+		WillReturnRows(sqlmock.NewRows([]string{"TABLE_ROWS"}).AddRow(nil))
+	estimate, err = e.EstimateRows("items_view")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(-1), estimate)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// Все запросы на настоящей базе, имена таблицы и колонок - ключевые слова и имена с пробелами
+func TestSqlite_unusualNames(t *testing.T) {
+	db, driver, err := Open("sqlite://:memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mustExec(t, db, `CREATE TABLE "order" (
+		"key" INTEGER PRIMARY KEY AUTOINCREMENT,
+		"select" VARCHAR(255) NOT NULL UNIQUE,
+		"my column" TEXT,
+		"dash-name" INT
+	);`)
+
+	repo, err := NewRepositoryFor(db, driver)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	columns, err := repo.GetColumns("order")
+	assert.NoError(t, err)
+	table := dto.Table{Name: "order", Columns: columns}
+
+	id, err := repo.Create(table, map[string]interface{}{"select": "first", "my column": "value", "dash-name": 1})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, id)
+
+	assert.NoError(t, repo.UpdateById(table, "key", id, map[string]interface{}{"dash-name": 2}))
+
+	id, created, err := repo.Upsert(table, "key", []string{"select"}, map[string]interface{}{"select": "first", "my column": "upserted"})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, id)
+	assert.False(t, created)
+
+	records, err := repo.GetAllRecords(table, dto.Filter{{Column: "dash-name", Operator: dto.OpGte, Value: 2}}, 5, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, []map[string]interface{}{{"key": int64(1), "select": "first", "my column": "upserted", "dash-name": int64(2)}}, records)
+
+	count, err := repo.CountRecords(table, dto.Filter{{Column: "my column", Operator: dto.OpNe, Value: nil}})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	affected, err := repo.UpdateByFilter(table, dto.Filter{{Column: "select", Operator: dto.OpLike, Value: "f%"}}, map[string]interface{}{"my column": nil})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, affected)
+
+	err = repo.InTx(func(tx RecordManager) error {
+		_, err := tx.GetByIdForUpdate(table, "key", 1)
+		return err
+	})
+	assert.NoError(t, err)
+
+	affected, err = repo.DeleteByFilter(table, dto.Filter{{Column: "my column", Operator: dto.OpEq, Value: nil}})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, affected)
+
+	_, err = repo.GetById(table, "key", 1)
+	assert.Equal(t, ErrRowNotFound, err)
+}
@@ -2,19 +2,25 @@ package repository
 
 import (
 	"database/sql"
-	"errors"
 	"fmt"
 	"hw6coursera/dto"
+	"regexp"
+	"strconv"
 	"strings"
 )
 
+var (
+	enumValuePattern  = regexp.MustCompile(`'((?:[^']|'')*)'`)
+	typeLengthPattern = regexp.MustCompile(`\((\d+)\)`)
+)
+
 type dbExplorer struct {
 	db *sql.DB
 }
 
 // GetColumns implements Explorer
 func (e *dbExplorer) GetColumns(tableName string) ([]dto.Column, error) {
-	rows, err := e.db.Query(fmt.Sprintf("SELECT * FROM `%s` LIMIT 1", tableName))
+	rows, err := e.db.Query(fmt.Sprintf("SELECT * FROM %s LIMIT 1", mysqlDialect{}.quote(tableName)))
 	if err != nil {
 		return nil, err
 	}
@@ -40,7 +46,7 @@ func (e *dbExplorer) GetColumns(tableName string) ([]dto.Column, error) {
 		}
 		nullable, ok := ct.Nullable()
 		if !ok {
-			return nil, errors.New("shitty driver")
+			return nil, fmt.Errorf("driver does not report nullability of column %s", col.Name)
 		}
 		col.Nullable = nullable
 		typeName := ct.DatabaseTypeName() // "VARCHAR", "TEXT", "NVARCHAR", "DECIMAL", "INT", "BIGINT" ...
@@ -56,6 +62,20 @@ func (e *dbExplorer) GetColumns(tableName string) ([]dto.Column, error) {
 		}
 		columns = append(columns, col)
 	}
+
+	details, err := e.getColumnDetails(tableName)
+	if err != nil {
+		return nil, err
+	}
+	for i := range columns {
+		d := details[columns[i].Name]
+		columns[i].Generated = d.Generated
+		columns[i].MaxLength = d.MaxLength
+		if len(d.Enum) > 0 {
+			columns[i].ColumnType = dto.StringType
+			columns[i].Enum = d.Enum
+		}
+	}
 	return columns, nil
 }
 
@@ -79,6 +99,134 @@ func (e *dbExplorer) GetTableNames() ([]string, error) {
 	return tableNames, nil
 }
 
+// GetIndexes implements Explorer
+func (e *dbExplorer) GetIndexes(tableName string) ([]dto.Index, error) {
+	rows, err := e.db.Query(`SELECT INDEX_NAME, NON_UNIQUE, COLUMN_NAME FROM information_schema.STATISTICS
+		WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? ORDER BY INDEX_NAME, SEQ_IN_INDEX`, tableName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// колонки составного индекса идут подряд, поэтому достаточно сравнивать с последним индексом
+	indexes := make([]dto.Index, 0)
+	for rows.Next() {
+		var name, column string
+		var nonUnique int
+		if err := rows.Scan(&name, &nonUnique, &column); err != nil {
+			return nil, err
+		}
+		if len(indexes) == 0 || indexes[len(indexes)-1].Name != name {
+			indexes = append(indexes, dto.Index{Name: name, Unique: nonUnique == 0})
+		}
+		last := &indexes[len(indexes)-1]
+		last.Columns = append(last.Columns, column)
+	}
+	return indexes, rows.Err()
+}
+
+// GetForeignKeys implements Explorer
+func (e *dbExplorer) GetForeignKeys(tableName string) ([]dto.ForeignKey, error) {
+	rows, err := e.db.Query(`SELECT CONSTRAINT_NAME, COLUMN_NAME, REFERENCED_TABLE_NAME, REFERENCED_COLUMN_NAME
+		FROM information_schema.KEY_COLUMN_USAGE
+		WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND REFERENCED_TABLE_NAME IS NOT NULL
+		ORDER BY CONSTRAINT_NAME, ORDINAL_POSITION`, tableName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanForeignKeys(rows)
+}
+
+// EstimateRows implements Explorer
+func (e *dbExplorer) EstimateRows(tableName string) (int64, error) {
+	// TABLE_ROWS для InnoDB - оценка по статистике, для VIEW - NULL
+	var estimate sql.NullInt64
+	err := e.db.QueryRow(`SELECT TABLE_ROWS FROM information_schema.TABLES
+		WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ?`, tableName).Scan(&estimate)
+	if err != nil {
+		return 0, err
+	}
+	if !estimate.Valid {
+		return -1, nil
+	}
+	return estimate.Int64, nil
+}
+
+// scanForeignKeys собирает внешние ключи из строк (имя ключа, колонка, таблица, колонка в ней),
+// колонки составного ключа должны идти подряд и по порядку
+func scanForeignKeys(rows *sql.Rows) ([]dto.ForeignKey, error) {
+	fks := make([]dto.ForeignKey, 0)
+	for rows.Next() {
+		var name, column, refTable, refColumn string
+		if err := rows.Scan(&name, &column, &refTable, &refColumn); err != nil {
+			return nil, err
+		}
+		if len(fks) == 0 || fks[len(fks)-1].Name != name {
+			fks = append(fks, dto.ForeignKey{Name: name, RefTable: refTable})
+		}
+		last := &fks[len(fks)-1]
+		last.Columns = append(last.Columns, column)
+		last.RefColumns = append(last.RefColumns, refColumn)
+	}
+	return fks, rows.Err()
+}
+
+// getColumnDetails - то, чего нет в sql.ColumnType: длина строк, значения ENUM и вычисляемые колонки
+func (e *dbExplorer) getColumnDetails(tableName string) (map[string]dto.Column, error) {
+	rows, err := e.db.Query(`SELECT COLUMN_NAME, DATA_TYPE, COLUMN_TYPE, CHARACTER_MAXIMUM_LENGTH, EXTRA
+		FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ?`, tableName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	details := make(map[string]dto.Column)
+	for rows.Next() {
+		var name, dataType, columnType, extra string
+		var maxLength sql.NullInt64
+		if err := rows.Scan(&name, &dataType, &columnType, &maxLength, &extra); err != nil {
+			return nil, err
+		}
+		// EXTRA: auto_increment, VIRTUAL GENERATED, STORED GENERATED, но DEFAULT_GENERATED - это просто значение по умолчанию
+		col := dto.Column{
+			Name:      name,
+			Generated: strings.Contains(extra, "auto_increment") || strings.Contains(extra, "VIRTUAL GENERATED") || strings.Contains(extra, "STORED GENERATED"),
+		}
+		switch strings.ToLower(dataType) {
+		case "char", "varchar":
+			col.MaxLength = int(maxLength.Int64)
+		case "enum":
+			col.Enum = parseEnumValues(columnType)
+		}
+		details[name] = col
+	}
+	return details, rows.Err()
+}
+
+// `enum('a','it”s')` -> [a it's]
+func parseEnumValues(columnType string) []string {
+	matches := enumValuePattern.FindAllStringSubmatch(columnType, -1)
+	values := make([]string, 0, len(matches))
+	for _, m := range matches {
+		values = append(values, strings.ReplaceAll(m[1], "''", "'"))
+	}
+	return values
+}
+
+// charLength - n из объявленного типа CHAR(n), VARCHAR(n), character varying(n)
+func charLength(typeName string) int {
+	if !strings.Contains(strings.ToUpper(typeName), "CHAR") {
+		return 0
+	}
+	m := typeLengthPattern.FindStringSubmatch(typeName)
+	if m == nil {
+		return 0
+	}
+	n, _ := strconv.Atoi(m[1])
+	return n
+}
+
 func newExplorer(db *sql.DB) *dbExplorer {
 	return &dbExplorer{
 		db: db,
@@ -94,7 +242,7 @@ func (e *dbExplorer) getPrimaryKeyFieldName(tableName string) (string, error) {
 	//	+-------+------+------+-----+---------+----------------+
 	//	| id    | int  | NO   | PRI | NULL    | auto_increment |
 	//	+-------+------+------+-----+---------+----------------+
-	row := e.db.QueryRow(fmt.Sprintf("SHOW COLUMNS FROM %s WHERE `Key` = 'PRI';", tableName))
+	row := e.db.QueryRow(fmt.Sprintf("SHOW COLUMNS FROM %s WHERE `Key` = 'PRI';", mysqlDialect{}.quote(tableName)))
 	if err := row.Err(); err != nil {
 		return "", err
 	}
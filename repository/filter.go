@@ -0,0 +1,49 @@
+package repository
+
+import (
+	"fmt"
+	"hw6coursera/dto"
+	"strings"
+)
+
+var sqlOperators = map[string]string{
+	dto.OpEq:   "=",
+	dto.OpNe:   "<>",
+	dto.OpLt:   "<",
+	dto.OpLte:  "<=",
+	dto.OpGt:   ">",
+	dto.OpGte:  ">=",
+	dto.OpLike: "LIKE",
+}
+
+// getWhereParams собирает условие WHERE (вместе с самим словом WHERE) и значения для плейсхолдеров.
+// Для пустого фильтра возвращает пустую строку
+func getWhereParams(d dialect, filter dto.Filter) (whereStr string, data []interface{}, err error) {
+	if len(filter) == 0 {
+		return "", nil, nil
+	}
+
+	conditions := make([]string, 0, len(filter))
+	output := make([]interface{}, 0, len(filter))
+	for _, c := range filter {
+		if c.Value == nil { // с null сравниваем только через IS
+			switch c.Operator {
+			case dto.OpEq:
+				conditions = append(conditions, fmt.Sprintf("%s IS NULL", d.quote(c.Column)))
+			case dto.OpNe:
+				conditions = append(conditions, fmt.Sprintf("%s IS NOT NULL", d.quote(c.Column)))
+			default:
+				return "", nil, fmt.Errorf("operator %s cannot be applied to null", c.Operator)
+			}
+			continue
+		}
+
+		op, ok := sqlOperators[c.Operator]
+		if !ok {
+			return "", nil, fmt.Errorf("unknown operator %s", c.Operator)
+		}
+		conditions = append(conditions, fmt.Sprintf("%s %s ?", d.quote(c.Column), op))
+		output = append(output, c.Value)
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), output, nil
+}
@@ -0,0 +1,138 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"hw6coursera/dto"
+	"hw6coursera/metrics"
+	"time"
+)
+
+// Instrument подменяет RecordManager и Explorer репозитория обёртками, которые замеряют время
+// и ошибки каждой операции. Операции внутри InTx замеряются по отдельности и ещё раз все вместе (tx)
+func Instrument(repo *Repository, m *metrics.Metrics) {
+	repo.RecordManager = &instrumentedRecords{next: repo.RecordManager, m: m}
+	repo.Explorer = &instrumentedExplorer{next: repo.Explorer, m: m}
+}
+
+// observe записывает время операции, начатой в start; ненайденная запись - не ошибка
+func observe(m *metrics.Metrics, operation string, start time.Time, err error) {
+	m.QueryDuration.Observe(time.Since(start).Seconds(), operation)
+	if err != nil && !errors.Is(err, ErrRowNotFound) {
+		m.QueryErrors.Inc(operation)
+	}
+}
+
+type instrumentedRecords struct {
+	next RecordManager
+	m    *metrics.Metrics
+}
+
+// GetAllRecords implements RecordManager
+func (r *instrumentedRecords) GetAllRecords(table dto.Table, filter dto.Filter, limit int, offset int) (data []map[string]interface{}, err error) {
+	defer func(start time.Time) { observe(r.m, "get_all_records", start, err) }(time.Now())
+	return r.next.GetAllRecords(table, filter, limit, offset)
+}
+
+// CountRecords implements RecordManager
+func (r *instrumentedRecords) CountRecords(table dto.Table, filter dto.Filter) (count int, err error) {
+	defer func(start time.Time) { observe(r.m, "count_records", start, err) }(time.Now())
+	return r.next.CountRecords(table, filter)
+}
+
+// EachRecord implements RecordManager. Время включает обработку записей в fn
+func (r *instrumentedRecords) EachRecord(ctx context.Context, table dto.Table, filter dto.Filter, fn func(record map[string]interface{}) error) (err error) {
+	defer func(start time.Time) { observe(r.m, "each_record", start, err) }(time.Now())
+	return r.next.EachRecord(ctx, table, filter, fn)
+}
+
+// GetById implements RecordManager
+func (r *instrumentedRecords) GetById(table dto.Table, primaryKey string, id int) (data map[string]interface{}, err error) {
+	defer func(start time.Time) { observe(r.m, "get_by_id", start, err) }(time.Now())
+	return r.next.GetById(table, primaryKey, id)
+}
+
+// GetByIdForUpdate implements RecordManager
+func (r *instrumentedRecords) GetByIdForUpdate(table dto.Table, primaryKey string, id int) (data map[string]interface{}, err error) {
+	defer func(start time.Time) { observe(r.m, "get_by_id_for_update", start, err) }(time.Now())
+	return r.next.GetByIdForUpdate(table, primaryKey, id)
+}
+
+// Create implements RecordManager
+func (r *instrumentedRecords) Create(table dto.Table, data map[string]interface{}) (lastInsertedId int, err error) {
+	defer func(start time.Time) { observe(r.m, "create", start, err) }(time.Now())
+	return r.next.Create(table, data)
+}
+
+// Upsert implements RecordManager
+func (r *instrumentedRecords) Upsert(table dto.Table, primaryKey string, keyColumns []string, data map[string]interface{}) (id int, created bool, err error) {
+	defer func(start time.Time) { observe(r.m, "upsert", start, err) }(time.Now())
+	return r.next.Upsert(table, primaryKey, keyColumns, data)
+}
+
+// UpdateById implements RecordManager
+func (r *instrumentedRecords) UpdateById(table dto.Table, primaryKey string, id int, data map[string]interface{}) (err error) {
+	defer func(start time.Time) { observe(r.m, "update_by_id", start, err) }(time.Now())
+	return r.next.UpdateById(table, primaryKey, id, data)
+}
+
+// DeleteById implements RecordManager
+func (r *instrumentedRecords) DeleteById(table dto.Table, primaryKey string, id int) (err error) {
+	defer func(start time.Time) { observe(r.m, "delete_by_id", start, err) }(time.Now())
+	return r.next.DeleteById(table, primaryKey, id)
+}
+
+// UpdateByFilter implements RecordManager
+func (r *instrumentedRecords) UpdateByFilter(table dto.Table, filter dto.Filter, data map[string]interface{}) (rowsAffected int, err error) {
+	defer func(start time.Time) { observe(r.m, "update_by_filter", start, err) }(time.Now())
+	return r.next.UpdateByFilter(table, filter, data)
+}
+
+// DeleteByFilter implements RecordManager
+func (r *instrumentedRecords) DeleteByFilter(table dto.Table, filter dto.Filter) (rowsAffected int, err error) {
+	defer func(start time.Time) { observe(r.m, "delete_by_filter", start, err) }(time.Now())
+	return r.next.DeleteByFilter(table, filter)
+}
+
+// InTx implements RecordManager
+func (r *instrumentedRecords) InTx(fn func(tx RecordManager) error) (err error) {
+	defer func(start time.Time) { observe(r.m, "tx", start, err) }(time.Now())
+	return r.next.InTx(func(tx RecordManager) error {
+		return fn(&instrumentedRecords{next: tx, m: r.m})
+	})
+}
+
+type instrumentedExplorer struct {
+	next Explorer
+	m    *metrics.Metrics
+}
+
+// GetTableNames implements Explorer
+func (e *instrumentedExplorer) GetTableNames() (names []string, err error) {
+	defer func(start time.Time) { observe(e.m, "get_table_names", start, err) }(time.Now())
+	return e.next.GetTableNames()
+}
+
+// GetColumns implements Explorer
+func (e *instrumentedExplorer) GetColumns(tableName string) (columns []dto.Column, err error) {
+	defer func(start time.Time) { observe(e.m, "get_columns", start, err) }(time.Now())
+	return e.next.GetColumns(tableName)
+}
+
+// GetIndexes implements Explorer
+func (e *instrumentedExplorer) GetIndexes(tableName string) (indexes []dto.Index, err error) {
+	defer func(start time.Time) { observe(e.m, "get_indexes", start, err) }(time.Now())
+	return e.next.GetIndexes(tableName)
+}
+
+// GetForeignKeys implements Explorer
+func (e *instrumentedExplorer) GetForeignKeys(tableName string) (keys []dto.ForeignKey, err error) {
+	defer func(start time.Time) { observe(e.m, "get_foreign_keys", start, err) }(time.Now())
+	return e.next.GetForeignKeys(tableName)
+}
+
+// EstimateRows implements Explorer
+func (e *instrumentedExplorer) EstimateRows(tableName string) (rows int64, err error) {
+	defer func(start time.Time) { observe(e.m, "estimate_rows", start, err) }(time.Now())
+	return e.next.EstimateRows(tableName)
+}
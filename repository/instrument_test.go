@@ -0,0 +1,51 @@
+package repository
+
+import (
+	"fmt"
+	"hw6coursera/metrics"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInstrument(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
+	require.NoError(t, err)
+	defer db.Close()
+
+	m := metrics.New()
+	repo := &Repository{RecordManager: newRecordManager(db, mysqlDialect{}), Explorer: newExplorer(db)}
+	Instrument(repo, m)
+	table := testingSchema["example_table_1"]
+
+	// запись не найдена - не ошибка базы
+	mock.ExpectExec("DELETE FROM").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 0))
+	assert.ErrorIs(t, repo.DeleteById(table, "primary_key", 1), ErrRowNotFound)
+
+	mock.ExpectExec("DELETE FROM").WithArgs(2).WillReturnError(fmt.Errorf("db error"))
+	assert.Error(t, repo.DeleteById(table, "primary_key", 2))
+
+	// операции в транзакции замеряются по отдельности и вместе
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO").WithArgs("name value").WillReturnResult(sqlmock.NewResult(5, 1))
+	mock.ExpectCommit()
+	err = repo.InTx(func(tx RecordManager) error {
+		_, err := tx.Create(table, map[string]interface{}{"name": "name value"})
+		return err
+	})
+	require.NoError(t, err)
+
+	mock.ExpectQuery("SHOW TABLES").WillReturnError(fmt.Errorf("db error"))
+	_, err = repo.GetTableNames()
+	assert.Error(t, err)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+	assert.Equal(t, uint64(2), m.QueryDuration.Count("delete_by_id"))
+	assert.Equal(t, float64(1), m.QueryErrors.Value("delete_by_id"))
+	assert.Equal(t, uint64(1), m.QueryDuration.Count("tx"))
+	assert.Equal(t, uint64(1), m.QueryDuration.Count("create"))
+	assert.Equal(t, float64(0), m.QueryErrors.Value("create"))
+	assert.Equal(t, float64(1), m.QueryErrors.Value("get_table_names"))
+}
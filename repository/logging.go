@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"hw6coursera/logging"
+	"time"
+)
+
+// loggable - менеджер записей, который умеет писать в логгер запроса
+type loggable interface {
+	withLogger(l *logging.Logger) RecordManager
+}
+
+// WithLogger - rm, который пишет предупреждения и запросы (если включено LogSQL) в l, так в них
+// попадает request_id. Менеджеры, которые не умеют логировать (моки в тестах), возвращаются как есть
+func WithLogger(rm RecordManager, l *logging.Logger) RecordManager {
+	if lm, ok := rm.(loggable); ok {
+		return lm.withLogger(l)
+	}
+	return rm
+}
+
+// LogSQL включает запись каждого запроса менеджера записей в лог. Значения аргументов
+// в лог не попадают, только их типы. Вызывается до Instrument
+func (r *Repository) LogSQL() {
+	if rm, ok := r.RecordManager.(*recordManager); ok {
+		rm.logSQL = true
+	}
+}
+
+func (rm *recordManager) withLogger(l *logging.Logger) RecordManager {
+	cp := *rm
+	cp.log = l
+	return &cp
+}
+
+func (r *instrumentedRecords) withLogger(l *logging.Logger) RecordManager {
+	return &instrumentedRecords{next: WithLogger(r.next, l), m: r.m}
+}
+
+func (rm *recordManager) logger() *logging.Logger {
+	if rm.log != nil {
+		return rm.log
+	}
+	return logging.Default()
+}
+
+// querier - соединение или транзакция, с LogSQL - с записью запросов в лог
+func (rm *recordManager) querier() querier {
+	if !rm.logSQL {
+		return rm.db
+	}
+	return &sqlLogger{next: rm.db, l: rm.logger()}
+}
+
+type sqlLogger struct {
+	next querier
+	l    *logging.Logger
+}
+
+func (q *sqlLogger) Exec(query string, args ...interface{}) (sql.Result, error) {
+	defer q.log(query, args, time.Now())
+	return q.next.Exec(query, args...)
+}
+
+func (q *sqlLogger) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	defer q.log(query, args, time.Now())
+	return q.next.Query(query, args...)
+}
+
+func (q *sqlLogger) QueryRow(query string, args ...interface{}) *sql.Row {
+	defer q.log(query, args, time.Now())
+	return q.next.QueryRow(query, args...)
+}
+
+func (q *sqlLogger) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	defer q.log(query, args, time.Now())
+	return q.next.QueryContext(ctx, query, args...)
+}
+
+func (q *sqlLogger) log(query string, args []interface{}, start time.Time) {
+	q.l.Info("sql", "query", query, "args", redactArgs(args), "duration", time.Since(start))
+}
+
+// redactArgs - типы аргументов вместо значений: в значениях бывают пароли и личные данные
+func redactArgs(args []interface{}) []string {
+	types := make([]string, len(args))
+	for i, arg := range args {
+		if arg == nil {
+			types[i] = "NULL"
+			continue
+		}
+		types[i] = fmt.Sprintf("%T", arg)
+	}
+	return types
+}
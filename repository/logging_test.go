@@ -0,0 +1,46 @@
+package repository
+
+import (
+	"bytes"
+	"hw6coursera/logging"
+	"hw6coursera/metrics"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogSQL(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
+	require.NoError(t, err)
+	defer db.Close()
+
+	var buf bytes.Buffer
+	l, err := logging.New(&buf, logging.Options{})
+	require.NoError(t, err)
+
+	repo := &Repository{RecordManager: newRecordManager(db, mysqlDialect{}), Explorer: newExplorer(db)}
+	repo.LogSQL()
+	Instrument(repo, metrics.New())
+	rm := WithLogger(repo.RecordManager, l.With("request_id", "abc"))
+	table := testingSchema["example_table_1"]
+
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO").WithArgs("s3cr3t").WillReturnResult(sqlmock.NewResult(5, 1))
+	mock.ExpectCommit()
+	err = rm.InTx(func(tx RecordManager) error {
+		_, err := tx.Create(table, map[string]interface{}{"name": "s3cr3t"})
+		return err
+	})
+	require.NoError(t, err)
+
+	mock.ExpectExec("DELETE FROM").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 0))
+	assert.ErrorIs(t, rm.DeleteById(table, "primary_key", 1), ErrRowNotFound)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+	out := buf.String()
+	assert.Contains(t, out, "msg=sql request_id=abc query=\"INSERT INTO `example_table_1` (`name`) VALUES (?);\" args=[string]")
+	assert.Contains(t, out, "msg=sql request_id=abc query=\"DELETE FROM `example_table_1` WHERE `primary_key` = ?;\" args=[int]")
+	assert.NotContains(t, out, "s3cr3t") // значения аргументов в лог не попадают
+}
@@ -5,6 +5,7 @@
 package repository
 
 import (
+	context "context"
 	dto "hw6coursera/dto"
 	reflect "reflect"
 
@@ -34,6 +35,21 @@ func (m *MockExplorer) EXPECT() *MockExplorerMockRecorder {
 	return m.recorder
 }
 
+// EstimateRows mocks base method.
+func (m *MockExplorer) EstimateRows(tableName string) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "EstimateRows", tableName)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// EstimateRows indicates an expected call of EstimateRows.
+func (mr *MockExplorerMockRecorder) EstimateRows(tableName interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EstimateRows", reflect.TypeOf((*MockExplorer)(nil).EstimateRows), tableName)
+}
+
 // GetColumns mocks base method.
 func (m *MockExplorer) GetColumns(tableName string) ([]dto.Column, error) {
 	m.ctrl.T.Helper()
@@ -49,6 +65,36 @@ func (mr *MockExplorerMockRecorder) GetColumns(tableName interface{}) *gomock.Ca
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetColumns", reflect.TypeOf((*MockExplorer)(nil).GetColumns), tableName)
 }
 
+// GetForeignKeys mocks base method.
+func (m *MockExplorer) GetForeignKeys(tableName string) ([]dto.ForeignKey, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetForeignKeys", tableName)
+	ret0, _ := ret[0].([]dto.ForeignKey)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetForeignKeys indicates an expected call of GetForeignKeys.
+func (mr *MockExplorerMockRecorder) GetForeignKeys(tableName interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetForeignKeys", reflect.TypeOf((*MockExplorer)(nil).GetForeignKeys), tableName)
+}
+
+// GetIndexes mocks base method.
+func (m *MockExplorer) GetIndexes(tableName string) ([]dto.Index, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetIndexes", tableName)
+	ret0, _ := ret[0].([]dto.Index)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetIndexes indicates an expected call of GetIndexes.
+func (mr *MockExplorerMockRecorder) GetIndexes(tableName interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetIndexes", reflect.TypeOf((*MockExplorer)(nil).GetIndexes), tableName)
+}
+
 // GetTableNames mocks base method.
 func (m *MockExplorer) GetTableNames() ([]string, error) {
 	m.ctrl.T.Helper()
@@ -87,6 +133,21 @@ func (m *MockRecordManager) EXPECT() *MockRecordManagerMockRecorder {
 	return m.recorder
 }
 
+// CountRecords mocks base method.
+func (m *MockRecordManager) CountRecords(table dto.Table, filter dto.Filter) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CountRecords", table, filter)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CountRecords indicates an expected call of CountRecords.
+func (mr *MockRecordManagerMockRecorder) CountRecords(table, filter interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CountRecords", reflect.TypeOf((*MockRecordManager)(nil).CountRecords), table, filter)
+}
+
 // Create mocks base method.
 func (m *MockRecordManager) Create(table dto.Table, data map[string]interface{}) (int, error) {
 	m.ctrl.T.Helper()
@@ -102,6 +163,21 @@ func (mr *MockRecordManagerMockRecorder) Create(table, data interface{}) *gomock
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Create", reflect.TypeOf((*MockRecordManager)(nil).Create), table, data)
 }
 
+// DeleteByFilter mocks base method.
+func (m *MockRecordManager) DeleteByFilter(table dto.Table, filter dto.Filter) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteByFilter", table, filter)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteByFilter indicates an expected call of DeleteByFilter.
+func (mr *MockRecordManagerMockRecorder) DeleteByFilter(table, filter interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteByFilter", reflect.TypeOf((*MockRecordManager)(nil).DeleteByFilter), table, filter)
+}
+
 // DeleteById mocks base method.
 func (m *MockRecordManager) DeleteById(table dto.Table, primaryKey string, id int) error {
 	m.ctrl.T.Helper()
@@ -116,19 +192,33 @@ func (mr *MockRecordManagerMockRecorder) DeleteById(table, primaryKey, id interf
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteById", reflect.TypeOf((*MockRecordManager)(nil).DeleteById), table, primaryKey, id)
 }
 
+// EachRecord mocks base method.
+func (m *MockRecordManager) EachRecord(ctx context.Context, table dto.Table, filter dto.Filter, fn func(map[string]interface{}) error) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "EachRecord", ctx, table, filter, fn)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// EachRecord indicates an expected call of EachRecord.
+func (mr *MockRecordManagerMockRecorder) EachRecord(ctx, table, filter, fn interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EachRecord", reflect.TypeOf((*MockRecordManager)(nil).EachRecord), ctx, table, filter, fn)
+}
+
 // GetAllRecords mocks base method.
-func (m *MockRecordManager) GetAllRecords(table dto.Table, limit, offset int) ([]map[string]interface{}, error) {
+func (m *MockRecordManager) GetAllRecords(table dto.Table, filter dto.Filter, limit, offset int) ([]map[string]interface{}, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetAllRecords", table, limit, offset)
+	ret := m.ctrl.Call(m, "GetAllRecords", table, filter, limit, offset)
 	ret0, _ := ret[0].([]map[string]interface{})
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetAllRecords indicates an expected call of GetAllRecords.
-func (mr *MockRecordManagerMockRecorder) GetAllRecords(table, limit, offset interface{}) *gomock.Call {
+func (mr *MockRecordManagerMockRecorder) GetAllRecords(table, filter, limit, offset interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAllRecords", reflect.TypeOf((*MockRecordManager)(nil).GetAllRecords), table, limit, offset)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAllRecords", reflect.TypeOf((*MockRecordManager)(nil).GetAllRecords), table, filter, limit, offset)
 }
 
 // GetById mocks base method.
@@ -146,6 +236,50 @@ func (mr *MockRecordManagerMockRecorder) GetById(table, primaryKey, id interface
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetById", reflect.TypeOf((*MockRecordManager)(nil).GetById), table, primaryKey, id)
 }
 
+// GetByIdForUpdate mocks base method.
+func (m *MockRecordManager) GetByIdForUpdate(table dto.Table, primaryKey string, id int) (map[string]interface{}, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetByIdForUpdate", table, primaryKey, id)
+	ret0, _ := ret[0].(map[string]interface{})
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetByIdForUpdate indicates an expected call of GetByIdForUpdate.
+func (mr *MockRecordManagerMockRecorder) GetByIdForUpdate(table, primaryKey, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetByIdForUpdate", reflect.TypeOf((*MockRecordManager)(nil).GetByIdForUpdate), table, primaryKey, id)
+}
+
+// InTx mocks base method.
+func (m *MockRecordManager) InTx(fn func(RecordManager) error) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "InTx", fn)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// InTx indicates an expected call of InTx.
+func (mr *MockRecordManagerMockRecorder) InTx(fn interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InTx", reflect.TypeOf((*MockRecordManager)(nil).InTx), fn)
+}
+
+// UpdateByFilter mocks base method.
+func (m *MockRecordManager) UpdateByFilter(table dto.Table, filter dto.Filter, data map[string]interface{}) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateByFilter", table, filter, data)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UpdateByFilter indicates an expected call of UpdateByFilter.
+func (mr *MockRecordManagerMockRecorder) UpdateByFilter(table, filter, data interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateByFilter", reflect.TypeOf((*MockRecordManager)(nil).UpdateByFilter), table, filter, data)
+}
+
 // UpdateById mocks base method.
 func (m *MockRecordManager) UpdateById(table dto.Table, primaryKey string, id int, data map[string]interface{}) error {
 	m.ctrl.T.Helper()
@@ -159,3 +293,85 @@ func (mr *MockRecordManagerMockRecorder) UpdateById(table, primaryKey, id, data
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateById", reflect.TypeOf((*MockRecordManager)(nil).UpdateById), table, primaryKey, id, data)
 }
+
+// Upsert mocks base method.
+func (m *MockRecordManager) Upsert(table dto.Table, primaryKey string, keyColumns []string, data map[string]interface{}) (int, bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Upsert", table, primaryKey, keyColumns, data)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(bool)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// Upsert indicates an expected call of Upsert.
+func (mr *MockRecordManagerMockRecorder) Upsert(table, primaryKey, keyColumns, data interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Upsert", reflect.TypeOf((*MockRecordManager)(nil).Upsert), table, primaryKey, keyColumns, data)
+}
+
+// MockAuditLog is a mock of AuditLog interface.
+type MockAuditLog struct {
+	ctrl     *gomock.Controller
+	recorder *MockAuditLogMockRecorder
+}
+
+// MockAuditLogMockRecorder is the mock recorder for MockAuditLog.
+type MockAuditLogMockRecorder struct {
+	mock *MockAuditLog
+}
+
+// NewMockAuditLog creates a new mock instance.
+func NewMockAuditLog(ctrl *gomock.Controller) *MockAuditLog {
+	mock := &MockAuditLog{ctrl: ctrl}
+	mock.recorder = &MockAuditLogMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockAuditLog) EXPECT() *MockAuditLogMockRecorder {
+	return m.recorder
+}
+
+// History mocks base method.
+func (m *MockAuditLog) History(rm RecordManager, table string, recordId int) ([]dto.AuditEntry, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "History", rm, table, recordId)
+	ret0, _ := ret[0].([]dto.AuditEntry)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// History indicates an expected call of History.
+func (mr *MockAuditLogMockRecorder) History(rm, table, recordId interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "History", reflect.TypeOf((*MockAuditLog)(nil).History), rm, table, recordId)
+}
+
+// TableName mocks base method.
+func (m *MockAuditLog) TableName() string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "TableName")
+	ret0, _ := ret[0].(string)
+	return ret0
+}
+
+// TableName indicates an expected call of TableName.
+func (mr *MockAuditLogMockRecorder) TableName() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TableName", reflect.TypeOf((*MockAuditLog)(nil).TableName))
+}
+
+// Write mocks base method.
+func (m *MockAuditLog) Write(rm RecordManager, entry dto.AuditEntry) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Write", rm, entry)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Write indicates an expected call of Write.
+func (mr *MockAuditLogMockRecorder) Write(rm, entry interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Write", reflect.TypeOf((*MockAuditLog)(nil).Write), rm, entry)
+}
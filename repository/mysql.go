@@ -0,0 +1,143 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"hw6coursera/dto"
+	"hw6coursera/logging"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+type mysqlDialect struct{}
+
+func (mysqlDialect) quote(name string) string {
+	return quoteIdentifier("`", name)
+}
+
+func (mysqlDialect) rebind(query string) string {
+	return query
+}
+
+func (d mysqlDialect) insert(db querier, table dto.Table, data map[string]interface{}) (int, error) {
+	fields, placehoders, sqlVals := getInsertParams(d, data)
+	queryTemplate := "INSERT INTO %s (%s) VALUES (%s);"
+	queryString := fmt.Sprintf(queryTemplate, d.quote(table.Name), fields, placehoders)
+	res, err := db.Exec(queryString, sqlVals...)
+	if err != nil {
+		if dataErr := dataError(d, err); dataErr != nil {
+			return 0, dataErr
+		}
+		return 0, fmt.Errorf("error on inserting values: %v", err)
+	}
+
+	if rowsAffected, err := res.RowsAffected(); err != nil {
+		logging.Default().Warn("error on RowsAffected()", "table", table.Name, "err", err)
+	} else if rowsAffected != 1 {
+		logging.Default().Warn("unexpected number of inserted rows", "table", table.Name, "rows", rowsAffected)
+	}
+
+	lastInsertId, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("error on lastinsertid(): %v", err)
+	}
+	return int(lastInsertId), nil
+}
+
+// ON DUPLICATE KEY UPDATE срабатывает на любом уникальном индексе, а не только на выбранном ключе,
+// поэтому запись ищем по ключу сами и блокируем до конца транзакции, см. recordManager.Upsert
+func (d mysqlDialect) upsert(db querier, table dto.Table, primaryKey string, keyColumns []string, data map[string]interface{}) (int, bool, error) {
+	conditions := make([]string, 0, len(keyColumns))
+	keyVals := make([]interface{}, 0, len(keyColumns))
+	isKey := make(map[string]bool, len(keyColumns))
+	for _, k := range keyColumns {
+		conditions = append(conditions, fmt.Sprintf("%s = ?", d.quote(k)))
+		keyVals = append(keyVals, data[k])
+		isKey[k] = true
+	}
+	var existing int
+	queryString := fmt.Sprintf("SELECT %s FROM %s WHERE %s FOR UPDATE;", d.quote(primaryKey), d.quote(table.Name), strings.Join(conditions, " AND "))
+	err := db.QueryRow(queryString, keyVals...).Scan(&existing)
+	if err == sql.ErrNoRows {
+		fields, placehoders, sqlVals := getInsertParams(d, data)
+		queryString = fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s);", d.quote(table.Name), fields, placehoders)
+		res, err := db.Exec(queryString, sqlVals...)
+		if dataErr := dataError(d, err); dataErr != nil { // в том числе запись с тем же значением другого уникального индекса
+			return 0, false, dataErr
+		} else if err != nil {
+			return 0, false, fmt.Errorf("error on upserting values: %v", err)
+		}
+		lastInsertId, err := res.LastInsertId()
+		if err != nil {
+			return 0, false, fmt.Errorf("error on lastinsertid(): %v", err)
+		}
+		if pk, ok := data[primaryKey].(int); ok && lastInsertId == 0 { // ключ без auto-increment
+			lastInsertId = int64(pk)
+		}
+		return int(lastInsertId), true, nil
+	} else if err != nil {
+		return 0, false, fmt.Errorf("error on upserting values: %v", err)
+	}
+
+	// колонки ключа и первичный ключ не обновляем
+	updates := make(map[string]interface{}, len(data))
+	for k, v := range data {
+		if !isKey[k] && k != primaryKey {
+			updates[k] = v
+		}
+	}
+	if len(updates) == 0 {
+		return existing, false, nil
+	}
+	placehoders, sqlVals := getUpdateParams(d, updates)
+	queryString = fmt.Sprintf("UPDATE %s SET %s WHERE %s = ?;", d.quote(table.Name), placehoders, d.quote(primaryKey))
+	_, err = db.Exec(queryString, append(sqlVals, existing)...)
+	if dataErr := dataError(d, err); dataErr != nil {
+		return 0, false, dataErr
+	} else if err != nil {
+		return 0, false, fmt.Errorf("error on upserting values: %v", err)
+	}
+	return existing, false, nil
+}
+
+func (mysqlDialect) isDuplicateKey(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == 1062 // ER_DUP_ENTRY
+}
+
+// коды ошибок, которые MySQL возвращает в строгом режиме на неподходящие данные
+var mysqlInvalidDataErrors = map[uint16]bool{
+	1048: true, // ER_BAD_NULL_ERROR
+	1264: true, // ER_WARN_DATA_OUT_OF_RANGE
+	1292: true, // ER_TRUNCATED_WRONG_VALUE
+	1364: true, // ER_NO_DEFAULT_FOR_FIELD
+	1366: true, // ER_TRUNCATED_WRONG_VALUE_FOR_FIELD
+	1406: true, // ER_DATA_TOO_LONG
+	1451: true, // ER_ROW_IS_REFERENCED_2
+	1452: true, // ER_NO_REFERENCED_ROW_2
+	3819: true, // ER_CHECK_CONSTRAINT_VIOLATED
+}
+
+func (mysqlDialect) isInvalidData(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlInvalidDataErrors[mysqlErr.Number]
+}
+
+func (mysqlDialect) forUpdate() string {
+	return " FOR UPDATE"
+}
+
+func (d mysqlDialect) auditTableDDL(name string) []string {
+	queryTemplate := "CREATE TABLE IF NOT EXISTS %s (" +
+		"id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY, " +
+		"table_name VARCHAR(255) NOT NULL, " +
+		"record_id BIGINT NOT NULL, " +
+		"operation VARCHAR(16) NOT NULL, " +
+		"actor VARCHAR(255) NOT NULL, " +
+		"created_at VARCHAR(64) NOT NULL, " +
+		"changes TEXT NOT NULL, " +
+		"KEY record_history (table_name, record_id));"
+	return []string{fmt.Sprintf(queryTemplate, d.quote(name))}
+}
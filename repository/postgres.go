@@ -0,0 +1,266 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hw6coursera/dto"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+type postgresDialect struct{}
+
+func (postgresDialect) quote(name string) string {
+	return quoteIdentifier(`"`, name)
+}
+
+func (postgresDialect) rebind(query string) string {
+	return rebindNumbered(query)
+}
+
+// LastInsertId в postgres нет, id получаем через RETURNING
+func (d postgresDialect) insert(db querier, table dto.Table, data map[string]interface{}) (int, error) {
+	fields, placehoders, sqlVals := getInsertParams(d, data)
+	values := fmt.Sprintf("(%s) VALUES (%s)", fields, placehoders)
+	if len(data) == 0 {
+		values = "DEFAULT VALUES"
+	}
+
+	primaryKey, ok := getPrimaryKey(table)
+	if !ok {
+		queryString := rebindNumbered(fmt.Sprintf("INSERT INTO %s %s;", d.quote(table.Name), values))
+		if _, err := db.Exec(queryString, sqlVals...); err != nil {
+			if dataErr := dataError(d, err); dataErr != nil {
+				return 0, dataErr
+			}
+			return 0, fmt.Errorf("error on inserting values: %v", err)
+		}
+		return 0, nil
+	}
+
+	queryTemplate := "INSERT INTO %s %s RETURNING %s;"
+	queryString := rebindNumbered(fmt.Sprintf(queryTemplate, d.quote(table.Name), values, d.quote(primaryKey)))
+	var id int
+	if err := db.QueryRow(queryString, sqlVals...).Scan(&id); err != nil {
+		if dataErr := dataError(d, err); dataErr != nil {
+			return 0, dataErr
+		}
+		return 0, fmt.Errorf("error on inserting values: %v", err)
+	}
+	return id, nil
+}
+
+// xmax = 0 только у только что вставленной строки
+func (d postgresDialect) upsert(db querier, table dto.Table, primaryKey string, keyColumns []string, data map[string]interface{}) (int, bool, error) {
+	fields, placehoders, sqlVals := getInsertParams(d, data)
+	queryTemplate := "INSERT INTO %s (%s) VALUES (%s) ON CONFLICT (%s) DO UPDATE SET %s RETURNING %s, (xmax = 0);"
+	queryString := rebindNumbered(fmt.Sprintf(queryTemplate, d.quote(table.Name), fields, placehoders,
+		quoteAll(d, keyColumns), getConflictUpdateParams(d, data, primaryKey, keyColumns), d.quote(primaryKey)))
+
+	var id int
+	var created bool
+	err := db.QueryRow(queryString, sqlVals...).Scan(&id, &created)
+	if dataErr := dataError(d, err); dataErr != nil { // ON CONFLICT ловит только выбранный ключ
+		return 0, false, dataErr
+	} else if err != nil {
+		return 0, false, fmt.Errorf("error on upserting values: %v", err)
+	}
+	return id, created, nil
+}
+
+func (postgresDialect) isDuplicateKey(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505" // unique_violation
+}
+
+// класс 22 - данные не подходят колонке, 23 - нарушено ограничение
+func (postgresDialect) isInvalidData(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && (pqErr.Code.Class() == "22" || pqErr.Code.Class() == "23")
+}
+
+func (postgresDialect) forUpdate() string {
+	return " FOR UPDATE"
+}
+
+func (d postgresDialect) auditTableDDL(name string) []string {
+	return []string{
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (`+
+			"id BIGSERIAL PRIMARY KEY, "+
+			"table_name VARCHAR(255) NOT NULL, "+
+			"record_id BIGINT NOT NULL, "+
+			"operation VARCHAR(16) NOT NULL, "+
+			"actor VARCHAR(255) NOT NULL, "+
+			"created_at VARCHAR(64) NOT NULL, "+
+			"changes TEXT NOT NULL);", d.quote(name)),
+		fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %s ON %s (table_name, record_id);`, d.quote(name+"_record_history"), d.quote(name)),
+	}
+}
+
+// pgExplorer читает схему из pg_catalog, только таблицы текущей схемы (search_path)
+type pgExplorer struct {
+	db *sql.DB
+}
+
+// GetTableNames implements Explorer
+func (e *pgExplorer) GetTableNames() ([]string, error) {
+	rows, err := e.db.Query(`SELECT c.relname FROM pg_catalog.pg_class c
+		JOIN pg_catalog.pg_namespace n ON n.oid = c.relnamespace
+		WHERE c.relkind = 'r' AND n.nspname = current_schema() ORDER BY c.relname`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tableNames := make([]string, 0)
+	for rows.Next() {
+		var n string
+		if err := rows.Scan(&n); err != nil {
+			return nil, err
+		}
+		tableNames = append(tableNames, n)
+	}
+	return tableNames, rows.Err()
+}
+
+// GetColumns implements Explorer
+func (e *pgExplorer) GetColumns(tableName string) ([]dto.Column, error) {
+	// вычисляемые колонки: identity, GENERATED ALWAYS AS и serial (значение по умолчанию из последовательности)
+	rows, err := e.db.Query(`SELECT a.attname, pg_catalog.format_type(a.atttypid, a.atttypmod), NOT a.attnotnull,
+			EXISTS (SELECT 1 FROM pg_catalog.pg_index i WHERE i.indrelid = c.oid AND i.indisprimary AND a.attnum = ANY(i.indkey)),
+			a.attidentity <> '' OR a.attgenerated <> '' OR COALESCE(pg_catalog.pg_get_expr(d.adbin, d.adrelid), '') LIKE 'nextval(%',
+			COALESCE((SELECT json_agg(e.enumlabel ORDER BY e.enumsortorder) FROM pg_catalog.pg_enum e WHERE e.enumtypid = a.atttypid), '[]')
+		FROM pg_catalog.pg_attribute a
+		JOIN pg_catalog.pg_class c ON c.oid = a.attrelid
+		JOIN pg_catalog.pg_namespace n ON n.oid = c.relnamespace
+		LEFT JOIN pg_catalog.pg_attrdef d ON d.adrelid = a.attrelid AND d.adnum = a.attnum
+		WHERE c.relname = $1 AND n.nspname = current_schema() AND a.attnum > 0 AND NOT a.attisdropped
+		ORDER BY a.attnum`, tableName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns := make([]dto.Column, 0)
+	for rows.Next() {
+		var col dto.Column
+		var typeName string
+		var enum []byte
+		if err := rows.Scan(&col.Name, &typeName, &col.Nullable, &col.IsPrimaryKey, &col.Generated, &enum); err != nil {
+			return nil, err
+		}
+		col.ColumnType = pgColumnType(typeName)
+		if err := json.Unmarshal(enum, &col.Enum); err != nil {
+			return nil, fmt.Errorf("unable to parse enum values of %s: %v", col.Name, err)
+		}
+		if len(col.Enum) > 0 {
+			col.ColumnType = dto.StringType
+		} else {
+			col.Enum = nil
+		}
+		if col.ColumnType == dto.StringType {
+			col.MaxLength = charLength(typeName)
+		}
+		columns = append(columns, col)
+	}
+	return columns, rows.Err()
+}
+
+// GetIndexes implements Explorer
+func (e *pgExplorer) GetIndexes(tableName string) ([]dto.Index, error) {
+	rows, err := e.db.Query(`SELECT i.relname, ix.indisprimary, ix.indisunique, a.attname
+		FROM pg_catalog.pg_index ix
+		JOIN pg_catalog.pg_class t ON t.oid = ix.indrelid
+		JOIN pg_catalog.pg_class i ON i.oid = ix.indexrelid
+		JOIN pg_catalog.pg_namespace n ON n.oid = t.relnamespace
+		CROSS JOIN LATERAL unnest(ix.indkey) WITH ORDINALITY AS k(attnum, ord)
+		JOIN pg_catalog.pg_attribute a ON a.attrelid = t.oid AND a.attnum = k.attnum
+		WHERE t.relname = $1 AND n.nspname = current_schema()
+		ORDER BY i.relname, k.ord`, tableName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// колонки составного индекса идут подряд, поэтому достаточно сравнивать с последним индексом
+	indexes := make([]dto.Index, 0)
+	lastName := ""
+	for rows.Next() {
+		var name, column string
+		var primary, unique bool
+		if err := rows.Scan(&name, &primary, &unique, &column); err != nil {
+			return nil, err
+		}
+		if len(indexes) == 0 || lastName != name {
+			idx := dto.Index{Name: name, Unique: unique}
+			if primary { // как в mysql, чтобы ?key=PRIMARY работал одинаково
+				idx.Name = dto.PrimaryIndexName
+			}
+			indexes = append(indexes, idx)
+			lastName = name
+		}
+		last := &indexes[len(indexes)-1]
+		last.Columns = append(last.Columns, column)
+	}
+	return indexes, rows.Err()
+}
+
+// GetForeignKeys implements Explorer
+func (e *pgExplorer) GetForeignKeys(tableName string) ([]dto.ForeignKey, error) {
+	rows, err := e.db.Query(`SELECT con.conname, a.attname, rt.relname, ra.attname
+		FROM pg_catalog.pg_constraint con
+		JOIN pg_catalog.pg_class t ON t.oid = con.conrelid
+		JOIN pg_catalog.pg_namespace n ON n.oid = t.relnamespace
+		JOIN pg_catalog.pg_class rt ON rt.oid = con.confrelid
+		CROSS JOIN LATERAL unnest(con.conkey, con.confkey) WITH ORDINALITY AS k(attnum, refattnum, ord)
+		JOIN pg_catalog.pg_attribute a ON a.attrelid = t.oid AND a.attnum = k.attnum
+		JOIN pg_catalog.pg_attribute ra ON ra.attrelid = rt.oid AND ra.attnum = k.refattnum
+		WHERE con.contype = 'f' AND t.relname = $1 AND n.nspname = current_schema()
+		ORDER BY con.conname, k.ord`, tableName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanForeignKeys(rows)
+}
+
+// EstimateRows implements Explorer
+func (e *pgExplorer) EstimateRows(tableName string) (int64, error) {
+	// reltuples обновляют VACUUM и ANALYZE, до первого из них - -1 (в старых версиях 0)
+	var estimate float64
+	err := e.db.QueryRow(`SELECT c.reltuples FROM pg_catalog.pg_class c
+		JOIN pg_catalog.pg_namespace n ON n.oid = c.relnamespace
+		WHERE c.relname = $1 AND n.nspname = current_schema()`, tableName).Scan(&estimate)
+	if err != nil {
+		return 0, err
+	}
+	if estimate < 0 {
+		return -1, nil
+	}
+	return int64(estimate), nil
+}
+
+// format_type отдаёт "integer", "character varying(255)", "numeric(10,2)", "double precision"...
+func pgColumnType(typeName string) string {
+	switch {
+	case strings.HasPrefix(typeName, "integer") || strings.HasPrefix(typeName, "bigint") || strings.HasPrefix(typeName, "smallint"):
+		return dto.IntType
+	case strings.HasPrefix(typeName, "numeric") || strings.HasPrefix(typeName, "real") || strings.HasPrefix(typeName, "double precision"):
+		return dto.FloatType
+	case strings.HasPrefix(typeName, "character") || strings.HasPrefix(typeName, "text"):
+		return dto.StringType
+	case typeName == "boolean":
+		return dto.BoolType
+	default:
+		return dto.UnknownType
+	}
+}
+
+func newPgExplorer(db *sql.DB) *pgExplorer {
+	return &pgExplorer{
+		db: db,
+	}
+}
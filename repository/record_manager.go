@@ -1,52 +1,62 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"hw6coursera/dto"
-	"log"
+	"hw6coursera/logging"
+	"sort"
 	"strconv"
 	"strings"
 )
 
-var ErrRowNotFound = fmt.Errorf("row not found")
+var (
+	ErrRowNotFound  = fmt.Errorf("row not found")
+	ErrDuplicateKey = fmt.Errorf("duplicate unique key")
+	ErrInvalidData  = fmt.Errorf("data rejected by database")
+)
+
+// querier - общее у *sql.DB и *sql.Tx
+type querier interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
 
 type recordManager struct {
-	db *sql.DB
+	db      querier
+	conn    *sql.DB // nil, если recordManager уже работает внутри транзакции
+	dialect dialect
+	log     *logging.Logger // nil - логгер по умолчанию
+	logSQL  bool            // писать в лог каждый запрос
 }
 
 // Create implements RecordManager
 func (rm *recordManager) Create(table dto.Table, data map[string]interface{}) (lastInsertedId int, err error) {
-	fields, placehoders, sqlVals := getInsertParams(data)
-	queryTemplate := "INSERT INTO %s (%s) VALUES (%s);"
-	queryString := fmt.Sprintf(queryTemplate, table.Name, fields, placehoders)
-	res, err := rm.db.Exec(queryString, sqlVals...)
-	if err != nil {
-		return 0, fmt.Errorf("error on inserting values: %v", err)
-	}
-
-	rowsAffected, err := res.RowsAffected()
-	if err != nil {
-		log.Printf("error on RowsAffected(): %v", err)
-	}
-	if rowsAffected != 1 {
-		log.Printf("wrong behaviour, affectet rows: %d\n", rowsAffected)
-	}
+	return rm.dialect.insert(rm.querier(), table, data)
+}
 
-	lastInsertId, err := res.LastInsertId()
-	if err != nil {
-		log.Printf("error on LastInsertId(): %v", err)
-		return 0, err
-	}
-	return int(lastInsertId), nil
+// Upsert implements RecordManager
+func (rm *recordManager) Upsert(table dto.Table, primaryKey string, keyColumns []string, data map[string]interface{}) (id int, created bool, err error) {
+	// диалект ищет запись по ключу и потом пишет, оба запроса должны идти в одной транзакции
+	err = rm.InTx(func(tx RecordManager) (err error) {
+		id, created, err = rm.dialect.upsert(tx.(*recordManager).querier(), table, primaryKey, keyColumns, data)
+		return err
+	})
+	return id, created, err
 }
 
 // DeleteById implements RecordManager
 func (rm *recordManager) DeleteById(table dto.Table, primaryKey string, id int) (err error) {
 	queryTemplate := "DELETE FROM %s WHERE %s = ?;"
-	queryString := fmt.Sprintf(queryTemplate, table.Name, primaryKey)
-	res, err := rm.db.Exec(queryString, id)
+	queryString := fmt.Sprintf(queryTemplate, rm.dialect.quote(table.Name), rm.dialect.quote(primaryKey))
+	res, err := rm.exec(queryString, id)
 	if err != nil {
+		if dataErr := dataError(rm.dialect, err); dataErr != nil {
+			return dataErr
+		}
 		return fmt.Errorf("error on deleting values: %v", err)
 	}
 
@@ -57,17 +67,23 @@ func (rm *recordManager) DeleteById(table dto.Table, primaryKey string, id int)
 	if rowsAffected == 0 {
 		return ErrRowNotFound
 	} else if rowsAffected > 1 {
-		log.Println("affected more then 1 row")
+		rm.logger().Warn("affected more than 1 row", "table", table.Name, "rows", rowsAffected)
 	}
 	return nil
 }
 
 // GetAllRecords implements RecordManager
-func (rm *recordManager) GetAllRecords(table dto.Table, limit int, offset int) (data []map[string]interface{}, err error) {
-	fields := getQueryFields(table)
-	queryTemplate := "SELECT %s FROM %s LIMIT ? OFFSET ?;"
-	queryString := fmt.Sprintf(queryTemplate, fields, table.Name)
-	rows, err := rm.db.Query(queryString, limit, offset)
+func (rm *recordManager) GetAllRecords(table dto.Table, filter dto.Filter, limit int, offset int) (data []map[string]interface{}, err error) {
+	fields := getQueryFields(rm.dialect, table)
+	where, sqlVals, err := getWhereParams(rm.dialect, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	queryTemplate := "SELECT %s FROM %s%s LIMIT ? OFFSET ?;"
+	queryString := fmt.Sprintf(queryTemplate, fields, rm.dialect.quote(table.Name), where)
+	sqlVals = append(sqlVals, limit, offset)
+	rows, err := rm.query(queryString, sqlVals...)
 	if err != nil {
 		return nil, fmt.Errorf("unable to get records due to error: %+v", err)
 	}
@@ -88,12 +104,53 @@ func (rm *recordManager) GetAllRecords(table dto.Table, limit int, offset int) (
 	return content, nil
 }
 
+// EachRecord implements RecordManager
+func (rm *recordManager) EachRecord(ctx context.Context, table dto.Table, filter dto.Filter, fn func(record map[string]interface{}) error) (err error) {
+	fields := getQueryFields(rm.dialect, table)
+	where, sqlVals, err := getWhereParams(rm.dialect, filter)
+	if err != nil {
+		return err
+	}
+
+	// без ORDER BY база отдаёт строки в порядке хранения и может не сортировать всю таблицу перед первой строкой
+	queryString := fmt.Sprintf("SELECT %s FROM %s%s;", fields, rm.dialect.quote(table.Name), where)
+	rows, err := rm.querier().QueryContext(ctx, rm.dialect.rebind(queryString), sqlVals...)
+	if err != nil {
+		return fmt.Errorf("unable to get records due to error: %+v", err)
+	}
+	defer rows.Close()
+
+	dest := initScanDestination(table)
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return err
+		}
+		unit, err := extractSqlVals(table, dest)
+		if err != nil {
+			return err
+		}
+		if err := fn(unit); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
 // GetById implements RecordManager
 func (rm *recordManager) GetById(table dto.Table, primaryKey string, id int) (data map[string]interface{}, err error) {
-	fields := getQueryFields(table)
-	queryTemplate := "SELECT %s FROM %s WHERE %s = ?;"
-	queryString := fmt.Sprintf(queryTemplate, fields, table.Name, primaryKey)
-	row := rm.db.QueryRow(queryString, id)
+	return rm.getById(table, primaryKey, id, "")
+}
+
+// GetByIdForUpdate implements RecordManager
+func (rm *recordManager) GetByIdForUpdate(table dto.Table, primaryKey string, id int) (data map[string]interface{}, err error) {
+	return rm.getById(table, primaryKey, id, rm.dialect.forUpdate())
+}
+
+func (rm *recordManager) getById(table dto.Table, primaryKey string, id int, lock string) (data map[string]interface{}, err error) {
+	fields := getQueryFields(rm.dialect, table)
+	queryTemplate := "SELECT %s FROM %s WHERE %s = ?%s;"
+	queryString := fmt.Sprintf(queryTemplate, fields, rm.dialect.quote(table.Name), rm.dialect.quote(primaryKey), lock)
+	row := rm.queryRow(queryString, id)
 	if err := row.Err(); err != nil {
 		return nil, fmt.Errorf("unable to get records due to error: %+v", err)
 	}
@@ -113,16 +170,19 @@ func (rm *recordManager) GetById(table dto.Table, primaryKey string, id int) (da
 
 // UpdateById implements RecordManager
 func (rm *recordManager) UpdateById(table dto.Table, primaryKey string, id int, data map[string]interface{}) (err error) {
-	palceholders, sqlVals := getUpdateParams(data)
+	palceholders, sqlVals := getUpdateParams(rm.dialect, data)
 	if len(sqlVals) == 0 {
 		return fmt.Errorf("required at least one field to update")
 	}
 
 	queryTemplate := "UPDATE %s SET %s WHERE %s = ?;"
-	queryString := fmt.Sprintf(queryTemplate, table.Name, palceholders, primaryKey)
+	queryString := fmt.Sprintf(queryTemplate, rm.dialect.quote(table.Name), palceholders, rm.dialect.quote(primaryKey))
 	sqlVals = append(sqlVals, id)
-	result, err := rm.db.Exec(queryString, sqlVals...)
+	result, err := rm.exec(queryString, sqlVals...)
 	if err != nil {
+		if dataErr := dataError(rm.dialect, err); dataErr != nil {
+			return dataErr
+		}
 		return fmt.Errorf("error on updating values: %v", err)
 	}
 
@@ -139,49 +199,167 @@ func (rm *recordManager) UpdateById(table dto.Table, primaryKey string, id int,
 	return nil
 }
 
-func newRecordManager(db *sql.DB) *recordManager {
+// CountRecords implements RecordManager
+func (rm *recordManager) CountRecords(table dto.Table, filter dto.Filter) (count int, err error) {
+	where, sqlVals, err := getWhereParams(rm.dialect, filter)
+	if err != nil {
+		return 0, err
+	}
+
+	queryTemplate := "SELECT COUNT(*) FROM %s%s;"
+	queryString := fmt.Sprintf(queryTemplate, rm.dialect.quote(table.Name), where)
+	if err := rm.queryRow(queryString, sqlVals...).Scan(&count); err != nil {
+		return 0, fmt.Errorf("unable to count records due to error: %+v", err)
+	}
+	return count, nil
+}
+
+// UpdateByFilter implements RecordManager
+func (rm *recordManager) UpdateByFilter(table dto.Table, filter dto.Filter, data map[string]interface{}) (rowsAffected int, err error) {
+	palceholders, sqlVals := getUpdateParams(rm.dialect, data)
+	if len(sqlVals) == 0 {
+		return 0, fmt.Errorf("required at least one field to update")
+	}
+
+	where, whereVals, err := getWhereParams(rm.dialect, filter)
+	if err != nil {
+		return 0, err
+	}
+
+	queryTemplate := "UPDATE %s SET %s%s;"
+	queryString := fmt.Sprintf(queryTemplate, rm.dialect.quote(table.Name), palceholders, where)
+	sqlVals = append(sqlVals, whereVals...)
+	result, err := rm.exec(queryString, sqlVals...)
+	if err != nil {
+		if dataErr := dataError(rm.dialect, err); dataErr != nil {
+			return 0, dataErr
+		}
+		return 0, fmt.Errorf("error on updating values: %v", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("error on rowsaffected(): %v", err)
+	}
+	return int(affected), nil
+}
+
+// DeleteByFilter implements RecordManager
+func (rm *recordManager) DeleteByFilter(table dto.Table, filter dto.Filter) (rowsAffected int, err error) {
+	where, sqlVals, err := getWhereParams(rm.dialect, filter)
+	if err != nil {
+		return 0, err
+	}
+
+	queryTemplate := "DELETE FROM %s%s;"
+	queryString := fmt.Sprintf(queryTemplate, rm.dialect.quote(table.Name), where)
+	result, err := rm.exec(queryString, sqlVals...)
+	if err != nil {
+		if dataErr := dataError(rm.dialect, err); dataErr != nil {
+			return 0, dataErr
+		}
+		return 0, fmt.Errorf("error on deleting values: %v", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("error on rowsaffected(): %v", err)
+	}
+	return int(affected), nil
+}
+
+// InTx implements RecordManager
+func (rm *recordManager) InTx(fn func(tx RecordManager) error) (err error) {
+	if rm.conn == nil { // вложенная транзакция - продолжаем текущую
+		return fn(rm)
+	}
+
+	tx, err := rm.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("unable to begin transaction: %v", err)
+	}
+
+	if err := fn(&recordManager{db: tx, dialect: rm.dialect, log: rm.log, logSQL: rm.logSQL}); err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			rm.logger().Error("error on rollback", "err", rbErr)
+		}
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("unable to commit transaction: %v", err)
+	}
+	return nil
+}
+
+func newRecordManager(db *sql.DB, d dialect) *recordManager {
 	return &recordManager{
-		db: db,
+		db:      db,
+		conn:    db,
+		dialect: d,
 	}
 }
 
-func getInsertParams(unit map[string]interface{}) (fieldNames string, placehoderStr string, data []interface{}) {
+// запросы собираются с плейсхолдерами `?`, под конкретную базу их переписывает диалект
+func (rm *recordManager) exec(query string, args ...interface{}) (sql.Result, error) {
+	return rm.querier().Exec(rm.dialect.rebind(query), args...)
+}
+
+func (rm *recordManager) query(query string, args ...interface{}) (*sql.Rows, error) {
+	return rm.querier().Query(rm.dialect.rebind(query), args...)
+}
+
+func (rm *recordManager) queryRow(query string, args ...interface{}) *sql.Row {
+	return rm.querier().QueryRow(rm.dialect.rebind(query), args...)
+}
+
+func getInsertParams(d dialect, unit map[string]interface{}) (fieldNames string, placehoderStr string, data []interface{}) {
 	length := len(unit)
 	names := make([]string, 0, length)
 	placehoders := make([]string, 0, length)
 	output := make([]interface{}, 0, length)
-	for k, v := range unit {
-		names = append(names, k)
+	for _, k := range sortedKeys(unit) {
+		names = append(names, d.quote(k))
 		placehoders = append(placehoders, "?")
-		output = append(output, v)
+		output = append(output, unit[k])
 	}
 	return strings.Join(names, ", "), strings.Join(placehoders, ", "), output
 }
 
-func getUpdateParams(unit map[string]interface{}) (placehoderStr string, data []interface{}) {
+// порядок полей в запросе не должен зависеть от обхода map
+func sortedKeys(unit map[string]interface{}) []string {
+	keys := make([]string, 0, len(unit))
+	for k := range unit {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func getUpdateParams(d dialect, unit map[string]interface{}) (placehoderStr string, data []interface{}) {
 	length := len(unit)
 	placehoders := make([]string, 0, length)
 	output := make([]interface{}, 0, length)
-	for k, v := range unit {
-		placehoders = append(placehoders, fmt.Sprintf("%s = ?", k))
-		output = append(output, v)
+	for _, k := range sortedKeys(unit) { // порядок колонок не должен зависеть от обхода map
+		placehoders = append(placehoders, fmt.Sprintf("%s = ?", d.quote(k)))
+		output = append(output, unit[k])
 	}
 	return strings.Join(placehoders, ", "), output
 }
 
 // копипаста функции strings.Join только для моей структуры table
-func getQueryFields(t dto.Table) string {
+func getQueryFields(d dialect, t dto.Table) string {
 	switch len(t.Columns) {
 	case 0:
 		return ""
 	case 1:
-		return t.Columns[0].Name
+		return d.quote(t.Columns[0].Name)
 	}
 	var sb strings.Builder
-	sb.WriteString(t.Columns[0].Name)
+	sb.WriteString(d.quote(t.Columns[0].Name))
 	for _, col := range t.Columns[1:] {
 		sb.WriteString(", ")
-		sb.WriteString(col.Name)
+		sb.WriteString(d.quote(col.Name))
 	}
 	return sb.String()
 }
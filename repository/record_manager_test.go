@@ -7,6 +7,7 @@ import (
 	"testing"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -80,7 +81,7 @@ func TestRecordManageer_Create(t *testing.T) {
 			name:          "OK",
 			tableStruct:   testingSchema["example_table_1"],
 			data:          map[string]interface{}{"name": "name value"},
-			expectedQuery: "INSERT INTO example_table_1",
+			expectedQuery: "INSERT INTO `example_table_1`",
 			mockBehaviour: func(query string) {
 				mock.ExpectExec(query).WithArgs("name value").WillReturnResult(sqlmock.NewResult(5, 1))
 			},
@@ -91,7 +92,7 @@ func TestRecordManageer_Create(t *testing.T) {
 			name:          "db error",
 			tableStruct:   testingSchema["example_table_1"],
 			data:          map[string]interface{}{"name": "name value"},
-			expectedQuery: "INSERT INTO example_table_1",
+			expectedQuery: "INSERT INTO `example_table_1`",
 			mockBehaviour: func(query string) {
 				mock.ExpectExec(query).WithArgs("name value").WillReturnError(fmt.Errorf("db error"))
 			},
@@ -101,7 +102,7 @@ func TestRecordManageer_Create(t *testing.T) {
 	}
 
 	for _, tc := range testCases {
-		rm := newRecordManager(db)
+		rm := newRecordManager(db, mysqlDialect{})
 		tc.mockBehaviour(tc.expectedQuery)
 
 		lastInsertedId, err := rm.Create(tc.tableStruct, tc.data)
@@ -131,7 +132,7 @@ func TestRecordManageer_DeleteById(t *testing.T) {
 			name:          "OK",
 			tableStruct:   testingSchema["example_table_1"],
 			primaryKey:    "primary_key",
-			expectedQuery: "DELETE FROM example_table_1 WHERE primary_key",
+			expectedQuery: "DELETE FROM `example_table_1` WHERE `primary_key`",
 			id:            6,
 			mockBehaviour: func(query string, id int) {
 				mock.ExpectExec(query).WithArgs(id).WillReturnResult(sqlmock.NewResult(0, 1))
@@ -142,7 +143,7 @@ func TestRecordManageer_DeleteById(t *testing.T) {
 			name:          "row not found",
 			tableStruct:   testingSchema["example_table_1"],
 			primaryKey:    "primary_key",
-			expectedQuery: "DELETE FROM example_table_1 WHERE primary_key",
+			expectedQuery: "DELETE FROM `example_table_1` WHERE `primary_key`",
 			id:            6,
 			mockBehaviour: func(query string, id int) {
 				mock.ExpectExec(query).WithArgs(id).WillReturnResult(sqlmock.NewResult(0, 0))
@@ -153,7 +154,7 @@ func TestRecordManageer_DeleteById(t *testing.T) {
 			name:          "db error",
 			tableStruct:   testingSchema["example_table_1"],
 			primaryKey:    "primary_key",
-			expectedQuery: "DELETE FROM example_table_1 WHERE primary_key",
+			expectedQuery: "DELETE FROM `example_table_1` WHERE `primary_key`",
 			id:            6,
 			mockBehaviour: func(query string, id int) {
 				mock.ExpectExec(query).WithArgs(id).WillReturnError(fmt.Errorf("db error"))
@@ -163,7 +164,7 @@ func TestRecordManageer_DeleteById(t *testing.T) {
 	}
 
 	for _, tc := range testCases {
-		rm := newRecordManager(db)
+		rm := newRecordManager(db, mysqlDialect{})
 		tc.mockBehaviour(tc.expectedQuery, tc.id)
 
 		err := rm.DeleteById(tc.tableStruct, tc.primaryKey, tc.id)
@@ -182,6 +183,7 @@ func TestRecordManageer_GetAllRecords(t *testing.T) {
 	testCases := []struct {
 		name          string
 		tableStruct   dto.Table
+		filter        dto.Filter
 		limit         int
 		offset        int
 		expectedQuery string
@@ -213,6 +215,29 @@ func TestRecordManageer_GetAllRecords(t *testing.T) {
 			},
 			expectedError: nil,
 		},
+		{
+			name:        "filter",
+			tableStruct: testingSchema["example_table_1"],
+			filter: dto.Filter{
+				{Column: "primary_key", Operator: dto.OpGte, Value: 3},
+				{Column: "nullable_field", Operator: dto.OpEq, Value: nil},
+			},
+			limit:         2,
+			offset:        0,
+			expectedQuery: "SELECT .+ FROM `example_table_1` WHERE `primary_key` >= \\? AND `nullable_field` IS NULL LIMIT",
+			mockBehaviour: func(query string, limit int, offset int) {
+				rows := sqlmock.NewRows([]string{"primary_key", "name", "nullable_field"}).AddRow(3, "name 3", nil)
+				mock.ExpectQuery(query).WithArgs(3, limit, offset).WillReturnRows(rows)
+			},
+			expectedData: []map[string]interface{}{
+				{
+					"primary_key":    int64(3),
+					"name":           "name 3",
+					"nullable_field": nil,
+				},
+			},
+			expectedError: nil,
+		},
 		{
 			name:          "db error",
 			tableStruct:   testingSchema["example_table_1"],
@@ -227,10 +252,10 @@ func TestRecordManageer_GetAllRecords(t *testing.T) {
 	}
 
 	for _, tc := range testCases {
-		rm := newRecordManager(db)
+		rm := newRecordManager(db, mysqlDialect{})
 		tc.mockBehaviour(tc.expectedQuery, tc.limit, tc.offset)
 
-		data, err := rm.GetAllRecords(tc.tableStruct, tc.limit, tc.offset)
+		data, err := rm.GetAllRecords(tc.tableStruct, tc.filter, tc.limit, tc.offset)
 
 		assert.Equal(t, tc.expectedData, data)
 		assert.Equal(t, tc.expectedError, err)
@@ -297,7 +322,7 @@ func TestRecordManageer_GetById(t *testing.T) {
 	}
 
 	for _, tc := range testCases {
-		rm := newRecordManager(db)
+		rm := newRecordManager(db, mysqlDialect{})
 		tc.mockBehaviour(tc.expectedQuery, tc.id)
 
 		data, err := rm.GetById(tc.tableStruct, tc.primaryKey, tc.id)
@@ -363,7 +388,7 @@ func TestRecordManageer_UpdateById(t *testing.T) {
 	}
 
 	for _, tc := range testCases {
-		rm := newRecordManager(db)
+		rm := newRecordManager(db, mysqlDialect{})
 		tc.mockBehaviour(tc.expectedQuery)
 
 		err := rm.UpdateById(tc.tableStruct, tc.primaryKey, tc.id, tc.data)
@@ -371,3 +396,374 @@ func TestRecordManageer_UpdateById(t *testing.T) {
 		assert.Equal(t, tc.expectedError, err)
 	}
 }
+
+func TestRecordManageer_CountRecords(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp)) //не требует полного совпадения запроса
+	if err != nil {
+		log.Fatalf("unable to mock db: %v", err)
+	}
+	defer db.Close()
+
+	testCases := []struct {
+		name          string
+		tableStruct   dto.Table
+		filter        dto.Filter
+		expectedQuery string
+		mockBehaviour func(query string)
+		expectedCount int
+		expectedError error
+	}{
+		{
+			name:          "OK",
+			tableStruct:   testingSchema["example_table_1"],
+			filter:        dto.Filter{{Column: "name", Operator: dto.OpLike, Value: "name%"}},
+			expectedQuery: "SELECT COUNT\\(\\*\\) FROM `example_table_1` WHERE `name` LIKE \\?",
+			mockBehaviour: func(query string) {
+				mock.ExpectQuery(query).WithArgs("name%").WillReturnRows(sqlmock.NewRows([]string{"COUNT(*)"}).AddRow(7))
+			},
+			expectedCount: 7,
+			expectedError: nil,
+		},
+		{
+			name:          "db error",
+			tableStruct:   testingSchema["example_table_1"],
+			expectedQuery: "SELECT COUNT\\(\\*\\) FROM `example_table_1`;",
+			mockBehaviour: func(query string) {
+				mock.ExpectQuery(query).WillReturnError(fmt.Errorf("db error"))
+			},
+			expectedCount: 0,
+			expectedError: fmt.Errorf("unable to count records due to error: %+v", fmt.Errorf("db error")),
+		},
+	}
+
+	for _, tc := range testCases {
+		rm := newRecordManager(db, mysqlDialect{})
+		tc.mockBehaviour(tc.expectedQuery)
+
+		count, err := rm.CountRecords(tc.tableStruct, tc.filter)
+
+		assert.Equal(t, tc.expectedCount, count)
+		assert.Equal(t, tc.expectedError, err)
+	}
+}
+
+func TestRecordManageer_UpdateByFilter(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp)) //не требует полного совпадения запроса
+	if err != nil {
+		log.Fatalf("unable to mock db: %v", err)
+	}
+	defer db.Close()
+
+	testCases := []struct {
+		name             string
+		tableStruct      dto.Table
+		filter           dto.Filter
+		data             map[string]interface{}
+		expectedQuery    string
+		mockBehaviour    func(query string)
+		expectedAffected int
+		expectedError    error
+	}{
+		{
+			name:          "OK",
+			tableStruct:   testingSchema["example_table_1"],
+			filter:        dto.Filter{{Column: "primary_key", Operator: dto.OpLt, Value: 5}},
+			data:          map[string]interface{}{"name": "new name"},
+			expectedQuery: "UPDATE `example_table_1` SET `name` = \\? WHERE `primary_key` < \\?",
+			mockBehaviour: func(query string) {
+				mock.ExpectExec(query).WithArgs("new name", 5).WillReturnResult(sqlmock.NewResult(0, 4))
+			},
+			expectedAffected: 4,
+			expectedError:    nil,
+		},
+		{
+			name:          "columns in stable order",
+			tableStruct:   testingSchema["example_table_1"],
+			filter:        dto.Filter{{Column: "primary_key", Operator: dto.OpEq, Value: 1}},
+			data:          map[string]interface{}{"nullable_field": "b", "name": "a"},
+			expectedQuery: "UPDATE `example_table_1` SET `name` = \\?, `nullable_field` = \\? WHERE `primary_key` = \\?",
+			mockBehaviour: func(query string) {
+				mock.ExpectExec(query).WithArgs("a", "b", 1).WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			expectedAffected: 1,
+			expectedError:    nil,
+		},
+		{
+			name:          "whole table",
+			tableStruct:   testingSchema["example_table_1"],
+			data:          map[string]interface{}{"nullable_field": nil},
+			expectedQuery: "UPDATE `example_table_1` SET `nullable_field` = \\?;",
+			mockBehaviour: func(query string) {
+				mock.ExpectExec(query).WithArgs(nil).WillReturnResult(sqlmock.NewResult(0, 10))
+			},
+			expectedAffected: 10,
+			expectedError:    nil,
+		},
+		{
+			name:          "db error",
+			tableStruct:   testingSchema["example_table_1"],
+			filter:        dto.Filter{{Column: "primary_key", Operator: dto.OpLt, Value: 5}},
+			data:          map[string]interface{}{"name": "new name"},
+			expectedQuery: "UPDATE",
+			mockBehaviour: func(query string) {
+				mock.ExpectExec(query).WithArgs("new name", 5).WillReturnError(fmt.Errorf("db error"))
+			},
+			expectedAffected: 0,
+			expectedError:    fmt.Errorf("error on updating values: %v", fmt.Errorf("db error")),
+		},
+	}
+
+	for _, tc := range testCases {
+		rm := newRecordManager(db, mysqlDialect{})
+		tc.mockBehaviour(tc.expectedQuery)
+
+		affected, err := rm.UpdateByFilter(tc.tableStruct, tc.filter, tc.data)
+
+		assert.Equal(t, tc.expectedAffected, affected)
+		assert.Equal(t, tc.expectedError, err)
+	}
+}
+
+func TestRecordManageer_DeleteByFilter(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp)) //не требует полного совпадения запроса
+	if err != nil {
+		log.Fatalf("unable to mock db: %v", err)
+	}
+	defer db.Close()
+
+	testCases := []struct {
+		name             string
+		tableStruct      dto.Table
+		filter           dto.Filter
+		expectedQuery    string
+		mockBehaviour    func(query string)
+		expectedAffected int
+		expectedError    error
+	}{
+		{
+			name:          "OK",
+			tableStruct:   testingSchema["example_table_1"],
+			filter:        dto.Filter{{Column: "nullable_field", Operator: dto.OpNe, Value: nil}, {Column: "name", Operator: dto.OpEq, Value: "archived"}},
+			expectedQuery: "DELETE FROM `example_table_1` WHERE `nullable_field` IS NOT NULL AND `name` = \\?",
+			mockBehaviour: func(query string) {
+				mock.ExpectExec(query).WithArgs("archived").WillReturnResult(sqlmock.NewResult(0, 2))
+			},
+			expectedAffected: 2,
+			expectedError:    nil,
+		},
+		{
+			name:             "null with wrong operator",
+			tableStruct:      testingSchema["example_table_1"],
+			filter:           dto.Filter{{Column: "nullable_field", Operator: dto.OpLt, Value: nil}},
+			mockBehaviour:    func(query string) {},
+			expectedAffected: 0,
+			expectedError:    fmt.Errorf("operator lt cannot be applied to null"),
+		},
+		{
+			name:          "db error",
+			tableStruct:   testingSchema["example_table_1"],
+			filter:        dto.Filter{{Column: "name", Operator: dto.OpEq, Value: "archived"}},
+			expectedQuery: "DELETE FROM `example_table_1` WHERE",
+			mockBehaviour: func(query string) {
+				mock.ExpectExec(query).WithArgs("archived").WillReturnError(fmt.Errorf("db error"))
+			},
+			expectedAffected: 0,
+			expectedError:    fmt.Errorf("error on deleting values: %v", fmt.Errorf("db error")),
+		},
+	}
+
+	for _, tc := range testCases {
+		rm := newRecordManager(db, mysqlDialect{})
+		tc.mockBehaviour(tc.expectedQuery)
+
+		affected, err := rm.DeleteByFilter(tc.tableStruct, tc.filter)
+
+		assert.Equal(t, tc.expectedAffected, affected)
+		assert.Equal(t, tc.expectedError, err)
+	}
+}
+
+func TestRecordManageer_Upsert(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp)) //не требует полного совпадения запроса
+	if err != nil {
+		log.Fatalf("unable to mock db: %v", err)
+	}
+	defer db.Close()
+
+	testCases := []struct {
+		name            string
+		tableStruct     dto.Table
+		primaryKey      string
+		keyColumns      []string
+		data            map[string]interface{}
+		expectedQuery   string
+		mockBehaviour   func(query string)
+		expectedId      int
+		expectedCreated bool
+		expectedError   error
+	}{
+		{
+			name:          "created",
+			tableStruct:   testingSchema["example_table_1"],
+			primaryKey:    "primary_key",
+			keyColumns:    []string{"name"},
+			data:          map[string]interface{}{"name": "name value", "nullable_field": "value"},
+			expectedQuery: "SELECT `primary_key` FROM `example_table_1` WHERE `name` = \\? FOR UPDATE",
+			mockBehaviour: func(query string) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(query).WithArgs("name value").WillReturnRows(sqlmock.NewRows([]string{"primary_key"}))
+				mock.ExpectExec("INSERT INTO `example_table_1` \\(`name`, `nullable_field`\\) VALUES \\(\\?, \\?\\);").
+					WithArgs("name value", "value").WillReturnResult(sqlmock.NewResult(5, 1))
+				mock.ExpectCommit()
+			},
+			expectedId:      5,
+			expectedCreated: true,
+			expectedError:   nil,
+		},
+		{
+			name:          "updated",
+			tableStruct:   testingSchema["example_table_1"],
+			primaryKey:    "primary_key",
+			keyColumns:    []string{"primary_key"},
+			data:          map[string]interface{}{"primary_key": 3, "name": "name value"},
+			expectedQuery: "SELECT `primary_key` FROM `example_table_1` WHERE `primary_key` = \\? FOR UPDATE",
+			mockBehaviour: func(query string) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(query).WithArgs(3).WillReturnRows(sqlmock.NewRows([]string{"primary_key"}).AddRow(3))
+				mock.ExpectExec("UPDATE `example_table_1` SET `name` = \\? WHERE `primary_key` = \\?;").
+					WithArgs("name value", 3).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+			expectedId:      3,
+			expectedCreated: false,
+			expectedError:   nil,
+		},
+		{
+			// name - второй уникальный индекс: запись с таким name есть, но upsert идёт по первичному ключу
+			name:          "duplicate of another unique key",
+			tableStruct:   testingSchema["example_table_1"],
+			primaryKey:    "primary_key",
+			keyColumns:    []string{"primary_key"},
+			data:          map[string]interface{}{"primary_key": 3, "name": "taken"},
+			expectedQuery: "SELECT `primary_key` FROM `example_table_1` WHERE `primary_key` = \\? FOR UPDATE",
+			mockBehaviour: func(query string) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(query).WithArgs(3).WillReturnRows(sqlmock.NewRows([]string{"primary_key"}))
+				mock.ExpectExec("INSERT INTO `example_table_1`").WithArgs("taken", 3).
+					WillReturnError(&mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'taken' for key 'name'"})
+				mock.ExpectRollback()
+			},
+			expectedId:      0,
+			expectedCreated: false,
+			expectedError:   ErrDuplicateKey,
+		},
+		{
+			name:          "db error",
+			tableStruct:   testingSchema["example_table_1"],
+			primaryKey:    "primary_key",
+			keyColumns:    []string{"primary_key"},
+			data:          map[string]interface{}{"primary_key": 3, "name": "name value"},
+			expectedQuery: "SELECT `primary_key` FROM `example_table_1`",
+			mockBehaviour: func(query string) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(query).WithArgs(3).WillReturnError(fmt.Errorf("db error"))
+				mock.ExpectRollback()
+			},
+			expectedId:      0,
+			expectedCreated: false,
+			expectedError:   fmt.Errorf("error on upserting values: %v", fmt.Errorf("db error")),
+		},
+	}
+
+	for _, tc := range testCases {
+		rm := newRecordManager(db, mysqlDialect{})
+		tc.mockBehaviour(tc.expectedQuery)
+
+		id, created, err := rm.Upsert(tc.tableStruct, tc.primaryKey, tc.keyColumns, tc.data)
+
+		assert.Equal(t, tc.expectedId, id)
+		assert.Equal(t, tc.expectedCreated, created)
+		assert.Equal(t, tc.expectedError, err)
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRecordManageer_InTx(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp)) //не требует полного совпадения запроса
+	if err != nil {
+		log.Fatalf("unable to mock db: %v", err)
+	}
+	defer db.Close()
+
+	testCases := []struct {
+		name          string
+		fn            func(tx RecordManager) error
+		mockBehaviour func()
+		expectedError error
+	}{
+		{
+			name: "commit",
+			fn: func(tx RecordManager) error {
+				_, err := tx.Create(testingSchema["example_table_1"], map[string]interface{}{"name": "name value"})
+				return err
+			},
+			mockBehaviour: func() {
+				mock.ExpectBegin()
+				mock.ExpectExec("INSERT INTO `example_table_1`").WithArgs("name value").WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectCommit()
+			},
+			expectedError: nil,
+		},
+		{
+			name: "rollback",
+			fn: func(tx RecordManager) error {
+				if _, err := tx.Create(testingSchema["example_table_1"], map[string]interface{}{"name": "name value"}); err != nil {
+					return err
+				}
+				return tx.DeleteById(testingSchema["example_table_1"], "primary_key", 100500)
+			},
+			mockBehaviour: func() {
+				mock.ExpectBegin()
+				mock.ExpectExec("INSERT INTO `example_table_1`").WithArgs("name value").WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec("DELETE FROM `example_table_1`").WithArgs(100500).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectRollback()
+			},
+			expectedError: ErrRowNotFound,
+		},
+		{
+			name: "begin error",
+			fn:   func(tx RecordManager) error { return nil },
+			mockBehaviour: func() {
+				mock.ExpectBegin().WillReturnError(fmt.Errorf("db error"))
+			},
+			expectedError: fmt.Errorf("unable to begin transaction: %v", fmt.Errorf("db error")),
+		},
+	}
+
+	for _, tc := range testCases {
+		rm := newRecordManager(db, mysqlDialect{})
+		tc.mockBehaviour()
+
+		err := rm.InTx(tc.fn)
+
+		assert.Equal(t, tc.expectedError, err)
+		assert.Equal(t, nil, mock.ExpectationsWereMet())
+	}
+}
+
+func TestRecordManageer_GetByIdForUpdate(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp)) //не требует полного совпадения запроса
+	if err != nil {
+		log.Fatalf("unable to mock db: %+v", err)
+	}
+	defer db.Close()
+
+	rows := sqlmock.NewRows([]string{"primary_key", "name", "nullable_field"}).AddRow(3, "name 3", nil)
+	mock.ExpectQuery("SELECT .+ FROM `example_table_1` WHERE `primary_key` = \\? FOR UPDATE").WithArgs(3).WillReturnRows(rows)
+
+	rm := newRecordManager(db, mysqlDialect{})
+	data, err := rm.GetByIdForUpdate(testingSchema["example_table_1"], "primary_key", 3)
+
+	assert.Equal(t, map[string]interface{}{"primary_key": int64(3), "name": "name 3", "nullable_field": nil}, data)
+	assert.Equal(t, nil, err)
+}
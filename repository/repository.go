@@ -1,6 +1,7 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
 	"hw6coursera/dto"
 )
@@ -10,24 +11,72 @@ import (
 type Explorer interface {
 	GetTableNames() ([]string, error)
 	GetColumns(tableName string) ([]dto.Column, error)
+	GetIndexes(tableName string) ([]dto.Index, error)
+	GetForeignKeys(tableName string) ([]dto.ForeignKey, error)
+	// EstimateRows - примерное число строк по статистике базы, без полного прохода по таблице; -1 - статистики нет
+	EstimateRows(tableName string) (int64, error)
 }
 
 type RecordManager interface {
-	GetAllRecords(table dto.Table, limit int, offset int) (data []map[string]interface{}, err error)
+	GetAllRecords(table dto.Table, filter dto.Filter, limit int, offset int) (data []map[string]interface{}, err error)
+	CountRecords(table dto.Table, filter dto.Filter) (count int, err error)
+	// EachRecord передаёт в fn записи по фильтру по одной, не накапливая их в памяти. Ошибка из fn
+	// или отмена ctx прерывают чтение
+	EachRecord(ctx context.Context, table dto.Table, filter dto.Filter, fn func(record map[string]interface{}) error) (err error)
 	GetById(table dto.Table, primaryKey string, id int) (data map[string]interface{}, err error)
+	// GetByIdForUpdate блокирует запись до конца транзакции, вне InTx не имеет смысла
+	GetByIdForUpdate(table dto.Table, primaryKey string, id int) (data map[string]interface{}, err error)
 	Create(table dto.Table, data map[string]interface{}) (lastInsertedId int, err error)
+	Upsert(table dto.Table, primaryKey string, keyColumns []string, data map[string]interface{}) (id int, created bool, err error)
 	UpdateById(table dto.Table, primaryKey string, id int, data map[string]interface{}) (err error)
 	DeleteById(table dto.Table, primaryKey string, id int) (err error)
+	UpdateByFilter(table dto.Table, filter dto.Filter, data map[string]interface{}) (rowsAffected int, err error)
+	DeleteByFilter(table dto.Table, filter dto.Filter) (rowsAffected int, err error)
+	// InTx выполняет fn в одной транзакции: ошибка из fn откатывает всё, что было сделано через tx
+	InTx(fn func(tx RecordManager) error) (err error)
+}
+
+// AuditLog - журнал изменений записей. rm - менеджер записей, через который идёт изменение:
+// журнал, который хранится в базе, пишется в той же транзакции
+type AuditLog interface {
+	Write(rm RecordManager, entry dto.AuditEntry) (err error)
+	History(rm RecordManager, table string, recordId int) (entries []dto.AuditEntry, err error)
+	// TableName - таблица журнала в базе, пустая строка для журнала вне базы
+	TableName() string
 }
 
 type Repository struct {
 	Explorer
 	RecordManager
+	AuditLog // nil - журнал изменений не ведётся
 }
 
+// NewRepository - репозиторий для MySQL
 func NewRepository(db *sql.DB) *Repository {
 	return &Repository{
 		Explorer:      newExplorer(db),
-		RecordManager: newRecordManager(db),
+		RecordManager: newRecordManager(db, mysqlDialect{}),
+	}
+}
+
+// NewRepositoryFor - репозиторий для базы driver (MySQL, Postgres, SQLite)
+func NewRepositoryFor(db *sql.DB, driver string) (*Repository, error) {
+	d, err := getDialect(driver)
+	if err != nil {
+		return nil, err
+	}
+
+	var explorer Explorer
+	switch driver {
+	case Postgres:
+		explorer = newPgExplorer(db)
+	case SQLite:
+		explorer = newSqliteExplorer(db)
+	default:
+		explorer = newExplorer(db)
 	}
+	return &Repository{
+		Explorer:      explorer,
+		RecordManager: newRecordManager(db, d),
+	}, nil
 }
@@ -0,0 +1,293 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"hw6coursera/dto"
+	"strings"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+type sqliteDialect struct{}
+
+func (sqliteDialect) quote(name string) string {
+	return quoteIdentifier(`"`, name)
+}
+
+func (sqliteDialect) rebind(query string) string {
+	return query
+}
+
+func (d sqliteDialect) insert(db querier, table dto.Table, data map[string]interface{}) (int, error) {
+	fields, placehoders, sqlVals := getInsertParams(d, data)
+	values := fmt.Sprintf("(%s) VALUES (%s)", fields, placehoders)
+	if len(data) == 0 {
+		values = "DEFAULT VALUES"
+	}
+
+	queryString := fmt.Sprintf("INSERT INTO %s %s;", d.quote(table.Name), values)
+	res, err := db.Exec(queryString, sqlVals...)
+	if err != nil {
+		if dataErr := dataError(d, err); dataErr != nil {
+			return 0, dataErr
+		}
+		return 0, fmt.Errorf("error on inserting values: %v", err)
+	}
+
+	lastInsertId, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("error on LastInsertId(): %v", err)
+	}
+	return int(lastInsertId), nil
+}
+
+// SQLite не сообщает, вставлена запись или обновлена, поэтому сначала ищем её по ключу.
+// Писатель в SQLite всегда один, так что между поиском и вставкой запись не появится
+func (d sqliteDialect) upsert(db querier, table dto.Table, primaryKey string, keyColumns []string, data map[string]interface{}) (int, bool, error) {
+	conditions := make([]string, 0, len(keyColumns))
+	keyVals := make([]interface{}, 0, len(keyColumns))
+	for _, k := range keyColumns {
+		conditions = append(conditions, fmt.Sprintf("%s = ?", d.quote(k)))
+		keyVals = append(keyVals, data[k])
+	}
+	var existing int
+	queryString := fmt.Sprintf("SELECT %s FROM %s WHERE %s;", d.quote(primaryKey), d.quote(table.Name), strings.Join(conditions, " AND "))
+	err := db.QueryRow(queryString, keyVals...).Scan(&existing)
+	if err != nil && err != sql.ErrNoRows {
+		return 0, false, fmt.Errorf("error on upserting values: %v", err)
+	}
+	created := err == sql.ErrNoRows
+
+	fields, placehoders, sqlVals := getInsertParams(d, data)
+	queryTemplate := "INSERT INTO %s (%s) VALUES (%s) ON CONFLICT (%s) DO UPDATE SET %s RETURNING %s;"
+	queryString = fmt.Sprintf(queryTemplate, d.quote(table.Name), fields, placehoders,
+		quoteAll(d, keyColumns), getConflictUpdateParams(d, data, primaryKey, keyColumns), d.quote(primaryKey))
+
+	var id int
+	err = db.QueryRow(queryString, sqlVals...).Scan(&id)
+	if dataErr := dataError(d, err); dataErr != nil { // ON CONFLICT ловит только выбранный ключ
+		return 0, false, dataErr
+	} else if err != nil {
+		return 0, false, fmt.Errorf("error on upserting values: %v", err)
+	}
+	return id, created, nil
+}
+
+func (sqliteDialect) isDuplicateKey(err error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) &&
+		(sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique || sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey)
+}
+
+func (sqliteDialect) isInvalidData(err error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) &&
+		(sqliteErr.Code == sqlite3.ErrConstraint || sqliteErr.Code == sqlite3.ErrMismatch || sqliteErr.Code == sqlite3.ErrTooBig)
+}
+
+// блокировок строк в SQLite нет: транзакция, которая пишет, и так блокирует всю базу
+func (sqliteDialect) forUpdate() string {
+	return ""
+}
+
+func (d sqliteDialect) auditTableDDL(name string) []string {
+	return []string{
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (`+
+			"id INTEGER PRIMARY KEY AUTOINCREMENT, "+
+			"table_name TEXT NOT NULL, "+
+			"record_id INTEGER NOT NULL, "+
+			"operation TEXT NOT NULL, "+
+			"actor TEXT NOT NULL, "+
+			"created_at TEXT NOT NULL, "+
+			"changes TEXT NOT NULL);", d.quote(name)),
+		fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %s ON %s (table_name, record_id);`, d.quote(name+"_record_history"), d.quote(name)),
+	}
+}
+
+// sqliteExplorer читает схему через sqlite_master и PRAGMA
+type sqliteExplorer struct {
+	db *sql.DB
+}
+
+// GetTableNames implements Explorer
+func (e *sqliteExplorer) GetTableNames() ([]string, error) {
+	rows, err := e.db.Query(`SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tableNames := make([]string, 0)
+	for rows.Next() {
+		var n string
+		if err := rows.Scan(&n); err != nil {
+			return nil, err
+		}
+		tableNames = append(tableNames, n)
+	}
+	return tableNames, rows.Err()
+}
+
+// GetColumns implements Explorer
+func (e *sqliteExplorer) GetColumns(tableName string) ([]dto.Column, error) {
+	// в table_xinfo есть и GENERATED-колонки: hidden = 2 (VIRTUAL) или 3 (STORED)
+	rows, err := e.db.Query(`SELECT name, type, "notnull", pk, hidden FROM pragma_table_xinfo(?) WHERE hidden <> 1 ORDER BY cid`, tableName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns := make([]dto.Column, 0)
+	for rows.Next() {
+		var name, typeName string
+		var notNull bool
+		var pk, hidden int
+		if err := rows.Scan(&name, &typeName, &notNull, &pk, &hidden); err != nil {
+			return nil, err
+		}
+		// pk - номер колонки в первичном ключе, составные ключи не поддерживаем - берём первую колонку.
+		// INTEGER PRIMARY KEY - это rowid, null в нём не бывает, хотя notnull у него не стоит
+		col := dto.Column{
+			Name:         name,
+			ColumnType:   sqliteColumnType(typeName),
+			Nullable:     !notNull && pk == 0,
+			IsPrimaryKey: pk == 1,
+			Generated:    hidden > 1 || (pk == 1 && strings.EqualFold(typeName, "INTEGER")),
+		}
+		if col.ColumnType == dto.StringType { // длину SQLite не проверяет, но она объявлена в схеме
+			col.MaxLength = charLength(typeName)
+		}
+		columns = append(columns, col)
+	}
+	return columns, rows.Err()
+}
+
+// GetIndexes implements Explorer
+func (e *sqliteExplorer) GetIndexes(tableName string) ([]dto.Index, error) {
+	rows, err := e.db.Query(`SELECT il.name, il."unique", il.origin, ii.name
+		FROM pragma_index_list(?) AS il, pragma_index_info(il.name) AS ii
+		ORDER BY il.name, ii.seqno`, tableName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// колонки составного индекса идут подряд, поэтому достаточно сравнивать с последним индексом
+	indexes := make([]dto.Index, 0)
+	lastName := ""
+	for rows.Next() {
+		var name, origin, column string
+		var unique bool
+		if err := rows.Scan(&name, &unique, &origin, &column); err != nil {
+			return nil, err
+		}
+		if len(indexes) == 0 || lastName != name {
+			idx := dto.Index{Name: name, Unique: unique}
+			if origin == "pk" { // как в mysql, чтобы ?key=PRIMARY работал одинаково
+				idx.Name = dto.PrimaryIndexName
+			}
+			indexes = append(indexes, idx)
+			lastName = name
+		}
+		last := &indexes[len(indexes)-1]
+		last.Columns = append(last.Columns, column)
+	}
+	return indexes, rows.Err()
+}
+
+// GetForeignKeys implements Explorer
+func (e *sqliteExplorer) GetForeignKeys(tableName string) ([]dto.ForeignKey, error) {
+	// имён у внешних ключей в SQLite нет, только номер; "to" пустой, если ссылка на первичный ключ
+	rows, err := e.db.Query(`SELECT id, "table", "from", "to" FROM pragma_foreign_key_list(?) ORDER BY id, seq`, tableName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	fks := make([]dto.ForeignKey, 0)
+	lastID := -1
+	for rows.Next() {
+		var id int
+		var refTable, column string
+		var refColumn sql.NullString
+		if err := rows.Scan(&id, &refTable, &column, &refColumn); err != nil {
+			return nil, err
+		}
+		if len(fks) == 0 || lastID != id {
+			fks = append(fks, dto.ForeignKey{Name: fmt.Sprintf("%s_fk_%d", tableName, id), RefTable: refTable})
+			lastID = id
+		}
+		last := &fks[len(fks)-1]
+		last.Columns = append(last.Columns, column)
+		last.RefColumns = append(last.RefColumns, refColumn.String)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	for i, fk := range fks {
+		if fk.RefColumns[0] != "" {
+			continue
+		}
+		if fks[i].RefColumns, err = e.primaryKeyColumns(fk.RefTable); err != nil {
+			return nil, err
+		}
+	}
+	return fks, nil
+}
+
+// EstimateRows implements Explorer
+func (e *sqliteExplorer) EstimateRows(tableName string) (int64, error) {
+	// статистики без ANALYZE нет, а база обычно небольшая и локальная - считаем точно
+	var count int64
+	if err := e.db.QueryRow(fmt.Sprintf("SELECT count(*) FROM %s", sqliteDialect{}.quote(tableName))).Scan(&count); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+func (e *sqliteExplorer) primaryKeyColumns(tableName string) ([]string, error) {
+	rows, err := e.db.Query(`SELECT name FROM pragma_table_info(?) WHERE pk > 0 ORDER BY pk`, tableName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns := make([]string, 0)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		columns = append(columns, name)
+	}
+	return columns, rows.Err()
+}
+
+// Правила определения type affinity из документации SQLite, порядок проверок важен
+func sqliteColumnType(typeName string) string {
+	t := strings.ToUpper(typeName)
+	switch {
+	case strings.Contains(t, "INT"):
+		return dto.IntType
+	case strings.Contains(t, "CHAR") || strings.Contains(t, "CLOB") || strings.Contains(t, "TEXT"):
+		return dto.StringType
+	case strings.Contains(t, "BLOB") || t == "":
+		return dto.UnknownType
+	case strings.Contains(t, "REAL") || strings.Contains(t, "FLOA") || strings.Contains(t, "DOUB"):
+		return dto.FloatType
+	case strings.Contains(t, "DECIMAL") || strings.Contains(t, "NUMERIC"):
+		return dto.FloatType // NUMERIC affinity, как DECIMAL в mysql
+	default:
+		return dto.UnknownType
+	}
+}
+
+func newSqliteExplorer(db *sql.DB) *sqliteExplorer {
+	return &sqliteExplorer{
+		db: db,
+	}
+}
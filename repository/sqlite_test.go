@@ -0,0 +1,241 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hw6coursera/dto"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func newSqliteTestRepository(t *testing.T) *Repository {
+	db, driver, err := Open("sqlite://:memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	mustExec(t, db, `CREATE TABLE items (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		title VARCHAR(255) NOT NULL UNIQUE,
+		price REAL,
+		amount NUMERIC,
+		payload BLOB,
+		created DATETIME
+	);`)
+
+	repo, err := NewRepositoryFor(db, driver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return repo
+}
+
+func TestSqlite_Explorer(t *testing.T) {
+	repo := newSqliteTestRepository(t)
+
+	names, err := repo.GetTableNames()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"items"}, names) // без служебной sqlite_sequence
+
+	columns, err := repo.GetColumns("items")
+	assert.NoError(t, err)
+	assert.Equal(t, []dto.Column{
+		{Name: "id", ColumnType: dto.IntType, Nullable: false, IsPrimaryKey: true, Generated: true},
+		{Name: "title", ColumnType: dto.StringType, Nullable: false, MaxLength: 255},
+		{Name: "price", ColumnType: dto.FloatType, Nullable: true},
+		{Name: "amount", ColumnType: dto.FloatType, Nullable: true},
+		{Name: "payload", ColumnType: dto.UnknownType, Nullable: true},
+		{Name: "created", ColumnType: dto.UnknownType, Nullable: true},
+	}, columns)
+
+	indexes, err := repo.GetIndexes("items")
+	assert.NoError(t, err)
+	assert.Equal(t, []dto.Index{
+		{Name: "sqlite_autoindex_items_1", Columns: []string{"title"}, Unique: true},
+	}, indexes)
+}
+
+func TestSqlite_generatedColumns(t *testing.T) {
+	db, driver, err := Open("sqlite://:memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	mustExec(t, db, `CREATE TABLE totals (
+		code CHAR(3) PRIMARY KEY,
+		a INT NOT NULL,
+		b INT GENERATED ALWAYS AS (a * 2) VIRTUAL,
+		c INT AS (a * 3) STORED
+	);`)
+	repo, err := NewRepositoryFor(db, driver)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	columns, err := repo.GetColumns("totals")
+	assert.NoError(t, err)
+	assert.Equal(t, []dto.Column{
+		{Name: "code", ColumnType: dto.StringType, IsPrimaryKey: true, MaxLength: 3}, // не rowid - значение задаёт клиент
+		{Name: "a", ColumnType: dto.IntType},
+		{Name: "b", ColumnType: dto.IntType, Nullable: true, Generated: true},
+		{Name: "c", ColumnType: dto.IntType, Nullable: true, Generated: true},
+	}, columns)
+}
+
+func TestSqlite_foreignKeys(t *testing.T) {
+	db, driver, err := Open("sqlite://:memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	mustExec(t, db, `CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT);`)
+	mustExec(t, db, `CREATE TABLE pairs (x INT, y INT, PRIMARY KEY (x, y));`)
+	mustExec(t, db, `CREATE TABLE items (
+		id INTEGER PRIMARY KEY,
+		owner_id INT REFERENCES users,
+		a INT,
+		b INT,
+		FOREIGN KEY (a, b) REFERENCES pairs (x, y)
+	);`)
+	mustExec(t, db, `INSERT INTO users (name) VALUES ('a'), ('b');`)
+	repo, err := NewRepositoryFor(db, driver)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// номера ключей SQLite раздаёт с конца объявления; ссылка без колонок - на первичный ключ
+	foreignKeys, err := repo.GetForeignKeys("items")
+	assert.NoError(t, err)
+	assert.Equal(t, []dto.ForeignKey{
+		{Name: "items_fk_0", Columns: []string{"a", "b"}, RefTable: "pairs", RefColumns: []string{"x", "y"}},
+		{Name: "items_fk_1", Columns: []string{"owner_id"}, RefTable: "users", RefColumns: []string{"id"}},
+	}, foreignKeys)
+
+	foreignKeys, err = repo.GetForeignKeys("users")
+	assert.NoError(t, err)
+	assert.Empty(t, foreignKeys)
+
+	estimate, err := repo.EstimateRows("users")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), estimate)
+}
+
+func TestSqlite_RecordManager(t *testing.T) {
+	repo := newSqliteTestRepository(t)
+	columns, err := repo.GetColumns("items")
+	if err != nil {
+		t.Fatal(err)
+	}
+	table := dto.Table{Name: "items", Columns: columns[:3]}
+
+	id, err := repo.Create(table, map[string]interface{}{"title": "first", "price": 1.5})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, id)
+
+	_, err = repo.Create(table, map[string]interface{}{"price": 1.5}) // title NOT NULL
+	assert.Equal(t, ErrInvalidData, err)
+
+	id, created, err := repo.Upsert(table, "id", []string{"title"}, map[string]interface{}{"title": "first", "price": 2.5})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, id)
+	assert.False(t, created)
+
+	id, created, err = repo.Upsert(table, "id", []string{"title"}, map[string]interface{}{"title": "second"})
+	assert.NoError(t, err)
+	assert.NotEqual(t, 1, id) // с AUTOINCREMENT upsert существующей записи тоже расходует id
+	assert.True(t, created)
+
+	// по первичному ключу записи нет, но title занят записью 1 - это не обновление записи 1
+	_, _, err = repo.Upsert(table, "id", []string{"id"}, map[string]interface{}{"id": 100, "title": "first"})
+	assert.Equal(t, ErrDuplicateKey, err)
+
+	err = repo.UpdateById(table, "id", id, map[string]interface{}{"title": "first"})
+	assert.Equal(t, ErrDuplicateKey, err)
+
+	err = repo.InTx(func(tx RecordManager) error {
+		record, err := tx.GetByIdForUpdate(table, "id", 1)
+		if err != nil {
+			return err
+		}
+		assert.Equal(t, map[string]interface{}{"id": int64(1), "title": "first", "price": 2.5}, record)
+		if err := tx.UpdateById(table, "id", 1, map[string]interface{}{"price": nil}); err != nil {
+			return err
+		}
+		return fmt.Errorf("rollback")
+	})
+	assert.EqualError(t, err, "rollback")
+
+	records, err := repo.GetAllRecords(table, dto.Filter{{Column: "price", Operator: dto.OpNe, Value: nil}}, 5, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, []map[string]interface{}{{"id": int64(1), "title": "first", "price": 2.5}}, records)
+
+	affected, err := repo.DeleteByFilter(table, dto.Filter{{Column: "title", Operator: dto.OpLike, Value: "sec%"}})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, affected)
+}
+
+func TestSqlite_EachRecord(t *testing.T) {
+	repo := newSqliteTestRepository(t)
+	columns, err := repo.GetColumns("items")
+	if err != nil {
+		t.Fatal(err)
+	}
+	table := dto.Table{Name: "items", Columns: columns[:3]}
+	for i := 1; i <= 3; i++ {
+		if _, err := repo.Create(table, map[string]interface{}{"title": fmt.Sprintf("item %d", i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var titles []interface{}
+	err = repo.EachRecord(context.Background(), table, dto.Filter{{Column: "id", Operator: dto.OpGt, Value: 1}}, func(record map[string]interface{}) error {
+		titles = append(titles, record["title"])
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{"item 2", "item 3"}, titles)
+
+	// ошибка из fn прерывает чтение
+	stop := errors.New("stop")
+	count := 0
+	err = repo.EachRecord(context.Background(), table, nil, func(record map[string]interface{}) error {
+		count++
+		return stop
+	})
+	assert.Equal(t, stop, err)
+	assert.Equal(t, 1, count)
+
+	// клиент ушёл посреди выгрузки
+	ctx, cancel := context.WithCancel(context.Background())
+	count = 0
+	err = repo.EachRecord(ctx, table, nil, func(record map[string]interface{}) error {
+		count++
+		cancel()
+		return nil
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 1, count)
+}
+
+func TestSqlite_AuditTable(t *testing.T) {
+	db, driver, err := Open("sqlite://:memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	audit, err := NewAuditTable(db, driver, "audit_log")
+	assert.NoError(t, err)
+
+	rm := newRecordManager(db, sqliteDialect{})
+	assert.NoError(t, audit.Write(rm, testingAuditEntry))
+
+	entries, err := audit.History(rm, testingAuditEntry.Table, testingAuditEntry.RecordID)
+	assert.NoError(t, err)
+	assert.Equal(t, []dto.AuditEntry{testingAuditEntry}, entries)
+}
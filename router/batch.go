@@ -0,0 +1,110 @@
+package router
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hw6coursera/dto"
+	"hw6coursera/logging"
+	"hw6coursera/service"
+	"net/http"
+)
+
+// batchOperation - операция пакета в том виде, в котором приходит в json.
+// Значения могут быть строками, числами или null, дальше они превращаются в строки,
+// как если бы пришли в x-www-form-urlencoded
+type batchOperation struct {
+	Op    string                 `json:"op"`
+	Table string                 `json:"table"`
+	ID    interface{}            `json:"id"`
+	Data  map[string]interface{} `json:"data"`
+}
+
+// Batch implements RequestProcessor
+func (rp *requestProcessor) batch(w http.ResponseWriter, r *http.Request) {
+	decoder := json.NewDecoder(r.Body)
+	decoder.UseNumber() // чтобы большие id не превращались во float
+	var rawOps []batchOperation
+	if err := decoder.Decode(&rawOps); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("invalid batch"))
+		return
+	}
+
+	ops := make([]dto.BatchOperation, 0, len(rawOps))
+	for _, raw := range rawOps {
+		op := dto.BatchOperation{
+			Op:    raw.Op,
+			Table: raw.Table,
+			Data:  make(map[string]string, len(raw.Data)),
+		}
+		if raw.ID != nil {
+			op.ID = formValue(raw.ID)
+		}
+		for k, v := range raw.Data {
+			op.Data[k] = formValue(v)
+		}
+		ops = append(ops, op)
+	}
+
+	results, err := rp.service.Batch(r.Context(), ops)
+	status := http.StatusOK
+	switch {
+	case err == service.ErrEmptyBatch:
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	case errors.As(err, &service.ErrBatchTooLarge{}):
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		w.Write([]byte(err.Error()))
+		return
+	case errors.As(err, &service.ErrBatchOperation{}):
+		status = batchErrorStatus(err)
+		if status == http.StatusInternalServerError {
+			// текст ошибки базы клиенту не отдаём, он остаётся в логе
+			logging.FromContext(r.Context()).Error("batch operation failed", "err", err)
+			results[len(results)-1].Error = "unable to execute operation"
+		}
+	case err != nil:
+		logging.FromContext(r.Context()).Error("unable to execute batch", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte("unable to execute batch"))
+		return
+	}
+
+	encodeResponse(w, r, status, "application/json", results)
+}
+
+func batchErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrTableNotFound) || errors.Is(err, service.ErrRecordNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrReadOnlyTable):
+		return http.StatusMethodNotAllowed
+	case errors.Is(err, service.ErrForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, service.ErrConflict):
+		return http.StatusConflict
+	case errors.Is(err, service.ErrMissingUpdData) || errors.Is(err, service.ErrRejectedRecord) ||
+		errors.As(err, &service.ErrReadOnlyColumn{}) ||
+		errors.As(err, &service.ErrTooLong{}) ||
+		errors.As(err, &service.ErrType{}) ||
+		errors.As(err, &service.ErrCannotBeNull{}) ||
+		errors.As(err, &service.ErrUnknownOperation{}) ||
+		errors.As(err, &service.ErrInvalidId{}):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func formValue(v interface{}) string {
+	switch value := v.(type) {
+	case nil:
+		return "%00" // так null кодируется в x-www-form-urlencoded
+	case string:
+		return value
+	default: // json.Number, bool
+		return fmt.Sprint(value)
+	}
+}
@@ -0,0 +1,125 @@
+package router
+
+import (
+	"bytes"
+	"fmt"
+	"hw6coursera/dto"
+	"hw6coursera/service"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRouter_batch(t *testing.T) {
+	testCases := []struct {
+		name              string
+		requestBody       string
+		expectedSatusCode int
+		expectedBody      string
+		mockBehaviour     func(ms *service.MockRecordService)
+	}{
+		{
+			name:              "OK",
+			requestBody:       `[{"op": "create", "table": "items", "data": {"title": "new", "level": 5, "updated": null}}, {"op": "delete", "table": "items", "id": "$0.id"}]`,
+			expectedSatusCode: 200,
+			expectedBody:      "[{\"index\":0,\"op\":\"create\",\"table\":\"items\",\"id\":3},{\"index\":1,\"op\":\"delete\",\"table\":\"items\",\"id\":3}]\n",
+			mockBehaviour: func(ms *service.MockRecordService) {
+				ops := []dto.BatchOperation{
+					{Op: "create", Table: "items", Data: map[string]string{"title": "new", "level": "5", "updated": "%00"}},
+					{Op: "delete", Table: "items", ID: "$0.id", Data: map[string]string{}},
+				}
+				ms.EXPECT().Batch(gomock.Any(), ops).Return([]dto.BatchResult{
+					{Index: 0, Op: "create", Table: "items", ID: 3},
+					{Index: 1, Op: "delete", Table: "items", ID: 3},
+				}, nil)
+			},
+		},
+		{
+			name:              "failed operation",
+			requestBody:       `[{"op": "update", "table": "items", "id": 100500, "data": {"title": "new"}}]`,
+			expectedSatusCode: 404,
+			expectedBody:      "[{\"index\":0,\"op\":\"update\",\"table\":\"items\",\"error\":\"record not found\"}]\n",
+			mockBehaviour: func(ms *service.MockRecordService) {
+				ops := []dto.BatchOperation{
+					{Op: "update", Table: "items", ID: "100500", Data: map[string]string{"title": "new"}},
+				}
+				ms.EXPECT().Batch(gomock.Any(), ops).Return([]dto.BatchResult{
+					{Index: 0, Op: "update", Table: "items", Error: "record not found"},
+				}, service.ErrBatchOperation{Index: 0, Err: service.ErrRecordNotFound})
+			},
+		},
+		{
+			name:              "conflict",
+			requestBody:       `[{"op": "update", "table": "items", "id": 1, "data": {"title": "taken"}}]`,
+			expectedSatusCode: 409,
+			expectedBody:      "[{\"index\":0,\"op\":\"update\",\"table\":\"items\",\"error\":\"another record has the same unique value\"}]\n",
+			mockBehaviour: func(ms *service.MockRecordService) {
+				ms.EXPECT().Batch(gomock.Any(), gomock.Any()).Return([]dto.BatchResult{
+					{Index: 0, Op: "update", Table: "items", Error: service.ErrConflict.Error()},
+				}, service.ErrBatchOperation{Index: 0, Err: service.ErrConflict})
+			},
+		},
+		{
+			name:              "database error in operation",
+			requestBody:       `[{"op": "delete", "table": "items", "id": 1}]`,
+			expectedSatusCode: 500,
+			expectedBody:      "[{\"index\":0,\"op\":\"delete\",\"table\":\"items\",\"error\":\"unable to execute operation\"}]\n",
+			mockBehaviour: func(ms *service.MockRecordService) {
+				dbErr := fmt.Errorf("error on deleting values: Error 1205: Lock wait timeout exceeded")
+				ms.EXPECT().Batch(gomock.Any(), gomock.Any()).Return([]dto.BatchResult{
+					{Index: 0, Op: "delete", Table: "items", Error: dbErr.Error()},
+				}, service.ErrBatchOperation{Index: 0, Err: dbErr})
+			},
+		},
+		{
+			name:              "too many operations",
+			requestBody:       `[{"op": "delete", "table": "items", "id": 1}, {"op": "delete", "table": "items", "id": 2}]`,
+			expectedSatusCode: 413,
+			expectedBody:      "batch has more than 1 operations",
+			mockBehaviour: func(ms *service.MockRecordService) {
+				ms.EXPECT().Batch(gomock.Any(), gomock.Any()).Return(nil, service.ErrBatchTooLarge{Limit: 1})
+			},
+		},
+		{
+			name:              "invalid json",
+			requestBody:       `{"op": "create"`,
+			expectedSatusCode: 400,
+			expectedBody:      "invalid batch",
+			mockBehaviour:     func(ms *service.MockRecordService) {},
+		},
+		{
+			name:              "service error",
+			requestBody:       `[{"op": "delete", "table": "items", "id": 1}]`,
+			expectedSatusCode: 500,
+			expectedBody:      "unable to execute batch",
+			mockBehaviour: func(ms *service.MockRecordService) {
+				ms.EXPECT().Batch(gomock.Any(), gomock.Any()).Return(nil, fmt.Errorf("unable to begin transaction"))
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := gomock.NewController(t)
+			defer c.Finish()
+
+			recordService := service.NewMockRecordService(c)
+			tc.mockBehaviour(recordService)
+
+			servicies := &service.Service{
+				RecordService: recordService,
+			}
+
+			router := NewRouter(servicies, DefaultOptions())
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest("POST", "/_batch", bytes.NewBufferString(tc.requestBody))
+
+			router.ServeHTTP(w, r)
+
+			assert.Equal(t, tc.expectedSatusCode, w.Result().StatusCode)
+			assert.Equal(t, tc.expectedBody, w.Body.String())
+		})
+	}
+}
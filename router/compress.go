@@ -0,0 +1,168 @@
+package router
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// сжатие ответов: gzip или deflate, если клиент их принимает
+const (
+	encodingGzip    = "gzip"
+	encodingDeflate = "deflate"
+)
+
+// compressMinSize - ответы короче не сжимаем: ошибки и короткие сообщения от сжатия только растут
+const compressMinSize = 1024
+
+// Compressor сжимает ответы next по Accept-Encoding
+type Compressor struct {
+	next http.Handler
+}
+
+func NewCompressor(next http.Handler) *Compressor {
+	return &Compressor{next: next}
+}
+
+func (c *Compressor) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+	if encoding == "" || r.Method == "HEAD" {
+		w.Header().Add("Vary", "Accept-Encoding")
+		c.next.ServeHTTP(w, r)
+		return
+	}
+
+	cw := &compressWriter{ResponseWriter: w, encoding: encoding}
+	defer cw.Close()
+	c.next.ServeHTTP(cw, r)
+}
+
+// negotiateEncoding выбирает gzip или deflate с наибольшим q, при равных - gzip; "" - без сжатия
+func negotiateEncoding(accept string) string {
+	best, bestQ := "", 0.0
+	for _, part := range strings.Split(accept, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if params = strings.TrimSpace(params); strings.HasPrefix(params, "q=") {
+			var err error
+			if q, err = strconv.ParseFloat(strings.TrimPrefix(params, "q="), 64); err != nil {
+				continue
+			}
+		}
+		encoding := strings.ToLower(strings.TrimSpace(name))
+		if encoding == "*" {
+			encoding = encodingGzip
+		}
+		if q <= 0 || encoding != encodingGzip && encoding != encodingDeflate {
+			continue
+		}
+		if q > bestQ || q == bestQ && encoding == encodingGzip {
+			best, bestQ = encoding, q
+		}
+	}
+	return best
+}
+
+// compressWriter копит начало ответа, пока не станет ясно, стоит ли его сжимать: до compressMinSize
+// байт, явного Flush (потоковая выгрузка) или конца ответа. Тело пишется без буфера на весь ответ
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+	status   int
+	buf      []byte
+	started  bool
+	w        io.WriteCloser // nil - ответ идёт без сжатия
+}
+
+func (cw *compressWriter) WriteHeader(status int) {
+	if cw.status == 0 {
+		cw.status = status
+	}
+}
+
+func (cw *compressWriter) Write(p []byte) (int, error) {
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+	if !cw.started {
+		cw.buf = append(cw.buf, p...)
+		if len(cw.buf) < compressMinSize {
+			return len(p), nil
+		}
+		if err := cw.start(true); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+	if cw.w != nil {
+		return cw.w.Write(p)
+	}
+	return cw.ResponseWriter.Write(p)
+}
+
+// Flush implements http.Flusher
+func (cw *compressWriter) Flush() {
+	if !cw.started {
+		cw.start(true) // дальше ответ пойдёт частями, и ждать его конца нельзя
+	}
+	if f, ok := cw.w.(interface{ Flush() error }); ok {
+		f.Flush()
+	}
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Close отправляет то, что ещё в буфере, и дописывает сжатый поток
+func (cw *compressWriter) Close() error {
+	if !cw.started {
+		if err := cw.start(len(cw.buf) >= compressMinSize); err != nil {
+			return err
+		}
+	}
+	if cw.w != nil {
+		return cw.w.Close()
+	}
+	return nil
+}
+
+// start отправляет заголовки и накопленное начало ответа. Ответ, который уже сжал обработчик,
+// и ответы без тела не сжимаются
+func (cw *compressWriter) start(compress bool) error {
+	cw.started = true
+	h := cw.Header()
+	h.Add("Vary", "Accept-Encoding")
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+	if compress && h.Get("Content-Encoding") == "" && bodyAllowed(cw.status) {
+		h.Set("Content-Encoding", cw.encoding)
+		h.Del("Content-Length")
+		if cw.encoding == encodingGzip {
+			cw.w = gzip.NewWriter(cw.ResponseWriter)
+		} else {
+			cw.w = zlib.NewWriter(cw.ResponseWriter) // deflate в HTTP - это поток zlib
+		}
+	}
+	cw.ResponseWriter.WriteHeader(cw.status)
+
+	buf := cw.buf
+	cw.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	var err error
+	if cw.w != nil {
+		_, err = cw.w.Write(buf)
+	} else {
+		_, err = cw.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+func bodyAllowed(status int) bool {
+	return status >= 200 && status != http.StatusNoContent && status != http.StatusNotModified
+}
@@ -0,0 +1,128 @@
+package router
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	testCases := map[string]string{
+		"":                             "",
+		"identity":                     "",
+		"gzip":                         "gzip",
+		"deflate, gzip":                "gzip",
+		"gzip;q=0.5, deflate":          "deflate",
+		"br, *":                        "gzip",
+		"GZIP;q=0, deflate;q=0.1":      "deflate",
+		"gzip;q=0, deflate;q=0, br":    "",
+		"gzip;q=abc, deflate;q=0.3":    "deflate",
+		" deflate ; q=0.8 ,gzip;q=0.8": "gzip",
+	}
+	for accept, expected := range testCases {
+		assert.Equal(t, expected, negotiateEncoding(accept), accept)
+	}
+}
+
+func TestCompressor(t *testing.T) {
+	big := strings.Repeat(`{"id":1,"title":"memcache"},`, 100)
+
+	testCases := []struct {
+		name             string
+		acceptEncoding   string
+		status           int
+		body             string
+		flush            bool
+		expectedEncoding string
+	}{
+		{
+			name:             "gzip",
+			acceptEncoding:   "gzip, deflate",
+			status:           200,
+			body:             big,
+			expectedEncoding: "gzip",
+		},
+		{
+			name:             "deflate",
+			acceptEncoding:   "deflate",
+			status:           200,
+			body:             big,
+			expectedEncoding: "deflate",
+		},
+		{
+			name:           "short body",
+			acceptEncoding: "gzip",
+			status:         404,
+			body:           "unknown table",
+		},
+		{
+			name:           "not accepted",
+			acceptEncoding: "gzip;q=0",
+			status:         200,
+			body:           big,
+		},
+		{
+			name:           "not modified",
+			acceptEncoding: "gzip",
+			status:         304,
+		},
+		{
+			name:             "flush before threshold",
+			acceptEncoding:   "gzip",
+			status:           200,
+			body:             "{\"id\":1}\n",
+			flush:            true,
+			expectedEncoding: "gzip",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Add("Vary", "Accept")
+				w.WriteHeader(tc.status)
+				// пишем частями, как encodeJSON
+				for i := 0; i < len(tc.body); i += 100 {
+					end := i + 100
+					if end > len(tc.body) {
+						end = len(tc.body)
+					}
+					w.Write([]byte(tc.body[i:end]))
+				}
+				if tc.flush {
+					w.(http.Flusher).Flush()
+				}
+			})
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest("GET", "/items", nil)
+			r.Header.Set("Accept-Encoding", tc.acceptEncoding)
+			NewCompressor(next).ServeHTTP(w, r)
+
+			assert.Equal(t, tc.status, w.Code)
+			assert.Equal(t, tc.expectedEncoding, w.Header().Get("Content-Encoding"))
+			assert.ElementsMatch(t, []string{"Accept", "Accept-Encoding"}, w.Header().Values("Vary"))
+
+			var body io.Reader = w.Body
+			switch tc.expectedEncoding {
+			case "gzip":
+				zr, err := gzip.NewReader(w.Body)
+				require.NoError(t, err)
+				body = zr
+			case "deflate":
+				zr, err := zlib.NewReader(w.Body)
+				require.NoError(t, err)
+				body = zr
+			}
+			data, err := io.ReadAll(body)
+			require.NoError(t, err)
+			assert.Equal(t, tc.body, string(data))
+		})
+	}
+}
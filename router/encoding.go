@@ -0,0 +1,241 @@
+package router
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"hw6coursera/dto"
+	"hw6coursera/logging"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// форматы списка записей: ?format=csv или заголовок Accept
+const (
+	formatJSON   = "json"
+	formatNDJSON = "ndjson"
+	formatCSV    = "csv"
+	formatXML    = "xml"
+)
+
+var (
+	errUnknownFormat = errors.New("unknown format")
+	errNotAcceptable = errors.New("not acceptable")
+)
+
+// recordsEncoder пишет страницу записей в одном формате
+type recordsEncoder struct {
+	contentType string
+	encode      func(w io.Writer, records dto.Records, pretty bool) error
+}
+
+var recordsEncoders = map[string]recordsEncoder{
+	formatJSON:   {contentType: "application/json", encode: encodeJSON},
+	formatNDJSON: {contentType: "application/x-ndjson", encode: encodeNDJSON},
+	formatCSV:    {contentType: "text/csv; charset=utf-8", encode: encodeCSV},
+	formatXML:    {contentType: "application/xml; charset=utf-8", encode: encodeXML},
+}
+
+// listFormats - форматы страницы записей, первый - по умолчанию
+var listFormats = []string{formatJSON, formatNDJSON, formatCSV, formatXML}
+
+// mediaTypeFormats - типы из Accept, которые мы умеем отдавать
+var mediaTypeFormats = map[string]string{
+	"application/json":     formatJSON,
+	"application/x-ndjson": formatNDJSON,
+	"application/ndjson":   formatNDJSON,
+	"text/csv":             formatCSV,
+	"application/xml":      formatXML,
+	"text/xml":             formatXML,
+}
+
+// negotiateFormat выбирает один из supported: ?format= важнее Accept, без них и для */* - первый.
+// Из Accept берётся поддерживаемый тип с наибольшим q, при равных - первый
+func negotiateFormat(r *http.Request, supported []string) (string, error) {
+	if format := strings.ToLower(r.URL.Query().Get(formatField)); format != "" {
+		if !containsFormat(supported, format) {
+			return "", errUnknownFormat
+		}
+		return format, nil
+	}
+
+	accept := r.Header.Get("Accept")
+	if accept == "" {
+		return supported[0], nil
+	}
+	best, bestQ := "", 0.0
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		format, ok := mediaTypeFormats[mediaType]
+		if mediaType == "*/*" || mediaType == "application/*" {
+			format, ok = supported[0], true
+		}
+		if ok && q > bestQ && containsFormat(supported, format) {
+			best, bestQ = format, q
+		}
+	}
+	if best == "" {
+		return "", errNotAcceptable
+	}
+	return best, nil
+}
+
+func containsFormat(formats []string, format string) bool {
+	for _, f := range formats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// encodeJSON - массив записей, поля в порядке колонок. Записи кодируются по одной, без буфера
+// на всю страницу; с pretty - с отступами, как у json.MarshalIndent
+func encodeJSON(w io.Writer, records dto.Records, pretty bool) error {
+	if len(records.Rows) == 0 { // пустой список - [], а не null
+		_, err := io.WriteString(w, "[]")
+		return err
+	}
+
+	open, sep, end := "[", ",", "]"
+	var row bytes.Buffer
+	enc := json.NewEncoder(&row)
+	if pretty {
+		open, sep, end = "[\n    ", ",\n    ", "\n]"
+		enc.SetIndent("    ", "    ")
+	}
+
+	bw := bufio.NewWriter(w)
+	bw.WriteString(open)
+	for i, record := range records.Ordered() {
+		if i > 0 {
+			bw.WriteString(sep)
+		}
+		row.Reset()
+		if err := enc.Encode(record); err != nil {
+			return err
+		}
+		bw.Write(bytes.TrimSuffix(row.Bytes(), []byte("\n"))) // Encode дописывает перевод строки
+	}
+	bw.WriteString(end)
+	return bw.Flush() // ошибки записи bufio.Writer запоминает до Flush
+}
+
+// encodeNDJSON - по одной записи в строке
+func encodeNDJSON(w io.Writer, records dto.Records, _ bool) error {
+	enc := json.NewEncoder(w)
+	for _, row := range records.Ordered() {
+		if err := enc.Encode(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encodeCSV - первая строка с именами колонок, null - пустая ячейка
+func encodeCSV(w io.Writer, records dto.Records, _ bool) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(records.Columns); err != nil {
+		return err
+	}
+	line := make([]string, len(records.Columns))
+	for _, row := range records.Rows {
+		for i, column := range records.Columns {
+			line[i], _ = formatValue(row[column])
+		}
+		if err := cw.Write(line); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// имена колонок не всегда годятся в имена XML-элементов, поэтому колонка - атрибут
+type xmlRecords struct {
+	XMLName xml.Name    `xml:"records"`
+	Records []xmlRecord `xml:"record"`
+}
+
+type xmlRecord struct {
+	Fields []xmlField `xml:"field"`
+}
+
+type xmlField struct {
+	Name  string `xml:"name,attr"`
+	Null  bool   `xml:"null,attr,omitempty"`
+	Value string `xml:",chardata"`
+}
+
+// encodeXML - <records><record><field name="id">1</field>...</record></records>. Поля с null отдаются,
+// только если они есть в записи (with_nulls), как и в JSON: <field name="info" null="true"></field>.
+// С pretty - с отступами
+func encodeXML(w io.Writer, records dto.Records, pretty bool) error {
+	doc := xmlRecords{Records: make([]xmlRecord, 0, len(records.Rows))}
+	for _, row := range records.Rows {
+		rec := xmlRecord{Fields: make([]xmlField, 0, len(records.Columns))}
+		for _, column := range records.Columns {
+			value, ok := formatValue(row[column])
+			if _, present := row[column]; ok || present {
+				rec.Fields = append(rec.Fields, xmlField{Name: column, Null: !ok, Value: value})
+			}
+		}
+		doc.Records = append(doc.Records, rec)
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	if pretty {
+		enc.Indent("", "    ")
+	}
+	return enc.Encode(doc)
+}
+
+// formatValue - значение колонки строкой для CSV и XML, false - null
+func formatValue(v interface{}) (string, bool) {
+	switch v := v.(type) {
+	case nil:
+		return "", false
+	case string:
+		return v, true
+	case []byte:
+		return string(v), true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32), true
+	default:
+		return fmt.Sprint(v), true
+	}
+}
+
+// encodeResponse кодирует v в json прямо в ответ, без отдельной копии: компактный,
+// с ?pretty=1 - с отступами. Ошибку после заголовков клиенту уже не передать, она попадает в лог
+func encodeResponse(w http.ResponseWriter, r *http.Request, status int, contentType string, v interface{}) {
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	if getBoolField(r, prettyField) {
+		enc.SetIndent("", "    ")
+	}
+	if err := enc.Encode(v); err != nil {
+		logging.FromContext(r.Context()).Error("unable to write response", "err", err)
+	}
+}
@@ -0,0 +1,224 @@
+package router
+
+import (
+	"hw6coursera/dto"
+	"hw6coursera/service"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRouter_getRecordsFormat(t *testing.T) {
+	records := dto.Records{
+		Columns: []string{"id", "title", "rating"},
+		Rows: []map[string]interface{}{
+			{"id": 1, "title": `say "hi", <b>`, "rating": 4.5},
+			{"id": 2, "title": "memcache"},
+		},
+	}
+
+	testCases := []struct {
+		name                string
+		urlPath             string
+		accept              string
+		expectedSatusCode   int
+		expectedContentType string
+		expectedBody        string
+	}{
+		{
+			name:                "csv",
+			urlPath:             "/items?format=csv",
+			expectedSatusCode:   200,
+			expectedContentType: "text/csv; charset=utf-8",
+			expectedBody:        "id,title,rating\n1,\"say \"\"hi\"\", <b>\",4.5\n2,memcache,\n",
+		},
+		{
+			name:                "ndjson",
+			urlPath:             "/items?format=ndjson",
+			expectedSatusCode:   200,
+			expectedContentType: "application/x-ndjson",
+			expectedBody:        "{\"id\":1,\"title\":\"say \\\"hi\\\", \\u003cb\\u003e\",\"rating\":4.5}\n{\"id\":2,\"title\":\"memcache\"}\n",
+		},
+		{
+			name:                "xml",
+			urlPath:             "/items?format=xml",
+			expectedSatusCode:   200,
+			expectedContentType: "application/xml; charset=utf-8",
+			expectedBody: `<?xml version="1.0" encoding="UTF-8"?>` + "\n" +
+				`<records><record><field name="id">1</field><field name="title">say &#34;hi&#34;, &lt;b&gt;</field><field name="rating">4.5</field></record>` +
+				`<record><field name="id">2</field><field name="title">memcache</field></record></records>`,
+		},
+		{
+			name:                "format overrides accept",
+			urlPath:             "/items?format=CSV",
+			accept:              "application/xml",
+			expectedSatusCode:   200,
+			expectedContentType: "text/csv; charset=utf-8",
+			expectedBody:        "id,title,rating\n1,\"say \"\"hi\"\", <b>\",4.5\n2,memcache,\n",
+		},
+		{
+			name:                "accept",
+			urlPath:             "/items",
+			accept:              "text/csv",
+			expectedSatusCode:   200,
+			expectedContentType: "text/csv; charset=utf-8",
+			expectedBody:        "id,title,rating\n1,\"say \"\"hi\"\", <b>\",4.5\n2,memcache,\n",
+		},
+		{
+			name:                "accept with quality",
+			urlPath:             "/items",
+			accept:              "text/html, text/csv;q=0.5, application/x-ndjson;q=0.9, */*;q=0.1",
+			expectedSatusCode:   200,
+			expectedContentType: "application/x-ndjson",
+			expectedBody:        "{\"id\":1,\"title\":\"say \\\"hi\\\", \\u003cb\\u003e\",\"rating\":4.5}\n{\"id\":2,\"title\":\"memcache\"}\n",
+		},
+		{
+			name:                "any",
+			urlPath:             "/items",
+			accept:              "*/*",
+			expectedSatusCode:   200,
+			expectedContentType: "application/json",
+			expectedBody:        "[{\"id\":1,\"title\":\"say \\\"hi\\\", \\u003cb\\u003e\",\"rating\":4.5},{\"id\":2,\"title\":\"memcache\"}]",
+		},
+		{
+			name:                "pretty",
+			urlPath:             "/items?pretty=1",
+			expectedSatusCode:   200,
+			expectedContentType: "application/json",
+			expectedBody:        "[\n    {\n        \"id\": 1,\n        \"title\": \"say \\\"hi\\\", \\u003cb\\u003e\",\n        \"rating\": 4.5\n    },\n    {\n        \"id\": 2,\n        \"title\": \"memcache\"\n    }\n]",
+		},
+		{
+			name:              "unknown format",
+			urlPath:           "/items?format=yaml",
+			expectedSatusCode: 400,
+			expectedBody:      "unknown format",
+		},
+		{
+			name:              "not acceptable",
+			urlPath:           "/items",
+			accept:            "text/html, application/json;q=0",
+			expectedSatusCode: 406,
+			expectedBody:      "not acceptable",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := gomock.NewController(t)
+			defer c.Finish()
+			recordService := service.NewMockRecordService(c)
+			if tc.expectedSatusCode == 200 {
+				// format и pretty не попадают в фильтр
+				recordService.EXPECT().GetAllRecords(gomock.Any(), "items", dto.Filter(nil), 5, 0, service.ReadOptions{}).Return(records, nil)
+			}
+
+			router := NewRouter(&service.Service{RecordService: recordService}, DefaultOptions())
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest("GET", tc.urlPath, nil)
+			if tc.accept != "" {
+				r.Header.Set("Accept", tc.accept)
+			}
+			router.ServeHTTP(w, r)
+
+			assert.Equal(t, tc.expectedSatusCode, w.Result().StatusCode)
+			assert.Equal(t, tc.expectedBody, w.Body.String())
+			if tc.expectedContentType != "" {
+				assert.Equal(t, tc.expectedContentType, w.Result().Header.Get("Content-Type"))
+			}
+		})
+	}
+}
+
+func TestEncodeJSON_empty(t *testing.T) {
+	w := httptest.NewRecorder()
+	assert.NoError(t, encodeJSON(w, dto.Records{Columns: []string{"id"}}, true))
+	assert.Equal(t, "[]", w.Body.String())
+
+	w = httptest.NewRecorder()
+	assert.NoError(t, encodeCSV(w, dto.Records{Columns: []string{"id"}}, false))
+	assert.Equal(t, "id\n", w.Body.String())
+}
+
+func TestEncode_keptNulls(t *testing.T) {
+	records := dto.Records{
+		Columns: []string{"id", "info", "note"},
+		Rows:    []map[string]interface{}{{"id": 1, "info": nil}}, // note не пришла вовсе, info - null по with_nulls
+	}
+
+	w := httptest.NewRecorder()
+	assert.NoError(t, encodeNDJSON(w, records, false))
+	assert.Equal(t, "{\"id\":1,\"info\":null}\n", w.Body.String())
+
+	w = httptest.NewRecorder()
+	assert.NoError(t, encodeXML(w, records, false))
+	assert.Equal(t, "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<records><record><field name=\"id\">1</field><field name=\"info\" null=\"true\"></field></record></records>", w.Body.String())
+}
+
+func TestRouter_pretty(t *testing.T) {
+	schema := dto.Schema{
+		"items": {Name: "items", Columns: []dto.Column{{Name: "id", ColumnType: dto.IntType, IsPrimaryKey: true}}},
+	}
+
+	// pretty - параметр ответа, а не часть адреса: на всех адресах с json он даёт отступы
+	testCases := []struct {
+		urlPath       string
+		mockBehaviour func(ms *service.MockRecordService)
+		expectedBody  string
+	}{
+		{
+			urlPath: "/items/1?pretty=1",
+			mockBehaviour: func(ms *service.MockRecordService) {
+				ms.EXPECT().GetById(gomock.Any(), "items", 1, service.ReadOptions{}).Return(dto.OrderedRecord{Columns: []string{"id"}, Values: map[string]interface{}{"id": 1}}, "", nil)
+			},
+			expectedBody: "{\n    \"id\": 1\n}\n",
+		},
+		{
+			urlPath: "/items/1/_history?pretty=1",
+			mockBehaviour: func(ms *service.MockRecordService) {
+				ms.EXPECT().History(gomock.Any(), "items", 1).Return([]dto.AuditEntry{{Table: "items", RecordID: 1, Operation: dto.AuditCreate, Actor: "alice"}}, nil)
+			},
+			expectedBody: "[\n    {\n        \"table\": \"items\",\n        \"record_id\": 1,\n        \"operation\": \"create\",\n        \"actor\": \"alice\",\n        \"time\": \"0001-01-01T00:00:00Z\",\n        \"changes\": null\n    }\n]\n",
+		},
+		{
+			urlPath: "/_schema?pretty=1",
+			mockBehaviour: func(ms *service.MockRecordService) {
+				ms.EXPECT().DescribeSchema(gomock.Any()).Return(schema, nil)
+			},
+		},
+		{
+			urlPath: "/_schema/items?pretty=1",
+			mockBehaviour: func(ms *service.MockRecordService) {
+				ms.EXPECT().GetSchema(gomock.Any()).Return(schema, nil)
+			},
+		},
+		{
+			urlPath: "/_openapi.json?pretty=1",
+			mockBehaviour: func(ms *service.MockRecordService) {
+				ms.EXPECT().GetSchema(gomock.Any()).Return(schema, nil)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.urlPath, func(t *testing.T) {
+			c := gomock.NewController(t)
+			defer c.Finish()
+			recordService := service.NewMockRecordService(c)
+			tc.mockBehaviour(recordService)
+
+			router := NewRouter(&service.Service{RecordService: recordService}, DefaultOptions())
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("GET", tc.urlPath, nil))
+
+			assert.Equal(t, 200, w.Result().StatusCode)
+			if tc.expectedBody != "" {
+				assert.Equal(t, tc.expectedBody, w.Body.String())
+				return
+			}
+			assert.True(t, strings.HasPrefix(w.Body.String(), "{\n    \""), w.Body.String())
+		})
+	}
+}
@@ -0,0 +1,160 @@
+package router
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"hw6coursera/dto"
+	"hw6coursera/logging"
+	"hw6coursera/service"
+	"net/http"
+	"strings"
+)
+
+// exportFormats - форматы выгрузки, которые пишутся построчно; первый - по умолчанию
+var exportFormats = []string{formatNDJSON, formatCSV}
+
+// exportFlushEvery - через сколько записей выгрузка отправляется клиенту, не дожидаясь буфера
+const exportFlushEvery = 1000
+
+// streamWriter пишет выгружаемые записи прямо в ответ. Заголовки уходят с первой записью
+// или в конце выгрузки: до этого ошибку ещё можно вернуть обычным ответом
+type streamWriter struct {
+	w       http.ResponseWriter
+	table   string
+	format  string
+	columns []string
+	csv     *csv.Writer
+	line    []string // строка CSV, переиспользуется между записями
+	json    *json.Encoder
+	started bool
+	pending int // записи, которые ещё не отправлены клиенту
+}
+
+func newStreamWriter(w http.ResponseWriter, table, format string) *streamWriter {
+	return &streamWriter{w: w, table: table, format: format}
+}
+
+// Columns implements service.RecordWriter
+func (s *streamWriter) Columns(columns []string) error {
+	s.columns = columns
+	return nil
+}
+
+// Write implements service.RecordWriter
+func (s *streamWriter) Write(record map[string]interface{}) error {
+	if !s.started {
+		if err := s.start(); err != nil {
+			return err
+		}
+	}
+
+	if s.format == formatCSV {
+		for i, column := range s.columns {
+			s.line[i], _ = formatValue(record[column])
+		}
+		if err := s.csv.Write(s.line); err != nil {
+			return err
+		}
+	} else if err := s.json.Encode(dto.OrderedRecord{Columns: s.columns, Values: record}); err != nil {
+		return err
+	}
+
+	s.pending++
+	if s.pending >= exportFlushEvery {
+		return s.flush()
+	}
+	return nil
+}
+
+// Close дописывает выгрузку, в том числе пустую: у CSV остаётся строка с именами колонок
+func (s *streamWriter) Close() error {
+	if !s.started {
+		if err := s.start(); err != nil {
+			return err
+		}
+	}
+	return s.flush()
+}
+
+func (s *streamWriter) start() error {
+	s.started = true
+	h := s.w.Header()
+	h.Set("Content-Type", recordsEncoders[s.format].contentType)
+	h.Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", s.table+"."+s.format))
+	h.Add("Vary", "Accept")
+	s.w.WriteHeader(http.StatusOK)
+
+	if s.format == formatCSV {
+		s.csv = csv.NewWriter(s.w)
+		s.line = make([]string, len(s.columns))
+		return s.csv.Write(s.columns)
+	}
+	s.json = json.NewEncoder(s.w)
+	return nil
+}
+
+func (s *streamWriter) flush() error {
+	if s.csv != nil {
+		s.csv.Flush()
+		if err := s.csv.Error(); err != nil {
+			return err
+		}
+	}
+	if f, ok := s.w.(http.Flusher); ok {
+		f.Flush()
+	}
+	s.pending = 0
+	return nil
+}
+
+// ExportRecords implements RequestProcessor
+func (rp *requestProcessor) exportRecords(w http.ResponseWriter, r *http.Request) {
+	tableName := strings.TrimSuffix(strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/"), "/"), "/_export")
+	filter, err := getFilter(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	format, err := negotiateFormat(r, exportFormats)
+	switch {
+	case err == errUnknownFormat:
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	case err == errNotAcceptable:
+		w.WriteHeader(http.StatusNotAcceptable)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	sw := newStreamWriter(w, tableName, format)
+	err = rp.service.ExportRecords(r.Context(), tableName, filter, rp.getReadOptions(r), sw)
+	if err == nil {
+		err = sw.Close()
+	}
+	switch {
+	case err == nil:
+		return
+	case r.Context().Err() != nil:
+		logging.FromContext(r.Context()).Info("export cancelled by client", "table", tableName)
+		return
+	case sw.started:
+		// ответ уже начат: обрываем соединение, чтобы клиент не принял часть таблицы за всю
+		logging.FromContext(r.Context()).Error("export failed", "table", tableName, "err", err)
+		panic(http.ErrAbortHandler)
+	case err == service.ErrTableNotFound:
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("unknown table"))
+	case isFilterError(err):
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+	case err == service.ErrForbidden:
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(err.Error()))
+	default:
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte("unable to export records"))
+	}
+}
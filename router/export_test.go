@@ -0,0 +1,186 @@
+package router
+
+import (
+	"fmt"
+	"hw6coursera/dto"
+	"hw6coursera/service"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// exportRows - поведение сервиса для мока: колонки и записи по одной, потом err
+func exportRows(columns []string, rows []map[string]interface{}, err error) func(interface{}, string, dto.Filter, service.ReadOptions, service.RecordWriter) error {
+	return func(_ interface{}, _ string, _ dto.Filter, _ service.ReadOptions, w service.RecordWriter) error {
+		if err := w.Columns(columns); err != nil {
+			return err
+		}
+		for _, row := range rows {
+			if err := w.Write(row); err != nil {
+				return err
+			}
+		}
+		return err
+	}
+}
+
+func TestRouter_exportRecords(t *testing.T) {
+	columns := []string{"id", "title", "rating"}
+	rows := []map[string]interface{}{
+		{"id": 1, "title": "a, b", "rating": 4.5},
+		{"id": 2, "title": "memcache"},
+	}
+
+	testCases := []struct {
+		name                string
+		urlPath             string
+		accept              string
+		export              func(interface{}, string, dto.Filter, service.ReadOptions, service.RecordWriter) error
+		expectedFilter      dto.Filter
+		expectedSatusCode   int
+		expectedContentType string
+		expectedDisposition string
+		expectedBody        string
+	}{
+		{
+			name:                "ndjson by default",
+			urlPath:             "/items/_export",
+			export:              exportRows(columns, rows, nil),
+			expectedSatusCode:   200,
+			expectedContentType: "application/x-ndjson",
+			expectedDisposition: `attachment; filename="items.ndjson"`,
+			expectedBody:        "{\"id\":1,\"title\":\"a, b\",\"rating\":4.5}\n{\"id\":2,\"title\":\"memcache\"}\n",
+		},
+		{
+			name:                "csv with filter",
+			urlPath:             "/items/_export?format=csv&id[gt]=0",
+			export:              exportRows(columns, rows, nil),
+			expectedFilter:      dto.Filter{{Column: "id", Operator: dto.OpGt, Value: "0"}},
+			expectedSatusCode:   200,
+			expectedContentType: "text/csv; charset=utf-8",
+			expectedDisposition: `attachment; filename="items.csv"`,
+			expectedBody:        "id,title,rating\n1,\"a, b\",4.5\n2,memcache,\n",
+		},
+		{
+			name:                "csv by accept",
+			urlPath:             "/items/_export/",
+			accept:              "text/csv",
+			export:              exportRows(columns, nil, nil),
+			expectedSatusCode:   200,
+			expectedContentType: "text/csv; charset=utf-8",
+			expectedDisposition: `attachment; filename="items.csv"`,
+			expectedBody:        "id,title,rating\n",
+		},
+		{
+			name:              "xml is not streamed",
+			urlPath:           "/items/_export?format=xml",
+			expectedSatusCode: 400,
+			expectedBody:      "unknown format",
+		},
+		{
+			name:              "not acceptable",
+			urlPath:           "/items/_export",
+			accept:            "application/json",
+			expectedSatusCode: 406,
+			expectedBody:      "not acceptable",
+		},
+		{
+			name:              "unknown table",
+			urlPath:           "/items/_export",
+			export:            exportRows(nil, nil, service.ErrTableNotFound),
+			expectedSatusCode: 404,
+			expectedBody:      "unknown table",
+		},
+		{
+			name:              "forbidden",
+			urlPath:           "/items/_export",
+			export:            exportRows(nil, nil, service.ErrForbidden),
+			expectedSatusCode: 403,
+			expectedBody:      service.ErrForbidden.Error(),
+		},
+		{
+			name:              "error before first record",
+			urlPath:           "/items/_export",
+			export:            exportRows(columns, nil, fmt.Errorf("db is down")),
+			expectedSatusCode: 500,
+			expectedBody:      "unable to export records",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := gomock.NewController(t)
+			defer c.Finish()
+			recordService := service.NewMockRecordService(c)
+			if tc.export != nil {
+				recordService.EXPECT().ExportRecords(gomock.Any(), "items", tc.expectedFilter, service.ReadOptions{}, gomock.Any()).DoAndReturn(tc.export)
+			}
+
+			router := NewRouter(&service.Service{RecordService: recordService}, DefaultOptions())
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest("GET", tc.urlPath, nil)
+			if tc.accept != "" {
+				r.Header.Set("Accept", tc.accept)
+			}
+			router.ServeHTTP(w, r)
+
+			assert.Equal(t, tc.expectedSatusCode, w.Result().StatusCode)
+			assert.Equal(t, tc.expectedBody, w.Body.String())
+			if tc.expectedContentType != "" {
+				assert.Equal(t, tc.expectedContentType, w.Result().Header.Get("Content-Type"))
+				assert.Equal(t, tc.expectedDisposition, w.Result().Header.Get("Content-Disposition"))
+			}
+		})
+	}
+}
+
+func TestRouter_exportRecordsFailure(t *testing.T) {
+	c := gomock.NewController(t)
+	defer c.Finish()
+	recordService := service.NewMockRecordService(c)
+	rows := []map[string]interface{}{{"id": 1}}
+	recordService.EXPECT().ExportRecords(gomock.Any(), "items", dto.Filter(nil), service.ReadOptions{}, gomock.Any()).
+		DoAndReturn(exportRows([]string{"id"}, rows, fmt.Errorf("connection lost")))
+
+	router := NewRouter(&service.Service{RecordService: recordService}, DefaultOptions())
+	w := httptest.NewRecorder()
+
+	// ответ уже начат, поэтому соединение обрывается, а не отдаётся как успешное
+	assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/items/_export", nil))
+	})
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "{\"id\":1}\n", w.Body.String())
+}
+
+func TestStreamWriter_flush(t *testing.T) {
+	w := httptest.NewRecorder()
+	sw := newStreamWriter(w, "items", formatNDJSON)
+	require.NoError(t, sw.Columns([]string{"id"}))
+	for i := 0; i < exportFlushEvery; i++ {
+		require.NoError(t, sw.Write(map[string]interface{}{"id": i}))
+	}
+	assert.True(t, w.Flushed) // не дожидаясь конца выгрузки
+	assert.Equal(t, 0, sw.pending)
+
+	require.NoError(t, sw.Write(map[string]interface{}{"id": exportFlushEvery}))
+	assert.Equal(t, 1, sw.pending)
+	require.NoError(t, sw.Close())
+	assert.Equal(t, 0, sw.pending)
+	assert.Equal(t, exportFlushEvery+1, strings.Count(w.Body.String(), "\n"))
+}
+
+func TestRouter_exportDisabled(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Export = false
+	router := NewRouter(&service.Service{}, opts)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/items/_export", nil))
+	assert.Equal(t, 404, w.Code)
+	assert.Equal(t, "page not found", w.Body.String())
+}
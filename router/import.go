@@ -0,0 +1,251 @@
+package router
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hw6coursera/logging"
+	"hw6coursera/service"
+	"io"
+	"mime"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	nullField      = "null"
+	chunkSizeField = "chunk_size"
+)
+
+var (
+	// importFormats - форматы загрузки, те же, что у выгрузки: файл можно загрузить обратно
+	importFormats = exportFormats
+
+	errInvalidHeader     = errors.New("invalid header")
+	errUnsupportedFormat = errors.New("unsupported format")
+
+	// `map[заголовок]=колонка`
+	mappingKeyPattern = regexp.MustCompile(`\Amap\[(.+)\]\z`)
+)
+
+// NewRecordReader читает загружаемый файл в формате ndjson или csv
+func NewRecordReader(format string, r io.Reader) (service.RecordReader, error) {
+	switch format {
+	case formatNDJSON:
+		return &ndjsonReader{r: bufio.NewReader(r)}, nil
+	case formatCSV:
+		cr := csv.NewReader(r)
+		cr.ReuseRecord = true
+		return &csvReader{r: cr}, nil
+	default:
+		return nil, errUnknownFormat
+	}
+}
+
+// DefaultNullTokens - что читается как null, если в запросе не указано иное: пустая ячейка CSV,
+// как её пишет выгрузка. В NDJSON null записывается самим JSON
+func DefaultNullTokens(format string) []string {
+	if format == formatCSV {
+		return []string{""}
+	}
+	return nil
+}
+
+// csvReader - первая строка файла с заголовками, дальше по записи в строке
+type csvReader struct {
+	r      *csv.Reader
+	header []string
+}
+
+// Read implements service.RecordReader
+func (c *csvReader) Read() (int, map[string]string, error) {
+	if c.header == nil {
+		if err := c.readHeader(); err != nil {
+			return 1, nil, err
+		}
+	}
+
+	fields, err := c.r.Read()
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return parseErr.StartLine, nil, service.ErrInvalidLine{Err: parseErr.Err}
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+	line, _ := c.r.FieldPos(0)
+
+	record := make(map[string]string, len(fields))
+	for i, value := range fields {
+		record[c.header[i]] = value
+	}
+	return line, record, nil
+}
+
+func (c *csvReader) readHeader() error {
+	header, err := c.r.Read()
+	if err == io.EOF {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %v", errInvalidHeader, err)
+	}
+
+	c.header = make([]string, len(header))
+	seen := make(map[string]bool, len(header))
+	for i, name := range header {
+		if i == 0 {
+			name = strings.TrimPrefix(name, "\ufeff") // BOM, с которым сохраняют CSV табличные редакторы
+		}
+		if name == "" || seen[name] {
+			return fmt.Errorf("%w: empty or duplicate column %q", errInvalidHeader, name)
+		}
+		seen[name] = true
+		c.header[i] = name
+	}
+	return nil
+}
+
+// ndjsonReader - по объекту в строке, пустые строки пропускаются
+type ndjsonReader struct {
+	r    *bufio.Reader
+	line int
+}
+
+// Read implements service.RecordReader
+func (n *ndjsonReader) Read() (int, map[string]string, error) {
+	for {
+		data, err := n.r.ReadBytes('\n')
+		if err != nil && (err != io.EOF || len(data) == 0) {
+			return 0, nil, err
+		}
+		n.line++
+		data = bytes.TrimSpace(data)
+		if len(data) == 0 {
+			continue
+		}
+
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		var object map[string]interface{}
+		if err := decoder.Decode(&object); err != nil || decoder.More() || object == nil {
+			return n.line, nil, service.ErrInvalidLine{Err: errors.New("expected json object")}
+		}
+
+		record := make(map[string]string, len(object))
+		for k, v := range object {
+			switch v.(type) {
+			case map[string]interface{}, []interface{}:
+				return n.line, nil, service.ErrInvalidLine{Err: fmt.Errorf("nested value in %s", k)}
+			}
+			record[k] = formValue(v) // как в пакетах: null - %00, числа и bool строкой
+		}
+		return n.line, record, nil
+	}
+}
+
+// ImportRecords implements RequestProcessor
+func (rp *requestProcessor) importRecords(w http.ResponseWriter, r *http.Request) {
+	tableName := strings.TrimSuffix(strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/"), "/"), "/_import")
+
+	format, err := importFormat(r)
+	switch {
+	case err == errUnknownFormat:
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	case err == errUnsupportedFormat:
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	opts, err := getImportOptions(r, format)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	src, _ := NewRecordReader(format, r.Body)
+	report, err := rp.service.ImportRecords(r.Context(), tableName, src, opts)
+	switch {
+	case err == nil:
+	case err == service.ErrTableNotFound:
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("unknown table"))
+		return
+	case err == service.ErrReadOnlyTable:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		w.Write([]byte(err.Error()))
+		return
+	case err == service.ErrForbidden:
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(err.Error()))
+		return
+	case errors.Is(err, errInvalidHeader):
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	default:
+		// уже записанные порции не откатываются, их число есть в логе
+		logging.FromContext(r.Context()).Error("import failed", "table", tableName, "records", report.Inserted, "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte("unable to import records"))
+		return
+	}
+
+	encodeResponse(w, r, http.StatusOK, "application/json", report)
+}
+
+// importFormat - ?format= или Content-Type тела запроса
+func importFormat(r *http.Request) (string, error) {
+	if format := strings.ToLower(r.URL.Query().Get(formatField)); format != "" {
+		if !containsFormat(importFormats, format) {
+			return "", errUnknownFormat
+		}
+		return format, nil
+	}
+
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return "", errUnsupportedFormat
+	}
+	format, ok := mediaTypeFormats[mediaType]
+	if !ok || !containsFormat(importFormats, format) {
+		return "", errUnsupportedFormat
+	}
+	return format, nil
+}
+
+// getImportOptions - `?null=NULL&map[Full Name]=name&chunk_size=1000`
+func getImportOptions(r *http.Request, format string) (service.ImportOptions, error) {
+	opts := service.ImportOptions{NullTokens: DefaultNullTokens(format)}
+	query := r.URL.Query()
+	for k, v := range query {
+		switch {
+		case k == formatField, k == prettyField:
+		case k == nullField:
+			opts.NullTokens = v
+		case k == chunkSizeField:
+			size, err := strconv.Atoi(v[0])
+			if err != nil || size <= 0 || size > service.MaxImportChunk {
+				return service.ImportOptions{}, fmt.Errorf("invalid %s", chunkSizeField)
+			}
+			opts.ChunkSize = size
+		case mappingKeyPattern.MatchString(k):
+			if opts.Mapping == nil {
+				opts.Mapping = make(map[string]string)
+			}
+			opts.Mapping[mappingKeyPattern.FindStringSubmatch(k)[1]] = v[0]
+		default:
+			return service.ImportOptions{}, fmt.Errorf("unknown parameter %s", k)
+		}
+	}
+	return opts, nil
+}
@@ -0,0 +1,227 @@
+package router
+
+import (
+	"errors"
+	"hw6coursera/dto"
+	"hw6coursera/service"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readLine - результат одного Read
+type readLine struct {
+	line   int
+	record map[string]string
+	err    string
+}
+
+func readAll(t *testing.T, src service.RecordReader) []readLine {
+	var lines []readLine
+	for {
+		line, record, err := src.Read()
+		if err == io.EOF {
+			return lines
+		}
+		l := readLine{line: line, record: record}
+		if err != nil {
+			require.True(t, errors.As(err, &service.ErrInvalidLine{}), err)
+			l.err = err.Error()
+		}
+		lines = append(lines, l)
+	}
+}
+
+func TestRecordReader(t *testing.T) {
+	testCases := []struct {
+		name          string
+		format        string
+		body          string
+		expectedLines []readLine
+		expectedErr   string
+	}{
+		{
+			name:   "csv",
+			format: formatCSV,
+			body:   "\ufefftitle,rating\n\"a, b\",4.5\nc\n\nd,\n",
+			expectedLines: []readLine{
+				{line: 2, record: map[string]string{"title": "a, b", "rating": "4.5"}},
+				{line: 3, err: "invalid line: wrong number of fields"},
+				{line: 5, record: map[string]string{"title": "d", "rating": ""}},
+			},
+		},
+		{
+			name:        "csv duplicate header",
+			format:      formatCSV,
+			body:        "title,title\na,b\n",
+			expectedErr: `invalid header: empty or duplicate column "title"`,
+		},
+		{
+			name:   "csv empty",
+			format: formatCSV,
+		},
+		{
+			name:   "ndjson",
+			format: formatNDJSON,
+			body:   "{\"title\":\"a\",\"rating\":4.5,\"id\":12345678901}\n\n{\"title\":null,\"ok\":true}\n[1]\n{\"tags\":[\"x\"]}\n{\"title\":\"b\"}",
+			expectedLines: []readLine{
+				{line: 1, record: map[string]string{"title": "a", "rating": "4.5", "id": "12345678901"}},
+				{line: 3, record: map[string]string{"title": "%00", "ok": "true"}},
+				{line: 4, err: "invalid line: expected json object"},
+				{line: 5, err: "invalid line: nested value in tags"},
+				{line: 6, record: map[string]string{"title": "b"}},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			src, err := NewRecordReader(tc.format, strings.NewReader(tc.body))
+			require.NoError(t, err)
+			if tc.expectedErr != "" {
+				_, _, err := src.Read()
+				assert.True(t, errors.Is(err, errInvalidHeader))
+				assert.EqualError(t, err, tc.expectedErr)
+				return
+			}
+			assert.Equal(t, tc.expectedLines, readAll(t, src))
+		})
+	}
+}
+
+func TestRouter_importRecords(t *testing.T) {
+	report := dto.ImportReport{Inserted: 1, Rejected: 1, Errors: []dto.RejectedLine{{Line: 3, Error: "invalid type rating"}}}
+
+	testCases := []struct {
+		name              string
+		urlPath           string
+		contentType       string
+		expectedOpts      *service.ImportOptions
+		serviceErr        error
+		expectedSatusCode int
+		expectedBody      string
+	}{
+		{
+			name:              "csv by content type",
+			urlPath:           "/items/_import",
+			contentType:       "text/csv; charset=utf-8",
+			expectedOpts:      &service.ImportOptions{NullTokens: []string{""}},
+			expectedSatusCode: 200,
+			expectedBody:      "{\"inserted\":1,\"rejected\":1,\"errors\":[{\"line\":3,\"error\":\"invalid type rating\"}]}\n",
+		},
+		{
+			name:        "options",
+			urlPath:     "/items/_import?format=csv&null=NULL&null=-&map[Full%20Name]=title&map[note]=&chunk_size=100",
+			contentType: "application/octet-stream",
+			expectedOpts: &service.ImportOptions{
+				Mapping:    map[string]string{"Full Name": "title", "note": ""},
+				NullTokens: []string{"NULL", "-"},
+				ChunkSize:  100,
+			},
+			expectedSatusCode: 200,
+		},
+		{
+			name:              "ndjson without null tokens",
+			urlPath:           "/items/_import",
+			contentType:       "application/x-ndjson",
+			expectedOpts:      &service.ImportOptions{},
+			expectedSatusCode: 200,
+		},
+		{
+			name:              "unsupported content type",
+			urlPath:           "/items/_import",
+			contentType:       "application/x-www-form-urlencoded",
+			expectedSatusCode: 415,
+			expectedBody:      "unsupported format",
+		},
+		{
+			name:              "unknown format",
+			urlPath:           "/items/_import?format=xml",
+			expectedSatusCode: 400,
+			expectedBody:      "unknown format",
+		},
+		{
+			name:              "invalid chunk size",
+			urlPath:           "/items/_import?format=csv&chunk_size=0",
+			expectedSatusCode: 400,
+			expectedBody:      "invalid chunk_size",
+		},
+		{
+			name:              "unknown parameter",
+			urlPath:           "/items/_import?format=csv&title=a",
+			expectedSatusCode: 400,
+			expectedBody:      "unknown parameter title",
+		},
+		{
+			name:              "unknown table",
+			urlPath:           "/items/_import?format=ndjson",
+			expectedOpts:      &service.ImportOptions{},
+			serviceErr:        service.ErrTableNotFound,
+			expectedSatusCode: 404,
+			expectedBody:      "unknown table",
+		},
+		{
+			name:              "read-only table",
+			urlPath:           "/items/_import?format=ndjson",
+			expectedOpts:      &service.ImportOptions{},
+			serviceErr:        service.ErrReadOnlyTable,
+			expectedSatusCode: 405,
+			expectedBody:      "table is read-only",
+		},
+		{
+			name:              "invalid header",
+			urlPath:           "/items/_import?format=csv",
+			expectedOpts:      &service.ImportOptions{NullTokens: []string{""}},
+			serviceErr:        errInvalidHeader,
+			expectedSatusCode: 400,
+			expectedBody:      "invalid header",
+		},
+		{
+			name:              "database error",
+			urlPath:           "/items/_import?format=csv",
+			expectedOpts:      &service.ImportOptions{NullTokens: []string{""}},
+			serviceErr:        errors.New("connection lost"),
+			expectedSatusCode: 500,
+			expectedBody:      "unable to import records",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := gomock.NewController(t)
+			defer c.Finish()
+			recordService := service.NewMockRecordService(c)
+			if tc.expectedOpts != nil {
+				recordService.EXPECT().ImportRecords(gomock.Any(), "items", gomock.Any(), *tc.expectedOpts).Return(report, tc.serviceErr)
+			}
+
+			router := NewRouter(&service.Service{RecordService: recordService}, DefaultOptions())
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest("POST", tc.urlPath, strings.NewReader("title\na\n"))
+			if tc.contentType != "" {
+				r.Header.Set("Content-Type", tc.contentType)
+			}
+			router.ServeHTTP(w, r)
+
+			assert.Equal(t, tc.expectedSatusCode, w.Code)
+			if tc.expectedBody != "" {
+				assert.Equal(t, tc.expectedBody, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestRouter_importDisabled(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Import = false
+	router := NewRouter(&service.Service{}, opts)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/items/_import?format=csv", nil))
+	assert.Equal(t, 404, w.Code)
+	assert.Equal(t, "page not found", w.Body.String())
+}
@@ -0,0 +1,76 @@
+package router
+
+import (
+	"hw6coursera/metrics"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// методы, которые попадают в метки как есть, остальные считаются вместе: произвольные
+// методы и имена таблиц из запроса не должны раздувать число серий
+var metricMethods = map[string]bool{
+	"GET": true, "HEAD": true, "POST": true, "PUT": true, "PATCH": true, "DELETE": true, "OPTIONS": true,
+}
+
+// Instrumenter считает запросы к next и их время по таблице, методу и коду ответа
+type Instrumenter struct {
+	next http.Handler
+	m    *metrics.Metrics
+	// таблица в метке только из схемы, иначе пустая. Функция, а не список: схема перечитывается
+	isTable func(table string) bool
+}
+
+func NewInstrumenter(next http.Handler, m *metrics.Metrics, isTable func(table string) bool) *Instrumenter {
+	return &Instrumenter{next: next, m: m, isTable: isTable}
+}
+
+func (i *Instrumenter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	sw := &statusWriter{ResponseWriter: w}
+	i.next.ServeHTTP(sw, r)
+
+	table, _, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if !i.isTable(table) {
+		table = ""
+	}
+	method := r.Method
+	if !metricMethods[method] {
+		method = "other"
+	}
+	status := http.StatusOK
+	if sw.status != 0 {
+		status = sw.status
+	}
+	labels := []string{table, method, strconv.Itoa(status)}
+	i.m.Requests.Inc(labels...)
+	i.m.RequestDuration.Observe(time.Since(start).Seconds(), labels...)
+}
+
+// statusWriter запоминает код ответа; 0 - обработчик ничего не записал, это 200
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (sw *statusWriter) WriteHeader(status int) {
+	if sw.status == 0 {
+		sw.status = status
+	}
+	sw.ResponseWriter.WriteHeader(status)
+}
+
+func (sw *statusWriter) Write(p []byte) (int, error) {
+	if sw.status == 0 {
+		sw.status = http.StatusOK
+	}
+	return sw.ResponseWriter.Write(p)
+}
+
+// Flush implements http.Flusher, без него выгрузка не отправлялась бы частями
+func (sw *statusWriter) Flush() {
+	if f, ok := sw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
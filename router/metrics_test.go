@@ -0,0 +1,45 @@
+package router
+
+import (
+	"hw6coursera/metrics"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInstrumenter(t *testing.T) {
+	m := metrics.New()
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/items/1":
+			w.Write([]byte("{}")) // без WriteHeader - это 200
+		case "/items/_export":
+			w.WriteHeader(http.StatusOK)
+			w.(http.Flusher).Flush()
+		default:
+			notFound(w)
+		}
+	})
+	instrumenter := NewInstrumenter(next, m, func(table string) bool { return table == "items" })
+
+	requests := []struct {
+		method string
+		path   string
+	}{
+		{"GET", "/items/1"},
+		{"GET", "/items/1?with_nulls=true"},
+		{"GET", "/items/_export"},
+		{"GET", "/random_words"},
+		{"BREW", "/items/2"},
+	}
+	for _, r := range requests {
+		instrumenter.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(r.method, r.path, nil))
+	}
+
+	assert.Equal(t, float64(3), m.Requests.Value("items", "GET", "200"))
+	assert.Equal(t, float64(1), m.Requests.Value("", "GET", "404")) // неизвестная таблица не попадает в метки
+	assert.Equal(t, float64(1), m.Requests.Value("items", "other", "404"))
+	assert.Equal(t, uint64(3), m.RequestDuration.Count("items", "GET", "200"))
+}
@@ -1,53 +1,38 @@
 package router
 
-const (
-	bigJSON = `[
-	{
-		"description": "Рассказать про базы данных",
-		"id": 1,
-		"rating": null,
-		"title": "database/sql",
-		"updated": "rvasily"
-	},
-	{
-		"description": "Рассказать про мемкеш с примером использования",
-		"id": 2,
-		"rating": null,
-		"title": "memcache",
-		"updated": null
-	},
-	{
-		"description": "long story about zavod's transformation",
-		"id": 3,
-		"rating": null,
-		"title": "Kozlov's list",
-		"updated": "Zhonstantin Kiharev"
-	},
-	{
-		"description": "short story about zavod",
-		"id": 4,
-		"rating": 4.56,
-		"title": "Kozlov's list 2",
-		"updated": null
-	},
-	{
-		"description": "sadnes",
-		"id": 6,
-		"rating": 0.7,
-		"title": "kkkkkk",
-		"updated": null
-	}
-]`
-	smallJSON = `{
-	"description": "long story about zavod's transformation",
-	"id": 3,
-	"rating": null,
-	"title": "Kozlov's list",
-	"updated": "Zhonstantin Kiharev"
-}`
+import (
+	"hw6coursera/dto"
+	"time"
 )
 
 var (
-	_ string = bigJSON
-	_ string = smallJSON
+	bigRecords = dto.Records{
+		Columns: []string{"id", "title", "rating", "updated"},
+		Rows: []map[string]interface{}{
+			{"id": 1, "title": "database/sql", "updated": "rvasily"},
+			{"id": 2, "title": "memcache"},
+			{"id": 4, "title": "Kozlov's list 2", "rating": 4.56},
+		},
+	}
+	bigRecordsJSON = `[{"id":1,"title":"database/sql","updated":"rvasily"},{"id":2,"title":"memcache"},{"id":4,"title":"Kozlov's list 2","rating":4.56}]`
+
+	smallRecords = dto.Records{
+		Columns: []string{"id", "title"},
+		Rows:    []map[string]interface{}{{"id": 3, "title": "Kozlov's list"}},
+	}
+	smallRecordsJSON = `[{"id":3,"title":"Kozlov's list"}]`
+
+	smallRecord = dto.OrderedRecord{
+		Columns: []string{"id", "title", "rating", "updated"},
+		Values:  map[string]interface{}{"id": 3, "title": "Kozlov's list", "rating": nil, "updated": "Zhonstantin Kiharev"},
+	}
+	smallRecordJSON = `{"id":3,"title":"Kozlov's list","rating":null,"updated":"Zhonstantin Kiharev"}` + "\n"
+
+	historyEntries = []dto.AuditEntry{
+		{Table: "table", RecordID: 3, Operation: dto.AuditCreate, Actor: "alice", Time: time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC)},
+		{Table: "table", RecordID: 3, Operation: dto.AuditUpdate, Actor: "bob", Time: time.Date(2024, 3, 2, 9, 0, 0, 0, time.UTC),
+			Changes: map[string]dto.Change{"title": {Old: "memcache", New: "Kozlov's list"}}},
+	}
+	historyJSON = `[{"table":"table","record_id":3,"operation":"create","actor":"alice","time":"2024-03-01T12:30:00Z","changes":null},` +
+		`{"table":"table","record_id":3,"operation":"update","actor":"bob","time":"2024-03-02T09:00:00Z","changes":{"title":{"old":"memcache","new":"Kozlov's list"}}}]` + "\n"
 )
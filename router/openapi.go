@@ -0,0 +1,76 @@
+package router
+
+import (
+	"hw6coursera/dto"
+	"hw6coursera/openapi"
+	"net/http"
+	"strings"
+)
+
+const (
+	openAPITitle   = "hw6coursera DB explorer"
+	openAPIVersion = "1.0.0"
+)
+
+// OpenAPI - описание API для таблиц схемы с учётом включённых частей API
+func OpenAPI(s dto.Schema, opts Options) *openapi.Document {
+	return openapi.Generate(s, openapi.Options{
+		Title:          openAPITitle,
+		Version:        openAPIVersion,
+		DefaultLimit:   opts.DefaultLimit,
+		MaxLimit:       opts.MaxLimit,
+		KeepNulls:      opts.KeepNulls,
+		Batch:          opts.Batch,
+		Bulk:           opts.Bulk,
+		Upsert:         opts.Upsert,
+		History:        opts.History,
+		Export:         opts.Export,
+		Import:         opts.Import,
+		Auth:           opts.Auth,
+		AllowAnonymous: opts.AllowAnonymous,
+	})
+}
+
+// GetOpenAPI implements RequestProcessor
+func (rp *requestProcessor) getOpenAPI(w http.ResponseWriter, r *http.Request) {
+	// документ строится по текущей схеме и описывает только таблицы, которые видит клиент
+	schema, err := rp.service.GetSchema(r.Context())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte("unable to get schema"))
+		return
+	}
+
+	encodeResponse(w, r, http.StatusOK, "application/json", OpenAPI(schema, rp.opts))
+}
+
+// GetTableSchema implements RequestProcessor
+func (rp *requestProcessor) getTableSchema(w http.ResponseWriter, r *http.Request) {
+	tableName := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/_schema/"), "/")
+	schema, err := rp.service.GetSchema(r.Context())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte("unable to get schema"))
+		return
+	}
+	table, ok := schema[tableName]
+	if !ok { // скрытые и недоступные клиенту таблицы не отличаются от несуществующих
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("unknown table"))
+		return
+	}
+
+	encodeResponse(w, r, http.StatusOK, "application/schema+json", openapi.TableSchema(table))
+}
+
+// GetSchema implements RequestProcessor
+func (rp *requestProcessor) getSchema(w http.ResponseWriter, r *http.Request) {
+	data, err := rp.service.DescribeSchema(r.Context())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte("unable to get schema"))
+		return
+	}
+
+	encodeResponse(w, r, http.StatusOK, "application/json", data)
+}
@@ -0,0 +1,148 @@
+package router
+
+import (
+	"encoding/json"
+	"fmt"
+	"hw6coursera/dto"
+	"hw6coursera/openapi"
+	"hw6coursera/service"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRouter_openAPI(t *testing.T) {
+	schema := dto.Schema{
+		"items": {
+			Name: "items",
+			Columns: []dto.Column{
+				{Name: "id", ColumnType: dto.IntType, IsPrimaryKey: true},
+				{Name: "title", ColumnType: dto.StringType},
+			},
+		},
+	}
+
+	t.Run("document", func(t *testing.T) {
+		c := gomock.NewController(t)
+		defer c.Finish()
+		recordService := service.NewMockRecordService(c)
+		recordService.EXPECT().GetSchema(gomock.Any()).Return(schema, nil)
+
+		opts := DefaultOptions()
+		opts.Upsert = false
+		opts.Auth = []string{openapi.AuthBearer}
+		router := NewRouter(&service.Service{RecordService: recordService}, opts)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/_openapi.json", nil))
+
+		require.Equal(t, 200, w.Result().StatusCode)
+		assert.Equal(t, "application/json", w.Result().Header.Get("Content-Type"))
+		var doc openapi.Document
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &doc))
+		assert.Equal(t, openapi.Version, doc.OpenAPI)
+		assert.Contains(t, doc.Paths, "/items/{id}")
+		assert.NotContains(t, doc.Paths, "/items/_upsert")
+		assert.Contains(t, doc.Components.SecuritySchemes, openapi.AuthBearer)
+	})
+
+	t.Run("service error", func(t *testing.T) {
+		c := gomock.NewController(t)
+		defer c.Finish()
+		recordService := service.NewMockRecordService(c)
+		recordService.EXPECT().GetSchema(gomock.Any()).Return(nil, fmt.Errorf("some service error"))
+
+		router := NewRouter(&service.Service{RecordService: recordService}, DefaultOptions())
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/_openapi.json", nil))
+
+		assert.Equal(t, 500, w.Result().StatusCode)
+		assert.Equal(t, "unable to get schema", w.Body.String())
+	})
+}
+
+func TestRouter_tableSchema(t *testing.T) {
+	schema := dto.Schema{
+		"items": {
+			Name: "items",
+			Columns: []dto.Column{
+				{Name: "id", ColumnType: dto.IntType, IsPrimaryKey: true},
+				{Name: "title", ColumnType: dto.StringType, MaxLength: 100},
+			},
+		},
+	}
+
+	testCases := []struct {
+		name              string
+		urlPath           string
+		expectedSatusCode int
+		expectedType      string
+	}{
+		{name: "ok", urlPath: "/_schema/items", expectedSatusCode: 200, expectedType: "application/schema+json"},
+		{name: "trailing slash", urlPath: "/_schema/items/", expectedSatusCode: 200, expectedType: "application/schema+json"},
+		{name: "unknown table", urlPath: "/_schema/users", expectedSatusCode: 404},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := gomock.NewController(t)
+			defer c.Finish()
+			recordService := service.NewMockRecordService(c)
+			recordService.EXPECT().GetSchema(gomock.Any()).Return(schema, nil)
+
+			router := NewRouter(&service.Service{RecordService: recordService}, DefaultOptions())
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("GET", tc.urlPath, nil))
+
+			require.Equal(t, tc.expectedSatusCode, w.Result().StatusCode)
+			if tc.expectedSatusCode != 200 {
+				assert.Equal(t, "unknown table", w.Body.String())
+				return
+			}
+			assert.Equal(t, tc.expectedType, w.Result().Header.Get("Content-Type"))
+			var doc openapi.Schema
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &doc))
+			assert.Equal(t, openapi.JSONSchemaDialect, doc.Schema)
+			assert.Equal(t, 100, doc.Properties["title"].MaxLength)
+		})
+	}
+}
+
+func TestRouter_schema(t *testing.T) {
+	testCases := []struct {
+		name              string
+		method            string
+		urlPath           string
+		serviceErr        error
+		expectedSatusCode int
+		expectedBody      string
+	}{
+		{name: "ok", method: "GET", urlPath: "/_schema", expectedSatusCode: 200, expectedBody: "{\"items\":{\"name\":\"items\",\"columns\":[],\"indexes\":[],\"foreign_keys\":[],\"rows_estimate\":10}}\n"},
+		{name: "trailing slash", method: "GET", urlPath: "/_schema/", expectedSatusCode: 200, expectedBody: "{\"items\":{\"name\":\"items\",\"columns\":[],\"indexes\":[],\"foreign_keys\":[],\"rows_estimate\":10}}\n"},
+		{name: "service error", method: "GET", urlPath: "/_schema", serviceErr: fmt.Errorf("db is down"), expectedSatusCode: 500, expectedBody: "unable to get schema"},
+		{name: "wrong method", method: "PUT", urlPath: "/_schema", expectedSatusCode: 500},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := gomock.NewController(t)
+			defer c.Finish()
+			recordService := service.NewMockRecordService(c)
+			if tc.method == "GET" {
+				recordService.EXPECT().DescribeSchema(gomock.Any()).Return(dto.Schema{"items": {Name: "items", Columns: []dto.Column{}, Indexes: []dto.Index{}, ForeignKeys: []dto.ForeignKey{}, RowsEstimate: 10}}, tc.serviceErr)
+			}
+
+			router := NewRouter(&service.Service{RecordService: recordService}, DefaultOptions())
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(tc.method, tc.urlPath, nil))
+
+			require.Equal(t, tc.expectedSatusCode, w.Result().StatusCode)
+			assert.Equal(t, tc.expectedBody, w.Body.String())
+			if tc.expectedSatusCode == 200 {
+				assert.Equal(t, "application/json", w.Result().Header.Get("Content-Type"))
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package router
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"hw6coursera/logging"
+	"net/http"
+	"regexp"
+	"time"
+)
+
+const requestIDHeader = "X-Request-ID"
+
+// идентификатор от клиента принимается, только если его безопасно писать в лог и заголовок
+var requestIDRe = regexp.MustCompile(`^[\w.:\-]{1,128}$`)
+
+// RequestLogger присваивает запросу идентификатор (из X-Request-ID или новый), кладёт в контекст
+// логгер с request_id для сервиса и репозитория и пишет запись о каждом запросе
+type RequestLogger struct {
+	next http.Handler
+	l    *logging.Logger
+}
+
+func NewRequestLogger(next http.Handler, l *logging.Logger) *RequestLogger {
+	return &RequestLogger{next: next, l: l}
+}
+
+func (rl *RequestLogger) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	id := r.Header.Get(requestIDHeader)
+	if !requestIDRe.MatchString(id) {
+		id = newRequestID()
+	}
+	w.Header().Set(requestIDHeader, id)
+
+	l := rl.l.With("request_id", id)
+	sw := &statusWriter{ResponseWriter: w}
+	rl.next.ServeHTTP(sw, r.WithContext(logging.NewContext(r.Context(), l)))
+
+	status := http.StatusOK
+	if sw.status != 0 {
+		status = sw.status
+	}
+	level := logging.LevelInfo
+	if status >= http.StatusInternalServerError {
+		level = logging.LevelError
+	}
+	// без query: в параметрах бывают значения фильтров и ключи доступа
+	l.Log(level, "request", "method", r.Method, "path", r.URL.Path, "status", status,
+		"duration", time.Since(start))
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,45 @@
+package router
+
+import (
+	"bytes"
+	"hw6coursera/logging"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestLogger(t *testing.T) {
+	var buf bytes.Buffer
+	l, err := logging.New(&buf, logging.Options{Format: logging.FormatJSON})
+	require.NoError(t, err)
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logging.FromContext(r.Context()).Info("from handler")
+		w.WriteHeader(http.StatusTeapot)
+	})
+	rl := NewRequestLogger(next, l)
+
+	// идентификатор клиента сохраняется в ответе и в каждой записи запроса
+	req := httptest.NewRequest("GET", "/items?api_key=secret", nil)
+	req.Header.Set(requestIDHeader, "client-id-1")
+	w := httptest.NewRecorder()
+	rl.ServeHTTP(w, req)
+
+	assert.Equal(t, "client-id-1", w.Header().Get(requestIDHeader))
+	assert.Contains(t, buf.String(), `"msg":"from handler","request_id":"client-id-1"`)
+	assert.Contains(t, buf.String(), `"msg":"request","request_id":"client-id-1","method":"GET","path":"/items","status":418`)
+	assert.NotContains(t, buf.String(), "secret")
+
+	// неподходящий идентификатор заменяется новым
+	buf.Reset()
+	req = httptest.NewRequest("GET", "/items", nil)
+	req.Header.Set(requestIDHeader, "bad id\n")
+	w = httptest.NewRecorder()
+	rl.ServeHTTP(w, req)
+
+	id := w.Header().Get(requestIDHeader)
+	assert.Regexp(t, `\A[0-9a-f]{16}\z`, id)
+	assert.Contains(t, buf.String(), `"request_id":"`+id+`"`)
+}
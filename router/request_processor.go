@@ -3,20 +3,52 @@ package router
 import (
 	"errors"
 	"fmt"
+	"hw6coursera/dto"
+	"hw6coursera/logging"
 	"hw6coursera/service"
-	"log"
 	"net/http"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 )
 
 const (
-	limitField  = "limit"
-	offsetField = "offset"
+	limitField   = "limit"
+	offsetField  = "offset"
+	confirmField = "confirm"
+	dryRunField  = "dry_run"
+	keyField     = "key"
+	formatField  = "format"
+	prettyField  = "pretty"
+
+	withDeletedField = "with_deleted"
+	withNullsField   = "with_nulls"
+)
+
+var (
+	errInvalidFilter = errors.New("invalid filter")
+
+	// служебные параметры запроса, которые не являются условиями фильтра
+	reservedFields = map[string]bool{
+		limitField:   true,
+		offsetField:  true,
+		confirmField: true,
+		dryRunField:  true,
+		formatField:  true,
+		prettyField:  true,
+
+		withDeletedField: true,
+		withNullsField:   true,
+	}
+
+	// `column=value` или `column[operator]=value`
+	filterKeyPattern = regexp.MustCompile(`\A(\w+)(?:\[(\w+)\])?\z`)
 )
 
 type requestProcessor struct {
 	service *service.Service
+	opts    Options
 }
 
 // DeleteRecord implements RequestProcessor
@@ -28,7 +60,11 @@ func (rp *requestProcessor) deleteRecord(w http.ResponseWriter, r *http.Request)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
-	switch err := rp.service.DeleteById(tableName, id); {
+	switch err := rp.service.DeleteById(r.Context(), tableName, id, r.Header.Get("If-Match")); {
+	case err == service.ErrPreconditionFailed:
+		w.WriteHeader(http.StatusPreconditionFailed)
+		w.Write([]byte(err.Error()))
+		return
 	case err == service.ErrRecordNotFound:
 		w.WriteHeader(http.StatusNotFound)
 		w.Write([]byte("record not found"))
@@ -37,8 +73,24 @@ func (rp *requestProcessor) deleteRecord(w http.ResponseWriter, r *http.Request)
 		w.WriteHeader(http.StatusNotFound)
 		w.Write([]byte("unknown table"))
 		return
+	case err == service.ErrRejectedRecord:
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	case err == service.ErrConflict:
+		w.WriteHeader(http.StatusConflict)
+		w.Write([]byte(err.Error()))
+		return
+	case err == service.ErrReadOnlyTable:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		w.Write([]byte(err.Error()))
+		return
+	case err == service.ErrForbidden:
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(err.Error()))
+		return
 	case err != nil:
-		log.Println(err.Error())
+		logging.FromContext(r.Context()).Error("request failed", "err", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
@@ -48,38 +100,69 @@ func (rp *requestProcessor) deleteRecord(w http.ResponseWriter, r *http.Request)
 
 // GetAllTables implements RequestProcessor
 func (rp *requestProcessor) getAllTables(w http.ResponseWriter, r *http.Request) {
-	data, err := rp.service.RecordService.GetAllTables()
+	data, err := rp.service.RecordService.GetAllTables(r.Context())
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		w.Write([]byte("unable to get tables"))
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-	w.Header().Set("Content-Type", "application-json")
-	w.Write(data)
+	encodeResponse(w, r, http.StatusOK, "application/json", data)
 }
 
 // GetRecords implements RequestProcessor
 func (rp *requestProcessor) getRecords(w http.ResponseWriter, r *http.Request) {
 	tableName := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/"), "/")
-	limit := getIntFieldOrDefault(r, limitField, service.DefaultLimit)
+	limit := getIntFieldOrDefault(r, limitField, rp.opts.DefaultLimit)
+	if rp.opts.MaxLimit > 0 && limit > rp.opts.MaxLimit {
+		limit = rp.opts.MaxLimit
+	}
 	offset := getIntFieldOrDefault(r, offsetField, service.DefaultOffset)
-	data, err := rp.service.GetAllRecords(tableName, limit, offset)
+	filter, err := getFilter(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	format, err := negotiateFormat(r, listFormats)
+	switch {
+	case err == errUnknownFormat:
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	case err == errNotAcceptable:
+		w.WriteHeader(http.StatusNotAcceptable)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	records, err := rp.service.GetAllRecords(r.Context(), tableName, filter, limit, offset, rp.getReadOptions(r))
 	switch {
 	case err == service.ErrTableNotFound:
 		w.WriteHeader(http.StatusNotFound)
 		w.Write([]byte("unknown table"))
 		return
+	case isFilterError(err):
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	case err == service.ErrForbidden:
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(err.Error()))
+		return
 	case err != nil:
 		w.WriteHeader(http.StatusInternalServerError)
 		w.Write([]byte("unable to get records"))
 		return
 	}
 
+	enc := recordsEncoders[format]
+	w.Header().Set("Content-Type", enc.contentType)
+	w.Header().Add("Vary", "Accept")
 	w.WriteHeader(http.StatusOK)
-	w.Header().Set("Content-Type", "application-json")
-	w.Write(data)
+	if err := enc.encode(w, records, getBoolField(r, prettyField)); err != nil { // заголовки уже ушли, остаётся только записать в лог
+		logging.FromContext(r.Context()).Error("unable to encode records", "err", err)
+	}
 }
 
 // GetSingleRecord implements RequestProcessor
@@ -92,7 +175,7 @@ func (rp *requestProcessor) getSingleRecord(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	data, err := rp.service.GetById(tableName, id)
+	data, etag, err := rp.service.GetById(r.Context(), tableName, id, rp.getReadOptions(r))
 	switch {
 	case err == service.ErrRecordNotFound:
 		w.WriteHeader(http.StatusNotFound)
@@ -102,15 +185,23 @@ func (rp *requestProcessor) getSingleRecord(w http.ResponseWriter, r *http.Reque
 		w.WriteHeader(http.StatusNotFound)
 		w.Write([]byte("unknown table"))
 		return
+	case err == service.ErrForbidden:
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(err.Error()))
+		return
 	case err != nil:
 		w.WriteHeader(http.StatusInternalServerError)
 		w.Write([]byte("unable to service"))
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-	w.Header().Set("Content-Type", "application-json")
-	w.Write(data)
+	w.Header().Set("ETag", etag)
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" && service.MatchWeak(ifNoneMatch, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	encodeResponse(w, r, http.StatusOK, "application/json", data)
 }
 
 // InsertRecord implements RequestProcessor
@@ -128,16 +219,28 @@ func (rp *requestProcessor) insertRecord(w http.ResponseWriter, r *http.Request)
 		unit[k] = urlVals.Get(k)
 	}
 
-	lastInsertedId, err := rp.service.Create(tableName, unit)
+	lastInsertedId, err := rp.service.Create(r.Context(), tableName, unit)
 	switch {
 	case err == service.ErrRecordNotFound || err == service.ErrTableNotFound:
 		w.WriteHeader(http.StatusNotFound)
 		w.Write([]byte(err.Error()))
 		return
-	case errors.As(err, &service.ErrType{}) || errors.As(err, &service.ErrCannotBeNull{}):
+	case err == service.ErrRejectedRecord || errors.As(err, &service.ErrType{}) || errors.As(err, &service.ErrCannotBeNull{}) || errors.As(err, &service.ErrReadOnlyColumn{}) || errors.As(err, &service.ErrTooLong{}):
 		w.WriteHeader(http.StatusBadRequest)
 		w.Write([]byte(err.Error()))
 		return
+	case err == service.ErrReadOnlyTable:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		w.Write([]byte(err.Error()))
+		return
+	case err == service.ErrForbidden:
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(err.Error()))
+		return
+	case err == service.ErrConflict:
+		w.WriteHeader(http.StatusConflict)
+		w.Write([]byte(err.Error()))
+		return
 	case err != nil:
 		w.WriteHeader(http.StatusInternalServerError)
 		w.Write([]byte("unable to insert record"))
@@ -148,6 +251,133 @@ func (rp *requestProcessor) insertRecord(w http.ResponseWriter, r *http.Request)
 	w.Write([]byte(fmt.Sprintf("last insert id %d", lastInsertedId)))
 }
 
+// RestoreRecord implements RequestProcessor
+func (rp *requestProcessor) restoreRecord(w http.ResponseWriter, r *http.Request) {
+	path := strings.Split(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	tableName := path[0]
+	id, err := strconv.Atoi(path[1])
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	switch err := rp.service.RestoreById(r.Context(), tableName, id); {
+	case err == service.ErrRecordNotFound:
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("record not found"))
+		return
+	case err == service.ErrTableNotFound:
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("unknown table"))
+		return
+	case err == service.ErrRestoreUnsupported:
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	case err == service.ErrReadOnlyTable:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		w.Write([]byte(err.Error()))
+		return
+	case err == service.ErrForbidden:
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(err.Error()))
+		return
+	case err != nil:
+		logging.FromContext(r.Context()).Error("request failed", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(fmt.Sprintf("restored record id %d", id)))
+}
+
+// GetHistory implements RequestProcessor
+func (rp *requestProcessor) getHistory(w http.ResponseWriter, r *http.Request) {
+	path := strings.Split(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	tableName := path[0]
+	id, err := strconv.Atoi(path[1])
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	data, err := rp.service.History(r.Context(), tableName, id)
+	switch {
+	case err == service.ErrTableNotFound:
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("unknown table"))
+		return
+	case err == service.ErrAuditDisabled:
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(err.Error()))
+		return
+	case err == service.ErrForbidden:
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(err.Error()))
+		return
+	case err != nil:
+		logging.FromContext(r.Context()).Error("request failed", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte("unable to get history"))
+		return
+	}
+
+	encodeResponse(w, r, http.StatusOK, "application/json", data)
+}
+
+// UpsertRecord implements RequestProcessor
+func (rp *requestProcessor) upsertRecord(w http.ResponseWriter, r *http.Request) {
+	path := strings.Split(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	tableName := path[0]
+	keyName := r.URL.Query().Get(keyField)
+
+	if err := r.ParseForm(); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	urlVals := r.PostForm
+	unit := make(map[string]string)
+	for k := range urlVals {
+		unit[k] = urlVals.Get(k)
+	}
+
+	id, created, err := rp.service.Upsert(r.Context(), tableName, keyName, unit)
+	switch {
+	case err == service.ErrTableNotFound:
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(err.Error()))
+		return
+	case err == service.ErrRejectedRecord || errors.As(err, &service.ErrUnknownKey{}) || errors.As(err, &service.ErrType{}) || errors.As(err, &service.ErrCannotBeNull{}) || errors.As(err, &service.ErrReadOnlyColumn{}) || errors.As(err, &service.ErrTooLong{}):
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	case err == service.ErrReadOnlyTable:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		w.Write([]byte(err.Error()))
+		return
+	case err == service.ErrForbidden:
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(err.Error()))
+		return
+	case err == service.ErrConflict:
+		w.WriteHeader(http.StatusConflict)
+		w.Write([]byte(err.Error()))
+		return
+	case err != nil:
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte("unable to upsert record"))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	if created {
+		w.Write([]byte(fmt.Sprintf("created record id %d", id)))
+		return
+	}
+	w.Write([]byte(fmt.Sprintf("updated record id %d", id)))
+}
+
 // UpdateRecord implements RequestProcessor
 func (rp *requestProcessor) updateRecord(w http.ResponseWriter, r *http.Request) {
 	path := strings.Split(strings.TrimPrefix(r.URL.Path, "/"), "/")
@@ -169,15 +399,31 @@ func (rp *requestProcessor) updateRecord(w http.ResponseWriter, r *http.Request)
 		unit[k] = urlVals.Get(k)
 	}
 
-	switch err := rp.service.UpdateById(tableName, id, unit); {
+	switch err := rp.service.UpdateById(r.Context(), tableName, id, unit, r.Header.Get("If-Match")); {
+	case err == service.ErrPreconditionFailed:
+		w.WriteHeader(http.StatusPreconditionFailed)
+		w.Write([]byte(err.Error()))
+		return
 	case err == service.ErrRecordNotFound || err == service.ErrTableNotFound:
 		w.WriteHeader(http.StatusNotFound)
 		w.Write([]byte(err.Error()))
 		return
-	case err == service.ErrMissingUpdData || errors.As(err, &service.ErrType{}) || errors.As(err, &service.ErrCannotBeNull{}):
+	case err == service.ErrMissingUpdData || err == service.ErrRejectedRecord || errors.As(err, &service.ErrType{}) || errors.As(err, &service.ErrCannotBeNull{}) || errors.As(err, &service.ErrReadOnlyColumn{}) || errors.As(err, &service.ErrTooLong{}):
 		w.WriteHeader(http.StatusBadRequest)
 		w.Write([]byte(err.Error()))
 		return
+	case err == service.ErrReadOnlyTable:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		w.Write([]byte(err.Error()))
+		return
+	case err == service.ErrForbidden:
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(err.Error()))
+		return
+	case err == service.ErrConflict:
+		w.WriteHeader(http.StatusConflict)
+		w.Write([]byte(err.Error()))
+		return
 	case err != nil:
 		w.WriteHeader(http.StatusInternalServerError)
 		w.Write([]byte("unable to update record"))
@@ -188,9 +434,111 @@ func (rp *requestProcessor) updateRecord(w http.ResponseWriter, r *http.Request)
 	w.Write([]byte(fmt.Sprintf("updated record id %d", id)))
 }
 
-func newRequectProcessor(s *service.Service) *requestProcessor {
+// UpdateRecords implements RequestProcessor
+func (rp *requestProcessor) updateRecords(w http.ResponseWriter, r *http.Request) {
+	tableName := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	filter, err := getFilter(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	urlVals := r.PostForm
+	unit := make(map[string]string)
+	for k := range urlVals {
+		unit[k] = urlVals.Get(k)
+	}
+
+	opts := getBulkOptions(r)
+	affected, err := rp.service.UpdateByFilter(r.Context(), tableName, filter, unit, opts)
+	switch {
+	case err == service.ErrTableNotFound:
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("unknown table"))
+		return
+	case err == service.ErrMissingUpdData || err == service.ErrUnfilteredBulk || err == service.ErrRejectedRecord || isFilterError(err) || errors.As(err, &service.ErrCannotBeNull{}) || errors.As(err, &service.ErrReadOnlyColumn{}) || errors.As(err, &service.ErrTooLong{}) || errors.As(err, &service.ErrBulkLimit{}):
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	case err == service.ErrReadOnlyTable:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		w.Write([]byte(err.Error()))
+		return
+	case err == service.ErrForbidden:
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(err.Error()))
+		return
+	case err == service.ErrConflict:
+		w.WriteHeader(http.StatusConflict)
+		w.Write([]byte(err.Error()))
+		return
+	case err != nil:
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte("unable to update records"))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	if opts.DryRun {
+		w.Write([]byte(fmt.Sprintf("dry run: %d records would be updated", affected)))
+		return
+	}
+	w.Write([]byte(fmt.Sprintf("updated %d records", affected)))
+}
+
+// DeleteRecords implements RequestProcessor
+func (rp *requestProcessor) deleteRecords(w http.ResponseWriter, r *http.Request) {
+	tableName := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	filter, err := getFilter(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	opts := getBulkOptions(r)
+	affected, err := rp.service.DeleteByFilter(r.Context(), tableName, filter, opts)
+	switch {
+	case err == service.ErrTableNotFound:
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("unknown table"))
+		return
+	case err == service.ErrUnfilteredBulk || err == service.ErrRejectedRecord || isFilterError(err) || errors.As(err, &service.ErrBulkLimit{}):
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	case err == service.ErrReadOnlyTable:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		w.Write([]byte(err.Error()))
+		return
+	case err == service.ErrForbidden:
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(err.Error()))
+		return
+	case err != nil:
+		logging.FromContext(r.Context()).Error("request failed", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	if opts.DryRun {
+		w.Write([]byte(fmt.Sprintf("dry run: %d records would be deleted", affected)))
+		return
+	}
+	w.Write([]byte(fmt.Sprintf("deleted %d records", affected)))
+}
+
+func newRequectProcessor(s *service.Service, opts Options) *requestProcessor {
 	return &requestProcessor{
 		service: s,
+		opts:    opts,
 	}
 }
 
@@ -202,8 +550,65 @@ func getIntFieldOrDefault(r *http.Request, field string, defaultValue int) int {
 	value, err := strconv.Atoi(valueStr)
 	if err != nil {
 		// Просто логгируемся, не крашимся
-		log.Printf("got error parsing to int %s value (%s): %+v\n", field, valueStr, err)
+		logging.FromContext(r.Context()).Info("invalid integer parameter, using default", "param", field, "value", valueStr, "default", defaultValue)
 		return defaultValue
 	}
 	return value
 }
+
+func getBoolField(r *http.Request, field string) bool {
+	value, err := strconv.ParseBool(r.URL.Query().Get(field))
+	return err == nil && value
+}
+
+// getReadOptions - параметры чтения из запроса, без with_nulls действует настройка KeepNulls
+func (rp *requestProcessor) getReadOptions(r *http.Request) service.ReadOptions {
+	keepNulls := rp.opts.KeepNulls
+	if value, err := strconv.ParseBool(r.URL.Query().Get(withNullsField)); err == nil {
+		keepNulls = value
+	}
+	return service.ReadOptions{
+		WithDeleted: getBoolField(r, withDeletedField),
+		KeepNulls:   keepNulls,
+	}
+}
+
+func getBulkOptions(r *http.Request) service.BulkOptions {
+	return service.BulkOptions{
+		Confirmed: getBoolField(r, confirmField),
+		DryRun:    getBoolField(r, dryRunField),
+	}
+}
+
+// getFilter собирает условия из всех параметров запроса, кроме служебных.
+// Значения остаются строками, типы проверяет сервис
+func getFilter(r *http.Request) (dto.Filter, error) {
+	query := r.URL.Query()
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		if !reservedFields[k] {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys) // порядок условий не должен зависеть от обхода map
+
+	var filter dto.Filter
+	for _, k := range keys {
+		matches := filterKeyPattern.FindStringSubmatch(k)
+		if matches == nil {
+			return nil, errInvalidFilter
+		}
+		operator := matches[2]
+		if operator == "" {
+			operator = dto.OpEq
+		}
+		for _, v := range query[k] {
+			filter = append(filter, dto.Condition{Column: matches[1], Operator: operator, Value: v})
+		}
+	}
+	return filter, nil
+}
+
+func isFilterError(err error) bool {
+	return errors.As(err, &service.ErrUnknownColumn{}) || errors.As(err, &service.ErrUnknownOperator{}) || errors.As(err, &service.ErrType{})
+}
@@ -3,6 +3,7 @@ package router
 import (
 	"bytes"
 	"fmt"
+	"hw6coursera/dto"
 	"hw6coursera/service"
 	"net/http/httptest"
 	"net/url"
@@ -32,7 +33,7 @@ func TestRouter_deleteRecord(t *testing.T) {
 			expectedSatusCode: 200,
 			expectedBody:      "deleted record id 1",
 			mockBehaviour: func(ms *service.MockRecordService, tableName string, id int) {
-				ms.EXPECT().DeleteById(tableName, id).Return(nil)
+				ms.EXPECT().DeleteById(gomock.Any(), tableName, id, "").Return(nil)
 			},
 		},
 		{
@@ -53,7 +54,7 @@ func TestRouter_deleteRecord(t *testing.T) {
 			expectedSatusCode: 500,
 			expectedBody:      "",
 			mockBehaviour: func(ms *service.MockRecordService, tableName string, id int) {
-				ms.EXPECT().DeleteById(tableName, id).Return(fmt.Errorf("some service error"))
+				ms.EXPECT().DeleteById(gomock.Any(), tableName, id, "").Return(fmt.Errorf("some service error"))
 			},
 		},
 		{
@@ -64,7 +65,7 @@ func TestRouter_deleteRecord(t *testing.T) {
 			expectedSatusCode: 404,
 			expectedBody:      "unknown table",
 			mockBehaviour: func(ms *service.MockRecordService, tableName string, id int) {
-				ms.EXPECT().DeleteById(tableName, id).Return(service.ErrTableNotFound)
+				ms.EXPECT().DeleteById(gomock.Any(), tableName, id, "").Return(service.ErrTableNotFound)
 			},
 		},
 		{
@@ -75,7 +76,7 @@ func TestRouter_deleteRecord(t *testing.T) {
 			expectedSatusCode: 404,
 			expectedBody:      "record not found",
 			mockBehaviour: func(ms *service.MockRecordService, tableName string, id int) {
-				ms.EXPECT().DeleteById(tableName, id).Return(service.ErrRecordNotFound)
+				ms.EXPECT().DeleteById(gomock.Any(), tableName, id, "").Return(service.ErrRecordNotFound)
 			},
 		},
 	}
@@ -91,7 +92,7 @@ func TestRouter_deleteRecord(t *testing.T) {
 			servicies := &service.Service{
 				RecordService: recordService,
 			}
-			router := NewRouter(servicies)
+			router := NewRouter(servicies, DefaultOptions())
 			w := httptest.NewRecorder()
 			r := httptest.NewRequest("DELETE", tc.urlPath, bytes.NewBufferString(""))
 
@@ -116,9 +117,9 @@ func TestRouter_getAllTables(t *testing.T) {
 			name:              "OK",
 			urlPath:           "/",
 			expectedSatusCode: 200,
-			expectedBody:      "[\n\t\"haha\",\n\t\"hoho\"\n]",
+			expectedBody:      "[\"haha\",\"hoho\"]\n",
 			mockBehaviour: func(ms *service.MockRecordService) {
-				ms.EXPECT().GetAllTables().Return([]byte("[\n\t\"haha\",\n\t\"hoho\"\n]"), nil)
+				ms.EXPECT().GetAllTables(gomock.Any()).Return([]string{"haha", "hoho"}, nil)
 			},
 		},
 		{
@@ -127,7 +128,7 @@ func TestRouter_getAllTables(t *testing.T) {
 			expectedSatusCode: 500,
 			expectedBody:      "unable to get tables",
 			mockBehaviour: func(ms *service.MockRecordService) {
-				ms.EXPECT().GetAllTables().Return([]byte("[\n\t\"haha\",\n\t\"hoho\"\n]"), fmt.Errorf("unable to serialize data"))
+				ms.EXPECT().GetAllTables(gomock.Any()).Return(nil, fmt.Errorf("unable to get schema"))
 			},
 		},
 	}
@@ -143,7 +144,7 @@ func TestRouter_getAllTables(t *testing.T) {
 			servicies := &service.Service{
 				RecordService: recordService,
 			}
-			router := NewRouter(servicies)
+			router := NewRouter(servicies, DefaultOptions())
 			w := httptest.NewRecorder()
 			r := httptest.NewRequest("GET", tc.urlPath, bytes.NewBufferString(""))
 
@@ -163,32 +164,103 @@ func TestRouter_getRecords(t *testing.T) {
 		expectedSatusCode int
 		expectedBody      string
 		tableName         string
+		filter            dto.Filter
 		limit             int
 		offset            int
-		mockBehaviour     func(ms *service.MockRecordService, tableName string, limit int, offset int)
+		mockBehaviour     func(ms *service.MockRecordService, tableName string, filter dto.Filter, limit int, offset int)
 	}{
 		{
 			name:              "OK",
 			urlPath:           "/table",
 			expectedSatusCode: 200,
-			expectedBody:      bigJSON,
+			expectedBody:      bigRecordsJSON,
 			tableName:         "table",
 			limit:             5,
 			offset:            0,
-			mockBehaviour: func(ms *service.MockRecordService, tableName string, limit int, offset int) {
-				ms.EXPECT().GetAllRecords(tableName, limit, offset).Return([]byte(bigJSON), nil)
+			mockBehaviour: func(ms *service.MockRecordService, tableName string, filter dto.Filter, limit int, offset int) {
+				ms.EXPECT().GetAllRecords(gomock.Any(), tableName, filter, limit, offset, service.ReadOptions{}).Return(bigRecords, nil)
 			},
 		},
 		{
 			name:              "limit & offset check",
 			urlPath:           "/table?limit=1&offset=2",
 			expectedSatusCode: 200,
-			expectedBody:      smallJSON,
+			expectedBody:      smallRecordsJSON,
 			tableName:         "table",
 			limit:             1,
 			offset:            2,
-			mockBehaviour: func(ms *service.MockRecordService, tableName string, limit int, offset int) {
-				ms.EXPECT().GetAllRecords(tableName, limit, offset).Return([]byte(smallJSON), nil)
+			mockBehaviour: func(ms *service.MockRecordService, tableName string, filter dto.Filter, limit int, offset int) {
+				ms.EXPECT().GetAllRecords(gomock.Any(), tableName, filter, limit, offset, service.ReadOptions{}).Return(smallRecords, nil)
+			},
+		},
+		{
+			name:              "filter",
+			urlPath:           "/table?limit=1&level[lt]=5&title=abc",
+			expectedSatusCode: 200,
+			expectedBody:      smallRecordsJSON,
+			tableName:         "table",
+			filter:            dto.Filter{{Column: "level", Operator: dto.OpLt, Value: "5"}, {Column: "title", Operator: dto.OpEq, Value: "abc"}},
+			limit:             1,
+			offset:            0,
+			mockBehaviour: func(ms *service.MockRecordService, tableName string, filter dto.Filter, limit int, offset int) {
+				ms.EXPECT().GetAllRecords(gomock.Any(), tableName, filter, limit, offset, service.ReadOptions{}).Return(smallRecords, nil)
+			},
+		},
+		{
+			name:              "filter values with special characters",
+			urlPath:           "/table?email=a@b.com&created_at[gte]=2024-01-01%2010:00:00&tags=a,b/c*~",
+			expectedSatusCode: 200,
+			expectedBody:      smallRecordsJSON,
+			tableName:         "table",
+			filter: dto.Filter{
+				{Column: "created_at", Operator: dto.OpGte, Value: "2024-01-01 10:00:00"},
+				{Column: "email", Operator: dto.OpEq, Value: "a@b.com"},
+				{Column: "tags", Operator: dto.OpEq, Value: "a,b/c*~"},
+			},
+			limit:  5,
+			offset: 0,
+			mockBehaviour: func(ms *service.MockRecordService, tableName string, filter dto.Filter, limit int, offset int) {
+				ms.EXPECT().GetAllRecords(gomock.Any(), tableName, filter, limit, offset, service.ReadOptions{}).Return(smallRecords, nil)
+			},
+		},
+		{
+			name:              "invalid limit falls back to default",
+			urlPath:           "/table?limit=five&offset=1.5",
+			expectedSatusCode: 200,
+			expectedBody:      smallRecordsJSON,
+			tableName:         "table",
+			limit:             5,
+			offset:            0,
+			mockBehaviour: func(ms *service.MockRecordService, tableName string, filter dto.Filter, limit int, offset int) {
+				ms.EXPECT().GetAllRecords(gomock.Any(), tableName, filter, limit, offset, service.ReadOptions{}).Return(smallRecords, nil)
+			},
+		},
+		{
+			name:              "unescaped quote in query",
+			urlPath:           "/table?limit=1'&offset=1\"",
+			expectedSatusCode: 404,
+			expectedBody:      "page not found",
+			mockBehaviour:     func(ms *service.MockRecordService, tableName string, filter dto.Filter, limit int, offset int) {},
+		},
+		{
+			name:              "invalid filter",
+			urlPath:           "/table?level[lt=5",
+			expectedSatusCode: 400,
+			expectedBody:      "invalid filter",
+			mockBehaviour: func(ms *service.MockRecordService, tableName string, filter dto.Filter, limit int, offset int) {
+			},
+		},
+		{
+			name:              "unknown column",
+			urlPath:           "/table?unknown=5",
+			expectedSatusCode: 400,
+			expectedBody:      service.ErrUnknownColumn{}.Error(),
+			tableName:         "table",
+			filter:            dto.Filter{{Column: "unknown", Operator: dto.OpEq, Value: "5"}},
+			limit:             5,
+			offset:            0,
+			mockBehaviour: func(ms *service.MockRecordService, tableName string, filter dto.Filter, limit int, offset int) {
+				ms.EXPECT().GetAllRecords(gomock.Any(), tableName, filter, limit, offset, service.ReadOptions{}).Return(dto.Records{}, service.ErrUnknownColumn{})
 			},
 		},
 		{
@@ -199,8 +271,8 @@ func TestRouter_getRecords(t *testing.T) {
 			tableName:         "table",
 			limit:             5,
 			offset:            0,
-			mockBehaviour: func(ms *service.MockRecordService, tableName string, limit int, offset int) {
-				ms.EXPECT().GetAllRecords(tableName, limit, offset).Return(nil, fmt.Errorf("some service error"))
+			mockBehaviour: func(ms *service.MockRecordService, tableName string, filter dto.Filter, limit int, offset int) {
+				ms.EXPECT().GetAllRecords(gomock.Any(), tableName, filter, limit, offset, service.ReadOptions{}).Return(dto.Records{}, fmt.Errorf("some service error"))
 			},
 		},
 		{
@@ -211,8 +283,8 @@ func TestRouter_getRecords(t *testing.T) {
 			tableName:         "table",
 			limit:             5,
 			offset:            0,
-			mockBehaviour: func(ms *service.MockRecordService, tableName string, limit int, offset int) {
-				ms.EXPECT().GetAllRecords(tableName, limit, offset).Return(nil, service.ErrTableNotFound)
+			mockBehaviour: func(ms *service.MockRecordService, tableName string, filter dto.Filter, limit int, offset int) {
+				ms.EXPECT().GetAllRecords(gomock.Any(), tableName, filter, limit, offset, service.ReadOptions{}).Return(dto.Records{}, service.ErrTableNotFound)
 			},
 		},
 	}
@@ -223,17 +295,17 @@ func TestRouter_getRecords(t *testing.T) {
 			defer c.Finish()
 
 			recordService := service.NewMockRecordService(c)
-			tc.mockBehaviour(recordService, tc.tableName, tc.limit, tc.offset)
+			tc.mockBehaviour(recordService, tc.tableName, tc.filter, tc.limit, tc.offset)
 
 			servicies := &service.Service{
 				RecordService: recordService,
 			}
 
-			router := NewRouter(servicies)
+			router := NewRouter(servicies, DefaultOptions())
 			w := httptest.NewRecorder()
 			r := httptest.NewRequest("GET", tc.urlPath, bytes.NewBufferString(""))
 
-			router.getRecords(w, r)
+			router.ServeHTTP(w, r) // вместе с выбором маршрута: он не должен зависеть от параметров
 
 			assert.Equal(t, tc.expectedSatusCode, w.Result().StatusCode)
 			assert.Equal(t, tc.expectedBody, w.Body.String())
@@ -256,11 +328,11 @@ func TestRouter_getSingleRecord(t *testing.T) {
 			name:              "OK",
 			urlPath:           "/table/3",
 			expectedSatusCode: 200,
-			expectedBody:      smallJSON,
+			expectedBody:      smallRecordJSON,
 			tableName:         "table",
 			id:                3,
 			mockBehaviour: func(ms *service.MockRecordService, tableName string, id int) {
-				ms.EXPECT().GetById(tableName, id).Return([]byte(smallJSON), nil)
+				ms.EXPECT().GetById(gomock.Any(), tableName, id, service.ReadOptions{}).Return(smallRecord, "\"etag\"", nil)
 			},
 		},
 		{
@@ -271,7 +343,7 @@ func TestRouter_getSingleRecord(t *testing.T) {
 			tableName:         "table",
 			id:                3,
 			mockBehaviour: func(ms *service.MockRecordService, tableName string, id int) {
-				ms.EXPECT().GetById(tableName, id).Return(nil, fmt.Errorf("some service error"))
+				ms.EXPECT().GetById(gomock.Any(), tableName, id, service.ReadOptions{}).Return(dto.OrderedRecord{}, "", fmt.Errorf("some service error"))
 			},
 		},
 		{
@@ -282,7 +354,7 @@ func TestRouter_getSingleRecord(t *testing.T) {
 			tableName:         "table",
 			id:                3,
 			mockBehaviour: func(ms *service.MockRecordService, tableName string, id int) {
-				ms.EXPECT().GetById(tableName, id).Return(nil, service.ErrTableNotFound)
+				ms.EXPECT().GetById(gomock.Any(), tableName, id, service.ReadOptions{}).Return(dto.OrderedRecord{}, "", service.ErrTableNotFound)
 			},
 		},
 		{
@@ -293,7 +365,7 @@ func TestRouter_getSingleRecord(t *testing.T) {
 			tableName:         "table",
 			id:                3,
 			mockBehaviour: func(ms *service.MockRecordService, tableName string, id int) {
-				ms.EXPECT().GetById(tableName, id).Return(nil, service.ErrRecordNotFound)
+				ms.EXPECT().GetById(gomock.Any(), tableName, id, service.ReadOptions{}).Return(dto.OrderedRecord{}, "", service.ErrRecordNotFound)
 			},
 		},
 	}
@@ -310,7 +382,7 @@ func TestRouter_getSingleRecord(t *testing.T) {
 				RecordService: recordService,
 			}
 
-			router := NewRouter(servicies)
+			router := NewRouter(servicies, DefaultOptions())
 			w := httptest.NewRecorder()
 			r := httptest.NewRequest("GET", tc.urlPath, bytes.NewBufferString(""))
 
@@ -345,7 +417,7 @@ func TestRouter_updateRecord(t *testing.T) {
 			requestData:        map[string]string{"some field": "new value", "another field": "another value"},
 			updateDataToExpect: map[string]string{"some field": "new value", "another field": "another value"},
 			mockBehaviour: func(ms *service.MockRecordService, tableName string, id int, data map[string]string) {
-				ms.EXPECT().UpdateById(tableName, id, data).Return(nil)
+				ms.EXPECT().UpdateById(gomock.Any(), tableName, id, data, "").Return(nil)
 			},
 		},
 		{
@@ -358,7 +430,7 @@ func TestRouter_updateRecord(t *testing.T) {
 			requestData:        map[string]string{},
 			updateDataToExpect: map[string]string{},
 			mockBehaviour: func(ms *service.MockRecordService, tableName string, id int, data map[string]string) {
-				ms.EXPECT().UpdateById(tableName, id, data).Return(fmt.Errorf("missing data to update"))
+				ms.EXPECT().UpdateById(gomock.Any(), tableName, id, data, "").Return(fmt.Errorf("missing data to update"))
 			},
 		},
 		{
@@ -387,7 +459,7 @@ func TestRouter_updateRecord(t *testing.T) {
 				RecordService: recordService,
 			}
 
-			router := NewRouter(servicies)
+			router := NewRouter(servicies, DefaultOptions())
 			w := httptest.NewRecorder()
 			params := url.Values{}
 			for k, v := range tc.requestData {
@@ -428,7 +500,7 @@ func TestRouter_insertRecord(t *testing.T) {
 			requestData:       map[string]string{"updating field": "new data"},
 			dataToExpect:      map[string]string{"updating field": "new data"},
 			mockBehaviour: func(ms *service.MockRecordService, tableName string, data map[string]string) {
-				ms.EXPECT().Create(tableName, data).Return(3, nil)
+				ms.EXPECT().Create(gomock.Any(), tableName, data).Return(3, nil)
 			},
 		},
 		{
@@ -441,7 +513,67 @@ func TestRouter_insertRecord(t *testing.T) {
 			requestData:       map[string]string{},
 			dataToExpect:      map[string]string{},
 			mockBehaviour: func(ms *service.MockRecordService, tableName string, data map[string]string) {
-				ms.EXPECT().Create(tableName, data).Return(0, service.ErrTableNotFound)
+				ms.EXPECT().Create(gomock.Any(), tableName, data).Return(0, service.ErrTableNotFound)
+			},
+		},
+		{
+			name:              "read-only table",
+			urlPath:           "/table",
+			expectedSatusCode: 405,
+			expectedBody:      "table is read-only",
+			tableName:         "table",
+			requestData:       map[string]string{"title": "new"},
+			dataToExpect:      map[string]string{"title": "new"},
+			mockBehaviour: func(ms *service.MockRecordService, tableName string, data map[string]string) {
+				ms.EXPECT().Create(gomock.Any(), tableName, data).Return(0, service.ErrReadOnlyTable)
+			},
+		},
+		{
+			name:              "forbidden",
+			urlPath:           "/table",
+			expectedSatusCode: 403,
+			expectedBody:      "forbidden",
+			tableName:         "table",
+			requestData:       map[string]string{"title": "new"},
+			dataToExpect:      map[string]string{"title": "new"},
+			mockBehaviour: func(ms *service.MockRecordService, tableName string, data map[string]string) {
+				ms.EXPECT().Create(gomock.Any(), tableName, data).Return(0, service.ErrForbidden)
+			},
+		},
+		{
+			name:              "read-only column",
+			urlPath:           "/table",
+			expectedSatusCode: 400,
+			expectedBody:      service.ErrReadOnlyColumn{}.Error(),
+			tableName:         "table",
+			requestData:       map[string]string{"created_at": "now"},
+			dataToExpect:      map[string]string{"created_at": "now"},
+			mockBehaviour: func(ms *service.MockRecordService, tableName string, data map[string]string) {
+				ms.EXPECT().Create(gomock.Any(), tableName, data).Return(0, service.ErrReadOnlyColumn{})
+			},
+		},
+		{
+			name:              "value too long",
+			urlPath:           "/table",
+			expectedSatusCode: 400,
+			expectedBody:      service.ErrTooLong{}.Error(),
+			tableName:         "table",
+			requestData:       map[string]string{"password": "long"},
+			dataToExpect:      map[string]string{"password": "long"},
+			mockBehaviour: func(ms *service.MockRecordService, tableName string, data map[string]string) {
+				ms.EXPECT().Create(gomock.Any(), tableName, data).Return(0, service.ErrTooLong{})
+			},
+		},
+		{
+			name:              "unique value conflict",
+			urlPath:           "/table",
+			expectedSatusCode: 409,
+			expectedBody:      service.ErrConflict.Error(),
+			tableName:         "table",
+			requestData:       map[string]string{"title": "taken"},
+			dataToExpect:      map[string]string{"title": "taken"},
+			mockBehaviour: func(ms *service.MockRecordService, tableName string, data map[string]string) {
+				ms.EXPECT().Create(gomock.Any(), tableName, data).Return(0, service.ErrConflict)
 			},
 		},
 		{
@@ -454,7 +586,7 @@ func TestRouter_insertRecord(t *testing.T) {
 			requestData:       map[string]string{},
 			dataToExpect:      map[string]string{},
 			mockBehaviour: func(ms *service.MockRecordService, tableName string, data map[string]string) {
-				ms.EXPECT().Create(tableName, data).Return(0, fmt.Errorf("some service error"))
+				ms.EXPECT().Create(gomock.Any(), tableName, data).Return(0, fmt.Errorf("some service error"))
 			},
 		},
 	}
@@ -471,7 +603,7 @@ func TestRouter_insertRecord(t *testing.T) {
 				RecordService: recordService,
 			}
 
-			router := NewRouter(servicies)
+			router := NewRouter(servicies, DefaultOptions())
 			w := httptest.NewRecorder()
 			params := url.Values{}
 			for k, v := range tc.requestData {
@@ -558,3 +690,645 @@ func Test_getIntFieldOrDefault(t *testing.T) {
 		})
 	}
 }
+
+func TestRouter_updateRecords(t *testing.T) {
+	testCases := []struct {
+		name              string
+		urlPath           string
+		expectedSatusCode int
+		expectedBody      string
+		requestData       map[string]string
+		mockBehaviour     func(ms *service.MockRecordService)
+	}{
+		{
+			name:              "OK",
+			urlPath:           "/table?level[lt]=5",
+			expectedSatusCode: 200,
+			expectedBody:      "updated 3 records",
+			requestData:       map[string]string{"status": "archived"},
+			mockBehaviour: func(ms *service.MockRecordService) {
+				filter := dto.Filter{{Column: "level", Operator: dto.OpLt, Value: "5"}}
+				ms.EXPECT().UpdateByFilter(gomock.Any(), "table", filter, map[string]string{"status": "archived"}, service.BulkOptions{}).Return(3, nil)
+			},
+		},
+		{
+			name:              "dry run",
+			urlPath:           "/table?level[lt]=5&dry_run=true",
+			expectedSatusCode: 200,
+			expectedBody:      "dry run: 3 records would be updated",
+			requestData:       map[string]string{"status": "archived"},
+			mockBehaviour: func(ms *service.MockRecordService) {
+				filter := dto.Filter{{Column: "level", Operator: dto.OpLt, Value: "5"}}
+				ms.EXPECT().UpdateByFilter(gomock.Any(), "table", filter, map[string]string{"status": "archived"}, service.BulkOptions{DryRun: true}).Return(3, nil)
+			},
+		},
+		{
+			name:              "unfiltered",
+			urlPath:           "/table",
+			expectedSatusCode: 400,
+			expectedBody:      service.ErrUnfilteredBulk.Error(),
+			requestData:       map[string]string{"status": "archived"},
+			mockBehaviour: func(ms *service.MockRecordService) {
+				ms.EXPECT().UpdateByFilter(gomock.Any(), "table", dto.Filter(nil), map[string]string{"status": "archived"}, service.BulkOptions{}).Return(0, service.ErrUnfilteredBulk)
+			},
+		},
+		{
+			name:              "service error",
+			urlPath:           "/table?confirm=true",
+			expectedSatusCode: 500,
+			expectedBody:      "unable to update records",
+			requestData:       map[string]string{"status": "archived"},
+			mockBehaviour: func(ms *service.MockRecordService) {
+				ms.EXPECT().UpdateByFilter(gomock.Any(), "table", dto.Filter(nil), map[string]string{"status": "archived"}, service.BulkOptions{Confirmed: true}).Return(0, fmt.Errorf("some service error"))
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := gomock.NewController(t)
+			defer c.Finish()
+
+			recordService := service.NewMockRecordService(c)
+			tc.mockBehaviour(recordService)
+
+			servicies := &service.Service{
+				RecordService: recordService,
+			}
+
+			router := NewRouter(servicies, DefaultOptions())
+			w := httptest.NewRecorder()
+			params := url.Values{}
+			for k, v := range tc.requestData {
+				params.Add(k, v)
+			}
+
+			r := httptest.NewRequest("PATCH", tc.urlPath, bytes.NewBufferString(params.Encode()))
+			r.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+
+			router.ServeHTTP(w, r)
+
+			assert.Equal(t, tc.expectedSatusCode, w.Result().StatusCode)
+			assert.Equal(t, tc.expectedBody, w.Body.String())
+		})
+	}
+}
+
+func TestRouter_deleteRecords(t *testing.T) {
+	testCases := []struct {
+		name              string
+		urlPath           string
+		expectedSatusCode int
+		expectedBody      string
+		mockBehaviour     func(ms *service.MockRecordService)
+	}{
+		{
+			name:              "OK",
+			urlPath:           "/table?status=archived",
+			expectedSatusCode: 200,
+			expectedBody:      "deleted 2 records",
+			mockBehaviour: func(ms *service.MockRecordService) {
+				filter := dto.Filter{{Column: "status", Operator: dto.OpEq, Value: "archived"}}
+				ms.EXPECT().DeleteByFilter(gomock.Any(), "table", filter, service.BulkOptions{}).Return(2, nil)
+			},
+		},
+		{
+			name:              "dry run",
+			urlPath:           "/table?status=archived&dry_run=1",
+			expectedSatusCode: 200,
+			expectedBody:      "dry run: 2 records would be deleted",
+			mockBehaviour: func(ms *service.MockRecordService) {
+				filter := dto.Filter{{Column: "status", Operator: dto.OpEq, Value: "archived"}}
+				ms.EXPECT().DeleteByFilter(gomock.Any(), "table", filter, service.BulkOptions{DryRun: true}).Return(2, nil)
+			},
+		},
+		{
+			name:              "unfiltered",
+			urlPath:           "/table",
+			expectedSatusCode: 400,
+			expectedBody:      service.ErrUnfilteredBulk.Error(),
+			mockBehaviour: func(ms *service.MockRecordService) {
+				ms.EXPECT().DeleteByFilter(gomock.Any(), "table", dto.Filter(nil), service.BulkOptions{}).Return(0, service.ErrUnfilteredBulk)
+			},
+		},
+		{
+			name:              "not found (table)",
+			urlPath:           "/table?status=archived",
+			expectedSatusCode: 404,
+			expectedBody:      "unknown table",
+			mockBehaviour: func(ms *service.MockRecordService) {
+				filter := dto.Filter{{Column: "status", Operator: dto.OpEq, Value: "archived"}}
+				ms.EXPECT().DeleteByFilter(gomock.Any(), "table", filter, service.BulkOptions{}).Return(0, service.ErrTableNotFound)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := gomock.NewController(t)
+			defer c.Finish()
+
+			recordService := service.NewMockRecordService(c)
+			tc.mockBehaviour(recordService)
+
+			servicies := &service.Service{
+				RecordService: recordService,
+			}
+
+			router := NewRouter(servicies, DefaultOptions())
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest("DELETE", tc.urlPath, bytes.NewBufferString(""))
+
+			router.ServeHTTP(w, r)
+
+			assert.Equal(t, tc.expectedSatusCode, w.Result().StatusCode)
+			assert.Equal(t, tc.expectedBody, w.Body.String())
+		})
+	}
+}
+
+func TestRouter_upsertRecord(t *testing.T) {
+	testCases := []struct {
+		name              string
+		urlPath           string
+		expectedSatusCode int
+		expectedBody      string
+		requestData       map[string]string
+		mockBehaviour     func(ms *service.MockRecordService)
+	}{
+		{
+			name:              "created",
+			urlPath:           "/table/_upsert",
+			expectedSatusCode: 200,
+			expectedBody:      "created record id 3",
+			requestData:       map[string]string{"id": "3", "title": "new"},
+			mockBehaviour: func(ms *service.MockRecordService) {
+				ms.EXPECT().Upsert(gomock.Any(), "table", "", map[string]string{"id": "3", "title": "new"}).Return(3, true, nil)
+			},
+		},
+		{
+			name:              "updated by unique key",
+			urlPath:           "/table/_upsert?key=title_unique",
+			expectedSatusCode: 200,
+			expectedBody:      "updated record id 8",
+			requestData:       map[string]string{"title": "new"},
+			mockBehaviour: func(ms *service.MockRecordService) {
+				ms.EXPECT().Upsert(gomock.Any(), "table", "title_unique", map[string]string{"title": "new"}).Return(8, false, nil)
+			},
+		},
+		{
+			name:              "not found (table)",
+			urlPath:           "/table/_upsert",
+			expectedSatusCode: 404,
+			expectedBody:      "table not found",
+			requestData:       map[string]string{"title": "new"},
+			mockBehaviour: func(ms *service.MockRecordService) {
+				ms.EXPECT().Upsert(gomock.Any(), "table", "", map[string]string{"title": "new"}).Return(0, false, service.ErrTableNotFound)
+			},
+		},
+		{
+			name:              "unique value conflict",
+			urlPath:           "/table/_upsert",
+			expectedSatusCode: 409,
+			expectedBody:      service.ErrConflict.Error(),
+			requestData:       map[string]string{"title": "new"},
+			mockBehaviour: func(ms *service.MockRecordService) {
+				ms.EXPECT().Upsert(gomock.Any(), "table", "", map[string]string{"title": "new"}).Return(0, false, service.ErrConflict)
+			},
+		},
+		{
+			name:              "service error",
+			urlPath:           "/table/_upsert",
+			expectedSatusCode: 500,
+			expectedBody:      "unable to upsert record",
+			requestData:       map[string]string{"title": "new"},
+			mockBehaviour: func(ms *service.MockRecordService) {
+				ms.EXPECT().Upsert(gomock.Any(), "table", "", map[string]string{"title": "new"}).Return(0, false, fmt.Errorf("some service error"))
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := gomock.NewController(t)
+			defer c.Finish()
+
+			recordService := service.NewMockRecordService(c)
+			tc.mockBehaviour(recordService)
+
+			servicies := &service.Service{
+				RecordService: recordService,
+			}
+
+			router := NewRouter(servicies, DefaultOptions())
+			w := httptest.NewRecorder()
+			params := url.Values{}
+			for k, v := range tc.requestData {
+				params.Add(k, v)
+			}
+
+			r := httptest.NewRequest("PUT", tc.urlPath, bytes.NewBufferString(params.Encode()))
+			r.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+
+			router.ServeHTTP(w, r)
+
+			assert.Equal(t, tc.expectedSatusCode, w.Result().StatusCode)
+			assert.Equal(t, tc.expectedBody, w.Body.String())
+		})
+	}
+}
+
+func TestRouter_conditionalRequests(t *testing.T) {
+	testCases := []struct {
+		name              string
+		method            string
+		urlPath           string
+		header            string
+		headerValue       string
+		requestData       map[string]string
+		expectedSatusCode int
+		expectedBody      string
+		expectedETag      string
+		mockBehaviour     func(ms *service.MockRecordService)
+	}{
+		{
+			name:              "get with etag",
+			method:            "GET",
+			urlPath:           "/table/3",
+			expectedSatusCode: 200,
+			expectedBody:      smallRecordJSON,
+			expectedETag:      `"abc"`,
+			mockBehaviour: func(ms *service.MockRecordService) {
+				ms.EXPECT().GetById(gomock.Any(), "table", 3, service.ReadOptions{}).Return(smallRecord, `"abc"`, nil)
+			},
+		},
+		{
+			name:              "not modified",
+			method:            "GET",
+			urlPath:           "/table/3",
+			header:            "If-None-Match",
+			headerValue:       `"abc"`,
+			expectedSatusCode: 304,
+			expectedBody:      "",
+			expectedETag:      `"abc"`,
+			mockBehaviour: func(ms *service.MockRecordService) {
+				ms.EXPECT().GetById(gomock.Any(), "table", 3, service.ReadOptions{}).Return(smallRecord, `"abc"`, nil)
+			},
+		},
+		{
+			name:              "modified",
+			method:            "GET",
+			urlPath:           "/table/3",
+			header:            "If-None-Match",
+			headerValue:       `"old"`,
+			expectedSatusCode: 200,
+			expectedBody:      smallRecordJSON,
+			expectedETag:      `"abc"`,
+			mockBehaviour: func(ms *service.MockRecordService) {
+				ms.EXPECT().GetById(gomock.Any(), "table", 3, service.ReadOptions{}).Return(smallRecord, `"abc"`, nil)
+			},
+		},
+		{
+			name:              "update precondition failed",
+			method:            "POST",
+			urlPath:           "/table/3",
+			header:            "If-Match",
+			headerValue:       `"old"`,
+			requestData:       map[string]string{"title": "new"},
+			expectedSatusCode: 412,
+			expectedBody:      "precondition failed",
+			mockBehaviour: func(ms *service.MockRecordService) {
+				ms.EXPECT().UpdateById(gomock.Any(), "table", 3, map[string]string{"title": "new"}, `"old"`).Return(service.ErrPreconditionFailed)
+			},
+		},
+		{
+			name:              "delete precondition failed",
+			method:            "DELETE",
+			urlPath:           "/table/3",
+			header:            "If-Match",
+			headerValue:       `"old"`,
+			expectedSatusCode: 412,
+			expectedBody:      "precondition failed",
+			mockBehaviour: func(ms *service.MockRecordService) {
+				ms.EXPECT().DeleteById(gomock.Any(), "table", 3, `"old"`).Return(service.ErrPreconditionFailed)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := gomock.NewController(t)
+			defer c.Finish()
+
+			recordService := service.NewMockRecordService(c)
+			tc.mockBehaviour(recordService)
+
+			servicies := &service.Service{
+				RecordService: recordService,
+			}
+
+			router := NewRouter(servicies, DefaultOptions())
+			w := httptest.NewRecorder()
+			params := url.Values{}
+			for k, v := range tc.requestData {
+				params.Add(k, v)
+			}
+
+			r := httptest.NewRequest(tc.method, tc.urlPath, bytes.NewBufferString(params.Encode()))
+			r.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+			if tc.header != "" {
+				r.Header.Add(tc.header, tc.headerValue)
+			}
+
+			router.ServeHTTP(w, r)
+
+			assert.Equal(t, tc.expectedSatusCode, w.Result().StatusCode)
+			assert.Equal(t, tc.expectedBody, w.Body.String())
+			assert.Equal(t, tc.expectedETag, w.Result().Header.Get("ETag"))
+		})
+	}
+}
+
+func TestRouter_softDelete(t *testing.T) {
+	testCases := []struct {
+		name              string
+		method            string
+		urlPath           string
+		expectedSatusCode int
+		expectedBody      string
+		mockBehaviour     func(ms *service.MockRecordService)
+	}{
+		{
+			name:              "restore",
+			method:            "POST",
+			urlPath:           "/table/3/_restore",
+			expectedSatusCode: 200,
+			expectedBody:      "restored record id 3",
+			mockBehaviour: func(ms *service.MockRecordService) {
+				ms.EXPECT().RestoreById(gomock.Any(), "table", 3).Return(nil)
+			},
+		},
+		{
+			name:              "restore unsupported",
+			method:            "POST",
+			urlPath:           "/table/3/_restore",
+			expectedSatusCode: 400,
+			expectedBody:      "table does not support soft delete",
+			mockBehaviour: func(ms *service.MockRecordService) {
+				ms.EXPECT().RestoreById(gomock.Any(), "table", 3).Return(service.ErrRestoreUnsupported)
+			},
+		},
+		{
+			name:              "restore not found",
+			method:            "POST",
+			urlPath:           "/table/3/_restore",
+			expectedSatusCode: 404,
+			expectedBody:      "record not found",
+			mockBehaviour: func(ms *service.MockRecordService) {
+				ms.EXPECT().RestoreById(gomock.Any(), "table", 3).Return(service.ErrRecordNotFound)
+			},
+		},
+		{
+			name:              "list with deleted",
+			method:            "GET",
+			urlPath:           "/table?with_deleted=true",
+			expectedSatusCode: 200,
+			expectedBody:      bigRecordsJSON,
+			mockBehaviour: func(ms *service.MockRecordService) {
+				ms.EXPECT().GetAllRecords(gomock.Any(), "table", dto.Filter(nil), 5, 0, service.ReadOptions{WithDeleted: true}).Return(bigRecords, nil)
+			},
+		},
+		{
+			name:              "get with deleted",
+			method:            "GET",
+			urlPath:           "/table/3?with_deleted=true",
+			expectedSatusCode: 200,
+			expectedBody:      smallRecordJSON,
+			mockBehaviour: func(ms *service.MockRecordService) {
+				ms.EXPECT().GetById(gomock.Any(), "table", 3, service.ReadOptions{WithDeleted: true}).Return(smallRecord, `"abc"`, nil)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := gomock.NewController(t)
+			defer c.Finish()
+
+			recordService := service.NewMockRecordService(c)
+			tc.mockBehaviour(recordService)
+
+			servicies := &service.Service{
+				RecordService: recordService,
+			}
+
+			router := NewRouter(servicies, DefaultOptions())
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(tc.method, tc.urlPath, bytes.NewBufferString(""))
+
+			router.ServeHTTP(w, r)
+
+			assert.Equal(t, tc.expectedSatusCode, w.Result().StatusCode)
+			assert.Equal(t, tc.expectedBody, w.Body.String())
+		})
+	}
+}
+
+func TestRouter_history(t *testing.T) {
+	testCases := []struct {
+		name              string
+		urlPath           string
+		expectedSatusCode int
+		expectedBody      string
+		mockBehaviour     func(ms *service.MockRecordService)
+	}{
+		{
+			name:              "OK",
+			urlPath:           "/table/3/_history",
+			expectedSatusCode: 200,
+			expectedBody:      historyJSON,
+			mockBehaviour: func(ms *service.MockRecordService) {
+				ms.EXPECT().History(gomock.Any(), "table", 3).Return(historyEntries, nil)
+			},
+		},
+		{
+			name:              "audit disabled",
+			urlPath:           "/table/3/_history",
+			expectedSatusCode: 404,
+			expectedBody:      "audit log is disabled",
+			mockBehaviour: func(ms *service.MockRecordService) {
+				ms.EXPECT().History(gomock.Any(), "table", 3).Return(nil, service.ErrAuditDisabled)
+			},
+		},
+		{
+			name:              "unknown table",
+			urlPath:           "/table/3/_history",
+			expectedSatusCode: 404,
+			expectedBody:      "unknown table",
+			mockBehaviour: func(ms *service.MockRecordService) {
+				ms.EXPECT().History(gomock.Any(), "table", 3).Return(nil, service.ErrTableNotFound)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := gomock.NewController(t)
+			defer c.Finish()
+
+			recordService := service.NewMockRecordService(c)
+			tc.mockBehaviour(recordService)
+
+			servicies := &service.Service{
+				RecordService: recordService,
+			}
+
+			router := NewRouter(servicies, DefaultOptions())
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest("GET", tc.urlPath, bytes.NewBufferString(""))
+
+			router.ServeHTTP(w, r)
+
+			assert.Equal(t, tc.expectedSatusCode, w.Result().StatusCode)
+			assert.Equal(t, tc.expectedBody, w.Body.String())
+		})
+	}
+}
+
+func TestRouter_options(t *testing.T) {
+	testCases := []struct {
+		name              string
+		method            string
+		urlPath           string
+		opts              func(o *Options)
+		expectedSatusCode int
+		expectedBody      string
+		mockBehaviour     func(ms *service.MockRecordService)
+	}{
+		{
+			name:              "default limit",
+			method:            "GET",
+			urlPath:           "/table",
+			opts:              func(o *Options) { o.DefaultLimit = 20 },
+			expectedSatusCode: 200,
+			expectedBody:      bigRecordsJSON,
+			mockBehaviour: func(ms *service.MockRecordService) {
+				ms.EXPECT().GetAllRecords(gomock.Any(), "table", gomock.Any(), 20, 0, gomock.Any()).Return(bigRecords, nil)
+			},
+		},
+		{
+			name:              "limit above max",
+			method:            "GET",
+			urlPath:           "/table?limit=500",
+			opts:              func(o *Options) { o.MaxLimit = 100 },
+			expectedSatusCode: 200,
+			expectedBody:      bigRecordsJSON,
+			mockBehaviour: func(ms *service.MockRecordService) {
+				ms.EXPECT().GetAllRecords(gomock.Any(), "table", gomock.Any(), 100, 0, gomock.Any()).Return(bigRecords, nil)
+			},
+		},
+		{
+			name:              "keep nulls",
+			method:            "GET",
+			urlPath:           "/table",
+			opts:              func(o *Options) { o.KeepNulls = true },
+			expectedSatusCode: 200,
+			expectedBody:      bigRecordsJSON,
+			mockBehaviour: func(ms *service.MockRecordService) {
+				ms.EXPECT().GetAllRecords(gomock.Any(), "table", dto.Filter(nil), 5, 0, service.ReadOptions{KeepNulls: true}).Return(bigRecords, nil)
+			},
+		},
+		{
+			name:              "with_nulls overrides option",
+			method:            "GET",
+			urlPath:           "/table?with_nulls=false",
+			opts:              func(o *Options) { o.KeepNulls = true },
+			expectedSatusCode: 200,
+			expectedBody:      bigRecordsJSON,
+			mockBehaviour: func(ms *service.MockRecordService) {
+				ms.EXPECT().GetAllRecords(gomock.Any(), "table", dto.Filter(nil), 5, 0, service.ReadOptions{}).Return(bigRecords, nil)
+			},
+		},
+		{
+			name:              "with_nulls",
+			method:            "GET",
+			urlPath:           "/table/3?with_nulls=true",
+			opts:              func(o *Options) {},
+			expectedSatusCode: 200,
+			expectedBody:      smallRecordJSON,
+			mockBehaviour: func(ms *service.MockRecordService) {
+				ms.EXPECT().GetById(gomock.Any(), "table", 3, service.ReadOptions{KeepNulls: true}).Return(smallRecord, `"abc"`, nil)
+			},
+		},
+		{
+			name:              "batch disabled",
+			method:            "POST",
+			urlPath:           "/_batch",
+			opts:              func(o *Options) { o.Batch = false },
+			expectedSatusCode: 404,
+			expectedBody:      "page not found",
+			mockBehaviour:     func(ms *service.MockRecordService) {},
+		},
+		{
+			name:              "bulk update disabled",
+			method:            "PATCH",
+			urlPath:           "/table?id=1",
+			opts:              func(o *Options) { o.Bulk = false },
+			expectedSatusCode: 404,
+			expectedBody:      "page not found",
+			mockBehaviour:     func(ms *service.MockRecordService) {},
+		},
+		{
+			name:              "bulk delete disabled",
+			method:            "DELETE",
+			urlPath:           "/table?id=1",
+			opts:              func(o *Options) { o.Bulk = false },
+			expectedSatusCode: 404,
+			expectedBody:      "page not found",
+			mockBehaviour:     func(ms *service.MockRecordService) {},
+		},
+		{
+			name:              "upsert disabled",
+			method:            "PUT",
+			urlPath:           "/table/_upsert",
+			opts:              func(o *Options) { o.Upsert = false },
+			expectedSatusCode: 404,
+			expectedBody:      "page not found",
+			mockBehaviour:     func(ms *service.MockRecordService) {},
+		},
+		{
+			name:              "history disabled",
+			method:            "GET",
+			urlPath:           "/table/3/_history",
+			opts:              func(o *Options) { o.History = false },
+			expectedSatusCode: 404,
+			expectedBody:      "page not found",
+			mockBehaviour:     func(ms *service.MockRecordService) {},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := gomock.NewController(t)
+			defer c.Finish()
+
+			recordService := service.NewMockRecordService(c)
+			tc.mockBehaviour(recordService)
+
+			servicies := &service.Service{
+				RecordService: recordService,
+			}
+
+			opts := DefaultOptions()
+			tc.opts(&opts)
+			router := NewRouter(servicies, opts)
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(tc.method, tc.urlPath, bytes.NewBufferString("{}"))
+
+			router.ServeHTTP(w, r)
+
+			assert.Equal(t, tc.expectedSatusCode, w.Result().StatusCode)
+			assert.Equal(t, tc.expectedBody, w.Body.String())
+		})
+	}
+}
@@ -6,47 +6,169 @@ import (
 	"regexp"
 )
 
+// символы, допустимые в query по RFC 3986, и скобки операторов фильтра (`level[lt]=5`).
+// Кавычку `"`, пробел и прочее клиент обязан кодировать, такой адрес не разбираем
+var queryPattern = regexp.MustCompile(`\A[\w\-.~!$&'()*+,;=:@/?%\[\]]*\z`)
+
 type RequestProcessor interface {
 	getRecords(w http.ResponseWriter, r *http.Request)
 	insertRecord(w http.ResponseWriter, r *http.Request)
+	upsertRecord(w http.ResponseWriter, r *http.Request)
 	getSingleRecord(w http.ResponseWriter, r *http.Request)
 	updateRecord(w http.ResponseWriter, r *http.Request)
 	deleteRecord(w http.ResponseWriter, r *http.Request)
+	restoreRecord(w http.ResponseWriter, r *http.Request)
+	getHistory(w http.ResponseWriter, r *http.Request)
+	updateRecords(w http.ResponseWriter, r *http.Request)
+	deleteRecords(w http.ResponseWriter, r *http.Request)
 	getAllTables(w http.ResponseWriter, r *http.Request)
+	batch(w http.ResponseWriter, r *http.Request)
+	getOpenAPI(w http.ResponseWriter, r *http.Request)
+	getTableSchema(w http.ResponseWriter, r *http.Request)
+	getSchema(w http.ResponseWriter, r *http.Request)
+	exportRecords(w http.ResponseWriter, r *http.Request)
+	importRecords(w http.ResponseWriter, r *http.Request)
+}
+
+// Options - настройки API, которые задаются при запуске
+type Options struct {
+	DefaultLimit int  // размер страницы, если limit не указан
+	MaxLimit     int  // 0 - без ограничения
+	KeepNulls    bool // отдавать поля с null, если в запросе нет with_nulls
+
+	// отключённые части API отвечают 404, как несуществующие
+	Batch   bool
+	Bulk    bool
+	Upsert  bool
+	History bool
+	Export  bool
+	Import  bool
+
+	// способы аутентификации (openapi.AuthAPIKey и т.д.) и анонимный доступ попадают только
+	// в описание API, проверяет их auth.Middleware
+	Auth           []string
+	AllowAnonymous bool
+}
+
+func DefaultOptions() Options {
+	return Options{
+		DefaultLimit: service.DefaultLimit,
+		Batch:        true,
+		Bulk:         true,
+		Upsert:       true,
+		History:      true,
+		Export:       true,
+		Import:       true,
+	}
 }
 
 type Router struct {
-	tableAndIdPattern *regexp.Regexp
-	tablePattern      *regexp.Regexp
-	showTablesPattern *regexp.Regexp
+	tableAndIdPattern  *regexp.Regexp
+	tablePattern       *regexp.Regexp
+	upsertPattern      *regexp.Regexp
+	restorePattern     *regexp.Regexp
+	historyPattern     *regexp.Regexp
+	exportPattern      *regexp.Regexp
+	importPattern      *regexp.Regexp
+	showTablesPattern  *regexp.Regexp
+	batchPattern       *regexp.Regexp
+	openAPIPattern     *regexp.Regexp
+	tableSchemaPattern *regexp.Regexp
+	schemaPattern      *regexp.Regexp
 
+	opts Options
 	RequestProcessor
 }
 
-func NewRouter(s *service.Service) *Router {
+func NewRouter(s *service.Service, opts Options) *Router {
 	tableAndIdPattern := regexp.MustCompile(`\A\/\w+\/\d+\/?\z`)
-	tablePattern := regexp.MustCompile(`\A\/\w+(?:\?\w+=\w+)?(?:&\w+=\w+)*\/?\z`)
+	tablePattern := regexp.MustCompile(`\A\/\w+\/?\z`)
+	upsertPattern := regexp.MustCompile(`\A\/\w+\/_upsert\/?\z`)
+	restorePattern := regexp.MustCompile(`\A\/\w+\/\d+\/_restore\/?\z`)
+	historyPattern := regexp.MustCompile(`\A\/\w+\/\d+\/_history\/?\z`)
+	exportPattern := regexp.MustCompile(`\A\/\w+\/_export\/?\z`)
+	importPattern := regexp.MustCompile(`\A\/\w+\/_import\/?\z`)
 	showTablesPattern := regexp.MustCompile(`\A\/\z`)
+	batchPattern := regexp.MustCompile(`\A\/_batch\/?\z`)
+	openAPIPattern := regexp.MustCompile(`\A\/_openapi\.json\z`)
+	tableSchemaPattern := regexp.MustCompile(`\A\/_schema\/\w+\/?\z`)
+	schemaPattern := regexp.MustCompile(`\A\/_schema\/?\z`)
 	return &Router{
-		tableAndIdPattern: tableAndIdPattern,
-		tablePattern:      tablePattern,
-		showTablesPattern: showTablesPattern,
-		RequestProcessor:  newRequectProcessor(s),
+		tableAndIdPattern:  tableAndIdPattern,
+		tablePattern:       tablePattern,
+		upsertPattern:      upsertPattern,
+		restorePattern:     restorePattern,
+		historyPattern:     historyPattern,
+		exportPattern:      exportPattern,
+		importPattern:      importPattern,
+		showTablesPattern:  showTablesPattern,
+		batchPattern:       batchPattern,
+		openAPIPattern:     openAPIPattern,
+		tableSchemaPattern: tableSchemaPattern,
+		schemaPattern:      schemaPattern,
+		opts:               opts,
+		RequestProcessor:   newRequectProcessor(s, opts),
 	}
 }
 
+// ServeHTTP выбирает обработчик только по пути: параметры запроса разбирают и проверяют
+// сами обработчики (getFilter и т.д.). Из query проверяется только, что это корректная часть URI
 func (router *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	switch {
-	case router.tablePattern.MatchString(r.RequestURI):
+	case !queryPattern.MatchString(r.URL.RawQuery):
+		notFound(w)
+	case router.batchPattern.MatchString(r.URL.Path): // раньше таблиц: `_batch` тоже подходит под \w+
+		switch {
+		case !router.opts.Batch:
+			notFound(w)
+		case r.Method == "POST":
+			router.batch(w, r)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	case router.openAPIPattern.MatchString(r.URL.Path):
+		switch r.Method {
+		case "GET":
+			router.getOpenAPI(w, r)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	case router.tableSchemaPattern.MatchString(r.URL.Path):
+		switch r.Method {
+		case "GET":
+			router.getTableSchema(w, r)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	case router.schemaPattern.MatchString(r.URL.Path): // раньше таблиц: `_schema` тоже подходит под \w+
+		switch r.Method {
+		case "GET":
+			router.getSchema(w, r)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	case router.tablePattern.MatchString(r.URL.Path):
 		switch r.Method {
 		case "GET":
 			router.getRecords(w, r)
 		case "PUT":
 			router.insertRecord(w, r)
+		case "PATCH":
+			if !router.opts.Bulk {
+				notFound(w)
+				return
+			}
+			router.updateRecords(w, r)
+		case "DELETE":
+			if !router.opts.Bulk {
+				notFound(w)
+				return
+			}
+			router.deleteRecords(w, r)
 		default:
 			w.WriteHeader(http.StatusInternalServerError)
 		}
-	case router.tableAndIdPattern.MatchString(r.RequestURI):
+	case router.tableAndIdPattern.MatchString(r.URL.Path):
 		switch r.Method {
 		case "GET":
 			router.getSingleRecord(w, r)
@@ -57,11 +179,58 @@ func (router *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		default:
 			w.WriteHeader(http.StatusInternalServerError)
 		}
-	case router.showTablesPattern.MatchString(r.RequestURI):
+	case router.upsertPattern.MatchString(r.URL.Path):
+		switch {
+		case !router.opts.Upsert:
+			notFound(w)
+		case r.Method == "PUT":
+			router.upsertRecord(w, r)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	case router.restorePattern.MatchString(r.URL.Path):
+		switch r.Method {
+		case "POST":
+			router.restoreRecord(w, r)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	case router.historyPattern.MatchString(r.URL.Path):
+		switch {
+		case !router.opts.History:
+			notFound(w)
+		case r.Method == "GET":
+			router.getHistory(w, r)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	case router.exportPattern.MatchString(r.URL.Path):
+		switch {
+		case !router.opts.Export:
+			notFound(w)
+		case r.Method == "GET":
+			router.exportRecords(w, r)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	case router.importPattern.MatchString(r.URL.Path):
+		switch {
+		case !router.opts.Import:
+			notFound(w)
+		case r.Method == "POST":
+			router.importRecords(w, r)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	case router.showTablesPattern.MatchString(r.URL.Path):
 		router.getAllTables(w, r)
 	default:
 		// router.getAllTables(w, r)
-		w.WriteHeader(http.StatusNotFound)
-		w.Write([]byte("page not found"))
+		notFound(w)
 	}
 }
+
+func notFound(w http.ResponseWriter) {
+	w.WriteHeader(http.StatusNotFound)
+	w.Write([]byte("page not found"))
+}
@@ -0,0 +1,232 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"hw6coursera/dto"
+	"hw6coursera/repository"
+)
+
+// Action - действие над таблицей, на которое выдаётся разрешение
+type Action string
+
+const (
+	ActionList   Action = "list"
+	ActionGet    Action = "get"
+	ActionCreate Action = "create"
+	ActionUpdate Action = "update"
+	ActionDelete Action = "delete"
+	ActionAll    Action = "*"
+)
+
+// AnonymousRole - роль запросов без аутентификации
+const AnonymousRole = "anonymous"
+
+// AllTables - разрешение на все таблицы
+const AllTables = "*"
+
+// AccessPolicy - какие роли что могут делать с таблицами и какие строки им видны
+type AccessPolicy struct {
+	Roles map[string]map[string][]Action // роль -> таблица или * -> действия; пусто - разрешено всё
+	Rows  map[string]RowRule             // таблица -> правило для строк
+}
+
+// RowRule - клиенту доступны только строки, где Column равна его id
+type RowRule struct {
+	Column      string
+	ExemptRoles []string // роли, на которые правило не действует
+}
+
+// validate проверяет, что правила ссылаются на таблицы и колонки, доступные через API
+func (a AccessPolicy) validate(s dto.Schema) error {
+	for role, tables := range a.Roles {
+		for tableName, actions := range tables {
+			if _, ok := s[tableName]; !ok && tableName != AllTables {
+				return fmt.Errorf("table %s from role %s not found in schema", tableName, role)
+			}
+			for _, action := range actions {
+				switch action {
+				case ActionList, ActionGet, ActionCreate, ActionUpdate, ActionDelete, ActionAll:
+				default:
+					return fmt.Errorf("unknown action %q for role %s", action, role)
+				}
+			}
+		}
+	}
+	for tableName, rule := range a.Rows {
+		t, ok := s[tableName]
+		if !ok {
+			return fmt.Errorf("table %s from row rules not found in schema", tableName)
+		}
+		c, ok := getColumn(t, rule.Column)
+		if !ok || c.WriteOnly {
+			return fmt.Errorf("column %s.%s from row rules not found", tableName, rule.Column)
+		}
+		if c.IsPrimaryKey {
+			return fmt.Errorf("row rule for %s cannot use primary key", tableName)
+		}
+	}
+	return nil
+}
+
+func rolesFromContext(ctx context.Context) (dto.Principal, []string, bool) {
+	p, ok := PrincipalFromContext(ctx)
+	if !ok {
+		return dto.Principal{}, []string{AnonymousRole}, false
+	}
+	return p, p.Roles, true
+}
+
+// allowed - разрешено ли хоть одной из ролей действие над таблицей
+func (a AccessPolicy) allowed(roles []string, tableName string, action Action) bool {
+	if len(a.Roles) == 0 {
+		return true
+	}
+	for _, role := range roles {
+		for _, table := range []string{tableName, AllTables} {
+			for _, granted := range a.Roles[role][table] {
+				if granted == action || granted == ActionAll {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// authorize проверяет, что клиенту из ctx разрешены все actions над таблицей, и возвращает
+// условия, которые нужно добавить в WHERE, чтобы клиент видел и менял только свои строки
+func (r *RecordManager) authorize(ctx context.Context, t dto.Table, actions ...Action) (dto.Filter, error) {
+	access := r.opts.Access
+	p, roles, authenticated := rolesFromContext(ctx)
+	for _, action := range actions {
+		if !access.allowed(roles, t.Name, action) {
+			return nil, ErrForbidden
+		}
+	}
+
+	rule, ok := access.Rows[t.Name]
+	if !ok || hasAnyRole(roles, rule.ExemptRoles) {
+		return nil, nil
+	}
+	if !authenticated { // анониму своих строк не бывает
+		return nil, ErrForbidden
+	}
+	c, _ := getColumn(t, rule.Column)
+	value, err := parseTypeAndNull(p.ID, c)
+	if err != nil { // id клиента не подходит по типу к колонке - его строк в таблице нет
+		return nil, ErrForbidden
+	}
+	return dto.Filter{{Column: c.Name, Operator: dto.OpEq, Value: value}}, nil
+}
+
+// visibleTables - таблицы, с которыми клиенту разрешено хоть что-то
+func (r *RecordManager) visibleTables(ctx context.Context, s dto.Schema) []string {
+	_, roles, _ := rolesFromContext(ctx)
+	tables := make([]string, 0, len(s))
+	for name := range s {
+		for _, action := range []Action{ActionList, ActionGet, ActionCreate, ActionUpdate, ActionDelete} {
+			if r.opts.Access.allowed(roles, name, action) {
+				tables = append(tables, name)
+				break
+			}
+		}
+	}
+	return tables
+}
+
+// scopeData проверяет колонки scope в данных запроса: чужие значения запрещены,
+// а при fill отсутствующие заполняются значениями клиента. Исходные данные не меняются
+func scopeData(scope dto.Filter, data map[string]string, fill bool) (map[string]string, error) {
+	if len(scope) == 0 {
+		return data, nil
+	}
+	scoped := make(map[string]string, len(data)+len(scope))
+	for k, v := range data {
+		scoped[k] = v
+	}
+	for _, cond := range scope {
+		value, ok := scoped[cond.Column]
+		switch {
+		case !ok && fill:
+			scoped[cond.Column] = fmt.Sprint(cond.Value)
+		case ok && !sameValue(value, cond.Value):
+			return nil, ErrForbidden
+		}
+	}
+	return scoped, nil
+}
+
+// getScoped читает запись по id, если она попадает в scope
+func getScoped(repo repository.RecordManager, t dto.Table, primaryKey string, id int, scope dto.Filter) (map[string]interface{}, error) {
+	if len(scope) == 0 {
+		return repo.GetById(t, primaryKey, id)
+	}
+	records, err := repo.GetAllRecords(t, byId(primaryKey, id, scope...), 1, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, missingOrForbidden(repo, t, primaryKey, id, scope)
+	}
+	return records[0], nil
+}
+
+// missingOrForbidden объясняет, почему запись не нашлась с учётом scope: её нет или она чужая
+func missingOrForbidden(repo repository.RecordManager, t dto.Table, primaryKey string, id int, scope dto.Filter) error {
+	if len(scope) == 0 {
+		return repository.ErrRowNotFound
+	}
+	record, err := repo.GetById(t, primaryKey, id)
+	if err != nil {
+		return err
+	}
+	if !matchesScope(record, scope) {
+		return ErrForbidden
+	}
+	return repository.ErrRowNotFound
+}
+
+func matchesScope(record map[string]interface{}, scope dto.Filter) bool {
+	for _, cond := range scope {
+		if !sameValue(record[cond.Column], cond.Value) {
+			return false
+		}
+	}
+	return true
+}
+
+// значения из базы и из запроса могут быть разных типов (int64 и int, []byte и string)
+func sameValue(a, b interface{}) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return fmt.Sprint(a) == fmt.Sprint(b)
+}
+
+func hasAnyRole(roles []string, wanted []string) bool {
+	for _, role := range roles {
+		for _, w := range wanted {
+			if role == w {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// scopedUpsert не даёт upsert перезаписать чужую строку с тем же ключом
+func scopedUpsert(t dto.Table, key dto.Index, unit map[string]interface{}, scope dto.Filter, upsertFn func(repo repository.RecordManager) error) func(repo repository.RecordManager) error {
+	return func(repo repository.RecordManager) error {
+		return repo.InTx(func(tx repository.RecordManager) error {
+			existing, err := tx.GetAllRecords(t, byKey(key, unit), 1, 0)
+			if err != nil {
+				return err
+			}
+			if len(existing) > 0 && !matchesScope(existing[0], scope) {
+				return ErrForbidden
+			}
+			return upsertFn(tx)
+		})
+	}
+}
@@ -0,0 +1,257 @@
+package service
+
+import (
+	"context"
+	"hw6coursera/dto"
+	"hw6coursera/repository"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func accessSchema() dto.Schema {
+	return dto.Schema{
+		"notes": {
+			Name: "notes",
+			Columns: []dto.Column{
+				{Name: "id", ColumnType: dto.IntType, IsPrimaryKey: true},
+				{Name: "owner_id", ColumnType: dto.IntType},
+				{Name: "text", ColumnType: dto.StringType},
+			},
+		},
+		"countries": {
+			Name: "countries",
+			Columns: []dto.Column{
+				{Name: "id", ColumnType: dto.IntType, IsPrimaryKey: true},
+				{Name: "name", ColumnType: dto.StringType},
+			},
+		},
+	}
+}
+
+var testAccess = AccessPolicy{
+	Roles: map[string]map[string][]Action{
+		AnonymousRole: {"countries": {ActionList, ActionGet}},
+		"user":        {"*": {ActionList, ActionGet}, "notes": {ActionCreate, ActionUpdate, ActionDelete}},
+		"admin":       {"*": {ActionAll}},
+	},
+	Rows: map[string]RowRule{
+		"notes": {Column: "owner_id", ExemptRoles: []string{"admin"}},
+	},
+}
+
+func as(id string, roles ...string) context.Context {
+	return WithPrincipal(context.Background(), dto.Principal{ID: id, Roles: roles})
+}
+
+func TestService_authorize(t *testing.T) {
+	r := &RecordManager{Schema: accessSchema(), opts: Options{Access: testAccess}}
+	notes, countries := r.Schema["notes"], r.Schema["countries"]
+	ownScope := dto.Filter{{Column: "owner_id", Operator: dto.OpEq, Value: 7}}
+
+	testCases := []struct {
+		name          string
+		ctx           context.Context
+		table         dto.Table
+		actions       []Action
+		expectedScope dto.Filter
+		expectedErr   error
+	}{
+		{name: "anonymous list", ctx: context.Background(), table: countries, actions: []Action{ActionList}},
+		{name: "anonymous create", ctx: context.Background(), table: countries, actions: []Action{ActionCreate}, expectedErr: ErrForbidden},
+		{name: "anonymous notes", ctx: context.Background(), table: notes, actions: []Action{ActionList}, expectedErr: ErrForbidden},
+		{name: "user own notes", ctx: as("7", "user"), table: notes, actions: []Action{ActionList}, expectedScope: ownScope},
+		{name: "user upsert notes", ctx: as("7", "user"), table: notes, actions: []Action{ActionCreate, ActionUpdate}, expectedScope: ownScope},
+		{name: "user writes countries", ctx: as("7", "user"), table: countries, actions: []Action{ActionUpdate}, expectedErr: ErrForbidden},
+		{name: "user id of wrong type", ctx: as("alice", "user"), table: notes, actions: []Action{ActionGet}, expectedErr: ErrForbidden},
+		{name: "admin is exempt from row rules", ctx: as("1", "admin"), table: notes, actions: []Action{ActionDelete}},
+		{name: "no roles", ctx: as("7"), table: countries, actions: []Action{ActionList}, expectedErr: ErrForbidden},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			scope, err := r.authorize(tc.ctx, tc.table, tc.actions...)
+			assert.Equal(t, tc.expectedErr, err)
+			assert.Equal(t, tc.expectedScope, scope)
+		})
+	}
+
+	t.Run("no roles configured", func(t *testing.T) {
+		open := &RecordManager{Schema: accessSchema()}
+		scope, err := open.authorize(context.Background(), notes, ActionDelete)
+		assert.NoError(t, err)
+		assert.Nil(t, scope)
+	})
+}
+
+func TestService_accessEnforcement(t *testing.T) {
+	schema := accessSchema()
+	notes := schema["notes"]
+	own := dto.Condition{Column: "owner_id", Operator: dto.OpEq, Value: 7}
+
+	testCases := []struct {
+		name          string
+		mockBehaviour func(mr *repository.MockRecordManager)
+		call          func(r *RecordManager) error
+		expectedErr   error
+	}{
+		{
+			name: "list adds row rule to filter",
+			mockBehaviour: func(mr *repository.MockRecordManager) {
+				mr.EXPECT().GetAllRecords(notes, dto.Filter{{Column: "text", Operator: dto.OpLike, Value: "a%"}, own}, 5, 0).Return(nil, nil)
+			},
+			call: func(r *RecordManager) error {
+				_, err := r.GetAllRecords(as("7", "user"), "notes", dto.Filter{{Column: "text", Operator: dto.OpLike, Value: "a%"}}, 5, 0, ReadOptions{})
+				return err
+			},
+		},
+		{
+			name: "get foreign record",
+			mockBehaviour: func(mr *repository.MockRecordManager) {
+				mr.EXPECT().GetAllRecords(notes, byId("id", 3, own), 1, 0).Return(nil, nil)
+				mr.EXPECT().GetById(notes, "id", 3).Return(map[string]interface{}{"id": int64(3), "owner_id": int64(8)}, nil)
+			},
+			call: func(r *RecordManager) error {
+				_, _, err := r.GetById(as("7", "user"), "notes", 3, ReadOptions{})
+				return err
+			},
+			expectedErr: ErrForbidden,
+		},
+		{
+			name: "get missing record",
+			mockBehaviour: func(mr *repository.MockRecordManager) {
+				mr.EXPECT().GetAllRecords(notes, byId("id", 3, own), 1, 0).Return(nil, nil)
+				mr.EXPECT().GetById(notes, "id", 3).Return(nil, repository.ErrRowNotFound)
+			},
+			call: func(r *RecordManager) error {
+				_, _, err := r.GetById(as("7", "user"), "notes", 3, ReadOptions{})
+				return err
+			},
+			expectedErr: ErrRecordNotFound,
+		},
+		{
+			name: "create fills owner",
+			mockBehaviour: func(mr *repository.MockRecordManager) {
+				mr.EXPECT().Create(notes, map[string]interface{}{"owner_id": 7, "text": "hi"}).Return(1, nil)
+			},
+			call: func(r *RecordManager) error {
+				_, err := r.Create(as("7", "user"), "notes", map[string]string{"text": "hi"})
+				return err
+			},
+		},
+		{
+			name:          "create for another owner",
+			mockBehaviour: func(mr *repository.MockRecordManager) {},
+			call: func(r *RecordManager) error {
+				_, err := r.Create(as("7", "user"), "notes", map[string]string{"text": "hi", "owner_id": "8"})
+				return err
+			},
+			expectedErr: ErrForbidden,
+		},
+		{
+			name: "update goes through filter",
+			mockBehaviour: func(mr *repository.MockRecordManager) {
+				mr.EXPECT().UpdateByFilter(notes, byId("id", 3, own), map[string]interface{}{"text": "new"}).Return(1, nil)
+			},
+			call: func(r *RecordManager) error {
+				return r.UpdateById(as("7", "user"), "notes", 3, map[string]string{"text": "new"}, "")
+			},
+		},
+		{
+			name:          "update gives record away",
+			mockBehaviour: func(mr *repository.MockRecordManager) {},
+			call: func(r *RecordManager) error {
+				return r.UpdateById(as("7", "user"), "notes", 3, map[string]string{"owner_id": "8"}, "")
+			},
+			expectedErr: ErrForbidden,
+		},
+		{
+			name: "delete foreign record",
+			mockBehaviour: func(mr *repository.MockRecordManager) {
+				mr.EXPECT().DeleteByFilter(notes, byId("id", 3, own)).Return(0, nil)
+				mr.EXPECT().GetById(notes, "id", 3).Return(map[string]interface{}{"id": int64(3), "owner_id": int64(8)}, nil)
+			},
+			call: func(r *RecordManager) error {
+				return r.DeleteById(as("7", "user"), "notes", 3, "")
+			},
+			expectedErr: ErrForbidden,
+		},
+		{
+			name: "bulk delete adds row rule",
+			mockBehaviour: func(mr *repository.MockRecordManager) {
+				mr.EXPECT().DeleteByFilter(notes, dto.Filter{own}).Return(2, nil)
+			},
+			call: func(r *RecordManager) error {
+				_, err := r.DeleteByFilter(as("7", "user"), "notes", nil, BulkOptions{Confirmed: true})
+				return err
+			},
+		},
+		{
+			name: "admin deletes by id",
+			mockBehaviour: func(mr *repository.MockRecordManager) {
+				mr.EXPECT().DeleteById(notes, "id", 3).Return(nil)
+			},
+			call: func(r *RecordManager) error {
+				return r.DeleteById(as("1", "admin"), "notes", 3, "")
+			},
+		},
+		{
+			name: "batch checks each operation",
+			mockBehaviour: func(mr *repository.MockRecordManager) {
+				mr.EXPECT().InTx(gomock.Any()).DoAndReturn(func(fn func(tx repository.RecordManager) error) error { return fn(mr) })
+			},
+			call: func(r *RecordManager) error {
+				_, err := r.Batch(as("7", "user"), []dto.BatchOperation{{Op: dto.BatchCreate, Table: "countries", Data: map[string]string{"name": "Norway"}}})
+				return err
+			},
+			expectedErr: ErrBatchOperation{Index: 0, Err: ErrForbidden},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := gomock.NewController(t)
+			defer c.Finish()
+
+			mockRepo := repository.NewMockRecordManager(c)
+			tc.mockBehaviour(mockRepo)
+			r := &RecordManager{repo: mockRepo, Schema: schema, opts: Options{Access: testAccess}}
+
+			assert.Equal(t, tc.expectedErr, tc.call(r))
+		})
+	}
+}
+
+func TestService_GetAllTablesAccess(t *testing.T) {
+	r := &RecordManager{Schema: accessSchema(), opts: Options{Access: testAccess}}
+
+	tables, err := r.GetAllTables(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"countries"}, tables)
+
+	schema, err := r.GetSchema(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, dto.Schema{"countries": r.Schema["countries"]}, schema)
+
+	tables, err = r.GetAllTables(as("7", "user"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"countries", "notes"}, tables)
+}
+
+func TestAccessPolicy_validate(t *testing.T) {
+	testCases := map[string]AccessPolicy{
+		"unknown table":       {Roles: map[string]map[string][]Action{"user": {"missing": {ActionGet}}}},
+		"unknown action":      {Roles: map[string]map[string][]Action{"user": {"notes": {"drop"}}}},
+		"unknown rule table":  {Rows: map[string]RowRule{"missing": {Column: "owner_id"}}},
+		"unknown rule column": {Rows: map[string]RowRule{"notes": {Column: "author"}}},
+		"primary key rule":    {Rows: map[string]RowRule{"notes": {Column: "id"}}},
+	}
+	for name, access := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert.Error(t, access.validate(accessSchema()))
+		})
+	}
+	assert.NoError(t, testAccess.validate(accessSchema()))
+}
@@ -0,0 +1,352 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"hw6coursera/dto"
+	"hw6coursera/logging"
+	"hw6coursera/repository"
+	"math"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+const anonymousActor = "anonymous"
+
+func actorFromContext(ctx context.Context) string {
+	if p, ok := PrincipalFromContext(ctx); ok {
+		return p.ID
+	}
+	return anonymousActor
+}
+
+// History implements RecordService
+func (r *RecordManager) History(ctx context.Context, tableName string, id int) ([]dto.AuditEntry, error) {
+	logger := logging.FromContext(ctx).With("table", tableName, "id", id)
+	logger.Debug("getting record history")
+
+	tableStruct, ok := r.schema()[tableName]
+	if !ok {
+		logger.Info("table not found")
+		return nil, ErrTableNotFound
+	}
+
+	if r.audit == nil {
+		logger.Info("audit log is disabled")
+		return nil, ErrAuditDisabled
+	}
+
+	scope, err := r.authorize(ctx, tableStruct, ActionGet)
+	if err != nil {
+		logger.Info("access denied")
+		return nil, err
+	}
+	if len(scope) > 0 { // историю чужой записи не отдаём
+		primaryKey, err := getPrimaryKeyColumnName(tableStruct)
+		if err != nil {
+			return nil, err
+		}
+		switch _, err := getScoped(r.reader(ctx), tableStruct, primaryKey, id, scope); {
+		case err == ErrForbidden:
+			return nil, err
+		case err == repository.ErrRowNotFound:
+			return nil, ErrRecordNotFound
+		case err != nil:
+			return nil, err
+		}
+	}
+
+	entries, err := r.audit.History(r.reader(ctx), tableName, id)
+	if err != nil {
+		logger.Error("unable to get record history", "err", err)
+		return nil, err
+	}
+	for _, entry := range entries { // записи могли попасть в журнал до того, как колонку сделали write-only
+		redactChanges(tableStruct, entry.Changes)
+	}
+	return entries, nil
+}
+
+// writer - через что идут изменения: при включённом журнале каждое изменение в него попадает
+func (r *RecordManager) writer(ctx context.Context) repository.RecordManager {
+	repo := r.reader(ctx)
+	if r.audit == nil {
+		return repo
+	}
+	return &auditedRepo{RecordManager: repo, log: r.audit, actor: actorFromContext(ctx), logger: logging.FromContext(ctx),
+		maxBulkRows: r.opts.AuditMaxBulkRows}
+}
+
+// reader - репозиторий для чтения, пишет в лог запроса из ctx
+func (r *RecordManager) reader(ctx context.Context) repository.RecordManager {
+	return repository.WithLogger(r.repo, logging.FromContext(ctx))
+}
+
+// auditedRepo читает запись до и после изменения и пишет разницу в журнал.
+// Изменение и чтения идут в одной транзакции
+type auditedRepo struct {
+	repository.RecordManager
+	log    repository.AuditLog
+	actor  string
+	logger *logging.Logger
+	// старые значения записей под фильтром держатся в памяти до конца операции, поэтому их число ограничено
+	maxBulkRows int
+
+	// записи для журнала вне базы: пишем их только после коммита. nil - транзакция не начата
+	pending *[]dto.AuditEntry
+}
+
+// InTx implements repository.RecordManager
+func (a *auditedRepo) InTx(fn func(tx repository.RecordManager) error) error {
+	return a.atomic(func(tx *auditedRepo) error {
+		return fn(tx)
+	})
+}
+
+func (a *auditedRepo) atomic(fn func(tx *auditedRepo) error) error {
+	if a.pending != nil { // вложенная транзакция - продолжаем текущую
+		return fn(a)
+	}
+
+	var pending []dto.AuditEntry
+	err := a.RecordManager.InTx(func(tx repository.RecordManager) error {
+		return fn(&auditedRepo{RecordManager: tx, log: a.log, actor: a.actor, logger: a.logger, maxBulkRows: a.maxBulkRows, pending: &pending})
+	})
+	if err != nil {
+		return err
+	}
+
+	// изменение уже закоммичено, ошибку журнала можно только залогировать
+	for _, entry := range pending {
+		if err := a.log.Write(a.RecordManager, entry); err != nil {
+			a.logger.Error("unable to write audit entry", "table", entry.Table, "id", entry.RecordID, "err", err)
+		}
+	}
+	return nil
+}
+
+// Create implements repository.RecordManager
+func (a *auditedRepo) Create(table dto.Table, data map[string]interface{}) (int, error) {
+	var id int
+	err := a.atomic(func(tx *auditedRepo) error {
+		primaryKey, err := getPrimaryKeyColumnName(table)
+		if err != nil {
+			return err
+		}
+		if id, err = tx.RecordManager.Create(table, data); err != nil {
+			return err
+		}
+		created, err := tx.RecordManager.GetById(table, primaryKey, id)
+		if err != nil {
+			return err
+		}
+		return tx.record(table, id, dto.AuditCreate, nil, created)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// Upsert implements repository.RecordManager
+func (a *auditedRepo) Upsert(table dto.Table, primaryKey string, keyColumns []string, data map[string]interface{}) (int, bool, error) {
+	var id int
+	var created bool
+	err := a.atomic(func(tx *auditedRepo) error {
+		// старую запись ищем по тому же ключу, по которому её найдёт upsert
+		var key dto.Filter
+		for _, k := range keyColumns {
+			key = append(key, dto.Condition{Column: k, Operator: dto.OpEq, Value: data[k]})
+		}
+		found, err := tx.RecordManager.GetAllRecords(table, key, 1, 0)
+		if err != nil {
+			return err
+		}
+		var old map[string]interface{}
+		if len(found) > 0 {
+			old = found[0]
+		}
+
+		if id, created, err = tx.RecordManager.Upsert(table, primaryKey, keyColumns, data); err != nil {
+			return err
+		}
+		current, err := tx.RecordManager.GetById(table, primaryKey, id)
+		if err != nil {
+			return err
+		}
+		if created {
+			return tx.record(table, id, dto.AuditCreate, nil, current)
+		}
+		return tx.record(table, id, dto.AuditUpdate, old, current)
+	})
+	if err != nil {
+		return 0, false, err
+	}
+	return id, created, nil
+}
+
+// UpdateById implements repository.RecordManager
+func (a *auditedRepo) UpdateById(table dto.Table, primaryKey string, id int, data map[string]interface{}) error {
+	return a.atomic(func(tx *auditedRepo) error {
+		old, err := tx.RecordManager.GetByIdForUpdate(table, primaryKey, id)
+		if err != nil {
+			return err
+		}
+		if err := tx.RecordManager.UpdateById(table, primaryKey, id, data); err != nil {
+			return err
+		}
+		current, err := tx.RecordManager.GetById(table, primaryKey, id)
+		if err != nil {
+			return err
+		}
+		return tx.record(table, id, auditOperation(table, data), old, current)
+	})
+}
+
+// DeleteById implements repository.RecordManager
+func (a *auditedRepo) DeleteById(table dto.Table, primaryKey string, id int) error {
+	return a.atomic(func(tx *auditedRepo) error {
+		old, err := tx.RecordManager.GetByIdForUpdate(table, primaryKey, id)
+		if err != nil {
+			return err
+		}
+		if err := tx.RecordManager.DeleteById(table, primaryKey, id); err != nil {
+			return err
+		}
+		return tx.record(table, id, dto.AuditDelete, old, nil)
+	})
+}
+
+// UpdateByFilter implements repository.RecordManager
+func (a *auditedRepo) UpdateByFilter(table dto.Table, filter dto.Filter, data map[string]interface{}) (int, error) {
+	var affected int
+	err := a.atomic(func(tx *auditedRepo) error {
+		primaryKey, olds, err := tx.selectForAudit(table, filter)
+		if err != nil {
+			return err
+		}
+		if affected, err = tx.RecordManager.UpdateByFilter(table, filter, data); err != nil {
+			return err
+		}
+
+		// после обновления запись может уже не подходить под фильтр, поэтому перечитываем по id
+		for id, old := range olds {
+			current, err := tx.RecordManager.GetById(table, primaryKey, id)
+			if err != nil {
+				return err
+			}
+			if err := tx.record(table, id, auditOperation(table, data), old, current); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return affected, nil
+}
+
+// DeleteByFilter implements repository.RecordManager
+func (a *auditedRepo) DeleteByFilter(table dto.Table, filter dto.Filter) (int, error) {
+	var affected int
+	err := a.atomic(func(tx *auditedRepo) error {
+		_, olds, err := tx.selectForAudit(table, filter)
+		if err != nil {
+			return err
+		}
+		if affected, err = tx.RecordManager.DeleteByFilter(table, filter); err != nil {
+			return err
+		}
+		for id, old := range olds {
+			if err := tx.record(table, id, dto.AuditDelete, old, nil); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return affected, nil
+}
+
+// selectForAudit - записи под фильтром по id, до изменения
+func (a *auditedRepo) selectForAudit(table dto.Table, filter dto.Filter) (string, map[int]map[string]interface{}, error) {
+	primaryKey, err := getPrimaryKeyColumnName(table)
+	if err != nil {
+		return "", nil, err
+	}
+	limit := math.MaxInt32
+	if a.maxBulkRows > 0 {
+		limit = a.maxBulkRows + 1 // лишняя запись - признак превышения
+	}
+	rows, err := a.RecordManager.GetAllRecords(table, filter, limit, 0)
+	if err != nil {
+		return "", nil, err
+	}
+	if a.maxBulkRows > 0 && len(rows) > a.maxBulkRows {
+		return "", nil, ErrBulkLimit{Limit: a.maxBulkRows}
+	}
+
+	olds := make(map[int]map[string]interface{}, len(rows))
+	for _, row := range rows {
+		id, err := strconv.Atoi(fmt.Sprint(row[primaryKey])) // драйвер отдаёт число или строку
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid primary key value: %v", row[primaryKey])
+		}
+		olds[id] = row
+	}
+	return primaryKey, olds, nil
+}
+
+func (a *auditedRepo) record(table dto.Table, id int, operation string, old, current map[string]interface{}) error {
+	changes := diffRecords(old, current)
+	if len(changes) == 0 { // запись не изменилась
+		return nil
+	}
+	redactChanges(table, changes)
+
+	entry := dto.AuditEntry{
+		Table:     table.Name,
+		RecordID:  id,
+		Operation: operation,
+		Actor:     a.actor,
+		Time:      time.Now().UTC(),
+		Changes:   changes,
+	}
+	if a.log.TableName() == "" {
+		*a.pending = append(*a.pending, entry)
+		return nil
+	}
+	return a.log.Write(a.RecordManager, entry)
+}
+
+// Мягкое удаление и восстановление - это обновление одной колонки-метки
+func auditOperation(table dto.Table, data map[string]interface{}) string {
+	marker, ok := data[table.SoftDeleteColumn]
+	if table.SoftDeleteColumn == "" || !ok || len(data) != 1 {
+		return dto.AuditUpdate
+	}
+	if marker == nil || marker == 0 {
+		return dto.AuditRestore
+	}
+	return dto.AuditDelete
+}
+
+// diffRecords оставляет только поля, значения которых различаются
+func diffRecords(old, current map[string]interface{}) map[string]dto.Change {
+	changes := make(map[string]dto.Change)
+	for k, v := range old {
+		if !reflect.DeepEqual(v, current[k]) {
+			changes[k] = dto.Change{Old: v, New: current[k]}
+		}
+	}
+	for k, v := range current {
+		if _, ok := old[k]; !ok && v != nil {
+			changes[k] = dto.Change{Old: nil, New: v}
+		}
+	}
+	return changes
+}
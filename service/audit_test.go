@@ -0,0 +1,201 @@
+package service
+
+import (
+	"context"
+	"hw6coursera/dto"
+	"hw6coursera/repository"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestService_auditedUpdate(t *testing.T) {
+	table := testingSchema["example_table_1"]
+	old := map[string]interface{}{"primary_key": int64(3), "name": "old", "nullable_field": nil}
+	current := map[string]interface{}{"primary_key": int64(3), "name": "new", "nullable_field": nil}
+
+	testCases := []struct {
+		name          string
+		auditTable    string
+		mockBehaviour func(mr *repository.MockRecordManager, ma *repository.MockAuditLog, written *[]dto.AuditEntry)
+	}{
+		{
+			name:       "audit table in transaction",
+			auditTable: "audit_log",
+			mockBehaviour: func(mr *repository.MockRecordManager, ma *repository.MockAuditLog, written *[]dto.AuditEntry) {
+				gomock.InOrder(
+					mr.EXPECT().InTx(gomock.Any()).DoAndReturn(func(fn func(tx repository.RecordManager) error) error { return fn(mr) }),
+					mr.EXPECT().GetByIdForUpdate(table, "primary_key", 3).Return(old, nil),
+					mr.EXPECT().UpdateById(table, "primary_key", 3, map[string]interface{}{"name": "new"}).Return(nil),
+					mr.EXPECT().GetById(table, "primary_key", 3).Return(current, nil),
+					ma.EXPECT().Write(mr, gomock.Any()).DoAndReturn(func(_ repository.RecordManager, e dto.AuditEntry) error {
+						*written = append(*written, e)
+						return nil
+					}),
+				)
+			},
+		},
+		{
+			name:       "audit file after commit",
+			auditTable: "",
+			mockBehaviour: func(mr *repository.MockRecordManager, ma *repository.MockAuditLog, written *[]dto.AuditEntry) {
+				committed := false
+				gomock.InOrder(
+					mr.EXPECT().InTx(gomock.Any()).DoAndReturn(func(fn func(tx repository.RecordManager) error) error {
+						err := fn(mr)
+						committed = true
+						return err
+					}),
+					mr.EXPECT().GetByIdForUpdate(table, "primary_key", 3).Return(old, nil),
+					mr.EXPECT().UpdateById(table, "primary_key", 3, map[string]interface{}{"name": "new"}).Return(nil),
+					mr.EXPECT().GetById(table, "primary_key", 3).Return(current, nil),
+					ma.EXPECT().Write(mr, gomock.Any()).DoAndReturn(func(_ repository.RecordManager, e dto.AuditEntry) error {
+						assert.True(t, committed)
+						*written = append(*written, e)
+						return nil
+					}),
+				)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := gomock.NewController(t)
+			defer c.Finish()
+
+			mockRepo := repository.NewMockRecordManager(c)
+			mockAudit := repository.NewMockAuditLog(c)
+			mockAudit.EXPECT().TableName().Return(tc.auditTable).AnyTimes()
+
+			var written []dto.AuditEntry
+			tc.mockBehaviour(mockRepo, mockAudit, &written)
+
+			service := Service{
+				RecordService: &RecordManager{
+					repo:   mockRepo,
+					audit:  mockAudit,
+					Schema: testingSchema,
+				},
+			}
+
+			ctx := WithPrincipal(context.Background(), dto.Principal{ID: "alice"})
+			err := service.UpdateById(ctx, "example_table_1", 3, map[string]string{"name": "new"}, "")
+
+			assert.NoError(t, err)
+			if assert.Len(t, written, 1) {
+				assert.Equal(t, "example_table_1", written[0].Table)
+				assert.Equal(t, 3, written[0].RecordID)
+				assert.Equal(t, dto.AuditUpdate, written[0].Operation)
+				assert.Equal(t, "alice", written[0].Actor)
+				assert.Equal(t, map[string]dto.Change{"name": {Old: "old", New: "new"}}, written[0].Changes)
+			}
+		})
+	}
+}
+
+func TestService_auditedBulkLimit(t *testing.T) {
+	c := gomock.NewController(t)
+	defer c.Finish()
+
+	table := testingSchema["example_table_1"]
+	filter := dto.Filter{{Column: "name", Operator: dto.OpEq, Value: "old"}}
+	rows := []map[string]interface{}{{"primary_key": int64(1)}, {"primary_key": int64(2)}, {"primary_key": int64(3)}}
+
+	mockRepo := repository.NewMockRecordManager(c)
+	mockAudit := repository.NewMockAuditLog(c)
+	mockAudit.EXPECT().TableName().Return("audit_log").AnyTimes()
+	// читается на одну запись больше лимита, изменение не выполняется
+	gomock.InOrder(
+		mockRepo.EXPECT().InTx(gomock.Any()).DoAndReturn(func(fn func(tx repository.RecordManager) error) error { return fn(mockRepo) }),
+		mockRepo.EXPECT().GetAllRecords(table, filter, 3, 0).Return(rows, nil),
+	)
+
+	service := Service{
+		RecordService: &RecordManager{
+			repo:   mockRepo,
+			audit:  mockAudit,
+			Schema: testingSchema,
+			opts:   Options{AuditMaxBulkRows: 2},
+		},
+	}
+
+	_, err := service.UpdateByFilter(context.Background(), "example_table_1", dto.Filter{{Column: "name", Operator: dto.OpEq, Value: "old"}},
+		map[string]string{"name": "new"}, BulkOptions{})
+	assert.Equal(t, ErrBulkLimit{Limit: 2}, err)
+}
+
+func TestService_History(t *testing.T) {
+	testCases := []struct {
+		name         string
+		tableName    string
+		withAudit    bool
+		expectedData []dto.AuditEntry
+		expectedErr  error
+	}{
+		{
+			name:      "OK",
+			tableName: "example_table_1",
+			withAudit: true,
+			expectedData: []dto.AuditEntry{{
+				Table:     "example_table_1",
+				RecordID:  3,
+				Operation: dto.AuditDelete,
+				Actor:     "alice",
+				Changes:   map[string]dto.Change{"name": {Old: "old"}},
+			}},
+			expectedErr: nil,
+		},
+		{
+			name:        "disabled",
+			tableName:   "example_table_1",
+			withAudit:   false,
+			expectedErr: ErrAuditDisabled,
+		},
+		{
+			name:        "unknown table",
+			tableName:   "unknown",
+			withAudit:   true,
+			expectedErr: ErrTableNotFound,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := gomock.NewController(t)
+			defer c.Finish()
+
+			mockRepo := repository.NewMockRecordManager(c)
+			recordManager := &RecordManager{
+				repo:   mockRepo,
+				Schema: testingSchema,
+			}
+			if tc.withAudit {
+				mockAudit := repository.NewMockAuditLog(c)
+				mockAudit.EXPECT().History(mockRepo, tc.tableName, 3).Return([]dto.AuditEntry{{
+					Table:     "example_table_1",
+					RecordID:  3,
+					Operation: dto.AuditDelete,
+					Actor:     "alice",
+					Changes:   map[string]dto.Change{"name": {Old: "old"}},
+				}}, nil).MaxTimes(1)
+				recordManager.audit = mockAudit
+			}
+
+			data, err := recordManager.History(context.Background(), tc.tableName, 3)
+
+			assert.Equal(t, tc.expectedErr, err)
+			assert.Equal(t, tc.expectedData, data)
+		})
+	}
+}
+
+func Test_auditOperation(t *testing.T) {
+	soft := dto.Table{Name: "soft", SoftDeleteColumn: "deleted_at"}
+
+	assert.Equal(t, dto.AuditUpdate, auditOperation(testingSchema["example_table_1"], map[string]interface{}{"name": "x"}))
+	assert.Equal(t, dto.AuditDelete, auditOperation(soft, map[string]interface{}{"deleted_at": "2026-01-01 00:00:00"}))
+	assert.Equal(t, dto.AuditRestore, auditOperation(soft, map[string]interface{}{"deleted_at": nil}))
+	assert.Equal(t, dto.AuditUpdate, auditOperation(soft, map[string]interface{}{"deleted_at": nil, "title": "x"}))
+}
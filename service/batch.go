@@ -0,0 +1,102 @@
+package service
+
+import (
+	"context"
+	"hw6coursera/dto"
+	"hw6coursera/logging"
+	"hw6coursera/repository"
+	"regexp"
+	"strconv"
+)
+
+// `$0.id` - id записи, созданной (или изменённой) операцией с индексом 0
+var batchRefPattern = regexp.MustCompile(`\A\$(\d+)\.id\z`)
+
+// Batch implements RecordService
+func (r *RecordManager) Batch(ctx context.Context, ops []dto.BatchOperation) ([]dto.BatchResult, error) {
+	logger := logging.FromContext(ctx)
+	logger.Debug("executing batch", "operations", len(ops))
+
+	if len(ops) == 0 {
+		return nil, ErrEmptyBatch
+	}
+	if max := r.opts.BatchMaxOperations; max > 0 && len(ops) > max {
+		return nil, ErrBatchTooLarge{Limit: max}
+	}
+
+	results := make([]dto.BatchResult, 0, len(ops))
+	err := r.writer(ctx).InTx(func(tx repository.RecordManager) error {
+		// та же валидация, что и для одиночных запросов, но все записи идут через транзакцию
+		// (журнал изменений, если он включён, уже подключён к tx)
+		txService := &RecordManager{
+			repo:   tx,
+			dbe:    r.dbe,
+			opts:   r.opts, // права доступа те же, что у одиночных запросов
+			Schema: r.schema(),
+		}
+
+		for i, op := range ops {
+			res := dto.BatchResult{Index: i, Op: op.Op, Table: op.Table}
+			id, err := txService.execBatchOperation(ctx, op, results)
+			if err != nil {
+				res.Error = err.Error()
+				results = append(results, res)
+				return ErrBatchOperation{Index: i, Err: err}
+			}
+			res.ID = id
+			results = append(results, res)
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Info("batch rolled back", "err", err)
+		return results, err
+	}
+	return results, nil
+}
+
+func (r *RecordManager) execBatchOperation(ctx context.Context, op dto.BatchOperation, done []dto.BatchResult) (int, error) {
+	data := make(map[string]string, len(op.Data))
+	for k, v := range op.Data {
+		resolved, err := resolveBatchRef(v, done)
+		if err != nil {
+			return 0, err
+		}
+		data[k] = resolved
+	}
+
+	switch op.Op {
+	case dto.BatchCreate:
+		return r.Create(ctx, op.Table, data)
+	case dto.BatchUpdate, dto.BatchDelete:
+	default:
+		return 0, ErrUnknownOperation{op.Op}
+	}
+
+	idStr, err := resolveBatchRef(op.ID, done)
+	if err != nil {
+		return 0, err
+	}
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return 0, ErrInvalidId{op.ID}
+	}
+
+	if op.Op == dto.BatchUpdate {
+		return id, r.UpdateById(ctx, op.Table, id, data, "")
+	}
+	return id, r.DeleteById(ctx, op.Table, id, "")
+}
+
+// Ссылаться можно только на уже выполненные операции
+func resolveBatchRef(value string, done []dto.BatchResult) (string, error) {
+	matches := batchRefPattern.FindStringSubmatch(value)
+	if matches == nil {
+		return value, nil
+	}
+	idx, err := strconv.Atoi(matches[1])
+	if err != nil || idx >= len(done) {
+		return "", ErrInvalidId{value}
+	}
+	return strconv.Itoa(done[idx].ID), nil
+}
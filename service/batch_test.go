@@ -0,0 +1,143 @@
+package service
+
+import (
+	"context"
+	"hw6coursera/dto"
+	"hw6coursera/repository"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestService_Batch(t *testing.T) {
+	testCases := []struct {
+		name            string
+		ops             []dto.BatchOperation
+		opts            Options
+		expectedResults []dto.BatchResult
+		expectedErr     error
+		mockBehaviour   func(mr *repository.MockRecordManager)
+	}{
+		{
+			name: "OK with reference",
+			ops: []dto.BatchOperation{
+				{Op: dto.BatchCreate, Table: "example_table_1", Data: map[string]string{"name": "parent"}},
+				{Op: dto.BatchUpdate, Table: "example_table_2", ID: "3", Data: map[string]string{"field": "$0.id"}},
+				{Op: dto.BatchDelete, Table: "example_table_1", ID: "$0.id"},
+			},
+			expectedResults: []dto.BatchResult{
+				{Index: 0, Op: dto.BatchCreate, Table: "example_table_1", ID: 10},
+				{Index: 1, Op: dto.BatchUpdate, Table: "example_table_2", ID: 3},
+				{Index: 2, Op: dto.BatchDelete, Table: "example_table_1", ID: 10},
+			},
+			expectedErr: nil,
+			mockBehaviour: func(mr *repository.MockRecordManager) {
+				mr.EXPECT().InTx(gomock.Any()).DoAndReturn(func(fn func(tx repository.RecordManager) error) error { return fn(mr) })
+				mr.EXPECT().Create(testingSchema["example_table_1"], map[string]interface{}{"name": "parent"}).Return(10, nil)
+				mr.EXPECT().UpdateById(testingSchema["example_table_2"], "primary_column", 3, map[string]interface{}{"field": "10"}).Return(nil)
+				mr.EXPECT().DeleteById(testingSchema["example_table_1"], "primary_key", 10).Return(nil)
+			},
+		},
+		{
+			name: "failed operation",
+			ops: []dto.BatchOperation{
+				{Op: dto.BatchCreate, Table: "example_table_1", Data: map[string]string{"name": "parent"}},
+				{Op: dto.BatchDelete, Table: "example_table_1", ID: "100500"},
+			},
+			expectedResults: []dto.BatchResult{
+				{Index: 0, Op: dto.BatchCreate, Table: "example_table_1", ID: 10},
+				{Index: 1, Op: dto.BatchDelete, Table: "example_table_1", Error: "record not found"},
+			},
+			expectedErr: ErrBatchOperation{Index: 1, Err: ErrRecordNotFound},
+			mockBehaviour: func(mr *repository.MockRecordManager) {
+				mr.EXPECT().InTx(gomock.Any()).DoAndReturn(func(fn func(tx repository.RecordManager) error) error { return fn(mr) })
+				mr.EXPECT().Create(testingSchema["example_table_1"], map[string]interface{}{"name": "parent"}).Return(10, nil)
+				mr.EXPECT().DeleteById(testingSchema["example_table_1"], "primary_key", 100500).Return(repository.ErrRowNotFound)
+			},
+		},
+		{
+			name: "forward reference",
+			ops: []dto.BatchOperation{
+				{Op: dto.BatchDelete, Table: "example_table_1", ID: "$1.id"},
+			},
+			expectedResults: []dto.BatchResult{
+				{Index: 0, Op: dto.BatchDelete, Table: "example_table_1", Error: "invalid id $1.id"},
+			},
+			expectedErr: ErrBatchOperation{Index: 0, Err: ErrInvalidId{"$1.id"}},
+			mockBehaviour: func(mr *repository.MockRecordManager) {
+				mr.EXPECT().InTx(gomock.Any()).DoAndReturn(func(fn func(tx repository.RecordManager) error) error { return fn(mr) })
+			},
+		},
+		{
+			name: "unknown operation",
+			ops: []dto.BatchOperation{
+				{Op: "truncate", Table: "example_table_1"},
+			},
+			expectedResults: []dto.BatchResult{
+				{Index: 0, Op: "truncate", Table: "example_table_1", Error: "unknown operation truncate"},
+			},
+			expectedErr: ErrBatchOperation{Index: 0, Err: ErrUnknownOperation{"truncate"}},
+			mockBehaviour: func(mr *repository.MockRecordManager) {
+				mr.EXPECT().InTx(gomock.Any()).DoAndReturn(func(fn func(tx repository.RecordManager) error) error { return fn(mr) })
+			},
+		},
+		{
+			name: "duplicate key",
+			ops: []dto.BatchOperation{
+				{Op: dto.BatchUpdate, Table: "example_table_2", ID: "3", Data: map[string]string{"field": "taken"}},
+			},
+			expectedResults: []dto.BatchResult{
+				{Index: 0, Op: dto.BatchUpdate, Table: "example_table_2", Error: "another record has the same unique value"},
+			},
+			expectedErr: ErrBatchOperation{Index: 0, Err: ErrConflict},
+			mockBehaviour: func(mr *repository.MockRecordManager) {
+				mr.EXPECT().InTx(gomock.Any()).DoAndReturn(func(fn func(tx repository.RecordManager) error) error { return fn(mr) })
+				mr.EXPECT().UpdateById(testingSchema["example_table_2"], "primary_column", 3, map[string]interface{}{"field": "taken"}).Return(repository.ErrDuplicateKey)
+			},
+		},
+		{
+			name: "too many operations",
+			ops: []dto.BatchOperation{
+				{Op: dto.BatchDelete, Table: "example_table_1", ID: "1"},
+				{Op: dto.BatchDelete, Table: "example_table_1", ID: "2"},
+			},
+			opts:            Options{BatchMaxOperations: 1},
+			expectedResults: nil,
+			expectedErr:     ErrBatchTooLarge{Limit: 1},
+			mockBehaviour:   func(mr *repository.MockRecordManager) {},
+		},
+		{
+			name:            "empty batch",
+			ops:             []dto.BatchOperation{},
+			expectedResults: nil,
+			expectedErr:     ErrEmptyBatch,
+			mockBehaviour:   func(mr *repository.MockRecordManager) {},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := gomock.NewController(t)
+			defer c.Finish()
+
+			mockRepo := repository.NewMockRecordManager(c)
+			recordManager := &RecordManager{
+				repo:   mockRepo,
+				dbe:    nil,
+				opts:   tc.opts,
+				Schema: testingSchema,
+			}
+
+			tc.mockBehaviour(mockRepo)
+			service := Service{
+				RecordService: recordManager,
+			}
+
+			results, err := service.Batch(context.Background(), tc.ops)
+
+			assert.Equal(t, tc.expectedResults, results)
+			assert.Equal(t, tc.expectedErr, err)
+		})
+	}
+}
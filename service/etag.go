@@ -0,0 +1,49 @@
+package service
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hw6coursera/dto"
+	"strings"
+)
+
+// computeETag считает ETag по колонке версии, если она задана в настройках, иначе по всей записи.
+// json.Marshal сортирует ключи, так что одинаковые записи дают одинаковый ETag
+func computeETag(tableStruct dto.Table, record map[string]interface{}) (string, error) {
+	var src []byte
+	if tableStruct.VersionColumn != "" {
+		src = []byte(fmt.Sprint(record[tableStruct.VersionColumn]))
+	} else {
+		var err error
+		if src, err = json.Marshal(record); err != nil {
+			return "", err
+		}
+	}
+	sum := sha1.Sum(src)
+	return `"` + hex.EncodeToString(sum[:]) + `"`, nil
+}
+
+// MatchStrong проверяет If-Match: список ETag через запятую или `*`. По RFC 7232 здесь
+// нужно строгое сравнение, слабый ETag (W/"...") не совпадает ни с одним
+func MatchStrong(header string, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchWeak проверяет If-None-Match: слабые ETag сравниваются как обычные
+func MatchWeak(header string, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
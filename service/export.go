@@ -0,0 +1,43 @@
+package service
+
+import (
+	"context"
+	"hw6coursera/dto"
+	"hw6coursera/logging"
+)
+
+// ExportRecords implements RecordService
+func (r *RecordManager) ExportRecords(ctx context.Context, tableName string, filter dto.Filter, opts ReadOptions, w RecordWriter) error {
+	logger := logging.FromContext(ctx).With("table", tableName)
+	logger.Debug("exporting records")
+
+	tableStruct, ok := r.schema()[tableName]
+	if !ok {
+		logger.Info("table not found")
+		return ErrTableNotFound
+	}
+
+	validFilter, err := r.listFilter(ctx, tableStruct, filter, opts)
+	if err != nil {
+		return err
+	}
+
+	if err := w.Columns(readableColumns(tableStruct)); err != nil {
+		return err
+	}
+	count := 0
+	err = r.reader(ctx).EachRecord(ctx, tableStruct, validFilter, func(record map[string]interface{}) error {
+		if !opts.KeepNulls {
+			removeNulls(record)
+		}
+		removeWriteOnly(tableStruct, record)
+		count++
+		return w.Write(record)
+	})
+	if err != nil {
+		logger.Warn("export stopped", "records", count, "err", err)
+		return err
+	}
+	logger.Info("exported records", "records", count)
+	return nil
+}
@@ -0,0 +1,179 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"hw6coursera/dto"
+	"hw6coursera/repository"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+// collectWriter копит выгрузку в памяти, failAfter > 0 - ошибка на записи с этим номером
+type collectWriter struct {
+	columns   []string
+	records   []map[string]interface{}
+	failAfter int
+}
+
+func (w *collectWriter) Columns(columns []string) error {
+	w.columns = columns
+	return nil
+}
+
+func (w *collectWriter) Write(record map[string]interface{}) error {
+	if w.failAfter > 0 && len(w.records) == w.failAfter {
+		return errWriteFailed
+	}
+	w.records = append(w.records, record)
+	return nil
+}
+
+var errWriteFailed = errors.New("connection reset")
+
+// eachRecord - поведение repository.EachRecord для мока: отдаёт rows, пока fn не вернёт ошибку
+func eachRecord(rows ...map[string]interface{}) func(ctx context.Context, table dto.Table, filter dto.Filter, fn func(map[string]interface{}) error) error {
+	return func(ctx context.Context, table dto.Table, filter dto.Filter, fn func(map[string]interface{}) error) error {
+		for _, row := range rows {
+			if err := fn(row); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func TestService_ExportRecords(t *testing.T) {
+	users := dto.Table{
+		Name: "users",
+		Columns: []dto.Column{
+			{Name: "id", ColumnType: dto.IntType, IsPrimaryKey: true},
+			{Name: "login", ColumnType: dto.StringType},
+			{Name: "password", ColumnType: dto.StringType, WriteOnly: true},
+			{Name: "info", ColumnType: dto.StringType, Nullable: true},
+			{Name: "deleted_at", ColumnType: dto.UnknownType, Nullable: true},
+		},
+		SoftDeleteColumn: "deleted_at",
+	}
+	schema := dto.Schema{"users": users, "notes": accessSchema()["notes"]}
+	notDeleted := dto.Condition{Column: "deleted_at", Operator: dto.OpEq, Value: nil}
+
+	testCases := []struct {
+		name            string
+		ctx             context.Context
+		table           string
+		filter          dto.Filter
+		opts            ReadOptions
+		failAfter       int
+		expectedErr     error
+		expectedColumns []string
+		expectedRecords []map[string]interface{}
+		mockBehaviour   func(mr *repository.MockRecordManager)
+	}{
+		{
+			name:            "ok",
+			table:           "users",
+			filter:          dto.Filter{{Column: "id", Operator: dto.OpGt, Value: "1"}},
+			expectedColumns: []string{"id", "login", "info", "deleted_at"},
+			expectedRecords: []map[string]interface{}{{"id": 2, "login": "a"}, {"id": 3, "login": "b", "info": "x"}},
+			mockBehaviour: func(mr *repository.MockRecordManager) {
+				filter := dto.Filter{{Column: "id", Operator: dto.OpGt, Value: 1}, notDeleted}
+				mr.EXPECT().EachRecord(gomock.Any(), users, filter, gomock.Any()).DoAndReturn(eachRecord(
+					map[string]interface{}{"id": 2, "login": "a", "password": "hash", "info": nil, "deleted_at": nil},
+					map[string]interface{}{"id": 3, "login": "b", "password": "hash", "info": "x", "deleted_at": nil},
+				))
+			},
+		},
+		{
+			name:            "with deleted",
+			table:           "users",
+			opts:            ReadOptions{WithDeleted: true},
+			expectedColumns: []string{"id", "login", "info", "deleted_at"},
+			mockBehaviour: func(mr *repository.MockRecordManager) {
+				mr.EXPECT().EachRecord(gomock.Any(), users, dto.Filter(nil), gomock.Any()).DoAndReturn(eachRecord())
+			},
+		},
+		{
+			name:            "keep nulls",
+			table:           "users",
+			opts:            ReadOptions{KeepNulls: true},
+			expectedColumns: []string{"id", "login", "info", "deleted_at"},
+			expectedRecords: []map[string]interface{}{{"id": 2, "login": "a", "info": nil, "deleted_at": nil}},
+			mockBehaviour: func(mr *repository.MockRecordManager) {
+				mr.EXPECT().EachRecord(gomock.Any(), users, dto.Filter{notDeleted}, gomock.Any()).DoAndReturn(eachRecord(
+					map[string]interface{}{"id": 2, "login": "a", "password": "hash", "info": nil, "deleted_at": nil},
+				))
+			},
+		},
+		{
+			name:            "row rule",
+			ctx:             as("7", "user"),
+			table:           "notes",
+			expectedColumns: []string{"id", "owner_id", "text"},
+			expectedRecords: []map[string]interface{}{{"id": 1, "owner_id": 7}},
+			mockBehaviour: func(mr *repository.MockRecordManager) {
+				filter := dto.Filter{{Column: "owner_id", Operator: dto.OpEq, Value: 7}}
+				mr.EXPECT().EachRecord(gomock.Any(), schema["notes"], filter, gomock.Any()).DoAndReturn(eachRecord(
+					map[string]interface{}{"id": 1, "owner_id": 7},
+				))
+			},
+		},
+		{
+			name:          "forbidden",
+			ctx:           as("7"),
+			table:         "notes",
+			expectedErr:   ErrForbidden,
+			mockBehaviour: func(mr *repository.MockRecordManager) {},
+		},
+		{
+			name:          "unknown table",
+			table:         "missing",
+			expectedErr:   ErrTableNotFound,
+			mockBehaviour: func(mr *repository.MockRecordManager) {},
+		},
+		{
+			name:          "invalid filter",
+			table:         "users",
+			filter:        dto.Filter{{Column: "password", Operator: dto.OpEq, Value: "secret"}},
+			expectedErr:   ErrUnknownColumn{"password"},
+			mockBehaviour: func(mr *repository.MockRecordManager) {},
+		},
+		{
+			name:            "writer error stops export",
+			table:           "users",
+			failAfter:       1,
+			expectedErr:     errWriteFailed,
+			expectedColumns: []string{"id", "login", "info", "deleted_at"},
+			expectedRecords: []map[string]interface{}{{"id": 2, "login": "a"}},
+			mockBehaviour: func(mr *repository.MockRecordManager) {
+				mr.EXPECT().EachRecord(gomock.Any(), users, dto.Filter{notDeleted}, gomock.Any()).DoAndReturn(eachRecord(
+					map[string]interface{}{"id": 2, "login": "a"},
+					map[string]interface{}{"id": 3, "login": "b"},
+				))
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := gomock.NewController(t)
+			defer c.Finish()
+			mockRepo := repository.NewMockRecordManager(c)
+			tc.mockBehaviour(mockRepo)
+
+			r := &RecordManager{repo: mockRepo, Schema: schema, opts: Options{Access: testAccess}}
+			ctx := tc.ctx
+			if ctx == nil {
+				ctx = as("1", "admin")
+			}
+			w := &collectWriter{failAfter: tc.failAfter}
+			err := r.ExportRecords(ctx, tc.table, tc.filter, tc.opts, w)
+
+			assert.Equal(t, tc.expectedErr, err)
+			assert.Equal(t, tc.expectedColumns, w.columns)
+			assert.Equal(t, tc.expectedRecords, w.records)
+		})
+	}
+}
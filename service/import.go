@@ -0,0 +1,178 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"hw6coursera/dto"
+	"hw6coursera/logging"
+	"hw6coursera/repository"
+	"io"
+	"sort"
+)
+
+const (
+	DefaultImportChunk = 500
+	MaxImportChunk     = 10000
+
+	// отчёт о загрузке держим в памяти, поэтому причины перечисляем только для первых строк
+	maxImportErrors = 1000
+)
+
+// importRow - проверенная строка файла, готовая к записи
+type importRow struct {
+	line int
+	unit map[string]interface{}
+}
+
+// ImportRecords implements RecordService
+func (r *RecordManager) ImportRecords(ctx context.Context, tableName string, src RecordReader, opts ImportOptions) (dto.ImportReport, error) {
+	logger := logging.FromContext(ctx).With("table", tableName)
+	logger.Debug("importing records")
+	report := dto.ImportReport{Errors: []dto.RejectedLine{}}
+
+	tableStruct, ok := r.schema()[tableName]
+	if !ok {
+		logger.Info("table not found")
+		return report, ErrTableNotFound
+	}
+
+	if tableStruct.ReadOnly {
+		logger.Info("table is read-only")
+		return report, ErrReadOnlyTable
+	}
+
+	scope, err := r.authorize(ctx, tableStruct, ActionCreate)
+	if err != nil {
+		logger.Info("access denied")
+		return report, err
+	}
+
+	chunkSize := opts.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = DefaultImportChunk
+	}
+	nullTokens := make(map[string]bool, len(opts.NullTokens))
+	for _, token := range opts.NullTokens {
+		nullTokens[token] = true
+	}
+
+	chunk := make([]importRow, 0, chunkSize)
+	for {
+		line, record, err := src.Read()
+		if err == io.EOF {
+			break
+		}
+		if errors.As(err, &ErrInvalidLine{}) {
+			rejectLine(&report, line, err)
+			continue
+		}
+		if err != nil {
+			logger.Warn("import stopped", "records", report.Inserted, "err", err)
+			return report, err
+		}
+
+		unit, err := r.importUnit(tableStruct, record, opts.Mapping, nullTokens, scope)
+		if err != nil {
+			rejectLine(&report, line, err)
+			continue
+		}
+		chunk = append(chunk, importRow{line: line, unit: unit})
+		if len(chunk) < chunkSize {
+			continue
+		}
+		if err := r.insertChunk(ctx, tableStruct, chunk, &report); err != nil {
+			logger.Warn("import stopped", "records", report.Inserted, "err", err)
+			return report, err
+		}
+		chunk = chunk[:0]
+	}
+
+	if err := r.insertChunk(ctx, tableStruct, chunk, &report); err != nil {
+		logger.Warn("import stopped", "records", report.Inserted, "err", err)
+		return report, err
+	}
+	// строки, отклонённые базой, попадают в отчёт позже разобранных после них
+	sort.SliceStable(report.Errors, func(i, j int) bool { return report.Errors[i].Line < report.Errors[j].Line })
+	logger.Info("imported records", "records", report.Inserted, "rejected", report.Rejected)
+	return report, nil
+}
+
+// importUnit проверяет строку файла по тем же правилам, что и Create
+func (r *RecordManager) importUnit(t dto.Table, record map[string]string, mapping map[string]string, nullTokens map[string]bool, scope dto.Filter) (map[string]interface{}, error) {
+	data := make(map[string]string, len(record))
+	for header, value := range record {
+		column, ok := mapping[header]
+		if !ok {
+			column = header
+		}
+		if column == "" { // колонка файла пропускается
+			continue
+		}
+		if _, ok := getColumn(t, column); !ok {
+			return nil, ErrUnknownColumn{column}
+		}
+		if nullTokens[value] {
+			value = encodedNull
+		}
+		data[column] = value
+	}
+
+	data, err := scopeData(scope, data, true)
+	if err != nil {
+		return nil, err
+	}
+
+	unit, err := validateDataToCreate(data, t)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := transformData(t, r.opts.Transforms[t.Name], unit, true); err != nil {
+		return nil, err
+	}
+	return unit, nil
+}
+
+// insertChunk пишет строки одной транзакцией. Если база отклонила строку из-за её данных, транзакция
+// откатывается, строка попадает в отчёт, а остальные строки пишутся заново. Прочие ошибки
+// (соединение, взаимная блокировка, отмена запроса) останавливают загрузку
+func (r *RecordManager) insertChunk(ctx context.Context, t dto.Table, rows []importRow, report *dto.ImportReport) error {
+	for len(rows) > 0 {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		failed, failedErr := -1, error(nil)
+		err := r.writer(ctx).InTx(func(tx repository.RecordManager) error {
+			for i, row := range rows {
+				if _, err := tx.Create(t, row.unit); err != nil {
+					failed, failedErr = i, err
+					return err
+				}
+			}
+			return nil
+		})
+		if err == nil {
+			report.Inserted += len(rows)
+			return nil
+		}
+		if failed == -1 { // не удалось начать или зафиксировать транзакцию
+			return err
+		}
+		rejected := rejectedRecord(failedErr)
+		if rejected == nil {
+			return failedErr
+		}
+		logging.FromContext(ctx).Info("line rejected by database", "line", rows[failed].line, "err", failedErr)
+		rejectLine(report, rows[failed].line, rejected)
+		rows = append(rows[:failed], rows[failed+1:]...)
+	}
+	return nil
+}
+
+func rejectLine(report *dto.ImportReport, line int, err error) {
+	report.Rejected++
+	if len(report.Errors) < maxImportErrors {
+		report.Errors = append(report.Errors, dto.RejectedLine{Line: line, Error: err.Error()})
+	}
+}
@@ -0,0 +1,188 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"hw6coursera/dto"
+	"hw6coursera/repository"
+	"io"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+// importLine - то, что отдаёт sliceReader на очередной Read
+type importLine struct {
+	record map[string]string
+	err    error
+}
+
+// sliceReader отдаёт строки по порядку, номера строк с 2: первая - заголовок
+type sliceReader struct {
+	lines []importLine
+	next  int
+}
+
+func (s *sliceReader) Read() (int, map[string]string, error) {
+	if s.next == len(s.lines) {
+		return 0, nil, io.EOF
+	}
+	l := s.lines[s.next]
+	s.next++
+	return s.next + 1, l.record, l.err
+}
+
+var errConnection = errors.New("driver: bad connection")
+
+func TestService_ImportRecords(t *testing.T) {
+	items := dto.Table{
+		Name: "items",
+		Columns: []dto.Column{
+			{Name: "id", ColumnType: dto.IntType, IsPrimaryKey: true},
+			{Name: "title", ColumnType: dto.StringType},
+			{Name: "rating", ColumnType: dto.FloatType, Nullable: true},
+		},
+	}
+	schema := dto.Schema{"items": items, "notes": accessSchema()["notes"], "logs": {Name: "logs", ReadOnly: true}}
+	inTx := func(mr *repository.MockRecordManager) *gomock.Call {
+		return mr.EXPECT().InTx(gomock.Any()).DoAndReturn(func(fn func(tx repository.RecordManager) error) error { return fn(mr) })
+	}
+
+	testCases := []struct {
+		name           string
+		ctx            context.Context
+		table          string
+		lines          []importLine
+		opts           ImportOptions
+		expectedReport dto.ImportReport
+		expectedErr    error
+		mockBehaviour  func(mr *repository.MockRecordManager)
+	}{
+		{
+			name:  "mapping, nulls and rejected lines",
+			table: "items",
+			lines: []importLine{
+				{record: map[string]string{"Name": "a", "rating": "1.5", "note": "x"}},
+				{record: map[string]string{"Name": "b", "rating": "NULL", "note": "y"}},
+				{err: ErrInvalidLine{errors.New("wrong number of fields")}},
+				{record: map[string]string{"Name": "c", "rating": "high", "note": "z"}},
+				{record: map[string]string{"Name": "a", "rating": "", "note": "w"}},
+				{record: map[string]string{"Name": "d", "rating": "2", "note": "v"}},
+			},
+			opts: ImportOptions{Mapping: map[string]string{"Name": "title", "note": ""}, NullTokens: []string{"", "NULL"}, ChunkSize: 2},
+			expectedReport: dto.ImportReport{Inserted: 3, Rejected: 3, Errors: []dto.RejectedLine{
+				{Line: 4, Error: "invalid line: wrong number of fields"},
+				{Line: 5, Error: "invalid type rating"},
+				{Line: 6, Error: "another record has the same unique value"},
+			}},
+			mockBehaviour: func(mr *repository.MockRecordManager) {
+				gomock.InOrder(
+					inTx(mr),
+					mr.EXPECT().Create(items, map[string]interface{}{"title": "a", "rating": 1.5}).Return(1, nil),
+					mr.EXPECT().Create(items, map[string]interface{}{"title": "b", "rating": nil}).Return(2, nil),
+					// база отклонила строку 6: порция откатывается и пишется без неё
+					inTx(mr),
+					mr.EXPECT().Create(items, map[string]interface{}{"title": "a", "rating": nil}).Return(0, repository.ErrDuplicateKey),
+					inTx(mr),
+					mr.EXPECT().Create(items, map[string]interface{}{"title": "d", "rating": 2.0}).Return(3, nil),
+				)
+			},
+		},
+		{
+			// строку отклоняют только ошибки из-за её данных, потеря соединения останавливает загрузку
+			name:  "database error stops import",
+			table: "items",
+			lines: []importLine{
+				{record: map[string]string{"title": "a"}},
+				{record: map[string]string{"title": "b"}},
+			},
+			expectedReport: dto.ImportReport{Errors: []dto.RejectedLine{}},
+			expectedErr:    errConnection,
+			mockBehaviour: func(mr *repository.MockRecordManager) {
+				gomock.InOrder(
+					inTx(mr),
+					mr.EXPECT().Create(items, map[string]interface{}{"title": "a"}).Return(1, nil),
+					mr.EXPECT().Create(items, map[string]interface{}{"title": "b"}).Return(0, errConnection),
+				)
+			},
+		},
+		{
+			name:  "unknown column",
+			table: "items",
+			lines: []importLine{{record: map[string]string{"title": "a", "color": "red"}}},
+			expectedReport: dto.ImportReport{Rejected: 1, Errors: []dto.RejectedLine{
+				{Line: 2, Error: "unknown column color"},
+			}},
+			mockBehaviour: func(mr *repository.MockRecordManager) {},
+		},
+		{
+			name:  "row rule fills owner",
+			ctx:   as("7", "user"),
+			table: "notes",
+			lines: []importLine{
+				{record: map[string]string{"text": "mine"}},
+				{record: map[string]string{"text": "theirs", "owner_id": "8"}},
+			},
+			expectedReport: dto.ImportReport{Inserted: 1, Rejected: 1, Errors: []dto.RejectedLine{
+				{Line: 3, Error: "forbidden"},
+			}},
+			mockBehaviour: func(mr *repository.MockRecordManager) {
+				inTx(mr)
+				mr.EXPECT().Create(schema["notes"], map[string]interface{}{"owner_id": 7, "text": "mine"}).Return(1, nil)
+			},
+		},
+		{
+			name:  "read error stops import",
+			table: "items",
+			lines: []importLine{
+				{record: map[string]string{"title": "a"}},
+				{err: io.ErrUnexpectedEOF},
+			},
+			expectedReport: dto.ImportReport{Errors: []dto.RejectedLine{}},
+			expectedErr:    io.ErrUnexpectedEOF,
+			mockBehaviour:  func(mr *repository.MockRecordManager) {},
+		},
+		{
+			name:           "forbidden",
+			ctx:            as("7"),
+			table:          "notes",
+			expectedReport: dto.ImportReport{Errors: []dto.RejectedLine{}},
+			expectedErr:    ErrForbidden,
+			mockBehaviour:  func(mr *repository.MockRecordManager) {},
+		},
+		{
+			name:           "read-only table",
+			table:          "logs",
+			expectedReport: dto.ImportReport{Errors: []dto.RejectedLine{}},
+			expectedErr:    ErrReadOnlyTable,
+			mockBehaviour:  func(mr *repository.MockRecordManager) {},
+		},
+		{
+			name:           "unknown table",
+			table:          "missing",
+			expectedReport: dto.ImportReport{Errors: []dto.RejectedLine{}},
+			expectedErr:    ErrTableNotFound,
+			mockBehaviour:  func(mr *repository.MockRecordManager) {},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := gomock.NewController(t)
+			defer c.Finish()
+			mockRepo := repository.NewMockRecordManager(c)
+			tc.mockBehaviour(mockRepo)
+
+			r := &RecordManager{repo: mockRepo, Schema: schema, opts: Options{Access: testAccess}}
+			ctx := tc.ctx
+			if ctx == nil {
+				ctx = as("1", "admin")
+			}
+			report, err := r.ImportRecords(ctx, tc.table, &sliceReader{lines: tc.lines}, tc.opts)
+
+			assert.Equal(t, tc.expectedErr, err)
+			assert.Equal(t, tc.expectedReport, report)
+		})
+	}
+}
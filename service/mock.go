@@ -5,6 +5,8 @@
 package service
 
 import (
+	context "context"
+	dto "hw6coursera/dto"
 	reflect "reflect"
 
 	gomock "github.com/golang/mock/gomock"
@@ -33,78 +35,197 @@ func (m *MockRecordService) EXPECT() *MockRecordServiceMockRecorder {
 	return m.recorder
 }
 
+// Batch mocks base method.
+func (m *MockRecordService) Batch(ctx context.Context, ops []dto.BatchOperation) ([]dto.BatchResult, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Batch", ctx, ops)
+	ret0, _ := ret[0].([]dto.BatchResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Batch indicates an expected call of Batch.
+func (mr *MockRecordServiceMockRecorder) Batch(ctx, ops interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Batch", reflect.TypeOf((*MockRecordService)(nil).Batch), ctx, ops)
+}
+
 // Create mocks base method.
-func (m *MockRecordService) Create(tableName string, data map[string]string) (int, error) {
+func (m *MockRecordService) Create(ctx context.Context, tableName string, data map[string]string) (int, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Create", tableName, data)
+	ret := m.ctrl.Call(m, "Create", ctx, tableName, data)
 	ret0, _ := ret[0].(int)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // Create indicates an expected call of Create.
-func (mr *MockRecordServiceMockRecorder) Create(tableName, data interface{}) *gomock.Call {
+func (mr *MockRecordServiceMockRecorder) Create(ctx, tableName, data interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Create", reflect.TypeOf((*MockRecordService)(nil).Create), ctx, tableName, data)
+}
+
+// DeleteByFilter mocks base method.
+func (m *MockRecordService) DeleteByFilter(ctx context.Context, tableName string, filter dto.Filter, opts BulkOptions) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteByFilter", ctx, tableName, filter, opts)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteByFilter indicates an expected call of DeleteByFilter.
+func (mr *MockRecordServiceMockRecorder) DeleteByFilter(ctx, tableName, filter, opts interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Create", reflect.TypeOf((*MockRecordService)(nil).Create), tableName, data)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteByFilter", reflect.TypeOf((*MockRecordService)(nil).DeleteByFilter), ctx, tableName, filter, opts)
 }
 
 // DeleteById mocks base method.
-func (m *MockRecordService) DeleteById(tableName string, id int) error {
+func (m *MockRecordService) DeleteById(ctx context.Context, tableName string, id int, ifMatch string) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "DeleteById", tableName, id)
+	ret := m.ctrl.Call(m, "DeleteById", ctx, tableName, id, ifMatch)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // DeleteById indicates an expected call of DeleteById.
-func (mr *MockRecordServiceMockRecorder) DeleteById(tableName, id interface{}) *gomock.Call {
+func (mr *MockRecordServiceMockRecorder) DeleteById(ctx, tableName, id, ifMatch interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteById", reflect.TypeOf((*MockRecordService)(nil).DeleteById), tableName, id)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteById", reflect.TypeOf((*MockRecordService)(nil).DeleteById), ctx, tableName, id, ifMatch)
+}
+
+// DescribeSchema mocks base method.
+func (m *MockRecordService) DescribeSchema(ctx context.Context) (dto.Schema, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DescribeSchema", ctx)
+	ret0, _ := ret[0].(dto.Schema)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DescribeSchema indicates an expected call of DescribeSchema.
+func (mr *MockRecordServiceMockRecorder) DescribeSchema(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DescribeSchema", reflect.TypeOf((*MockRecordService)(nil).DescribeSchema), ctx)
+}
+
+// ExportRecords mocks base method.
+func (m *MockRecordService) ExportRecords(ctx context.Context, tableName string, filter dto.Filter, opts ReadOptions, w RecordWriter) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ExportRecords", ctx, tableName, filter, opts, w)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ExportRecords indicates an expected call of ExportRecords.
+func (mr *MockRecordServiceMockRecorder) ExportRecords(ctx, tableName, filter, opts, w interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExportRecords", reflect.TypeOf((*MockRecordService)(nil).ExportRecords), ctx, tableName, filter, opts, w)
 }
 
 // GetAllRecords mocks base method.
-func (m *MockRecordService) GetAllRecords(tableName string, limit, offset int) ([]byte, error) {
+func (m *MockRecordService) GetAllRecords(ctx context.Context, tableName string, filter dto.Filter, limit, offset int, opts ReadOptions) (dto.Records, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetAllRecords", tableName, limit, offset)
-	ret0, _ := ret[0].([]byte)
+	ret := m.ctrl.Call(m, "GetAllRecords", ctx, tableName, filter, limit, offset, opts)
+	ret0, _ := ret[0].(dto.Records)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetAllRecords indicates an expected call of GetAllRecords.
-func (mr *MockRecordServiceMockRecorder) GetAllRecords(tableName, limit, offset interface{}) *gomock.Call {
+func (mr *MockRecordServiceMockRecorder) GetAllRecords(ctx, tableName, filter, limit, offset, opts interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAllRecords", reflect.TypeOf((*MockRecordService)(nil).GetAllRecords), tableName, limit, offset)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAllRecords", reflect.TypeOf((*MockRecordService)(nil).GetAllRecords), ctx, tableName, filter, limit, offset, opts)
 }
 
 // GetAllTables mocks base method.
-func (m *MockRecordService) GetAllTables() ([]byte, error) {
+func (m *MockRecordService) GetAllTables(ctx context.Context) ([]string, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetAllTables")
-	ret0, _ := ret[0].([]byte)
+	ret := m.ctrl.Call(m, "GetAllTables", ctx)
+	ret0, _ := ret[0].([]string)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetAllTables indicates an expected call of GetAllTables.
-func (mr *MockRecordServiceMockRecorder) GetAllTables() *gomock.Call {
+func (mr *MockRecordServiceMockRecorder) GetAllTables(ctx interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAllTables", reflect.TypeOf((*MockRecordService)(nil).GetAllTables))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAllTables", reflect.TypeOf((*MockRecordService)(nil).GetAllTables), ctx)
 }
 
 // GetById mocks base method.
-func (m *MockRecordService) GetById(tableName string, id int) ([]byte, error) {
+func (m *MockRecordService) GetById(ctx context.Context, tableName string, id int, opts ReadOptions) (dto.OrderedRecord, string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetById", ctx, tableName, id, opts)
+	ret0, _ := ret[0].(dto.OrderedRecord)
+	ret1, _ := ret[1].(string)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// GetById indicates an expected call of GetById.
+func (mr *MockRecordServiceMockRecorder) GetById(ctx, tableName, id, opts interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetById", reflect.TypeOf((*MockRecordService)(nil).GetById), ctx, tableName, id, opts)
+}
+
+// GetSchema mocks base method.
+func (m *MockRecordService) GetSchema(ctx context.Context) (dto.Schema, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetById", tableName, id)
-	ret0, _ := ret[0].([]byte)
+	ret := m.ctrl.Call(m, "GetSchema", ctx)
+	ret0, _ := ret[0].(dto.Schema)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-// GetById indicates an expected call of GetById.
-func (mr *MockRecordServiceMockRecorder) GetById(tableName, id interface{}) *gomock.Call {
+// GetSchema indicates an expected call of GetSchema.
+func (mr *MockRecordServiceMockRecorder) GetSchema(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSchema", reflect.TypeOf((*MockRecordService)(nil).GetSchema), ctx)
+}
+
+// HasTable mocks base method.
+func (m *MockRecordService) HasTable(tableName string) bool {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "HasTable", tableName)
+	ret0, _ := ret[0].(bool)
+	return ret0
+}
+
+// HasTable indicates an expected call of HasTable.
+func (mr *MockRecordServiceMockRecorder) HasTable(tableName interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "HasTable", reflect.TypeOf((*MockRecordService)(nil).HasTable), tableName)
+}
+
+// History mocks base method.
+func (m *MockRecordService) History(ctx context.Context, tableName string, id int) ([]dto.AuditEntry, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "History", ctx, tableName, id)
+	ret0, _ := ret[0].([]dto.AuditEntry)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// History indicates an expected call of History.
+func (mr *MockRecordServiceMockRecorder) History(ctx, tableName, id interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetById", reflect.TypeOf((*MockRecordService)(nil).GetById), tableName, id)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "History", reflect.TypeOf((*MockRecordService)(nil).History), ctx, tableName, id)
+}
+
+// ImportRecords mocks base method.
+func (m *MockRecordService) ImportRecords(ctx context.Context, tableName string, src RecordReader, opts ImportOptions) (dto.ImportReport, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ImportRecords", ctx, tableName, src, opts)
+	ret0, _ := ret[0].(dto.ImportReport)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ImportRecords indicates an expected call of ImportRecords.
+func (mr *MockRecordServiceMockRecorder) ImportRecords(ctx, tableName, src, opts interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ImportRecords", reflect.TypeOf((*MockRecordService)(nil).ImportRecords), ctx, tableName, src, opts)
 }
 
 // InitSchema mocks base method.
@@ -121,16 +242,151 @@ func (mr *MockRecordServiceMockRecorder) InitSchema() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InitSchema", reflect.TypeOf((*MockRecordService)(nil).InitSchema))
 }
 
+// RestoreById mocks base method.
+func (m *MockRecordService) RestoreById(ctx context.Context, tableName string, id int) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RestoreById", ctx, tableName, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RestoreById indicates an expected call of RestoreById.
+func (mr *MockRecordServiceMockRecorder) RestoreById(ctx, tableName, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RestoreById", reflect.TypeOf((*MockRecordService)(nil).RestoreById), ctx, tableName, id)
+}
+
+// UpdateByFilter mocks base method.
+func (m *MockRecordService) UpdateByFilter(ctx context.Context, tableName string, filter dto.Filter, data map[string]string, opts BulkOptions) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateByFilter", ctx, tableName, filter, data, opts)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UpdateByFilter indicates an expected call of UpdateByFilter.
+func (mr *MockRecordServiceMockRecorder) UpdateByFilter(ctx, tableName, filter, data, opts interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateByFilter", reflect.TypeOf((*MockRecordService)(nil).UpdateByFilter), ctx, tableName, filter, data, opts)
+}
+
 // UpdateById mocks base method.
-func (m *MockRecordService) UpdateById(tableName string, id int, data map[string]string) error {
+func (m *MockRecordService) UpdateById(ctx context.Context, tableName string, id int, data map[string]string, ifMatch string) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "UpdateById", tableName, id, data)
+	ret := m.ctrl.Call(m, "UpdateById", ctx, tableName, id, data, ifMatch)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // UpdateById indicates an expected call of UpdateById.
-func (mr *MockRecordServiceMockRecorder) UpdateById(tableName, id, data interface{}) *gomock.Call {
+func (mr *MockRecordServiceMockRecorder) UpdateById(ctx, tableName, id, data, ifMatch interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateById", reflect.TypeOf((*MockRecordService)(nil).UpdateById), ctx, tableName, id, data, ifMatch)
+}
+
+// Upsert mocks base method.
+func (m *MockRecordService) Upsert(ctx context.Context, tableName, keyName string, data map[string]string) (int, bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Upsert", ctx, tableName, keyName, data)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(bool)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// Upsert indicates an expected call of Upsert.
+func (mr *MockRecordServiceMockRecorder) Upsert(ctx, tableName, keyName, data interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Upsert", reflect.TypeOf((*MockRecordService)(nil).Upsert), ctx, tableName, keyName, data)
+}
+
+// MockRecordWriter is a mock of RecordWriter interface.
+type MockRecordWriter struct {
+	ctrl     *gomock.Controller
+	recorder *MockRecordWriterMockRecorder
+}
+
+// MockRecordWriterMockRecorder is the mock recorder for MockRecordWriter.
+type MockRecordWriterMockRecorder struct {
+	mock *MockRecordWriter
+}
+
+// NewMockRecordWriter creates a new mock instance.
+func NewMockRecordWriter(ctrl *gomock.Controller) *MockRecordWriter {
+	mock := &MockRecordWriter{ctrl: ctrl}
+	mock.recorder = &MockRecordWriterMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockRecordWriter) EXPECT() *MockRecordWriterMockRecorder {
+	return m.recorder
+}
+
+// Columns mocks base method.
+func (m *MockRecordWriter) Columns(columns []string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Columns", columns)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Columns indicates an expected call of Columns.
+func (mr *MockRecordWriterMockRecorder) Columns(columns interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Columns", reflect.TypeOf((*MockRecordWriter)(nil).Columns), columns)
+}
+
+// Write mocks base method.
+func (m *MockRecordWriter) Write(record map[string]interface{}) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Write", record)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Write indicates an expected call of Write.
+func (mr *MockRecordWriterMockRecorder) Write(record interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Write", reflect.TypeOf((*MockRecordWriter)(nil).Write), record)
+}
+
+// MockRecordReader is a mock of RecordReader interface.
+type MockRecordReader struct {
+	ctrl     *gomock.Controller
+	recorder *MockRecordReaderMockRecorder
+}
+
+// MockRecordReaderMockRecorder is the mock recorder for MockRecordReader.
+type MockRecordReaderMockRecorder struct {
+	mock *MockRecordReader
+}
+
+// NewMockRecordReader creates a new mock instance.
+func NewMockRecordReader(ctrl *gomock.Controller) *MockRecordReader {
+	mock := &MockRecordReader{ctrl: ctrl}
+	mock.recorder = &MockRecordReaderMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockRecordReader) EXPECT() *MockRecordReaderMockRecorder {
+	return m.recorder
+}
+
+// Read mocks base method.
+func (m *MockRecordReader) Read() (int, map[string]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Read")
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(map[string]string)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// Read indicates an expected call of Read.
+func (mr *MockRecordReaderMockRecorder) Read() *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateById", reflect.TypeOf((*MockRecordService)(nil).UpdateById), tableName, id, data)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Read", reflect.TypeOf((*MockRecordReader)(nil).Read))
 }
@@ -0,0 +1,170 @@
+package service
+
+import (
+	"fmt"
+	"hw6coursera/dto"
+)
+
+// ColumnAccess - ограничение доступа к колонке через API
+type ColumnAccess string
+
+const (
+	ColumnHidden    ColumnAccess = "hidden"     // колонки как будто нет
+	ColumnReadOnly  ColumnAccess = "read_only"  // отдаётся, но не записывается
+	ColumnWriteOnly ColumnAccess = "write_only" // записывается, но не отдаётся (например, password)
+)
+
+// так значения write-only колонок выглядят в журнале изменений
+const redactedValue = "***"
+
+// applyPolicy оставляет в схеме только то, что доступно через API, и помечает
+// read-only и write-only таблицы и колонки
+func applyPolicy(s dto.Schema, opts Options) (dto.Schema, error) {
+	if len(opts.Tables) > 0 {
+		exposed := make(dto.Schema, len(opts.Tables))
+		for _, name := range opts.Tables {
+			t, ok := s[name]
+			if !ok {
+				return nil, fmt.Errorf("table %s from config not found in database", name)
+			}
+			exposed[name] = t
+		}
+		s = exposed
+	}
+
+	for _, name := range opts.HiddenTables {
+		delete(s, name) // скрывать можно и то, чего нет: список может быть общим для нескольких баз
+	}
+
+	for _, name := range opts.ReadOnlyTables {
+		t, ok := s[name]
+		if !ok {
+			return nil, fmt.Errorf("read-only table %s not found in schema", name)
+		}
+		t.ReadOnly = true
+		s[name] = t
+	}
+
+	for tableName := range opts.SoftDeleteColumns {
+		if _, ok := s[tableName]; !ok {
+			return nil, fmt.Errorf("table %s from soft delete columns not found in schema", tableName)
+		}
+	}
+	for name, t := range s {
+		column, configured := opts.SoftDeleteColumns[name]
+		if !configured && opts.DetectSoftDelete {
+			column = detectColumn(t.Columns, softDeleteColumnNames)
+		}
+		if column == "" {
+			continue
+		}
+		c, ok := getColumn(t, column)
+		if !ok {
+			return nil, fmt.Errorf("soft delete column %s.%s not found", name, column)
+		}
+		if !canMarkDeleted(c) {
+			return nil, fmt.Errorf("soft delete column %s.%s must be an integer or boolean flag or nullable", name, column)
+		}
+		t.SoftDeleteColumn = column
+		s[name] = t
+	}
+
+	// до политики колонок: колонку версии нельзя скрыть
+	for tableName, column := range opts.VersionColumns {
+		t, ok := s[tableName]
+		if !ok {
+			return nil, fmt.Errorf("table %s from version columns not found in schema", tableName)
+		}
+		if _, ok := getColumn(t, column); !ok {
+			return nil, fmt.Errorf("version column %s.%s not found", tableName, column)
+		}
+		t.VersionColumn = column
+		s[tableName] = t
+	}
+
+	for tableName, columns := range opts.Columns {
+		t, ok := s[tableName]
+		if !ok {
+			return nil, fmt.Errorf("table %s from column policy not found in schema", tableName)
+		}
+		for columnName, access := range columns {
+			var err error
+			if t, err = applyColumnAccess(t, columnName, access); err != nil {
+				return nil, err
+			}
+		}
+		s[tableName] = t
+	}
+
+	if err := opts.Access.validate(s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func applyColumnAccess(t dto.Table, columnName string, access ColumnAccess) (dto.Table, error) {
+	idx := -1
+	for i, c := range t.Columns {
+		if c.Name == columnName {
+			idx = i
+			break
+		}
+	}
+	if idx == -1 {
+		return t, fmt.Errorf("column %s.%s from column policy not found", t.Name, columnName)
+	}
+
+	c := t.Columns[idx]
+	// без этих колонок не работают обращение по id, ETag и мягкое удаление
+	service := c.IsPrimaryKey || c.Name == t.VersionColumn || c.Name == t.SoftDeleteColumn
+
+	// колонки копируем: исходный срез может разделяться с другими копиями схемы
+	columns := append([]dto.Column(nil), t.Columns...)
+	switch access {
+	case ColumnHidden:
+		if service {
+			return t, fmt.Errorf("column %s.%s cannot be hidden", t.Name, columnName)
+		}
+		columns = append(columns[:idx], columns[idx+1:]...)
+	case ColumnReadOnly:
+		columns[idx].ReadOnly = true
+	case ColumnWriteOnly:
+		if service {
+			return t, fmt.Errorf("column %s.%s cannot be write-only", t.Name, columnName)
+		}
+		columns[idx].WriteOnly = true
+	default:
+		return t, fmt.Errorf("unknown access %q for column %s.%s", access, t.Name, columnName)
+	}
+	t.Columns = columns
+	return t, nil
+}
+
+// removeWriteOnly убирает из записи колонки, которые нельзя отдавать
+func removeWriteOnly(t dto.Table, record map[string]interface{}) {
+	for _, c := range t.Columns {
+		if c.WriteOnly {
+			delete(record, c.Name)
+		}
+	}
+}
+
+// readableColumns - колонки, которые отдаются клиенту, в порядке схемы
+func readableColumns(t dto.Table) []string {
+	columns := make([]string, 0, len(t.Columns))
+	for _, c := range t.Columns {
+		if !c.WriteOnly {
+			columns = append(columns, c.Name)
+		}
+	}
+	return columns
+}
+
+// redactChanges скрывает значения write-only колонок в записи журнала, сам факт изменения остаётся
+func redactChanges(t dto.Table, changes map[string]dto.Change) {
+	for _, c := range t.Columns {
+		if _, ok := changes[c.Name]; ok && c.WriteOnly {
+			changes[c.Name] = dto.Change{Old: redactedValue, New: redactedValue}
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package service
+
+import (
+	"context"
+	"hw6coursera/dto"
+	"hw6coursera/repository"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func policySchema() dto.Schema {
+	return dto.Schema{
+		"users": {
+			Name: "users",
+			Columns: []dto.Column{
+				{Name: "id", ColumnType: dto.IntType, IsPrimaryKey: true},
+				{Name: "login", ColumnType: dto.StringType},
+				{Name: "password", ColumnType: dto.StringType},
+				{Name: "note", ColumnType: dto.StringType, Nullable: true},
+				{Name: "created_at", ColumnType: dto.StringType},
+			},
+		},
+		"countries": {
+			Name: "countries",
+			Columns: []dto.Column{
+				{Name: "id", ColumnType: dto.IntType, IsPrimaryKey: true},
+				{Name: "name", ColumnType: dto.StringType},
+			},
+		},
+		"secrets": {
+			Name: "secrets",
+			Columns: []dto.Column{
+				{Name: "id", ColumnType: dto.IntType, IsPrimaryKey: true},
+			},
+		},
+	}
+}
+
+func Test_applyPolicy(t *testing.T) {
+	s, err := applyPolicy(policySchema(), Options{
+		HiddenTables:   []string{"secrets", "missing"},
+		ReadOnlyTables: []string{"countries"},
+		Columns: map[string]map[string]ColumnAccess{
+			"users": {
+				"password":   ColumnWriteOnly,
+				"note":       ColumnHidden,
+				"created_at": ColumnReadOnly,
+			},
+		},
+		VersionColumns: map[string]string{"users": "created_at"},
+	})
+	require.NoError(t, err)
+
+	assert.NotContains(t, s, "secrets")
+	assert.Equal(t, "created_at", s["users"].VersionColumn)
+	assert.Empty(t, s["countries"].VersionColumn) // без настройки ETag считается по всей записи
+	assert.True(t, s["countries"].ReadOnly)
+	assert.False(t, s["users"].ReadOnly)
+	assert.Equal(t, []dto.Column{
+		{Name: "id", ColumnType: dto.IntType, IsPrimaryKey: true},
+		{Name: "login", ColumnType: dto.StringType},
+		{Name: "password", ColumnType: dto.StringType, WriteOnly: true},
+		{Name: "created_at", ColumnType: dto.StringType, ReadOnly: true},
+	}, s["users"].Columns)
+}
+
+func Test_applyPolicySoftDelete(t *testing.T) {
+	schema := func() dto.Schema {
+		s := policySchema()
+		for _, name := range []string{"countries", "secrets"} {
+			table := s[name]
+			table.Columns = append(table.Columns, dto.Column{Name: "deleted_at", ColumnType: dto.StringType, Nullable: true})
+			s[name] = table
+		}
+		return s
+	}
+
+	// колонка из настроек важнее найденной по имени, пустая отключает мягкое удаление
+	s, err := applyPolicy(schema(), Options{
+		SoftDeleteColumns: map[string]string{"users": "note", "secrets": ""},
+		DetectSoftDelete:  true,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "note", s["users"].SoftDeleteColumn)
+	assert.Equal(t, "deleted_at", s["countries"].SoftDeleteColumn)
+	assert.Empty(t, s["secrets"].SoftDeleteColumn)
+
+	// найденная по имени колонка неподходящего типа - обычная колонка, а не метка
+	s = policySchema()
+	users := s["users"]
+	users.Columns = append(users.Columns, dto.Column{Name: "deleted_at", ColumnType: dto.StringType}, dto.Column{Name: "is_deleted", ColumnType: dto.BoolType})
+	s["users"] = users
+	countries := s["countries"]
+	countries.Columns = append(countries.Columns, dto.Column{Name: "deleted_at", ColumnType: dto.StringType})
+	s["countries"] = countries
+	s, err = applyPolicy(s, Options{DetectSoftDelete: true})
+	require.NoError(t, err)
+	assert.Equal(t, "is_deleted", s["users"].SoftDeleteColumn)
+	assert.Empty(t, s["countries"].SoftDeleteColumn)
+
+	// без поиска по имени - только явно указанные колонки
+	s, err = applyPolicy(schema(), Options{SoftDeleteColumns: map[string]string{"secrets": "deleted_at"}})
+	require.NoError(t, err)
+	assert.Empty(t, s["countries"].SoftDeleteColumn)
+	assert.Equal(t, "deleted_at", s["secrets"].SoftDeleteColumn)
+}
+
+func Test_applyPolicyErrors(t *testing.T) {
+	testCases := []struct {
+		name string
+		opts Options
+	}{
+		{name: "unknown exposed table", opts: Options{Tables: []string{"missing"}}},
+		{name: "unknown read-only table", opts: Options{ReadOnlyTables: []string{"missing"}}},
+		{name: "read-only hidden table", opts: Options{HiddenTables: []string{"secrets"}, ReadOnlyTables: []string{"secrets"}}},
+		{name: "unknown column", opts: Options{Columns: map[string]map[string]ColumnAccess{"users": {"missing": ColumnHidden}}}},
+		{name: "unknown access", opts: Options{Columns: map[string]map[string]ColumnAccess{"users": {"note": "secret"}}}},
+		{name: "hidden primary key", opts: Options{Columns: map[string]map[string]ColumnAccess{"users": {"id": ColumnHidden}}}},
+		{name: "write-only primary key", opts: Options{Columns: map[string]map[string]ColumnAccess{"users": {"id": ColumnWriteOnly}}}},
+		{name: "unknown version table", opts: Options{VersionColumns: map[string]string{"missing": "version"}}},
+		{name: "unknown version column", opts: Options{VersionColumns: map[string]string{"users": "version"}}},
+		{name: "unknown soft delete table", opts: Options{SoftDeleteColumns: map[string]string{"missing": "deleted_at"}}},
+		{name: "unknown soft delete column", opts: Options{SoftDeleteColumns: map[string]string{"users": "deleted_at"}}},
+		{name: "not nullable soft delete column", opts: Options{SoftDeleteColumns: map[string]string{"users": "login"}}},
+		{name: "hidden version column", opts: Options{VersionColumns: map[string]string{"users": "note"}, Columns: map[string]map[string]ColumnAccess{"users": {"note": ColumnHidden}}}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := applyPolicy(policySchema(), tc.opts)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestService_policy(t *testing.T) {
+	schema, err := applyPolicy(policySchema(), Options{
+		ReadOnlyTables: []string{"countries"},
+		Columns: map[string]map[string]ColumnAccess{
+			"users": {"password": ColumnWriteOnly, "created_at": ColumnReadOnly},
+		},
+	})
+	require.NoError(t, err)
+	users := schema["users"]
+
+	t.Run("write-only column is not returned", func(t *testing.T) {
+		c := gomock.NewController(t)
+		defer c.Finish()
+		mockRepo := repository.NewMockRecordManager(c)
+		mockRepo.EXPECT().GetById(users, "id", 1).Return(map[string]interface{}{
+			"id": 1, "login": "admin", "password": "secret", "created_at": "2024-01-01",
+		}, nil)
+
+		r := &RecordManager{repo: mockRepo, Schema: schema}
+		data, _, err := r.GetById(context.Background(), "users", 1, ReadOptions{})
+		require.NoError(t, err)
+		assert.NotContains(t, data.Columns, "password")
+		assert.NotContains(t, data.Values, "password")
+		assert.Equal(t, "admin", data.Values["login"])
+	})
+
+	t.Run("write-only column is accepted on create", func(t *testing.T) {
+		c := gomock.NewController(t)
+		defer c.Finish()
+		mockRepo := repository.NewMockRecordManager(c)
+		mockRepo.EXPECT().Create(users, map[string]interface{}{"login": "admin", "password": "secret"}).Return(1, nil)
+
+		r := &RecordManager{repo: mockRepo, Schema: schema}
+		id, err := r.Create(context.Background(), "users", map[string]string{"login": "admin", "password": "secret"})
+		require.NoError(t, err)
+		assert.Equal(t, 1, id)
+	})
+
+	t.Run("write-only column cannot be filtered", func(t *testing.T) {
+		r := &RecordManager{Schema: schema}
+		_, err := r.GetAllRecords(context.Background(), "users", dto.Filter{{Column: "password", Operator: dto.OpEq, Value: "secret"}}, 5, 0, ReadOptions{})
+		assert.Equal(t, ErrUnknownColumn{"password"}, err)
+	})
+
+	t.Run("read-only column", func(t *testing.T) {
+		r := &RecordManager{Schema: schema}
+		_, err := r.Create(context.Background(), "users", map[string]string{"login": "admin", "password": "secret", "created_at": "now"})
+		assert.Equal(t, ErrReadOnlyColumn{"created_at"}, err)
+
+		err = r.UpdateById(context.Background(), "users", 1, map[string]string{"created_at": "now"}, "")
+		assert.Equal(t, ErrReadOnlyColumn{"created_at"}, err)
+	})
+
+	t.Run("read-only table", func(t *testing.T) {
+		r := &RecordManager{Schema: schema}
+		_, err := r.Create(context.Background(), "countries", map[string]string{"name": "Norway"})
+		assert.Equal(t, ErrReadOnlyTable, err)
+
+		err = r.DeleteById(context.Background(), "countries", 1, "")
+		assert.Equal(t, ErrReadOnlyTable, err)
+
+		_, err = r.UpdateByFilter(context.Background(), "countries", nil, map[string]string{"name": "Norway"}, BulkOptions{Confirmed: true})
+		assert.Equal(t, ErrReadOnlyTable, err)
+	})
+
+	t.Run("write-only changes are redacted in history", func(t *testing.T) {
+		changes := map[string]dto.Change{
+			"login":    {Old: "admin", New: "root"},
+			"password": {Old: "secret", New: "qwerty"},
+		}
+		redactChanges(users, changes)
+		assert.Equal(t, map[string]dto.Change{
+			"login":    {Old: "admin", New: "root"},
+			"password": {Old: redactedValue, New: redactedValue},
+		}, changes)
+	})
+}
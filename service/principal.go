@@ -0,0 +1,19 @@
+package service
+
+import (
+	"context"
+	"hw6coursera/dto"
+)
+
+type principalKey struct{}
+
+// WithPrincipal запоминает в контексте, от чьего имени выполняется запрос
+func WithPrincipal(ctx context.Context, p dto.Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFromContext - клиент запроса; ok == false, если запрос анонимный
+func PrincipalFromContext(ctx context.Context) (p dto.Principal, ok bool) {
+	p, ok = ctx.Value(principalKey{}).(dto.Principal)
+	return p, ok && p.ID != ""
+}
@@ -1,14 +1,16 @@
 package service
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
 	"hw6coursera/dbexplorer"
 	"hw6coursera/dto"
+	"hw6coursera/logging"
 	"hw6coursera/repository"
-	"log"
 	"sort"
 	"strconv"
+	"sync"
 )
 
 const (
@@ -19,196 +21,760 @@ const (
 )
 
 type RecordManager struct {
-	repo   repository.RecordManager
-	dbe    dbexplorer.SchemeParser
+	repo     repository.RecordManager
+	audit    repository.AuditLog
+	dbe      dbexplorer.SchemeParser
+	explorer repository.Explorer // статистика таблиц для описания схемы
+	opts     Options
+
+	mu     sync.RWMutex // схема перечитывается на работающем сервере, см. InitSchema
 	Schema dto.Schema
 }
 
+// schema - текущая схема. Схема целиком заменяется при перечитывании и не меняется на месте,
+// поэтому запрос берёт её один раз и работает с одной и той же версией
+func (r *RecordManager) schema() dto.Schema {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.Schema
+}
+
 // GetAllTables implements RecordService
-func (r *RecordManager) GetAllTables() ([]byte, error) {
-	log.Println("getting all tables...")
+func (r *RecordManager) GetAllTables(ctx context.Context) ([]string, error) {
+	logger := logging.FromContext(ctx)
+	logger.Debug("getting all tables")
 
 	// чтобы получить список таблиц не ходим в базу
-	tablesList := make([]string, 0, len(r.Schema))
-	for n := range r.Schema {
-		tablesList = append(tablesList, n)
-	}
+	tablesList := r.visibleTables(ctx, r.schema())
 
 	sort.Strings(tablesList) // нужно быть предсказуемым на тестах...
+	return tablesList, nil
+}
 
-	jsonBytes, err := json.MarshalIndent(tablesList, "", "    ")
+// GetSchema implements RecordService
+func (r *RecordManager) GetSchema(ctx context.Context) (dto.Schema, error) {
+	schema := r.schema()
+	tables := r.visibleTables(ctx, schema)
+	s := make(dto.Schema, len(tables))
+	for _, name := range tables {
+		s[name] = schema[name]
+	}
+	return s, nil
+}
+
+// DescribeSchema implements RecordService
+func (r *RecordManager) DescribeSchema(ctx context.Context) (dto.Schema, error) {
+	logger := logging.FromContext(ctx)
+	logger.Debug("describing schema")
+
+	s, err := r.GetSchema(ctx)
 	if err != nil {
-		log.Printf("unable to serialize data: %+v", err)
 		return nil, err
 	}
-	return jsonBytes, nil
+	for name, t := range s {
+		if t.RowsEstimate, err = r.explorer.EstimateRows(name); err != nil {
+			logger.Error("unable to estimate rows", "table", name, "err", err)
+			return nil, err
+		}
+		s[name] = describeKeys(t, s)
+	}
+	return s, nil
+}
+
+// describeKeys оставляет индексы и внешние ключи только по колонкам и таблицам, которые видит клиент,
+// чтобы через них не узнать о скрытых. Срезы копируются: схема общая для всех запросов
+func describeKeys(t dto.Table, s dto.Schema) dto.Table {
+	indexes := make([]dto.Index, 0, len(t.Indexes))
+	for _, idx := range t.Indexes {
+		if hasColumns(t, idx.Columns) {
+			indexes = append(indexes, idx)
+		}
+	}
+	foreignKeys := make([]dto.ForeignKey, 0, len(t.ForeignKeys))
+	for _, fk := range t.ForeignKeys {
+		ref, ok := s[fk.RefTable]
+		if ok && hasColumns(t, fk.Columns) && hasColumns(ref, fk.RefColumns) {
+			foreignKeys = append(foreignKeys, fk)
+		}
+	}
+	t.Indexes = indexes
+	t.ForeignKeys = foreignKeys
+	return t
+}
+
+func hasColumns(t dto.Table, names []string) bool {
+	for _, name := range names {
+		found := false
+		for _, c := range t.Columns {
+			if c.Name == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
 }
 
 // Create implements RecordService
-func (r *RecordManager) Create(tableName string, data map[string]string) (int, error) {
-	log.Printf("inserting record to table %s\n", tableName)
+func (r *RecordManager) Create(ctx context.Context, tableName string, data map[string]string) (int, error) {
+	logger := logging.FromContext(ctx).With("table", tableName)
+	logger.Debug("inserting record")
 
-	tableStruct, ok := r.Schema[tableName]
+	tableStruct, ok := r.schema()[tableName]
 	if !ok {
-		log.Printf("table %s not found", tableName)
+		logger.Info("table not found")
 		return 0, ErrTableNotFound
 	}
 
-	unit, err := validateDataToCreate(data, tableStruct)
+	if tableStruct.ReadOnly {
+		logger.Info("table is read-only")
+		return 0, ErrReadOnlyTable
+	}
+
+	scope, err := r.authorize(ctx, tableStruct, ActionCreate)
 	if err != nil {
-		log.Printf("invalid data")
+		logger.Info("access denied")
+		return 0, err
+	}
+
+	if data, err = scopeData(scope, data, true); err != nil {
+		logger.Info("record belongs to another client")
 		return 0, err
 	}
 
-	insertedId, err := r.repo.Create(tableStruct, unit)
+	unit, err := validateDataToCreate(data, tableStruct)
 	if err != nil {
-		log.Printf("unable to create record: %+v", err)
+		logger.Info("invalid data", "err", err)
+		return 0, err
+	}
+
+	if err := transformData(tableStruct, r.opts.Transforms[tableName], unit, true); err != nil {
+		logger.Error("unable to transform data", "err", err)
+		return 0, err
+	}
+
+	insertedId, err := r.writer(ctx).Create(tableStruct, unit)
+	if rejected := rejectedRecord(err); rejected != nil {
+		logger.Info("record rejected by database", "err", err)
+		return 0, rejected
+	} else if err != nil {
+		logger.Error("unable to create record", "err", err)
 		return 0, err
 	}
 	return insertedId, nil
 }
 
+// rejectedRecord - ошибка сервиса, если база отклонила саму запись, иначе nil.
+// Текст ошибки драйвера клиенту не отдаём, он остаётся в логе
+func rejectedRecord(err error) error {
+	switch {
+	case errors.Is(err, repository.ErrDuplicateKey):
+		return ErrConflict
+	case errors.Is(err, repository.ErrInvalidData):
+		return ErrRejectedRecord
+	}
+	return nil
+}
+
+// Upsert implements RecordService
+func (r *RecordManager) Upsert(ctx context.Context, tableName string, keyName string, data map[string]string) (int, bool, error) {
+	logger := logging.FromContext(ctx).With("table", tableName)
+	logger.Debug("upserting record")
+
+	tableStruct, ok := r.schema()[tableName]
+	if !ok {
+		logger.Info("table not found")
+		return 0, false, ErrTableNotFound
+	}
+
+	if tableStruct.ReadOnly {
+		logger.Info("table is read-only")
+		return 0, false, ErrReadOnlyTable
+	}
+
+	scope, err := r.authorize(ctx, tableStruct, ActionCreate, ActionUpdate)
+	if err != nil {
+		logger.Info("access denied")
+		return 0, false, err
+	}
+
+	if data, err = scopeData(scope, data, true); err != nil {
+		logger.Info("record belongs to another client")
+		return 0, false, err
+	}
+
+	primaryKey, err := getPrimaryKeyColumnName(tableStruct)
+	if err != nil {
+		logger.Error("unable to get primary key name", "err", err)
+		return 0, false, err
+	}
+
+	key, err := getUniqueKey(tableStruct, keyName, primaryKey)
+	if err != nil {
+		logger.Info("unique key not found", "key", keyName)
+		return 0, false, err
+	}
+
+	unit, err := validateDataToUpsert(data, tableStruct, key)
+	if err != nil {
+		logger.Info("invalid data", "err", err)
+		return 0, false, err
+	}
+
+	if err := transformData(tableStruct, r.opts.Transforms[tableName], unit, true); err != nil {
+		logger.Error("unable to transform data", "err", err)
+		return 0, false, err
+	}
+
+	var id int
+	var created bool
+	upsertFn := func(repo repository.RecordManager) (err error) {
+		id, created, err = repo.Upsert(tableStruct, primaryKey, key.Columns, unit)
+		return err
+	}
+	upsertFn = keepCreatedAt(tableStruct, key, unit, r.opts.Transforms[tableName], upsertFn)
+	if len(scope) > 0 {
+		upsertFn = scopedUpsert(tableStruct, key, unit, scope, upsertFn)
+	}
+
+	err = upsertFn(r.writer(ctx))
+	if rejected := rejectedRecord(err); rejected != nil {
+		logger.Info("record rejected by database", "key", key.Name, "err", err)
+		return 0, false, rejected
+	} else if err != nil {
+		logger.Error("unable to upsert record", "err", err)
+		return 0, false, err
+	}
+	return id, created, nil
+}
+
 // DeleteById implements RecordService
-func (r *RecordManager) DeleteById(tableName string, id int) error {
-	log.Printf("deleting record from table %s\n", tableName)
+func (r *RecordManager) DeleteById(ctx context.Context, tableName string, id int, ifMatch string) error {
+	logger := logging.FromContext(ctx).With("table", tableName, "id", id)
+	logger.Debug("deleting record")
 
-	tableStruct, ok := r.Schema[tableName]
+	tableStruct, ok := r.schema()[tableName]
 	if !ok {
-		log.Printf("table %s not found", tableName)
+		logger.Info("table not found")
 		return ErrTableNotFound
 	}
 
+	if tableStruct.ReadOnly {
+		logger.Info("table is read-only")
+		return ErrReadOnlyTable
+	}
+
+	scope, err := r.authorize(ctx, tableStruct, ActionDelete)
+	if err != nil {
+		logger.Info("access denied")
+		return err
+	}
+
 	primaryKey, err := getPrimaryKeyColumnName(tableStruct)
 	if err != nil {
-		log.Printf("unable to get primary key name: %+v", err)
+		logger.Error("unable to get primary key name", "err", err)
+		return err
+	}
+
+	deleteFn := func(repo repository.RecordManager) error {
+		var affected int
+		var err error
+		switch {
+		case tableStruct.SoftDeleteColumn != "":
+			affected, err = markDeleted(repo, tableStruct, byId(primaryKey, id, scope...), true)
+		case len(scope) > 0: // правило для строк добавляется в WHERE
+			affected, err = repo.DeleteByFilter(tableStruct, byId(primaryKey, id, scope...))
+		default:
+			return repo.DeleteById(tableStruct, primaryKey, id)
+		}
+		if err == nil && affected == 0 {
+			return missingOrForbidden(repo, tableStruct, primaryKey, id, scope)
+		}
 		return err
 	}
 
-	switch err := r.repo.DeleteById(tableStruct, primaryKey, id); {
+	switch err := r.withPrecondition(r.writer(ctx), tableStruct, primaryKey, id, ifMatch, deleteFn); {
+	case err == ErrForbidden:
+		logger.Info("record belongs to another client")
+		return err
+	case err == ErrPreconditionFailed:
+		logger.Info("record was changed")
+		return err
 	case err == repository.ErrRowNotFound:
-		log.Printf("record (id=%d) not found", id)
+		logger.Info("record not found")
 		return ErrRecordNotFound
+	case rejectedRecord(err) != nil:
+		logger.Info("record rejected by database", "err", err)
+		return rejectedRecord(err)
 	case err != nil:
-		log.Printf("unable to delete record: %+v", err)
+		logger.Error("unable to delete record", "err", err)
 		return err
 	}
 	return nil
 }
 
 // GetAllRecords implements RecordService
-func (r *RecordManager) GetAllRecords(tableName string, limit int, offset int) ([]byte, error) {
-	log.Printf("getting records from table %s", tableName)
+func (r *RecordManager) GetAllRecords(ctx context.Context, tableName string, filter dto.Filter, limit int, offset int, opts ReadOptions) (dto.Records, error) {
+	logger := logging.FromContext(ctx).With("table", tableName)
+	logger.Debug("getting records")
 
-	tableStruct, ok := r.Schema[tableName]
+	tableStruct, ok := r.schema()[tableName]
 	if !ok {
-		log.Printf("table %s not found", tableName)
-		return nil, ErrTableNotFound
+		logger.Info("table not found")
+		return dto.Records{}, ErrTableNotFound
 	}
 
-	records, err := r.repo.GetAllRecords(tableStruct, limit, offset)
+	validFilter, err := r.listFilter(ctx, tableStruct, filter, opts)
 	if err != nil {
-		log.Printf("unable to get all records: %+v", err)
-		return nil, err
+		return dto.Records{}, err
 	}
 
-	//поля с нуллами не отдаём
+	records, err := r.reader(ctx).GetAllRecords(tableStruct, validFilter, limit, offset)
+	if err != nil {
+		logger.Error("unable to get all records", "err", err)
+		return dto.Records{}, err
+	}
+
+	//поля с нуллами (если клиент не просил их) и write-only колонки не отдаём
 	for _, record := range records {
-		removeNulls(record)
+		if !opts.KeepNulls {
+			removeNulls(record)
+		}
+		removeWriteOnly(tableStruct, record)
+	}
+
+	return dto.Records{Columns: readableColumns(tableStruct), Rows: records}, nil
+}
+
+// listFilter - фильтр для чтения списка: права клиента, условия из запроса и мягкое удаление
+func (r *RecordManager) listFilter(ctx context.Context, tableStruct dto.Table, filter dto.Filter, opts ReadOptions) (dto.Filter, error) {
+	scope, err := r.authorize(ctx, tableStruct, ActionList)
+	if err != nil {
+		logging.FromContext(ctx).Info("access denied", "table", tableStruct.Name)
+		return nil, err
 	}
 
-	jsonBytes, err := json.MarshalIndent(records, "", "    ")
+	validFilter, err := validateFilter(filter, tableStruct)
 	if err != nil {
-		log.Printf("unable to serialize data: %+v", err)
+		logging.FromContext(ctx).Info("invalid filter", "table", tableStruct.Name, "err", err)
 		return nil, err
 	}
-	return jsonBytes, nil
+	validFilter = append(validFilter, scope...)
+
+	if tableStruct.SoftDeleteColumn != "" && !opts.WithDeleted {
+		validFilter = append(validFilter, softDeletedCondition(tableStruct, false))
+	}
+	return validFilter, nil
 }
 
 // GetById implements RecordService
-func (r *RecordManager) GetById(tableName string, id int) ([]byte, error) {
-	log.Printf("getting record (id=%d) from table %s", id, tableName)
+func (r *RecordManager) GetById(ctx context.Context, tableName string, id int, opts ReadOptions) (dto.OrderedRecord, string, error) {
+	logger := logging.FromContext(ctx).With("table", tableName, "id", id)
+	logger.Debug("getting record")
 
-	tableStruct, ok := r.Schema[tableName]
+	tableStruct, ok := r.schema()[tableName]
 	if !ok {
-		log.Printf("table %s not found", tableName)
-		return nil, ErrTableNotFound
+		logger.Info("table not found")
+		return dto.OrderedRecord{}, "", ErrTableNotFound
+	}
+
+	scope, err := r.authorize(ctx, tableStruct, ActionGet)
+	if err != nil {
+		logger.Info("access denied")
+		return dto.OrderedRecord{}, "", err
 	}
 
 	primaryKey, err := getPrimaryKeyColumnName(tableStruct)
 	if err != nil {
-		log.Printf("unable to get primary key name: %+v", err)
-		return nil, err
+		logger.Error("unable to get primary key name", "err", err)
+		return dto.OrderedRecord{}, "", err
 	}
 
-	record, err := r.repo.GetById(tableStruct, primaryKey, id)
+	record, err := getScoped(r.reader(ctx), tableStruct, primaryKey, id, scope)
 	switch {
+	case err == ErrForbidden:
+		logger.Info("record belongs to another client")
+		return dto.OrderedRecord{}, "", err
 	case err == repository.ErrRowNotFound:
-		log.Printf("record (id=%d) not found", id)
-		return nil, ErrRecordNotFound
+		logger.Info("record not found")
+		return dto.OrderedRecord{}, "", ErrRecordNotFound
 	case err != nil:
-		log.Printf("unable to get record dy id: %+v", err)
-		return nil, err
+		logger.Error("unable to get record by id", "err", err)
+		return dto.OrderedRecord{}, "", err
 	}
 
-	//поля с нуллами не отдаём
-	removeNulls(record)
+	if tableStruct.SoftDeleteColumn != "" && !opts.WithDeleted && isSoftDeleted(tableStruct, record) {
+		logger.Info("record is deleted")
+		return dto.OrderedRecord{}, "", ErrRecordNotFound
+	}
 
-	jsonBytes, err := json.MarshalIndent(record, "", "    ")
+	// ETag считаем до удаления нуллов, так же как при проверке If-Match
+	etag, err := computeETag(tableStruct, record)
 	if err != nil {
-		log.Printf("unable to serialize data: %+v", err)
-		return nil, err
+		logger.Error("unable to compute etag", "err", err)
+		return dto.OrderedRecord{}, "", err
 	}
-	return jsonBytes, nil
+
+	//поля с нуллами (если клиент не просил их) и write-only колонки не отдаём
+	if !opts.KeepNulls {
+		removeNulls(record)
+	}
+	removeWriteOnly(tableStruct, record)
+
+	return dto.OrderedRecord{Columns: readableColumns(tableStruct), Values: record}, etag, nil
 }
 
 // UpdateById implements RecordService
-func (r *RecordManager) UpdateById(tableName string, id int, data map[string]string) error {
-	log.Printf("updating record (id=%d) from table %s", id, tableName)
+func (r *RecordManager) UpdateById(ctx context.Context, tableName string, id int, data map[string]string, ifMatch string) error {
+	logger := logging.FromContext(ctx).With("table", tableName, "id", id)
+	logger.Debug("updating record")
 
-	tableStruct, ok := r.Schema[tableName]
+	tableStruct, ok := r.schema()[tableName]
 	if !ok {
-		log.Printf("table %s not found", tableName)
+		logger.Info("table not found")
 		return ErrTableNotFound
 	}
 
+	if tableStruct.ReadOnly {
+		logger.Info("table is read-only")
+		return ErrReadOnlyTable
+	}
+
+	scope, err := r.authorize(ctx, tableStruct, ActionUpdate)
+	if err != nil {
+		logger.Info("access denied")
+		return err
+	}
+
+	if _, err := scopeData(scope, data, false); err != nil {
+		logger.Info("record cannot be given to another client")
+		return err
+	}
+
 	unit, err := validateDataToUpdate(data, tableStruct)
 	if err != nil {
-		log.Printf("invalid data")
+		logger.Info("invalid data", "err", err)
+		return err
+	}
+
+	if err := transformData(tableStruct, r.opts.Transforms[tableName], unit, false); err != nil {
+		logger.Error("unable to transform data", "err", err)
 		return err
 	}
 
 	primaryKey, err := getPrimaryKeyColumnName(tableStruct)
 	if err != nil {
-		log.Printf("unable to get primary key name: %+v", err)
+		logger.Error("unable to get primary key name", "err", err)
 		return err
 	}
 
-	switch err := r.repo.UpdateById(tableStruct, primaryKey, id, unit); {
+	// правило для строк и пропуск удалённых записей добавляются в WHERE: удалённую запись
+	// нельзя изменить, как нельзя и получить
+	conds := append(dto.Filter{}, scope...)
+	if tableStruct.SoftDeleteColumn != "" {
+		conds = append(conds, softDeletedCondition(tableStruct, false))
+	}
+	updateFn := func(repo repository.RecordManager) error {
+		if len(conds) == 0 {
+			return repo.UpdateById(tableStruct, primaryKey, id, unit)
+		}
+		affected, err := repo.UpdateByFilter(tableStruct, byId(primaryKey, id, conds...), unit)
+		if err == nil && affected == 0 {
+			return missingOrForbidden(repo, tableStruct, primaryKey, id, scope)
+		}
+		return err
+	}
+
+	switch err := r.withPrecondition(r.writer(ctx), tableStruct, primaryKey, id, ifMatch, updateFn); {
+	case err == ErrForbidden:
+		logger.Info("record belongs to another client")
+		return err
+	case err == ErrPreconditionFailed:
+		logger.Info("record was changed")
+		return err
 	case err == repository.ErrRowNotFound:
-		log.Printf("record (id=%d) not found", id)
+		logger.Info("record not found")
 		return ErrRecordNotFound
+	case rejectedRecord(err) != nil:
+		logger.Info("record rejected by database", "err", err)
+		return rejectedRecord(err)
 	case err != nil:
-		log.Printf("unable to update record by id: %+v", err)
+		logger.Error("unable to update record by id", "err", err)
 		return err
 	}
 
 	return nil
 }
 
-func (r *RecordManager) InitSchema() error {
+// UpdateByFilter implements RecordService
+func (r *RecordManager) UpdateByFilter(ctx context.Context, tableName string, filter dto.Filter, data map[string]string, opts BulkOptions) (int, error) {
+	logger := logging.FromContext(ctx).With("table", tableName)
+	logger.Debug("updating records by filter")
+
+	tableStruct, ok := r.schema()[tableName]
+	if !ok {
+		logger.Info("table not found")
+		return 0, ErrTableNotFound
+	}
+
+	if tableStruct.ReadOnly {
+		logger.Info("table is read-only")
+		return 0, ErrReadOnlyTable
+	}
+
+	scope, err := r.authorize(ctx, tableStruct, ActionUpdate)
+	if err != nil {
+		logger.Info("access denied")
+		return 0, err
+	}
+
+	if _, err := scopeData(scope, data, false); err != nil {
+		logger.Info("records cannot be given to another client")
+		return 0, err
+	}
+
+	validFilter, err := validateBulkFilter(filter, tableStruct, opts)
+	if err != nil {
+		logger.Info("invalid filter", "err", err)
+		return 0, err
+	}
+	validFilter = append(validFilter, scope...)
+	if tableStruct.SoftDeleteColumn != "" { // удалённые записи не изменяются и не считаются в dry run
+		validFilter = append(validFilter, softDeletedCondition(tableStruct, false))
+	}
+
+	unit, err := validateDataToUpdate(data, tableStruct)
+	if err != nil {
+		logger.Info("invalid data", "err", err)
+		return 0, err
+	}
+
+	if err := transformData(tableStruct, r.opts.Transforms[tableName], unit, false); err != nil {
+		logger.Error("unable to transform data", "err", err)
+		return 0, err
+	}
+
+	if opts.DryRun {
+		return r.countRecords(ctx, tableStruct, validFilter)
+	}
+
+	affected, err := r.writer(ctx).UpdateByFilter(tableStruct, validFilter, unit)
+	switch {
+	case errors.As(err, &ErrBulkLimit{}):
+		logger.Info("too many records to audit", "err", err)
+		return 0, err
+	case rejectedRecord(err) != nil:
+		logger.Info("record rejected by database", "err", err)
+		return 0, rejectedRecord(err)
+	case err != nil:
+		logger.Error("unable to update records by filter", "err", err)
+		return 0, err
+	}
+	return affected, nil
+}
+
+// DeleteByFilter implements RecordService
+func (r *RecordManager) DeleteByFilter(ctx context.Context, tableName string, filter dto.Filter, opts BulkOptions) (int, error) {
+	logger := logging.FromContext(ctx).With("table", tableName)
+	logger.Debug("deleting records by filter")
+
+	tableStruct, ok := r.schema()[tableName]
+	if !ok {
+		logger.Info("table not found")
+		return 0, ErrTableNotFound
+	}
+
+	if tableStruct.ReadOnly {
+		logger.Info("table is read-only")
+		return 0, ErrReadOnlyTable
+	}
+
+	scope, err := r.authorize(ctx, tableStruct, ActionDelete)
+	if err != nil {
+		logger.Info("access denied")
+		return 0, err
+	}
+
+	validFilter, err := validateBulkFilter(filter, tableStruct, opts)
+	if err != nil {
+		logger.Info("invalid filter", "err", err)
+		return 0, err
+	}
+	validFilter = append(validFilter, scope...)
+
+	if tableStruct.SoftDeleteColumn != "" {
+		return r.softDeleteByFilter(ctx, tableStruct, validFilter, opts)
+	}
+
+	if opts.DryRun {
+		return r.countRecords(ctx, tableStruct, validFilter)
+	}
+
+	affected, err := r.writer(ctx).DeleteByFilter(tableStruct, validFilter)
+	switch {
+	case errors.As(err, &ErrBulkLimit{}):
+		logger.Info("too many records to audit", "err", err)
+		return 0, err
+	case rejectedRecord(err) != nil:
+		logger.Info("record rejected by database", "err", err)
+		return 0, rejectedRecord(err)
+	case err != nil:
+		logger.Error("unable to delete records by filter", "err", err)
+		return 0, err
+	}
+	return affected, nil
+}
+
+// RestoreById implements RecordService
+func (r *RecordManager) RestoreById(ctx context.Context, tableName string, id int) error {
+	logger := logging.FromContext(ctx).With("table", tableName, "id", id)
+	logger.Debug("restoring record")
+
+	tableStruct, ok := r.schema()[tableName]
+	if !ok {
+		logger.Info("table not found")
+		return ErrTableNotFound
+	}
+
+	if tableStruct.ReadOnly {
+		logger.Info("table is read-only")
+		return ErrReadOnlyTable
+	}
+
+	if tableStruct.SoftDeleteColumn == "" {
+		logger.Info("table has no soft delete column")
+		return ErrRestoreUnsupported
+	}
+
+	scope, err := r.authorize(ctx, tableStruct, ActionUpdate)
+	if err != nil {
+		logger.Info("access denied")
+		return err
+	}
+
+	primaryKey, err := getPrimaryKeyColumnName(tableStruct)
+	if err != nil {
+		logger.Error("unable to get primary key name", "err", err)
+		return err
+	}
+
+	repo := r.writer(ctx)
+	affected, err := markDeleted(repo, tableStruct, byId(primaryKey, id, scope...), false)
+	if err == nil && affected == 0 { // записи нет, она не удалена или чужая
+		err = missingOrForbidden(repo, tableStruct, primaryKey, id, scope)
+	}
+	switch {
+	case err == ErrForbidden:
+		logger.Info("record belongs to another client")
+		return err
+	case err == repository.ErrRowNotFound:
+		logger.Info("deleted record not found")
+		return ErrRecordNotFound
+	case err != nil:
+		logger.Error("unable to restore record", "err", err)
+		return err
+	}
+	return nil
+}
+
+func (r *RecordManager) softDeleteByFilter(ctx context.Context, tableStruct dto.Table, filter dto.Filter, opts BulkOptions) (int, error) {
+	if opts.DryRun {
+		return r.countRecords(ctx, tableStruct, append(filter, softDeletedCondition(tableStruct, false)))
+	}
+
+	affected, err := markDeleted(r.writer(ctx), tableStruct, filter, true)
+	switch {
+	case errors.As(err, &ErrBulkLimit{}):
+		logging.FromContext(ctx).Info("too many records to audit", "table", tableStruct.Name, "err", err)
+		return 0, err
+	case err != nil:
+		logging.FromContext(ctx).Error("unable to soft delete records by filter", "table", tableStruct.Name, "err", err)
+		return 0, err
+	}
+	return affected, nil
+}
+
+// withPrecondition выполняет fn, только если текущий ETag записи подходит под If-Match.
+// Запись блокируется на время проверки, чтобы её не изменили между проверкой и fn
+func (r *RecordManager) withPrecondition(repo repository.RecordManager, tableStruct dto.Table, primaryKey string, id int, ifMatch string, fn func(repo repository.RecordManager) error) error {
+	if ifMatch == "" {
+		return fn(repo)
+	}
+
+	return repo.InTx(func(tx repository.RecordManager) error {
+		current, err := tx.GetByIdForUpdate(tableStruct, primaryKey, id)
+		if err != nil {
+			return err
+		}
+		etag, err := computeETag(tableStruct, current)
+		if err != nil {
+			return err
+		}
+		if !MatchStrong(ifMatch, etag) {
+			return ErrPreconditionFailed
+		}
+		return fn(tx)
+	})
+}
+
+func (r *RecordManager) countRecords(ctx context.Context, tableStruct dto.Table, filter dto.Filter) (int, error) {
+	count, err := r.reader(ctx).CountRecords(tableStruct, filter)
+	if err != nil {
+		logging.FromContext(ctx).Error("unable to count records", "table", tableStruct.Name, "err", err)
+		return 0, err
+	}
+	return count, nil
+}
+
+// HasTable implements RecordService
+func (r *RecordManager) HasTable(tableName string) bool {
+	_, ok := r.schema()[tableName]
+	return ok
+}
+
+// InitSchema implements RecordService. Повторный вызов перечитывает схему на работающем сервере:
+// запросы, которые уже идут, заканчиваются со старой схемой, при ошибке старая схема остаётся
+func (r *RecordManager) InitSchema() (err error) {
+	if r.opts.Metrics != nil {
+		defer func() {
+			result := "ok"
+			if err != nil {
+				result = "error"
+			}
+			r.opts.Metrics.SchemaReloads.Inc(result)
+		}()
+	}
+
 	s, err := r.dbe.ParseSchema()
 	if err != nil {
 		return err
 	}
+	if r.audit != nil { // журнал не отдаём как обычную таблицу
+		delete(s, r.audit.TableName())
+	}
+	if s, err = applyPolicy(s, r.opts); err != nil {
+		return err
+	}
+	if s, err = applyTransforms(s, r.opts.Transforms); err != nil {
+		return err
+	}
+	r.mu.Lock()
 	r.Schema = s
+	r.mu.Unlock()
 	return nil
 }
 
-func newRecordService(repo *repository.Repository, dbe dbexplorer.SchemeParser) *RecordManager {
+func newRecordService(repo *repository.Repository, dbe dbexplorer.SchemeParser, opts Options) *RecordManager {
 	return &RecordManager{
-		repo:   repo.RecordManager,
-		dbe:    dbe,
-		Schema: map[string]dto.Table{},
+		repo:     repo.RecordManager,
+		audit:    repo.AuditLog,
+		dbe:      dbe,
+		explorer: repo.Explorer,
+		opts:     opts,
+		Schema:   map[string]dto.Table{},
 	}
 }
 
@@ -221,7 +787,15 @@ func validateDataToCreate(data map[string]string, tableStruct dto.Table) (map[st
 			continue
 		}
 
-		if value, ok := data[c.Name]; ok { //пропускаем только те ключи, которые есть в схеме БД
+		value, ok := data[c.Name]
+		if c.ReadOnly {
+			if ok {
+				return nil, ErrReadOnlyColumn{c.Name}
+			}
+			continue // значение подставит база
+		}
+
+		if ok { //пропускаем только те ключи, которые есть в схеме БД
 			validValue, err := parseTypeAndNull(value, c)
 			if err != nil {
 				return nil, err
@@ -247,7 +821,12 @@ func validateDataToUpdate(data map[string]string, tableStruct dto.Table) (map[st
 			continue
 		}
 
-		if value, ok := data[c.Name]; ok { //пропускаем только те ключи, которые есть в схеме БД и у которых не null значения
+		value, ok := data[c.Name]
+		if ok && c.ReadOnly {
+			return nil, ErrReadOnlyColumn{c.Name}
+		}
+
+		if ok { //пропускаем только те ключи, которые есть в схеме БД и у которых не null значения
 			validValue, err := parseTypeAndNull(value, c)
 			if err != nil {
 				return nil, err
@@ -277,6 +856,8 @@ func parseTypeAndNull(value string, c dto.Column) (interface{}, error) {
 		a, err = strconv.Atoi(value)
 	case dto.FloatType:
 		a, err = strconv.ParseFloat(value, 64)
+	case dto.BoolType:
+		a, err = strconv.ParseBool(value)
 	default: // stringType || unknownType
 		a = value
 	}
@@ -287,6 +868,93 @@ func parseTypeAndNull(value string, c dto.Column) (interface{}, error) {
 	return a, nil
 }
 
+// Для upsert действуют правила создания, но колонки ключа (в том числе первичного) обязательны:
+// по ним ищется существующая запись
+func validateDataToUpsert(data map[string]string, tableStruct dto.Table, key dto.Index) (map[string]interface{}, error) {
+	unit, err := validateDataToCreate(data, tableStruct)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range key.Columns {
+		c, ok := getColumn(tableStruct, name)
+		if !ok {
+			return nil, ErrUnknownColumn{name}
+		}
+		value, ok := data[name]
+		if !ok || value == encodedNull {
+			return nil, ErrCannotBeNull{name}
+		}
+		validValue, err := parseTypeAndNull(value, c)
+		if err != nil {
+			return nil, err
+		}
+		unit[name] = validValue
+	}
+	return unit, nil
+}
+
+// Для фильтра null допустим в любой колонке, но сравнивать с ним можно только на (не)равенство
+func validateFilter(filter dto.Filter, tableStruct dto.Table) (dto.Filter, error) {
+	var validFilter dto.Filter
+	for _, cond := range filter {
+		c, ok := getColumn(tableStruct, cond.Column)
+		if !ok || c.WriteOnly { // по write-only колонке можно было бы подобрать значение
+			return nil, ErrUnknownColumn{cond.Column}
+		}
+
+		value, ok := cond.Value.(string)
+		if !ok {
+			return nil, ErrType{c.Name}
+		}
+
+		var validValue interface{}
+		var err error
+
+		switch cond.Operator {
+		case dto.OpEq, dto.OpNe:
+			if value != encodedNull {
+				validValue, err = parseTypeAndNull(value, c)
+			}
+		case dto.OpLt, dto.OpLte, dto.OpGt, dto.OpGte:
+			if value == encodedNull {
+				return nil, ErrType{c.Name}
+			}
+			validValue, err = parseTypeAndNull(value, c)
+		case dto.OpLike:
+			if value == encodedNull {
+				return nil, ErrType{c.Name}
+			}
+			validValue = value // шаблон всегда строка
+		default:
+			return nil, ErrUnknownOperator{cond.Operator}
+		}
+
+		if err != nil {
+			return nil, err
+		}
+		validFilter = append(validFilter, dto.Condition{Column: c.Name, Operator: cond.Operator, Value: validValue})
+	}
+	return validFilter, nil
+}
+
+// Массовая операция без фильтра затронет всю таблицу, поэтому требует явного подтверждения
+func validateBulkFilter(filter dto.Filter, tableStruct dto.Table, opts BulkOptions) (dto.Filter, error) {
+	if len(filter) == 0 && !opts.Confirmed {
+		return nil, ErrUnfilteredBulk
+	}
+	return validateFilter(filter, tableStruct)
+}
+
+func getColumn(t dto.Table, name string) (dto.Column, bool) {
+	for _, c := range t.Columns {
+		if c.Name == name {
+			return c, true
+		}
+	}
+	return dto.Column{}, false
+}
+
 func removeNulls(data map[string]interface{}) {
 	// Это безопасно?
 	for k, v := range data {
@@ -296,6 +964,28 @@ func removeNulls(data map[string]interface{}) {
 	}
 }
 
+// Пустое имя означает первичный ключ. Подходят только уникальные индексы
+func getUniqueKey(t dto.Table, keyName string, primaryKey string) (dto.Index, error) {
+	if keyName == "" || keyName == dto.PrimaryIndexName {
+		return dto.Index{Name: dto.PrimaryIndexName, Columns: []string{primaryKey}, Unique: true}, nil
+	}
+	for _, idx := range t.Indexes {
+		if idx.Name == keyName && idx.Unique {
+			return idx, nil
+		}
+	}
+	return dto.Index{}, ErrUnknownKey{keyName}
+}
+
+// byKey - фильтр по значениям колонок уникального ключа из данных записи
+func byKey(key dto.Index, unit map[string]interface{}) dto.Filter {
+	filter := make(dto.Filter, 0, len(key.Columns))
+	for _, name := range key.Columns {
+		filter = append(filter, dto.Condition{Column: name, Operator: dto.OpEq, Value: unit[name]})
+	}
+	return filter
+}
+
 func getPrimaryKeyColumnName(t dto.Table) (string, error) {
 	for _, c := range t.Columns {
 		if c.IsPrimaryKey {
@@ -1,13 +1,17 @@
 package service
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"hw6coursera/dto"
+	"hw6coursera/metrics"
 	"hw6coursera/repository"
 	"testing"
 
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 var (
@@ -57,9 +61,14 @@ var (
 					IsPrimaryKey: false,
 				},
 			},
+			Indexes: []dto.Index{
+				{Name: "PRIMARY", Columns: []string{"primary_column"}, Unique: true},
+				{Name: "field_unique", Columns: []string{"field"}, Unique: true},
+				{Name: "additional_idx", Columns: []string{"additional_field"}, Unique: false},
+			},
 		}}
 
-	jsonTables string = "[\n    \"example_table_1\",\n    \"example_table_2\"\n]"
+	testingTables []string = []string{"example_table_1", "example_table_2"}
 
 	exampleData []map[string]interface{} = []map[string]interface{}{
 		{
@@ -74,8 +83,8 @@ var (
 		},
 	}
 
-	serializedExampleData       string = "[\n    {\n        \"additional_field\": \"additional value\",\n        \"field\": \"value\",\n        \"primary_column\": 3\n    },\n    {\n        \"additional_field\": \"another additional value\",\n        \"field\": \"another value\",\n        \"primary_column\": 4\n    }\n]"
-	serializedExampleSingleData string = "{\n    \"additional_field\": \"additional value\",\n    \"field\": \"value\",\n    \"primary_column\": 3\n}"
+	serializedExampleData       string = "[{\"additional_field\":\"additional value\",\"field\":\"value\",\"primary_column\":3},{\"additional_field\":\"another additional value\",\"field\":\"another value\",\"primary_column\":4}]"
+	serializedExampleSingleData string = "{\"primary_column\":3,\"field\":\"value\",\"additional_field\":\"additional value\"}"
 
 	exampleDataWithNull []map[string]interface{} = []map[string]interface{}{
 		{
@@ -90,21 +99,30 @@ var (
 		},
 	}
 
-	serializedExampleDataWithNull string = "[\n    {\n        \"field\": \"value\",\n        \"primary_column\": 3\n    },\n    {\n        \"field\": \"another value\",\n        \"primary_column\": 4\n    }\n]"
+	exampleDataWithoutNull []map[string]interface{} = []map[string]interface{}{
+		{
+			"primary_column": 3,
+			"field":          "value",
+		},
+		{
+			"primary_column": 4,
+			"field":          "another value",
+		},
+	}
 )
 
 func TestService_GetAllTables(t *testing.T) {
 	testCases := []struct {
 		name          string
 		schema        dto.Schema
-		expectedData  string
+		expectedData  []string
 		expectedErr   error
 		mockBehaviour func(mr *repository.MockRecordManager)
 	}{
 		{
 			name:         "OK",
 			schema:       testingSchema,
-			expectedData: jsonTables,
+			expectedData: testingTables,
 			expectedErr:  nil,
 			mockBehaviour: func(mr *repository.MockRecordManager) {
 			},
@@ -127,9 +145,9 @@ func TestService_GetAllTables(t *testing.T) {
 				RecordService: recordManager,
 			}
 
-			data, err := service.GetAllTables()
+			data, err := service.GetAllTables(context.Background())
 
-			assert.Equal(t, tc.expectedData, string(data))
+			assert.Equal(t, tc.expectedData, data)
 			assert.Equal(t, tc.expectedErr, err)
 		})
 	}
@@ -228,6 +246,18 @@ func TestService_Create(t *testing.T) {
 			mockBehaviour: func(mr *repository.MockRecordManager, schema dto.Schema, table string, validatedData map[string]interface{}) {
 			},
 		},
+		{
+			name:             "rejected by database",
+			schema:           testingSchema,
+			tableName:        "example_table_1",
+			inputData:        map[string]string{"name": "name", "nullable_field": "not null"},
+			dataToExpect:     map[string]interface{}{"name": "name", "nullable_field": "not null"},
+			expectedInsertId: 0,
+			expectedErr:      ErrRejectedRecord,
+			mockBehaviour: func(mr *repository.MockRecordManager, schema dto.Schema, table string, validatedData map[string]interface{}) {
+				mr.EXPECT().Create(schema[table], validatedData).Return(0, repository.ErrInvalidData)
+			},
+		},
 		{
 			name:             "repository error",
 			schema:           testingSchema,
@@ -259,7 +289,7 @@ func TestService_Create(t *testing.T) {
 				RecordService: recordManager,
 			}
 
-			insertedId, err := service.Create(tc.tableName, tc.inputData)
+			insertedId, err := service.Create(context.Background(), tc.tableName, tc.inputData)
 
 			assert.Equal(t, tc.expectedInsertId, insertedId)
 			assert.Equal(t, tc.expectedErr, err)
@@ -340,7 +370,7 @@ func TestService_DeleteById(t *testing.T) {
 				RecordService: recordManager,
 			}
 
-			err := service.DeleteById(tc.tableName, tc.idToDelete)
+			err := service.DeleteById(context.Background(), tc.tableName, tc.idToDelete, "")
 
 			assert.Equal(t, tc.expectedErr, err)
 		})
@@ -353,13 +383,15 @@ func TestService_GetAllRecords(t *testing.T) {
 		name          string
 		schema        dto.Schema
 		tableName     string
+		filter        dto.Filter
 		limit         int
 		offset        int
+		opts          ReadOptions
 		dataToReturn  []map[string]interface{}
 		errorToReturn error
 		expectedErr   error
-		expectedData  string
-		mockBehaviour func(mr *repository.MockRecordManager, schema dto.Schema, tableName string, limit int, offset int, data []map[string]interface{}, errorToReturn error)
+		expectedData  dto.Records
+		mockBehaviour func(mr *repository.MockRecordManager, schema dto.Schema, tableName string, filter dto.Filter, limit int, offset int, data []map[string]interface{}, errorToReturn error)
 	}{
 		{
 			name:          "OK",
@@ -370,9 +402,9 @@ func TestService_GetAllRecords(t *testing.T) {
 			dataToReturn:  exampleData,
 			errorToReturn: nil,
 			expectedErr:   nil,
-			expectedData:  serializedExampleData,
-			mockBehaviour: func(mr *repository.MockRecordManager, schema dto.Schema, tableName string, limit int, offset int, data []map[string]interface{}, errorToReturn error) {
-				mr.EXPECT().GetAllRecords(schema[tableName], limit, offset).Return(data, errorToReturn)
+			expectedData:  dto.Records{Columns: []string{"primary_key", "name", "nullable_field"}, Rows: exampleData},
+			mockBehaviour: func(mr *repository.MockRecordManager, schema dto.Schema, tableName string, filter dto.Filter, limit int, offset int, data []map[string]interface{}, errorToReturn error) {
+				mr.EXPECT().GetAllRecords(schema[tableName], filter, limit, offset).Return(data, errorToReturn)
 			},
 		},
 		{
@@ -384,9 +416,76 @@ func TestService_GetAllRecords(t *testing.T) {
 			dataToReturn:  exampleDataWithNull,
 			errorToReturn: nil,
 			expectedErr:   nil,
-			expectedData:  serializedExampleDataWithNull,
-			mockBehaviour: func(mr *repository.MockRecordManager, schema dto.Schema, tableName string, limit int, offset int, data []map[string]interface{}, errorToReturn error) {
-				mr.EXPECT().GetAllRecords(schema[tableName], limit, offset).Return(data, errorToReturn)
+			expectedData:  dto.Records{Columns: []string{"primary_key", "name", "nullable_field"}, Rows: exampleDataWithoutNull},
+			mockBehaviour: func(mr *repository.MockRecordManager, schema dto.Schema, tableName string, filter dto.Filter, limit int, offset int, data []map[string]interface{}, errorToReturn error) {
+				mr.EXPECT().GetAllRecords(schema[tableName], filter, limit, offset).Return(data, errorToReturn)
+			},
+		},
+		{
+			name:         "keep nulls",
+			schema:       testingSchema,
+			tableName:    "example_table_1",
+			limit:        2,
+			opts:         ReadOptions{KeepNulls: true},
+			dataToReturn: []map[string]interface{}{{"primary_key": 3, "name": "value", "nullable_field": nil}},
+			expectedData: dto.Records{
+				Columns: []string{"primary_key", "name", "nullable_field"},
+				Rows:    []map[string]interface{}{{"primary_key": 3, "name": "value", "nullable_field": nil}},
+			},
+			mockBehaviour: func(mr *repository.MockRecordManager, schema dto.Schema, tableName string, filter dto.Filter, limit int, offset int, data []map[string]interface{}, errorToReturn error) {
+				mr.EXPECT().GetAllRecords(schema[tableName], filter, limit, offset).Return(data, errorToReturn)
+			},
+		},
+		{
+			name:          "filter",
+			schema:        testingSchema,
+			tableName:     "example_table_2",
+			filter:        dto.Filter{{Column: "primary_column", Operator: dto.OpGt, Value: "2"}, {Column: "additional_field", Operator: dto.OpNe, Value: "%00"}},
+			limit:         2,
+			offset:        0,
+			dataToReturn:  exampleData,
+			errorToReturn: nil,
+			expectedErr:   nil,
+			expectedData:  dto.Records{Columns: []string{"primary_column", "field", "additional_field"}, Rows: exampleData},
+			mockBehaviour: func(mr *repository.MockRecordManager, schema dto.Schema, tableName string, filter dto.Filter, limit int, offset int, data []map[string]interface{}, errorToReturn error) {
+				validFilter := dto.Filter{{Column: "primary_column", Operator: dto.OpGt, Value: 2}, {Column: "additional_field", Operator: dto.OpNe, Value: nil}}
+				mr.EXPECT().GetAllRecords(schema[tableName], validFilter, limit, offset).Return(data, errorToReturn)
+			},
+		},
+		{
+			name:         "filter by unknown column",
+			schema:       testingSchema,
+			tableName:    "example_table_2",
+			filter:       dto.Filter{{Column: "unknown", Operator: dto.OpEq, Value: "1"}},
+			limit:        5,
+			offset:       0,
+			expectedErr:  ErrUnknownColumn{"unknown"},
+			expectedData: dto.Records{},
+			mockBehaviour: func(mr *repository.MockRecordManager, schema dto.Schema, tableName string, filter dto.Filter, limit int, offset int, data []map[string]interface{}, errorToReturn error) {
+			},
+		},
+		{
+			name:         "filter with invalid type",
+			schema:       testingSchema,
+			tableName:    "example_table_2",
+			filter:       dto.Filter{{Column: "primary_column", Operator: dto.OpLt, Value: "five"}},
+			limit:        5,
+			offset:       0,
+			expectedErr:  ErrType{"primary_column"},
+			expectedData: dto.Records{},
+			mockBehaviour: func(mr *repository.MockRecordManager, schema dto.Schema, tableName string, filter dto.Filter, limit int, offset int, data []map[string]interface{}, errorToReturn error) {
+			},
+		},
+		{
+			name:         "filter with unknown operator",
+			schema:       testingSchema,
+			tableName:    "example_table_2",
+			filter:       dto.Filter{{Column: "primary_column", Operator: "between", Value: "1"}},
+			limit:        5,
+			offset:       0,
+			expectedErr:  ErrUnknownOperator{"between"},
+			expectedData: dto.Records{},
+			mockBehaviour: func(mr *repository.MockRecordManager, schema dto.Schema, tableName string, filter dto.Filter, limit int, offset int, data []map[string]interface{}, errorToReturn error) {
 			},
 		},
 		{
@@ -396,8 +495,8 @@ func TestService_GetAllRecords(t *testing.T) {
 			limit:        5,
 			offset:       0,
 			expectedErr:  ErrTableNotFound,
-			expectedData: "",
-			mockBehaviour: func(mr *repository.MockRecordManager, schema dto.Schema, tableName string, limit int, offset int, data []map[string]interface{}, errorToReturn error) {
+			expectedData: dto.Records{},
+			mockBehaviour: func(mr *repository.MockRecordManager, schema dto.Schema, tableName string, filter dto.Filter, limit int, offset int, data []map[string]interface{}, errorToReturn error) {
 			},
 		},
 		{
@@ -409,9 +508,9 @@ func TestService_GetAllRecords(t *testing.T) {
 			dataToReturn:  nil,
 			errorToReturn: fmt.Errorf("repository error"),
 			expectedErr:   fmt.Errorf("repository error"),
-			expectedData:  "",
-			mockBehaviour: func(mr *repository.MockRecordManager, schema dto.Schema, tableName string, limit int, offset int, data []map[string]interface{}, errorToReturn error) {
-				mr.EXPECT().GetAllRecords(schema[tableName], limit, offset).Return(data, errorToReturn)
+			expectedData:  dto.Records{},
+			mockBehaviour: func(mr *repository.MockRecordManager, schema dto.Schema, tableName string, filter dto.Filter, limit int, offset int, data []map[string]interface{}, errorToReturn error) {
+				mr.EXPECT().GetAllRecords(schema[tableName], filter, limit, offset).Return(data, errorToReturn)
 			},
 		},
 	}
@@ -428,14 +527,14 @@ func TestService_GetAllRecords(t *testing.T) {
 				Schema: tc.schema,
 			}
 
-			tc.mockBehaviour(mockRepo, tc.schema, tc.tableName, tc.limit, tc.offset, tc.dataToReturn, tc.errorToReturn)
+			tc.mockBehaviour(mockRepo, tc.schema, tc.tableName, tc.filter, tc.limit, tc.offset, tc.dataToReturn, tc.errorToReturn)
 			service := Service{
 				RecordService: recordManager,
 			}
 
-			data, err := service.GetAllRecords(tc.tableName, tc.limit, tc.offset)
+			data, err := service.GetAllRecords(context.Background(), tc.tableName, tc.filter, tc.limit, tc.offset, tc.opts)
 
-			assert.Equal(t, tc.expectedData, string(data))
+			assert.Equal(t, tc.expectedData, data)
 			assert.Equal(t, tc.expectedErr, err)
 		})
 	}
@@ -453,18 +552,20 @@ func TestService_GetById(t *testing.T) {
 		errorToReturn error
 		expectedErr   error
 		expectedData  string
+		expectedETag  string
 		mockBehaviour func(mr *repository.MockRecordManager, schema dto.Schema, tableName string, primaryKey string, id int, data map[string]interface{}, errorToReturn error)
 	}{
 		{
 			name:          "OK",
 			schema:        testingSchema,
-			tableName:     "example_table_1",
-			primaryKey:    "primary_key",
+			tableName:     "example_table_2",
+			primaryKey:    "primary_column",
 			id:            3,
 			dataToReturn:  exampleData[0],
 			errorToReturn: nil,
 			expectedErr:   nil,
 			expectedData:  serializedExampleSingleData,
+			expectedETag:  `"152d94420006c50d6df22281fe46864d39183eb8"`,
 			mockBehaviour: func(mr *repository.MockRecordManager, schema dto.Schema, tableName string, primaryKey string, id int, data map[string]interface{}, errorToReturn error) {
 				mr.EXPECT().GetById(schema[tableName], primaryKey, id).Return(data, errorToReturn)
 			},
@@ -526,9 +627,14 @@ func TestService_GetById(t *testing.T) {
 				RecordService: recordManager,
 			}
 
-			data, err := service.GetById(tc.tableName, tc.id)
+			data, etag, err := service.GetById(context.Background(), tc.tableName, tc.id, ReadOptions{})
 
-			assert.Equal(t, tc.expectedData, string(data))
+			if tc.expectedData != "" { // порядок полей задаёт OrderedRecord, поэтому сравниваем json
+				jsonBytes, err := json.Marshal(data)
+				require.NoError(t, err)
+				assert.Equal(t, tc.expectedData, string(jsonBytes))
+			}
+			assert.Equal(t, tc.expectedETag, etag)
 			assert.Equal(t, tc.expectedErr, err)
 		})
 	}
@@ -616,10 +722,597 @@ func TestService_UpdateById(t *testing.T) {
 				RecordService: recordManager,
 			}
 
-			err := service.UpdateById(tc.tableName, tc.id, tc.inputData)
+			err := service.UpdateById(context.Background(), tc.tableName, tc.id, tc.inputData, "")
+
+			assert.Equal(t, tc.expectedErr, err)
+		})
+	}
+
+}
+
+func TestService_UpdateByFilter(t *testing.T) {
+	testCases := []struct {
+		name             string
+		schema           dto.Schema
+		tableName        string
+		filter           dto.Filter
+		inputData        map[string]string
+		opts             BulkOptions
+		expectedAffected int
+		expectedErr      error
+		mockBehaviour    func(mr *repository.MockRecordManager, schema dto.Schema, tableName string)
+	}{
+		{
+			name:             "OK",
+			schema:           testingSchema,
+			tableName:        "example_table_1",
+			filter:           dto.Filter{{Column: "primary_key", Operator: dto.OpLt, Value: "5"}},
+			inputData:        map[string]string{"name": "updated name"},
+			expectedAffected: 4,
+			expectedErr:      nil,
+			mockBehaviour: func(mr *repository.MockRecordManager, schema dto.Schema, tableName string) {
+				validFilter := dto.Filter{{Column: "primary_key", Operator: dto.OpLt, Value: 5}}
+				mr.EXPECT().UpdateByFilter(schema[tableName], validFilter, map[string]interface{}{"name": "updated name"}).Return(4, nil)
+			},
+		},
+		{
+			name:             "dry run",
+			schema:           testingSchema,
+			tableName:        "example_table_1",
+			filter:           dto.Filter{{Column: "primary_key", Operator: dto.OpLt, Value: "5"}},
+			inputData:        map[string]string{"name": "updated name"},
+			opts:             BulkOptions{DryRun: true},
+			expectedAffected: 3,
+			expectedErr:      nil,
+			mockBehaviour: func(mr *repository.MockRecordManager, schema dto.Schema, tableName string) {
+				mr.EXPECT().CountRecords(schema[tableName], dto.Filter{{Column: "primary_key", Operator: dto.OpLt, Value: 5}}).Return(3, nil)
+			},
+		},
+		{
+			name:             "unfiltered without confirmation",
+			schema:           testingSchema,
+			tableName:        "example_table_1",
+			inputData:        map[string]string{"name": "updated name"},
+			expectedAffected: 0,
+			expectedErr:      ErrUnfilteredBulk,
+			mockBehaviour:    func(mr *repository.MockRecordManager, schema dto.Schema, tableName string) {},
+		},
+		{
+			name:             "unfiltered with confirmation",
+			schema:           testingSchema,
+			tableName:        "example_table_1",
+			inputData:        map[string]string{"name": "updated name"},
+			opts:             BulkOptions{Confirmed: true},
+			expectedAffected: 10,
+			expectedErr:      nil,
+			mockBehaviour: func(mr *repository.MockRecordManager, schema dto.Schema, tableName string) {
+				mr.EXPECT().UpdateByFilter(schema[tableName], dto.Filter(nil), map[string]interface{}{"name": "updated name"}).Return(10, nil)
+			},
+		},
+		{
+			name:             "missing data to update",
+			schema:           testingSchema,
+			tableName:        "example_table_1",
+			filter:           dto.Filter{{Column: "primary_key", Operator: dto.OpLt, Value: "5"}},
+			inputData:        map[string]string{"primary_key": "1"},
+			expectedAffected: 0,
+			expectedErr:      ErrMissingUpdData,
+			mockBehaviour:    func(mr *repository.MockRecordManager, schema dto.Schema, tableName string) {},
+		},
+		{
+			name:             "not found (table)",
+			schema:           testingSchema,
+			tableName:        "unknown_table",
+			filter:           dto.Filter{{Column: "primary_key", Operator: dto.OpLt, Value: "5"}},
+			inputData:        map[string]string{"name": "updated name"},
+			expectedAffected: 0,
+			expectedErr:      ErrTableNotFound,
+			mockBehaviour:    func(mr *repository.MockRecordManager, schema dto.Schema, tableName string) {},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := gomock.NewController(t)
+			defer c.Finish()
+
+			mockRepo := repository.NewMockRecordManager(c)
+			recordManager := &RecordManager{
+				repo:   mockRepo,
+				dbe:    nil,
+				Schema: tc.schema,
+			}
+
+			tc.mockBehaviour(mockRepo, tc.schema, tc.tableName)
+			service := Service{
+				RecordService: recordManager,
+			}
+
+			affected, err := service.UpdateByFilter(context.Background(), tc.tableName, tc.filter, tc.inputData, tc.opts)
+
+			assert.Equal(t, tc.expectedAffected, affected)
+			assert.Equal(t, tc.expectedErr, err)
+		})
+	}
+}
+
+func TestService_DeleteByFilter(t *testing.T) {
+	testCases := []struct {
+		name             string
+		schema           dto.Schema
+		tableName        string
+		filter           dto.Filter
+		opts             BulkOptions
+		expectedAffected int
+		expectedErr      error
+		mockBehaviour    func(mr *repository.MockRecordManager, schema dto.Schema, tableName string)
+	}{
+		{
+			name:             "OK",
+			schema:           testingSchema,
+			tableName:        "example_table_2",
+			filter:           dto.Filter{{Column: "field", Operator: dto.OpEq, Value: "archived"}},
+			expectedAffected: 2,
+			expectedErr:      nil,
+			mockBehaviour: func(mr *repository.MockRecordManager, schema dto.Schema, tableName string) {
+				mr.EXPECT().DeleteByFilter(schema[tableName], dto.Filter{{Column: "field", Operator: dto.OpEq, Value: "archived"}}).Return(2, nil)
+			},
+		},
+		{
+			name:             "dry run",
+			schema:           testingSchema,
+			tableName:        "example_table_2",
+			filter:           dto.Filter{{Column: "field", Operator: dto.OpEq, Value: "archived"}},
+			opts:             BulkOptions{DryRun: true},
+			expectedAffected: 5,
+			expectedErr:      nil,
+			mockBehaviour: func(mr *repository.MockRecordManager, schema dto.Schema, tableName string) {
+				mr.EXPECT().CountRecords(schema[tableName], dto.Filter{{Column: "field", Operator: dto.OpEq, Value: "archived"}}).Return(5, nil)
+			},
+		},
+		{
+			name:             "unfiltered without confirmation",
+			schema:           testingSchema,
+			tableName:        "example_table_2",
+			opts:             BulkOptions{DryRun: true},
+			expectedAffected: 0,
+			expectedErr:      ErrUnfilteredBulk,
+			mockBehaviour:    func(mr *repository.MockRecordManager, schema dto.Schema, tableName string) {},
+		},
+		{
+			name:             "invalid filter",
+			schema:           testingSchema,
+			tableName:        "example_table_2",
+			filter:           dto.Filter{{Column: "field", Operator: dto.OpGt, Value: "%00"}},
+			expectedAffected: 0,
+			expectedErr:      ErrType{"field"},
+			mockBehaviour:    func(mr *repository.MockRecordManager, schema dto.Schema, tableName string) {},
+		},
+		{
+			name:             "repository error",
+			schema:           testingSchema,
+			tableName:        "example_table_2",
+			filter:           dto.Filter{{Column: "field", Operator: dto.OpEq, Value: "archived"}},
+			expectedAffected: 0,
+			expectedErr:      fmt.Errorf("repository error"),
+			mockBehaviour: func(mr *repository.MockRecordManager, schema dto.Schema, tableName string) {
+				mr.EXPECT().DeleteByFilter(schema[tableName], dto.Filter{{Column: "field", Operator: dto.OpEq, Value: "archived"}}).Return(0, fmt.Errorf("repository error"))
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := gomock.NewController(t)
+			defer c.Finish()
+
+			mockRepo := repository.NewMockRecordManager(c)
+			recordManager := &RecordManager{
+				repo:   mockRepo,
+				dbe:    nil,
+				Schema: tc.schema,
+			}
+
+			tc.mockBehaviour(mockRepo, tc.schema, tc.tableName)
+			service := Service{
+				RecordService: recordManager,
+			}
+
+			affected, err := service.DeleteByFilter(context.Background(), tc.tableName, tc.filter, tc.opts)
+
+			assert.Equal(t, tc.expectedAffected, affected)
+			assert.Equal(t, tc.expectedErr, err)
+		})
+	}
+}
+
+func TestService_Upsert(t *testing.T) {
+	testCases := []struct {
+		name            string
+		schema          dto.Schema
+		tableName       string
+		keyName         string
+		inputData       map[string]string
+		expectedId      int
+		expectedCreated bool
+		expectedErr     error
+		mockBehaviour   func(mr *repository.MockRecordManager, schema dto.Schema, tableName string)
+	}{
+		{
+			name:            "by primary key",
+			schema:          testingSchema,
+			tableName:       "example_table_2",
+			inputData:       map[string]string{"primary_column": "7", "field": "value"},
+			expectedId:      7,
+			expectedCreated: false,
+			expectedErr:     nil,
+			mockBehaviour: func(mr *repository.MockRecordManager, schema dto.Schema, tableName string) {
+				data := map[string]interface{}{"primary_column": 7, "field": "value"}
+				mr.EXPECT().Upsert(schema[tableName], "primary_column", []string{"primary_column"}, data).Return(7, false, nil)
+			},
+		},
+		{
+			name:            "by unique index",
+			schema:          testingSchema,
+			tableName:       "example_table_2",
+			keyName:         "field_unique",
+			inputData:       map[string]string{"primary_column": "7", "field": "value", "additional_field": "%00"},
+			expectedId:      12,
+			expectedCreated: true,
+			expectedErr:     nil,
+			mockBehaviour: func(mr *repository.MockRecordManager, schema dto.Schema, tableName string) {
+				data := map[string]interface{}{"field": "value", "additional_field": nil}
+				mr.EXPECT().Upsert(schema[tableName], "primary_column", []string{"field"}, data).Return(12, true, nil)
+			},
+		},
+		{
+			name:          "missing primary key",
+			schema:        testingSchema,
+			tableName:     "example_table_2",
+			inputData:     map[string]string{"field": "value"},
+			expectedErr:   ErrCannotBeNull{"primary_column"},
+			mockBehaviour: func(mr *repository.MockRecordManager, schema dto.Schema, tableName string) {},
+		},
+		{
+			name:          "non-unique index",
+			schema:        testingSchema,
+			tableName:     "example_table_2",
+			keyName:       "additional_idx",
+			inputData:     map[string]string{"field": "value"},
+			expectedErr:   ErrUnknownKey{"additional_idx"},
+			mockBehaviour: func(mr *repository.MockRecordManager, schema dto.Schema, tableName string) {},
+		},
+		{
+			name:          "not found (table)",
+			schema:        testingSchema,
+			tableName:     "unknown_table",
+			inputData:     map[string]string{"field": "value"},
+			expectedErr:   ErrTableNotFound,
+			mockBehaviour: func(mr *repository.MockRecordManager, schema dto.Schema, tableName string) {},
+		},
+		{
+			name:        "unique value conflict",
+			schema:      testingSchema,
+			tableName:   "example_table_2",
+			inputData:   map[string]string{"primary_column": "7", "field": "value"},
+			expectedErr: ErrConflict,
+			mockBehaviour: func(mr *repository.MockRecordManager, schema dto.Schema, tableName string) {
+				data := map[string]interface{}{"primary_column": 7, "field": "value"}
+				mr.EXPECT().Upsert(schema[tableName], "primary_column", []string{"primary_column"}, data).Return(0, false, repository.ErrDuplicateKey)
+			},
+		},
+		{
+			name:        "repository error",
+			schema:      testingSchema,
+			tableName:   "example_table_2",
+			inputData:   map[string]string{"primary_column": "7", "field": "value"},
+			expectedErr: fmt.Errorf("repository error"),
+			mockBehaviour: func(mr *repository.MockRecordManager, schema dto.Schema, tableName string) {
+				data := map[string]interface{}{"primary_column": 7, "field": "value"}
+				mr.EXPECT().Upsert(schema[tableName], "primary_column", []string{"primary_column"}, data).Return(0, false, fmt.Errorf("repository error"))
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := gomock.NewController(t)
+			defer c.Finish()
+
+			mockRepo := repository.NewMockRecordManager(c)
+			recordManager := &RecordManager{
+				repo:   mockRepo,
+				dbe:    nil,
+				Schema: tc.schema,
+			}
+
+			tc.mockBehaviour(mockRepo, tc.schema, tc.tableName)
+			service := Service{
+				RecordService: recordManager,
+			}
+
+			id, created, err := service.Upsert(context.Background(), tc.tableName, tc.keyName, tc.inputData)
+
+			assert.Equal(t, tc.expectedId, id)
+			assert.Equal(t, tc.expectedCreated, created)
+			assert.Equal(t, tc.expectedErr, err)
+		})
+	}
+}
+
+func TestService_UpdateByIdIfMatch(t *testing.T) {
+	versionedTable := dto.Table{
+		Name:          "versioned",
+		Columns:       append([]dto.Column{{Name: "version", ColumnType: dto.IntType}}, testingSchema["example_table_1"].Columns...),
+		VersionColumn: "version",
+	}
+	schema := dto.Schema{"versioned": versionedTable}
+	currentETag := `"902ba3cda1883801594b6e1b452790cc53948fda"` // sha1 от "7"
+
+	testCases := []struct {
+		name          string
+		ifMatch       string
+		expectedErr   error
+		mockBehaviour func(mr *repository.MockRecordManager)
+	}{
+		{
+			name:        "matched",
+			ifMatch:     currentETag,
+			expectedErr: nil,
+			mockBehaviour: func(mr *repository.MockRecordManager) {
+				mr.EXPECT().InTx(gomock.Any()).DoAndReturn(func(fn func(tx repository.RecordManager) error) error { return fn(mr) })
+				mr.EXPECT().GetByIdForUpdate(versionedTable, "primary_key", 3).Return(map[string]interface{}{"version": int64(7), "primary_key": int64(3)}, nil)
+				mr.EXPECT().UpdateById(versionedTable, "primary_key", 3, map[string]interface{}{"name": "new"}).Return(nil)
+			},
+		},
+		{
+			name:        "any",
+			ifMatch:     "*",
+			expectedErr: nil,
+			mockBehaviour: func(mr *repository.MockRecordManager) {
+				mr.EXPECT().InTx(gomock.Any()).DoAndReturn(func(fn func(tx repository.RecordManager) error) error { return fn(mr) })
+				mr.EXPECT().GetByIdForUpdate(versionedTable, "primary_key", 3).Return(map[string]interface{}{"version": int64(8), "primary_key": int64(3)}, nil)
+				mr.EXPECT().UpdateById(versionedTable, "primary_key", 3, map[string]interface{}{"name": "new"}).Return(nil)
+			},
+		},
+		{
+			name:        "changed",
+			ifMatch:     currentETag,
+			expectedErr: ErrPreconditionFailed,
+			mockBehaviour: func(mr *repository.MockRecordManager) {
+				mr.EXPECT().InTx(gomock.Any()).DoAndReturn(func(fn func(tx repository.RecordManager) error) error { return fn(mr) })
+				mr.EXPECT().GetByIdForUpdate(versionedTable, "primary_key", 3).Return(map[string]interface{}{"version": int64(8), "primary_key": int64(3)}, nil)
+			},
+		},
+		{
+			name:        "weak etag",
+			ifMatch:     "W/" + currentETag,
+			expectedErr: ErrPreconditionFailed,
+			mockBehaviour: func(mr *repository.MockRecordManager) {
+				mr.EXPECT().InTx(gomock.Any()).DoAndReturn(func(fn func(tx repository.RecordManager) error) error { return fn(mr) })
+				mr.EXPECT().GetByIdForUpdate(versionedTable, "primary_key", 3).Return(map[string]interface{}{"version": int64(7), "primary_key": int64(3)}, nil)
+			},
+		},
+		{
+			name:        "not found (record)",
+			ifMatch:     currentETag,
+			expectedErr: ErrRecordNotFound,
+			mockBehaviour: func(mr *repository.MockRecordManager) {
+				mr.EXPECT().InTx(gomock.Any()).DoAndReturn(func(fn func(tx repository.RecordManager) error) error { return fn(mr) })
+				mr.EXPECT().GetByIdForUpdate(versionedTable, "primary_key", 3).Return(nil, repository.ErrRowNotFound)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := gomock.NewController(t)
+			defer c.Finish()
+
+			mockRepo := repository.NewMockRecordManager(c)
+			recordManager := &RecordManager{
+				repo:   mockRepo,
+				dbe:    nil,
+				Schema: schema,
+			}
+
+			tc.mockBehaviour(mockRepo)
+			service := Service{
+				RecordService: recordManager,
+			}
+
+			err := service.UpdateById(context.Background(), "versioned", 3, map[string]string{"name": "new"}, tc.ifMatch)
 
 			assert.Equal(t, tc.expectedErr, err)
 		})
 	}
+}
+
+func TestMatchETag(t *testing.T) {
+	testCases := []struct {
+		name           string
+		header         string
+		etag           string
+		expectedStrong bool
+		expectedWeak   bool
+	}{
+		{name: "equal", header: `"abc"`, etag: `"abc"`, expectedStrong: true, expectedWeak: true},
+		{name: "list", header: `"xyz", "abc"`, etag: `"abc"`, expectedStrong: true, expectedWeak: true},
+		{name: "weak", header: `W/"abc"`, etag: `"abc"`, expectedStrong: false, expectedWeak: true},
+		{name: "weak in list", header: `W/"abc", "xyz"`, etag: `"abc"`, expectedStrong: false, expectedWeak: true},
+		{name: "any", header: `*`, etag: `"abc"`, expectedStrong: true, expectedWeak: true},
+		{name: "different", header: `"xyz"`, etag: `"abc"`, expectedStrong: false, expectedWeak: false},
+		{name: "unquoted", header: `abc`, etag: `"abc"`, expectedStrong: false, expectedWeak: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expectedStrong, MatchStrong(tc.header, tc.etag))
+			assert.Equal(t, tc.expectedWeak, MatchWeak(tc.header, tc.etag))
+		})
+	}
+}
+
+type staticSchema dto.Schema
+
+func (s staticSchema) ParseSchema() (dto.Schema, error) {
+	schema := make(dto.Schema, len(s))
+	for name, t := range s {
+		schema[name] = t
+	}
+	return schema, nil
+}
+
+func TestService_InitSchema(t *testing.T) {
+	testCases := []struct {
+		name           string
+		tables         []string
+		expectedTables []string
+		expectedErr    bool
+	}{
+		{
+			name:           "all tables",
+			expectedTables: []string{"example_table_1", "example_table_2"},
+		},
+		{
+			name:           "exposed tables",
+			tables:         []string{"example_table_2"},
+			expectedTables: []string{"example_table_2"},
+		},
+		{
+			name:        "unknown exposed table",
+			tables:      []string{"example_table_2", "missing"},
+			expectedErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			m := metrics.New()
+			recordManager := &RecordManager{
+				dbe:  staticSchema(testingSchema),
+				opts: Options{Tables: tc.tables, Metrics: m},
+			}
+
+			err := recordManager.InitSchema()
+			if tc.expectedErr {
+				assert.Error(t, err)
+				assert.Equal(t, float64(1), m.SchemaReloads.Value("error"))
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, float64(1), m.SchemaReloads.Value("ok"))
+			var tables []string
+			for _, name := range []string{"example_table_1", "example_table_2", "missing"} {
+				if recordManager.HasTable(name) {
+					tables = append(tables, name)
+				}
+			}
+			assert.Equal(t, tc.expectedTables, tables)
+		})
+	}
+}
+
+// schemaSequence отдаёт схемы по очереди, nil - ошибка чтения
+type schemaSequence []dto.Schema
+
+func (s *schemaSequence) ParseSchema() (dto.Schema, error) {
+	next := (*s)[0]
+	*s = (*s)[1:]
+	if next == nil {
+		return nil, fmt.Errorf("connection refused")
+	}
+	return staticSchema(next).ParseSchema()
+}
+
+func TestService_reloadSchema(t *testing.T) {
+	m := metrics.New()
+	parser := &schemaSequence{
+		{"example_table_1": testingSchema["example_table_1"]},
+		testingSchema,
+		nil,
+	}
+	recordManager := &RecordManager{dbe: parser, opts: Options{Metrics: m}}
+
+	require.NoError(t, recordManager.InitSchema())
+	assert.False(t, recordManager.HasTable("example_table_2"))
+
+	// новая таблица видна после перечитывания
+	require.NoError(t, recordManager.InitSchema())
+	assert.True(t, recordManager.HasTable("example_table_2"))
+
+	// при ошибке остаётся прежняя схема
+	assert.Error(t, recordManager.InitSchema())
+	assert.True(t, recordManager.HasTable("example_table_2"))
+
+	// в метрике - загрузка при старте и каждое перечитывание
+	assert.Equal(t, float64(2), m.SchemaReloads.Value("ok"))
+	assert.Equal(t, float64(1), m.SchemaReloads.Value("error"))
+
+}
+
+func TestService_DescribeSchema(t *testing.T) {
+	c := gomock.NewController(t)
+	defer c.Finish()
+	explorer := repository.NewMockExplorer(c)
+
+	schema := dto.Schema{
+		"users": {
+			Name: "users",
+			Columns: []dto.Column{
+				{Name: "id", ColumnType: dto.IntType, IsPrimaryKey: true, Generated: true},
+				{Name: "email", ColumnType: dto.StringType, MaxLength: 255},
+				{Name: "team_id", ColumnType: dto.IntType, Nullable: true},
+				{Name: "secret", ColumnType: dto.StringType},
+			},
+			Indexes: []dto.Index{
+				{Name: dto.PrimaryIndexName, Columns: []string{"id"}, Unique: true},
+				{Name: "email_secret", Columns: []string{"email", "secret"}, Unique: true},
+			},
+			ForeignKeys: []dto.ForeignKey{
+				{Name: "users_team", Columns: []string{"team_id"}, RefTable: "teams", RefColumns: []string{"id"}},
+			},
+		},
+		"teams": {
+			Name:    "teams",
+			Columns: []dto.Column{{Name: "id", ColumnType: dto.IntType, IsPrimaryKey: true}},
+		},
+	}
+	recordManager := &RecordManager{
+		dbe:      staticSchema(schema),
+		explorer: explorer,
+		opts: Options{
+			HiddenTables: []string{"teams"},
+			Columns:      map[string]map[string]ColumnAccess{"users": {"secret": ColumnHidden}},
+		},
+	}
+	assert.NoError(t, recordManager.InitSchema())
+
+	explorer.EXPECT().EstimateRows("users").Return(int64(10), nil)
+	data, err := recordManager.DescribeSchema(context.Background())
+	assert.NoError(t, err)
+	jsonBytes, err := json.Marshal(data)
+	require.NoError(t, err)
+	// индекс со скрытой колонкой и ключ на скрытую таблицу не отдаются
+	assert.JSONEq(t, `{
+		"users": {
+			"name": "users",
+			"columns": [
+				{"name": "id", "type": "int", "nullable": false, "primary_key": true, "generated": true},
+				{"name": "email", "type": "string", "nullable": false, "max_length": 255},
+				{"name": "team_id", "type": "int", "nullable": true}
+			],
+			"indexes": [{"name": "PRIMARY", "columns": ["id"], "unique": true}],
+			"foreign_keys": [],
+			"rows_estimate": 10
+		}
+	}`, string(jsonBytes))
+
+	// общая схема не меняется
+	assert.Len(t, recordManager.Schema["users"].Indexes, 2)
+	assert.Equal(t, int64(0), recordManager.Schema["users"].RowsEstimate)
 
+	explorer.EXPECT().EstimateRows("users").Return(int64(0), fmt.Errorf("connection refused"))
+	_, err = recordManager.DescribeSchema(context.Background())
+	assert.Error(t, err)
 }
@@ -1,28 +1,102 @@
 package service
 
 import (
+	"context"
 	"hw6coursera/dbexplorer"
+	"hw6coursera/dto"
+	"hw6coursera/metrics"
 	"hw6coursera/repository"
 )
 
 //go:generate mockgen -source=service.go -destination=mock.go
 
 type RecordService interface {
-	GetAllTables() (data []byte, err error)
-	GetAllRecords(tableName string, limit int, offset int) (data []byte, err error)
-	GetById(tableName string, id int) (data []byte, err error)
-	Create(tableName string, data map[string]string) (lastInsertedId int, err error)
-	UpdateById(tableName string, id int, data map[string]string) (err error)
-	DeleteById(tableName string, id int) (err error)
+	// ctx несёт клиента, от имени которого выполняется запрос (см. WithPrincipal),
+	// при изменениях он попадает в журнал
+	GetAllTables(ctx context.Context) (tables []string, err error)
+	// GetSchema - схема таблиц, которые видит клиент, уже с учётом настроек доступа
+	GetSchema(ctx context.Context) (schema dto.Schema, err error)
+	// DescribeSchema - то же, что GetSchema, с оценкой числа строк в каждой таблице
+	DescribeSchema(ctx context.Context) (schema dto.Schema, err error)
+	GetAllRecords(ctx context.Context, tableName string, filter dto.Filter, limit int, offset int, opts ReadOptions) (records dto.Records, err error)
+	// ExportRecords отдаёт в w все записи по фильтру, без страниц и не накапливая их в памяти
+	ExportRecords(ctx context.Context, tableName string, filter dto.Filter, opts ReadOptions, w RecordWriter) (err error)
+	GetById(ctx context.Context, tableName string, id int, opts ReadOptions) (record dto.OrderedRecord, etag string, err error)
+	Create(ctx context.Context, tableName string, data map[string]string) (lastInsertedId int, err error)
+	Upsert(ctx context.Context, tableName string, keyName string, data map[string]string) (id int, created bool, err error)
+	// ifMatch - значение заголовка If-Match, пустое значение отключает проверку
+	UpdateById(ctx context.Context, tableName string, id int, data map[string]string, ifMatch string) (err error)
+	DeleteById(ctx context.Context, tableName string, id int, ifMatch string) (err error)
+	RestoreById(ctx context.Context, tableName string, id int) (err error)
+	UpdateByFilter(ctx context.Context, tableName string, filter dto.Filter, data map[string]string, opts BulkOptions) (affected int, err error)
+	DeleteByFilter(ctx context.Context, tableName string, filter dto.Filter, opts BulkOptions) (affected int, err error)
+	Batch(ctx context.Context, ops []dto.BatchOperation) (results []dto.BatchResult, err error)
+	// ImportRecords добавляет записи из src порциями по транзакции. Строки, которые не прошли
+	// проверку или были отклонены базой, попадают в отчёт и не мешают остальным
+	ImportRecords(ctx context.Context, tableName string, src RecordReader, opts ImportOptions) (report dto.ImportReport, err error)
+	// History - записи журнала изменений по одной записи таблицы, от старых к новым
+	History(ctx context.Context, tableName string, id int) (entries []dto.AuditEntry, err error)
+	// HasTable - есть ли таблица в схеме, без учёта прав клиента, например для меток метрик
+	HasTable(tableName string) bool
+	// InitSchema читает схему базы. Вызывается при старте и при перечитывании схемы (SIGHUP)
 	InitSchema() error
 }
 
+// ReadOptions - параметры чтения записей
+type ReadOptions struct {
+	WithDeleted bool // показывать мягко удалённые записи
+	KeepNulls   bool // отдавать поля с null, а не пропускать их
+}
+
+// RecordWriter получает выгружаемые записи: сначала колонки, потом записи по одной.
+// Ошибка из Write прерывает выгрузку
+type RecordWriter interface {
+	Columns(columns []string) error
+	Write(record map[string]interface{}) error
+}
+
+// RecordReader отдаёт загружаемые записи по одной: номер строки в файле и значения по заголовкам.
+// В конце файла - io.EOF, ErrInvalidLine - строку не удалось разобрать, чтение можно продолжать
+type RecordReader interface {
+	Read() (line int, record map[string]string, err error)
+}
+
+// ImportOptions - параметры загрузки записей из файла
+type ImportOptions struct {
+	Mapping    map[string]string // заголовок файла -> колонка, пустая колонка - пропустить; остальные заголовки совпадают с колонками
+	NullTokens []string          // значения, которые читаются как null, %00 - null всегда
+	ChunkSize  int               // записей в одной транзакции, 0 - DefaultImportChunk
+}
+
+// BulkOptions - параметры массовых операций по фильтру
+type BulkOptions struct {
+	Confirmed bool // разрешает операцию без фильтра, т.е. над всей таблицей
+	DryRun    bool // ничего не меняем, только считаем затрагиваемые записи
+}
+
+// Options - настройки сервиса, которые задаются при запуске
+type Options struct {
+	Tables         []string // таблицы, доступные через API, пусто - все таблицы базы
+	HiddenTables   []string
+	ReadOnlyTables []string
+	Columns        map[string]map[string]ColumnAccess // таблица -> колонка -> доступ
+	Access         AccessPolicy
+	Transforms     map[string]map[string][]Transform // таблица -> колонка -> преобразования перед записью, по порядку
+	VersionColumns map[string]string                 // таблица -> колонка версии для ETag, у остальных ETag по всей записи
+	// таблица -> колонка-метка мягкого удаления, пустая строка - удалять по-настоящему
+	SoftDeleteColumns  map[string]string
+	DetectSoftDelete   bool             // искать deleted_at или is_deleted у таблиц, которых нет в SoftDeleteColumns
+	AuditMaxBulkRows   int              // сколько записей может затронуть операция по фильтру при включённом журнале, 0 - без ограничения
+	BatchMaxOperations int              // сколько операций может быть в одном пакете, 0 - без ограничения
+	Metrics            *metrics.Metrics // nil - загрузки схемы не считаются
+}
+
 type Service struct {
 	RecordService
 }
 
-func NewService(r *repository.Repository, dbe *dbexplorer.DBexplorer) *Service {
+func NewService(r *repository.Repository, dbe *dbexplorer.DBexplorer, opts Options) *Service {
 	return &Service{
-		RecordService: newRecordService(r, dbe),
+		RecordService: newRecordService(r, dbe, opts),
 	}
 }
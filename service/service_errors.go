@@ -6,6 +6,16 @@ var (
 	ErrTableNotFound  = fmt.Errorf("table not found")
 	ErrRecordNotFound = fmt.Errorf("record not found")
 	ErrMissingUpdData = fmt.Errorf("missing data to update")
+	ErrUnfilteredBulk = fmt.Errorf("bulk operation without filter requires confirm=true")
+	ErrEmptyBatch     = fmt.Errorf("empty batch")
+
+	ErrPreconditionFailed = fmt.Errorf("precondition failed")
+	ErrRestoreUnsupported = fmt.Errorf("table does not support soft delete")
+	ErrAuditDisabled      = fmt.Errorf("audit log is disabled")
+	ErrReadOnlyTable      = fmt.Errorf("table is read-only")
+	ErrForbidden          = fmt.Errorf("forbidden")
+	ErrConflict           = fmt.Errorf("another record has the same unique value")
+	ErrRejectedRecord     = fmt.Errorf("record violates a database constraint")
 )
 
 type ErrType struct {
@@ -23,3 +33,104 @@ type ErrCannotBeNull struct {
 func (ne ErrCannotBeNull) Error() string {
 	return fmt.Sprintf("%s cannot be null", ne.field)
 }
+
+type ErrUnknownColumn struct {
+	field string
+}
+
+func (ue ErrUnknownColumn) Error() string {
+	return fmt.Sprintf("unknown column %s", ue.field)
+}
+
+type ErrReadOnlyColumn struct {
+	field string
+}
+
+func (re ErrReadOnlyColumn) Error() string {
+	return fmt.Sprintf("%s is read-only", re.field)
+}
+
+type ErrTooLong struct {
+	field string
+}
+
+func (le ErrTooLong) Error() string {
+	return fmt.Sprintf("%s is too long", le.field)
+}
+
+type ErrUnknownOperator struct {
+	operator string
+}
+
+func (oe ErrUnknownOperator) Error() string {
+	return fmt.Sprintf("unknown operator %s", oe.operator)
+}
+
+type ErrUnknownKey struct {
+	key string
+}
+
+func (ke ErrUnknownKey) Error() string {
+	return fmt.Sprintf("unique key %s not found", ke.key)
+}
+
+type ErrUnknownOperation struct {
+	op string
+}
+
+func (oe ErrUnknownOperation) Error() string {
+	return fmt.Sprintf("unknown operation %s", oe.op)
+}
+
+// ErrBulkLimit - операция по фильтру затронула бы больше записей, чем можно записать в журнал за раз
+type ErrBulkLimit struct {
+	Limit int
+}
+
+func (be ErrBulkLimit) Error() string {
+	return fmt.Sprintf("bulk operation affects more than %d records, narrow the filter", be.Limit)
+}
+
+type ErrInvalidId struct {
+	id string
+}
+
+func (ie ErrInvalidId) Error() string {
+	return fmt.Sprintf("invalid id %s", ie.id)
+}
+
+// ErrBatchTooLarge - в пакете больше операций, чем разрешено настройкой
+type ErrBatchTooLarge struct {
+	Limit int
+}
+
+func (be ErrBatchTooLarge) Error() string {
+	return fmt.Sprintf("batch has more than %d operations", be.Limit)
+}
+
+// ErrBatchOperation - ошибка конкретной операции пакета, весь пакет при этом откатывается
+type ErrBatchOperation struct {
+	Index int
+	Err   error
+}
+
+func (be ErrBatchOperation) Error() string {
+	return fmt.Sprintf("operation %d: %v", be.Index, be.Err)
+}
+
+func (be ErrBatchOperation) Unwrap() error {
+	return be.Err
+}
+
+// ErrInvalidLine - строку загружаемого файла не удалось разобрать, остальные строки читаются дальше
+type ErrInvalidLine struct {
+	Err error
+}
+
+func (le ErrInvalidLine) Error() string {
+	return fmt.Sprintf("invalid line: %v", le.Err)
+}
+
+func (le ErrInvalidLine) Unwrap() error {
+	return le.Err
+}
@@ -0,0 +1,105 @@
+package service
+
+import (
+	"hw6coursera/dto"
+	"hw6coursera/repository"
+	"time"
+)
+
+const softDeleteTimeLayout = "2006-01-02 15:04:05"
+
+// колонки-метки мягкого удаления, которые находятся без настройки: время удаления или флаг
+var softDeleteColumnNames = []string{"deleted_at", "is_deleted"}
+
+// detectColumn возвращает первое из names, которое есть среди колонок таблицы и подходит для метки.
+// Колонка с таким именем, но другого типа - обычная колонка, а не метка
+func detectColumn(cols []dto.Column, names []string) string {
+	for _, name := range names {
+		for _, c := range cols {
+			if c.Name == name && canMarkDeleted(c) {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+// Метка мягкого удаления бывает двух видов: время удаления (null - не удалена)
+// или флаг - целочисленный (0 - не удалена) или логический
+func isSoftDeleteFlag(t dto.Table) bool {
+	c, _ := getColumn(t, t.SoftDeleteColumn)
+	return isFlagColumn(c)
+}
+
+func isFlagColumn(c dto.Column) bool {
+	return c.ColumnType == dto.IntType || c.ColumnType == dto.BoolType
+}
+
+// canMarkDeleted - подходит ли колонка для метки: флаг или время удаления, null у живых записей
+func canMarkDeleted(c dto.Column) bool {
+	return isFlagColumn(c) || c.Nullable
+}
+
+// flagValue - значение флага в типе колонки
+func flagValue(t dto.Table, deleted bool) interface{} {
+	if c, _ := getColumn(t, t.SoftDeleteColumn); c.ColumnType == dto.BoolType {
+		return deleted
+	}
+	if deleted {
+		return 1
+	}
+	return 0
+}
+
+// softDeletedCondition - условие фильтра на удалённые (deleted == true) или живые записи
+func softDeletedCondition(t dto.Table, deleted bool) dto.Condition {
+	cond := dto.Condition{Column: t.SoftDeleteColumn, Operator: dto.OpEq}
+	switch {
+	case isSoftDeleteFlag(t):
+		cond.Value = flagValue(t, deleted)
+	case deleted:
+		cond.Operator = dto.OpNe // IS NOT NULL
+	}
+	return cond
+}
+
+// softDeleteMarker - данные для UPDATE, которые помечают запись удалённой или восстанавливают её
+func softDeleteMarker(t dto.Table, deleted bool) map[string]interface{} {
+	var value interface{}
+	switch {
+	case isSoftDeleteFlag(t):
+		value = flagValue(t, deleted)
+	case deleted:
+		value = time.Now().UTC().Format(softDeleteTimeLayout)
+	}
+	return map[string]interface{}{t.SoftDeleteColumn: value}
+}
+
+func isSoftDeleted(t dto.Table, record map[string]interface{}) bool {
+	value := record[t.SoftDeleteColumn]
+	if !isSoftDeleteFlag(t) {
+		return value != nil
+	}
+	switch flag := value.(type) { // в зависимости от протокола драйвер отдаёт число или строку
+	case bool:
+		return flag
+	case int64:
+		return flag != 0
+	case string:
+		return flag != "" && flag != "0"
+	default:
+		return false
+	}
+}
+
+// byId - фильтр на одну запись, для операций, которые идут через UpdateByFilter
+func byId(primaryKey string, id int, conds ...dto.Condition) dto.Filter {
+	return append(dto.Filter{{Column: primaryKey, Operator: dto.OpEq, Value: id}}, conds...)
+}
+
+// markDeleted помечает удалёнными живые записи под фильтром (deleted == true) или восстанавливает удалённые
+func markDeleted(repo repository.RecordManager, t dto.Table, filter dto.Filter, deleted bool) (int, error) {
+	conds := append(dto.Filter{}, filter...) // не портим фильтр вызывающего
+	conds = append(conds, softDeletedCondition(t, !deleted))
+	return repo.UpdateByFilter(t, conds, softDeleteMarker(t, deleted))
+}
@@ -0,0 +1,242 @@
+package service
+
+import (
+	"context"
+	"hw6coursera/dto"
+	"hw6coursera/repository"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	softDeleteTable = dto.Table{
+		Name: "soft",
+		Columns: []dto.Column{
+			{Name: "id", ColumnType: dto.IntType, IsPrimaryKey: true},
+			{Name: "title", ColumnType: dto.StringType},
+			{Name: "deleted_at", ColumnType: dto.UnknownType, Nullable: true},
+		},
+		SoftDeleteColumn: "deleted_at",
+	}
+	flagTable = dto.Table{
+		Name: "flag",
+		Columns: []dto.Column{
+			{Name: "id", ColumnType: dto.IntType, IsPrimaryKey: true},
+			{Name: "is_deleted", ColumnType: dto.IntType},
+		},
+		SoftDeleteColumn: "is_deleted",
+	}
+	boolFlagTable = dto.Table{
+		Name: "bool_flag",
+		Columns: []dto.Column{
+			{Name: "id", ColumnType: dto.IntType, IsPrimaryKey: true},
+			{Name: "is_deleted", ColumnType: dto.BoolType},
+		},
+		SoftDeleteColumn: "is_deleted",
+	}
+	softDeleteSchema = dto.Schema{"soft": softDeleteTable, "flag": flagTable, "bool_flag": boolFlagTable}
+)
+
+func TestService_SoftDelete(t *testing.T) {
+	testCases := []struct {
+		name          string
+		call          func(s *Service) error
+		expectedErr   error
+		mockBehaviour func(mr *repository.MockRecordManager)
+	}{
+		{
+			name: "delete marks record",
+			call: func(s *Service) error { return s.DeleteById(context.Background(), "soft", 3, "") },
+			mockBehaviour: func(mr *repository.MockRecordManager) {
+				filter := dto.Filter{{Column: "id", Operator: dto.OpEq, Value: 3}, {Column: "deleted_at", Operator: dto.OpEq, Value: nil}}
+				mr.EXPECT().UpdateByFilter(softDeleteTable, filter, gomock.Any()).Return(1, nil)
+			},
+		},
+		{
+			name:        "delete already deleted",
+			call:        func(s *Service) error { return s.DeleteById(context.Background(), "soft", 3, "") },
+			expectedErr: ErrRecordNotFound,
+			mockBehaviour: func(mr *repository.MockRecordManager) {
+				filter := dto.Filter{{Column: "id", Operator: dto.OpEq, Value: 3}, {Column: "deleted_at", Operator: dto.OpEq, Value: nil}}
+				mr.EXPECT().UpdateByFilter(softDeleteTable, filter, gomock.Any()).Return(0, nil)
+			},
+		},
+		{
+			name: "delete with flag",
+			call: func(s *Service) error { return s.DeleteById(context.Background(), "flag", 3, "") },
+			mockBehaviour: func(mr *repository.MockRecordManager) {
+				filter := dto.Filter{{Column: "id", Operator: dto.OpEq, Value: 3}, {Column: "is_deleted", Operator: dto.OpEq, Value: 0}}
+				mr.EXPECT().UpdateByFilter(flagTable, filter, map[string]interface{}{"is_deleted": 1}).Return(1, nil)
+			},
+		},
+		{
+			name: "delete with boolean flag",
+			call: func(s *Service) error { return s.DeleteById(context.Background(), "bool_flag", 3, "") },
+			mockBehaviour: func(mr *repository.MockRecordManager) {
+				filter := dto.Filter{{Column: "id", Operator: dto.OpEq, Value: 3}, {Column: "is_deleted", Operator: dto.OpEq, Value: false}}
+				mr.EXPECT().UpdateByFilter(boolFlagTable, filter, map[string]interface{}{"is_deleted": true}).Return(1, nil)
+			},
+		},
+		{
+			name: "restore with boolean flag",
+			call: func(s *Service) error { return s.RestoreById(context.Background(), "bool_flag", 3) },
+			mockBehaviour: func(mr *repository.MockRecordManager) {
+				filter := dto.Filter{{Column: "id", Operator: dto.OpEq, Value: 3}, {Column: "is_deleted", Operator: dto.OpEq, Value: true}}
+				mr.EXPECT().UpdateByFilter(boolFlagTable, filter, map[string]interface{}{"is_deleted": false}).Return(1, nil)
+			},
+		},
+		{
+			name: "delete by filter",
+			call: func(s *Service) error {
+				_, err := s.DeleteByFilter(context.Background(), "soft", dto.Filter{{Column: "title", Operator: dto.OpEq, Value: "old"}}, BulkOptions{})
+				return err
+			},
+			mockBehaviour: func(mr *repository.MockRecordManager) {
+				filter := dto.Filter{{Column: "title", Operator: dto.OpEq, Value: "old"}, {Column: "deleted_at", Operator: dto.OpEq, Value: nil}}
+				mr.EXPECT().UpdateByFilter(softDeleteTable, filter, gomock.Any()).Return(2, nil)
+			},
+		},
+		{
+			name: "update skips deleted",
+			call: func(s *Service) error {
+				return s.UpdateById(context.Background(), "soft", 3, map[string]string{"title": "new"}, "")
+			},
+			expectedErr: ErrRecordNotFound,
+			mockBehaviour: func(mr *repository.MockRecordManager) {
+				filter := dto.Filter{{Column: "id", Operator: dto.OpEq, Value: 3}, {Column: "deleted_at", Operator: dto.OpEq, Value: nil}}
+				mr.EXPECT().UpdateByFilter(softDeleteTable, filter, map[string]interface{}{"title": "new"}).Return(0, nil)
+			},
+		},
+		{
+			name: "update by filter skips deleted",
+			call: func(s *Service) error {
+				_, err := s.UpdateByFilter(context.Background(), "soft", dto.Filter{{Column: "title", Operator: dto.OpEq, Value: "old"}},
+					map[string]string{"title": "new"}, BulkOptions{})
+				return err
+			},
+			mockBehaviour: func(mr *repository.MockRecordManager) {
+				filter := dto.Filter{{Column: "title", Operator: dto.OpEq, Value: "old"}, {Column: "deleted_at", Operator: dto.OpEq, Value: nil}}
+				mr.EXPECT().UpdateByFilter(softDeleteTable, filter, map[string]interface{}{"title": "new"}).Return(2, nil)
+			},
+		},
+		{
+			name: "update dry run skips deleted",
+			call: func(s *Service) error {
+				_, err := s.UpdateByFilter(context.Background(), "soft", dto.Filter{{Column: "title", Operator: dto.OpEq, Value: "old"}},
+					map[string]string{"title": "new"}, BulkOptions{DryRun: true})
+				return err
+			},
+			mockBehaviour: func(mr *repository.MockRecordManager) {
+				filter := dto.Filter{{Column: "title", Operator: dto.OpEq, Value: "old"}, {Column: "deleted_at", Operator: dto.OpEq, Value: nil}}
+				mr.EXPECT().CountRecords(softDeleteTable, filter).Return(2, nil)
+			},
+		},
+		{
+			name: "restore",
+			call: func(s *Service) error { return s.RestoreById(context.Background(), "soft", 3) },
+			mockBehaviour: func(mr *repository.MockRecordManager) {
+				filter := dto.Filter{{Column: "id", Operator: dto.OpEq, Value: 3}, {Column: "deleted_at", Operator: dto.OpNe, Value: nil}}
+				mr.EXPECT().UpdateByFilter(softDeleteTable, filter, map[string]interface{}{"deleted_at": nil}).Return(1, nil)
+			},
+		},
+		{
+			name:        "restore not deleted",
+			call:        func(s *Service) error { return s.RestoreById(context.Background(), "flag", 3) },
+			expectedErr: ErrRecordNotFound,
+			mockBehaviour: func(mr *repository.MockRecordManager) {
+				filter := dto.Filter{{Column: "id", Operator: dto.OpEq, Value: 3}, {Column: "is_deleted", Operator: dto.OpEq, Value: 1}}
+				mr.EXPECT().UpdateByFilter(flagTable, filter, map[string]interface{}{"is_deleted": 0}).Return(0, nil)
+			},
+		},
+		{
+			name:          "restore unsupported",
+			call:          func(s *Service) error { return s.RestoreById(context.Background(), "example_table_1", 3) },
+			expectedErr:   ErrRestoreUnsupported,
+			mockBehaviour: func(mr *repository.MockRecordManager) {},
+		},
+		{
+			name: "list hides deleted",
+			call: func(s *Service) error {
+				_, err := s.GetAllRecords(context.Background(), "soft", nil, 5, 0, ReadOptions{})
+				return err
+			},
+			mockBehaviour: func(mr *repository.MockRecordManager) {
+				filter := dto.Filter{{Column: "deleted_at", Operator: dto.OpEq, Value: nil}}
+				mr.EXPECT().GetAllRecords(softDeleteTable, filter, 5, 0).Return(nil, nil)
+			},
+		},
+		{
+			name: "list with deleted",
+			call: func(s *Service) error {
+				_, err := s.GetAllRecords(context.Background(), "soft", nil, 5, 0, ReadOptions{WithDeleted: true})
+				return err
+			},
+			mockBehaviour: func(mr *repository.MockRecordManager) {
+				mr.EXPECT().GetAllRecords(softDeleteTable, dto.Filter(nil), 5, 0).Return(nil, nil)
+			},
+		},
+		{
+			name: "get deleted",
+			call: func(s *Service) error {
+				_, _, err := s.GetById(context.Background(), "soft", 3, ReadOptions{})
+				return err
+			},
+			expectedErr: ErrRecordNotFound,
+			mockBehaviour: func(mr *repository.MockRecordManager) {
+				record := map[string]interface{}{"id": int64(3), "title": "old", "deleted_at": "2026-01-01 00:00:00"}
+				mr.EXPECT().GetById(softDeleteTable, "id", 3).Return(record, nil)
+			},
+		},
+		{
+			name: "get deleted with boolean flag",
+			call: func(s *Service) error {
+				_, _, err := s.GetById(context.Background(), "bool_flag", 3, ReadOptions{})
+				return err
+			},
+			expectedErr: ErrRecordNotFound,
+			mockBehaviour: func(mr *repository.MockRecordManager) {
+				mr.EXPECT().GetById(boolFlagTable, "id", 3).Return(map[string]interface{}{"id": int64(3), "is_deleted": true}, nil)
+			},
+		},
+		{
+			name: "get deleted with flag",
+			call: func(s *Service) error {
+				_, _, err := s.GetById(context.Background(), "flag", 3, ReadOptions{WithDeleted: true})
+				return err
+			},
+			expectedErr: nil,
+			mockBehaviour: func(mr *repository.MockRecordManager) {
+				mr.EXPECT().GetById(flagTable, "id", 3).Return(map[string]interface{}{"id": int64(3), "is_deleted": int64(1)}, nil)
+			},
+		},
+	}
+
+	schema := dto.Schema{}
+	for name, table := range softDeleteSchema {
+		schema[name] = table
+	}
+	schema["example_table_1"] = testingSchema["example_table_1"]
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := gomock.NewController(t)
+			defer c.Finish()
+
+			mockRepo := repository.NewMockRecordManager(c)
+			recordManager := &RecordManager{
+				repo:   mockRepo,
+				dbe:    nil,
+				Schema: schema,
+			}
+
+			tc.mockBehaviour(mockRepo)
+			service := &Service{
+				RecordService: recordManager,
+			}
+
+			assert.Equal(t, tc.expectedErr, tc.call(service))
+		})
+	}
+}
@@ -0,0 +1,203 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"hw6coursera/dto"
+	"hw6coursera/repository"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Transform - преобразование значения колонки перед записью в базу
+type Transform string
+
+const (
+	TransformTrim      Transform = "trim"       // убрать пробелы по краям
+	TransformNormalize Transform = "normalize"  // убрать пробелы по краям и схлопнуть повторяющиеся внутри
+	TransformLowercase Transform = "lowercase"  // например, для email
+	TransformBcrypt    Transform = "bcrypt"     // хеш пароля, см. auth.basic_credentials_file
+	TransformArgon2    Transform = "argon2"     // argon2id в формате PHC: $argon2id$v=19$m=...,t=...,p=...$соль$хеш
+	TransformCreatedAt Transform = "created_at" // время создания записи
+	TransformUpdatedAt Transform = "updated_at" // время создания и каждого изменения записи
+)
+
+// параметры argon2id - рекомендованные RFC 9106 для ограниченной памяти
+const (
+	argon2Time    = 3
+	argon2Memory  = 64 * 1024
+	argon2Threads = 4
+	argon2SaltLen = 16
+	argon2KeyLen  = 32
+)
+
+// now - время для created_at и updated_at, в тестах подменяется
+var now = func() time.Time {
+	return time.Now().UTC()
+}
+
+// applyTransforms проверяет преобразования из настроек по схеме. Колонки с временем
+// ставит сервер, поэтому для клиента они становятся read-only
+func applyTransforms(s dto.Schema, transforms map[string]map[string][]Transform) (dto.Schema, error) {
+	for tableName, columns := range transforms {
+		t, ok := s[tableName]
+		if !ok {
+			return nil, fmt.Errorf("table %s from transforms not found in schema", tableName)
+		}
+		// колонки копируем: исходный срез может разделяться с другими копиями схемы
+		t.Columns = append([]dto.Column(nil), t.Columns...)
+		for columnName, list := range columns {
+			idx := -1
+			for i, c := range t.Columns {
+				if c.Name == columnName {
+					idx = i
+					break
+				}
+			}
+			if idx == -1 {
+				return nil, fmt.Errorf("column %s.%s from transforms not found", tableName, columnName)
+			}
+			c := t.Columns[idx]
+			if c.IsPrimaryKey || c.Name == t.SoftDeleteColumn {
+				return nil, fmt.Errorf("column %s.%s cannot be transformed", tableName, columnName)
+			}
+			// колонку версии сервер может только проставлять временем, иначе ETag не отразит изменение
+			if c.Name == t.VersionColumn && !isTimeTransforms(list) {
+				return nil, fmt.Errorf("version column %s.%s accepts only %s or %s", tableName, columnName, TransformCreatedAt, TransformUpdatedAt)
+			}
+
+			for _, tr := range list {
+				switch tr {
+				case TransformCreatedAt, TransformUpdatedAt:
+					if len(list) > 1 {
+						return nil, fmt.Errorf("%s cannot be combined with other transforms in %s.%s", tr, tableName, columnName)
+					}
+					if c.ColumnType == dto.FloatType || c.ColumnType == dto.BoolType {
+						return nil, fmt.Errorf("column %s.%s cannot hold %s", tableName, columnName, tr)
+					}
+					c.ReadOnly = true
+				case TransformTrim, TransformNormalize, TransformLowercase, TransformBcrypt, TransformArgon2:
+					if c.ColumnType == dto.IntType || c.ColumnType == dto.FloatType || c.ColumnType == dto.BoolType {
+						return nil, fmt.Errorf("transform %s requires string column %s.%s", tr, tableName, columnName)
+					}
+				default:
+					return nil, fmt.Errorf("unknown transform %q for %s.%s", tr, tableName, columnName)
+				}
+			}
+			t.Columns[idx] = c
+		}
+		s[tableName] = t
+	}
+	return s, nil
+}
+
+// transformData применяет преобразования к уже проверенным данным, created - данные новой записи
+func transformData(t dto.Table, transforms map[string][]Transform, unit map[string]interface{}, created bool) error {
+	if len(transforms) == 0 {
+		return nil
+	}
+	ts := now()
+	for _, c := range t.Columns {
+		for _, tr := range transforms[c.Name] {
+			switch tr {
+			case TransformCreatedAt:
+				if created {
+					unit[c.Name] = timestampValue(c, ts)
+				}
+			case TransformUpdatedAt:
+				unit[c.Name] = timestampValue(c, ts)
+			default:
+				value, ok := unit[c.Name].(string)
+				if !ok { // колонку не меняют или ставят null
+					continue
+				}
+				transformed, err := transformString(tr, value)
+				if err == bcrypt.ErrPasswordTooLong {
+					return ErrTooLong{c.Name}
+				} else if err != nil {
+					return err
+				}
+				unit[c.Name] = transformed
+			}
+		}
+	}
+	return nil
+}
+
+func transformString(tr Transform, value string) (string, error) {
+	switch tr {
+	case TransformTrim:
+		return strings.TrimSpace(value), nil
+	case TransformNormalize:
+		return strings.Join(strings.Fields(value), " "), nil
+	case TransformLowercase:
+		return strings.ToLower(value), nil
+	case TransformBcrypt:
+		hash, err := bcrypt.GenerateFromPassword([]byte(value), bcrypt.DefaultCost)
+		return string(hash), err
+	case TransformArgon2:
+		return argon2Hash(value)
+	}
+	return "", fmt.Errorf("unknown transform %q", tr)
+}
+
+func argon2Hash(value string) (string, error) {
+	salt := make([]byte, argon2SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("unable to generate salt: %v", err)
+	}
+	key := argon2.IDKey([]byte(value), salt, argon2Time, argon2Memory, argon2Threads, argon2KeyLen)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, argon2Memory, argon2Time, argon2Threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// время в целочисленной колонке - unix-время в секундах
+func timestampValue(c dto.Column, ts time.Time) interface{} {
+	if c.ColumnType == dto.IntType {
+		return ts.Unix()
+	}
+	return ts.Format(softDeleteTimeLayout)
+}
+
+// keepCreatedAt не даёт upsert перезаписать время создания существующей записи
+func keepCreatedAt(t dto.Table, key dto.Index, unit map[string]interface{}, transforms map[string][]Transform, upsertFn func(repo repository.RecordManager) error) func(repo repository.RecordManager) error {
+	var createdAt []string
+	for column, list := range transforms {
+		for _, tr := range list {
+			if tr == TransformCreatedAt {
+				createdAt = append(createdAt, column)
+			}
+		}
+	}
+	if len(createdAt) == 0 {
+		return upsertFn
+	}
+
+	return func(repo repository.RecordManager) error {
+		return repo.InTx(func(tx repository.RecordManager) error {
+			existing, err := tx.GetAllRecords(t, byKey(key, unit), 1, 0)
+			if err != nil {
+				return err
+			}
+			if len(existing) > 0 {
+				for _, column := range createdAt {
+					delete(unit, column)
+				}
+			}
+			return upsertFn(tx)
+		})
+	}
+}
+
+func isTimeTransforms(list []Transform) bool {
+	for _, tr := range list {
+		if tr != TransformCreatedAt && tr != TransformUpdatedAt {
+			return false
+		}
+	}
+	return len(list) > 0
+}
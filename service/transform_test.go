@@ -0,0 +1,223 @@
+package service
+
+import (
+	"context"
+	"hw6coursera/dto"
+	"hw6coursera/repository"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func transformSchema() dto.Schema {
+	return dto.Schema{
+		"users": {
+			Name: "users",
+			Columns: []dto.Column{
+				{Name: "id", ColumnType: dto.IntType, IsPrimaryKey: true},
+				{Name: "email", ColumnType: dto.StringType},
+				{Name: "name", ColumnType: dto.StringType, Nullable: true},
+				{Name: "password", ColumnType: dto.StringType},
+				{Name: "created_at", ColumnType: dto.StringType},
+				{Name: "updated_at", ColumnType: dto.IntType},
+			},
+			Indexes: []dto.Index{{Name: "email", Columns: []string{"email"}, Unique: true}},
+		},
+	}
+}
+
+var testTransforms = map[string]map[string][]Transform{
+	"users": {
+		"email":      {TransformTrim, TransformLowercase},
+		"name":       {TransformNormalize},
+		"password":   {TransformBcrypt},
+		"created_at": {TransformCreatedAt},
+		"updated_at": {TransformUpdatedAt},
+	},
+}
+
+func fixedNow(t *testing.T) time.Time {
+	ts := time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC)
+	orig := now
+	now = func() time.Time { return ts }
+	t.Cleanup(func() { now = orig })
+	return ts
+}
+
+func Test_applyTransforms(t *testing.T) {
+	orig := transformSchema()
+	columns := orig["users"].Columns
+	s, err := applyTransforms(orig, testTransforms)
+	require.NoError(t, err)
+	for _, c := range columns {
+		assert.False(t, c.ReadOnly, c.Name) // срез колонок исходной схемы не меняется
+	}
+
+	users := s["users"]
+	for _, c := range users.Columns {
+		assert.Equal(t, c.Name == "created_at" || c.Name == "updated_at", c.ReadOnly, c.Name)
+	}
+
+	// колонку версии может проставлять сервер
+	versioned := transformSchema()
+	table := versioned["users"]
+	table.VersionColumn = "updated_at"
+	versioned["users"] = table
+	s, err = applyTransforms(versioned, testTransforms)
+	require.NoError(t, err)
+	assert.Equal(t, "updated_at", s["users"].VersionColumn)
+
+	versioned = transformSchema()
+	table = versioned["users"]
+	table.VersionColumn = "name"
+	versioned["users"] = table
+	_, err = applyTransforms(versioned, testTransforms)
+	assert.Error(t, err) // остальные преобразования колонку версии не меняют
+
+	testCases := map[string]map[string]map[string][]Transform{
+		"unknown table":      {"missing": {"email": {TransformTrim}}},
+		"unknown column":     {"users": {"login": {TransformTrim}}},
+		"primary key":        {"users": {"id": {TransformTrim}}},
+		"unknown transform":  {"users": {"email": {"uppercase"}}},
+		"string on int":      {"users": {"updated_at": {TransformLowercase}}},
+		"combined timestamp": {"users": {"created_at": {TransformTrim, TransformCreatedAt}}},
+	}
+	for name, transforms := range testCases {
+		t.Run(name, func(t *testing.T) {
+			_, err := applyTransforms(transformSchema(), transforms)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func Test_transformString(t *testing.T) {
+	testCases := []struct {
+		tr       Transform
+		value    string
+		expected string
+	}{
+		{tr: TransformTrim, value: "  a b  ", expected: "a b"},
+		{tr: TransformNormalize, value: " John \t  Smith\n", expected: "John Smith"},
+		{tr: TransformLowercase, value: "John@Example.COM", expected: "john@example.com"},
+	}
+	for _, tc := range testCases {
+		value, err := transformString(tc.tr, tc.value)
+		require.NoError(t, err)
+		assert.Equal(t, tc.expected, value)
+	}
+
+	hash, err := transformString(TransformBcrypt, "secret")
+	require.NoError(t, err)
+	assert.NoError(t, bcrypt.CompareHashAndPassword([]byte(hash), []byte("secret")))
+
+	first, err := transformString(TransformArgon2, "secret")
+	require.NoError(t, err)
+	second, err := transformString(TransformArgon2, "secret")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(first, "$argon2id$v=19$m=65536,t=3,p=4$"), first)
+	assert.NotEqual(t, first, second, "salt must be random")
+
+	_, err = transformString(TransformBcrypt, strings.Repeat("a", 73))
+	assert.Equal(t, bcrypt.ErrPasswordTooLong, err)
+}
+
+func TestService_transforms(t *testing.T) {
+	ts := fixedNow(t)
+	schema, err := applyTransforms(transformSchema(), testTransforms)
+	require.NoError(t, err)
+	users := schema["users"]
+
+	checkPassword := func(t *testing.T, unit map[string]interface{}) {
+		hash, _ := unit["password"].(string)
+		assert.NoError(t, bcrypt.CompareHashAndPassword([]byte(hash), []byte("secret")))
+		delete(unit, "password")
+	}
+
+	testCases := []struct {
+		name          string
+		mockBehaviour func(t *testing.T, mr *repository.MockRecordManager)
+		call          func(r *RecordManager) error
+		expectedErr   error
+	}{
+		{
+			name: "create",
+			mockBehaviour: func(t *testing.T, mr *repository.MockRecordManager) {
+				mr.EXPECT().Create(users, gomock.Any()).DoAndReturn(func(_ dto.Table, unit map[string]interface{}) (int, error) {
+					checkPassword(t, unit)
+					assert.Equal(t, map[string]interface{}{
+						"email":      "john@example.com",
+						"name":       "John Smith",
+						"created_at": "2024-03-01 12:30:00",
+						"updated_at": ts.Unix(),
+					}, unit)
+					return 1, nil
+				})
+			},
+			call: func(r *RecordManager) error {
+				_, err := r.Create(context.Background(), "users", map[string]string{"email": " John@Example.COM ", "name": "John  Smith", "password": "secret"})
+				return err
+			},
+		},
+		{
+			name:          "create with server-set column",
+			mockBehaviour: func(t *testing.T, mr *repository.MockRecordManager) {},
+			call: func(r *RecordManager) error {
+				_, err := r.Create(context.Background(), "users", map[string]string{"email": "a@b.c", "password": "secret", "created_at": "2000-01-01 00:00:00"})
+				return err
+			},
+			expectedErr: ErrReadOnlyColumn{"created_at"},
+		},
+		{
+			name: "update keeps created_at",
+			mockBehaviour: func(t *testing.T, mr *repository.MockRecordManager) {
+				mr.EXPECT().UpdateById(users, "id", 1, map[string]interface{}{"name": nil, "updated_at": ts.Unix()}).Return(nil)
+			},
+			call: func(r *RecordManager) error {
+				return r.UpdateById(context.Background(), "users", 1, map[string]string{"name": encodedNull}, "")
+			},
+		},
+		{
+			name:          "password too long",
+			mockBehaviour: func(t *testing.T, mr *repository.MockRecordManager) {},
+			call: func(r *RecordManager) error {
+				return r.UpdateById(context.Background(), "users", 1, map[string]string{"password": strings.Repeat("a", 73)}, "")
+			},
+			expectedErr: ErrTooLong{"password"},
+		},
+		{
+			name: "upsert of existing record",
+			mockBehaviour: func(t *testing.T, mr *repository.MockRecordManager) {
+				key := dto.Filter{{Column: "email", Operator: dto.OpEq, Value: "john@example.com"}}
+				mr.EXPECT().InTx(gomock.Any()).DoAndReturn(func(fn func(tx repository.RecordManager) error) error { return fn(mr) })
+				mr.EXPECT().GetAllRecords(users, key, 1, 0).Return([]map[string]interface{}{{"id": int64(1)}}, nil)
+				mr.EXPECT().Upsert(users, "id", []string{"email"}, gomock.Any()).DoAndReturn(func(_ dto.Table, _ string, _ []string, unit map[string]interface{}) (int, bool, error) {
+					checkPassword(t, unit)
+					assert.Equal(t, map[string]interface{}{"email": "john@example.com", "name": nil, "updated_at": ts.Unix()}, unit)
+					return 1, false, nil
+				})
+			},
+			call: func(r *RecordManager) error {
+				_, _, err := r.Upsert(context.Background(), "users", "email", map[string]string{"email": "John@example.com", "name": encodedNull, "password": "secret"})
+				return err
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := gomock.NewController(t)
+			defer c.Finish()
+
+			mockRepo := repository.NewMockRecordManager(c)
+			tc.mockBehaviour(t, mockRepo)
+			r := &RecordManager{repo: mockRepo, Schema: schema, opts: Options{Transforms: testTransforms}}
+
+			assert.Equal(t, tc.expectedErr, tc.call(r))
+		})
+	}
+}